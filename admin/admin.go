@@ -0,0 +1,191 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admin carries out the operator commands on customers, writing
+// every action to an audit trail.
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aheadaviation/Users/audit"
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/transfer"
+	"github.com/aheadaviation/Users/users"
+)
+
+// Actions written to the audit trail.
+const (
+	ActionGet           = "get"
+	ActionDisable       = "disable"
+	ActionRestore       = "restore"
+	ActionResetPassword = "reset-password"
+	ActionDelete        = "delete"
+)
+
+var (
+	ErrNoCustomer    = "No customer with ID or username %q"
+	ErrEmptyPassword = errors.New("Password must not be empty")
+	ErrNoActor       = errors.New("Actor must be set for the audit trail")
+	ErrErased        = errors.New("Customer has been erased")
+)
+
+// AuditError is an action that could not be written to the audit trail.
+// Done tells whether it was carried out all the same: an action whose start
+// cannot be recorded is not.
+type AuditError struct {
+	Action string
+	Done   bool
+	Err    error
+}
+
+func (e AuditError) Error() string {
+	if !e.Done {
+		return fmt.Sprintf("%v not done as it could not be audited: %v", e.Action, e.Err)
+	}
+	return fmt.Sprintf("%v done but not audited: %v", e.Action, e.Err)
+}
+
+// Admin acts on customers named by ID or username as Actor, giving Reason
+// in the audit trail.
+type Admin struct {
+	Database db.Database
+	Trail    audit.Trail
+	Actor    string
+	Reason   string
+}
+
+// Record is what get shows of a customer: everything stored except the
+// password hash, with card numbers masked and CCVs left out.
+type Record struct {
+	transfer.Record
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+	ErasedAt   *time.Time `json:"erasedAt,omitempty"`
+}
+
+func (a Admin) Get(ctx context.Context, ref string) (Record, error) {
+	var r Record
+	u, err := a.do(ctx, ActionGet, ref, func(u *users.User) error {
+		return a.Database.GetUserAttributes(ctx, u)
+	})
+	if err != nil {
+		return r, err
+	}
+	r.Record = transfer.FromUser(u)
+	r.PasswordHash = ""
+	for k, c := range r.Cards {
+		uc := users.Card{LongNum: c.LongNum}
+		uc.MaskCC()
+		r.Cards[k].LongNum, r.Cards[k].CCV = uc.LongNum, ""
+	}
+	r.DisabledAt, r.ErasedAt = u.DisabledAt, u.ErasedAt
+	return r, nil
+}
+
+// Disable stops the customer logging in until the account is restored.
+func (a Admin) Disable(ctx context.Context, ref string) (users.User, error) {
+	return a.do(ctx, ActionDisable, ref, func(u *users.User) error {
+		return a.Database.SetDisabled(ctx, u.UserID, true)
+	})
+}
+
+// Restore lets a disabled customer log in again.
+func (a Admin) Restore(ctx context.Context, ref string) (users.User, error) {
+	return a.do(ctx, ActionRestore, ref, func(u *users.User) error {
+		return a.Database.SetDisabled(ctx, u.UserID, false)
+	})
+}
+
+// ResetPassword replaces the customer's password, with a new salt. Erased
+// customers are refused, as a password would let them log in again.
+func (a Admin) ResetPassword(ctx context.Context, ref, password string) (users.User, error) {
+	return a.do(ctx, ActionResetPassword, ref, func(u *users.User) error {
+		if password == "" {
+			return ErrEmptyPassword
+		}
+		if u.ErasedAt != nil {
+			return ErrErased
+		}
+		u.NewSalt()
+		return a.Database.SetPassword(ctx, u.UserID, users.HashPassword(password, u.Salt), u.Salt)
+	})
+}
+
+// Delete removes the customer with its addresses and cards.
+func (a Admin) Delete(ctx context.Context, ref string) (users.User, error) {
+	return a.do(ctx, ActionDelete, ref, func(u *users.User) error {
+		return a.Database.DeleteUser(ctx, u.UserID)
+	})
+}
+
+// do finds the customer named by ref, audits that action is starting, runs f
+// on it and audits the outcome. Nothing is done without an actor to audit or
+// when the start cannot be recorded.
+func (a Admin) do(ctx context.Context, action, ref string, f func(*users.User) error) (users.User, error) {
+	if a.Actor == "" {
+		return users.User{}, ErrNoActor
+	}
+	e := audit.Entry{
+		Actor:    a.Actor,
+		Action:   action,
+		Tenant:   reqctx.Tenant(ctx),
+		Customer: ref,
+		Reason:   a.Reason,
+		Outcome:  audit.OutcomeStarted,
+	}
+	u, err := a.find(ctx, ref)
+	if err == nil {
+		e.Customer, e.Username = u.UserID, u.Username
+		if aerr := a.Trail.Record(e); aerr != nil {
+			return u, AuditError{Action: action, Err: aerr}
+		}
+		err = f(&u)
+	}
+	e.Outcome = audit.OutcomeOK
+	if err != nil {
+		e.Outcome, e.Error = audit.OutcomeFailed, err.Error()
+	}
+	if aerr := a.Trail.Record(e); aerr != nil {
+		if err == nil {
+			err = AuditError{Action: action, Done: true, Err: aerr}
+		}
+	}
+	return u, err
+}
+
+// find looks ref up as a username and then as an ID.
+func (a Admin) find(ctx context.Context, ref string) (users.User, error) {
+	u, err := a.Database.GetUserByName(ctx, ref)
+	if err != db.ErrNotFound {
+		return u, err
+	}
+	u, err = a.Database.GetUser(ctx, ref)
+	if err != nil {
+		return u, fmt.Errorf(ErrNoCustomer, ref)
+	}
+	return u, nil
+}
+
+// NewPassword returns a random password to hand to a customer.
+func NewPassword() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
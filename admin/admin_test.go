@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aheadaviation/Users/audit"
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/users"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const adaID = "5a0000000000000000000001"
+
+// fakeDatabase holds a single customer, ada.
+type fakeDatabase struct {
+	db.Database
+	user    users.User
+	deleted bool
+}
+
+func (d *fakeDatabase) GetUserByName(ctx context.Context, name string) (users.User, error) {
+	if d.deleted || name != d.user.Username {
+		return users.User{}, db.ErrNotFound
+	}
+	return d.user, nil
+}
+
+func (d *fakeDatabase) GetUser(ctx context.Context, id string) (users.User, error) {
+	if d.deleted || id != d.user.UserID {
+		return users.User{}, errors.New("Invalid id hex")
+	}
+	return d.user, nil
+}
+
+func (d *fakeDatabase) GetUserAttributes(ctx context.Context, u *users.User) error {
+	u.Cards = []users.Card{{ID: "c1", LongNum: "4111111111111111", CCV: "123", Expires: "04/30"}}
+	return nil
+}
+
+func (d *fakeDatabase) SetDisabled(ctx context.Context, userid string, disabled bool) error {
+	d.user.DisabledAt = nil
+	if disabled {
+		now := time.Now()
+		d.user.DisabledAt = &now
+	}
+	return nil
+}
+
+func (d *fakeDatabase) SetPassword(ctx context.Context, userid, password, salt string) error {
+	d.user.Password, d.user.Salt = password, salt
+	return nil
+}
+
+func (d *fakeDatabase) DeleteUser(ctx context.Context, id string) error {
+	d.deleted = true
+	return nil
+}
+
+type memTrail struct {
+	entries []audit.Entry
+	err     error
+}
+
+func (t *memTrail) Record(e audit.Entry) error {
+	t.entries = append(t.entries, e)
+	return t.err
+}
+
+func TestAdmin(t *testing.T) {
+	ctx := reqctx.WithTenant(context.Background(), "acme")
+
+	Convey("Given a customer", t, func() {
+		d := &fakeDatabase{user: users.User{UserID: adaID, Username: "ada", Password: "old", Salt: "salt"}}
+		trail := &memTrail{}
+		a := Admin{Database: d, Trail: trail, Actor: "support1", Reason: "ticket 42"}
+
+		Convey("When it is looked up by username", func() {
+			r, err := a.Get(ctx, "ada")
+			So(err, ShouldBeNil)
+
+			Convey("Then its record is shown without secrets", func() {
+				So(r.ID, ShouldEqual, adaID)
+				So(r.PasswordHash, ShouldBeEmpty)
+				So(r.Cards[0].LongNum, ShouldEqual, "************1111")
+				So(r.Cards[0].CCV, ShouldBeEmpty)
+			})
+
+			Convey("Then the lookup is audited before and after", func() {
+				So(trail.entries, ShouldHaveLength, 2)
+				So(trail.entries[0].Outcome, ShouldEqual, audit.OutcomeStarted)
+				e := trail.entries[1]
+				So(e.Action, ShouldEqual, ActionGet)
+				So(e.Actor, ShouldEqual, "support1")
+				So(e.Reason, ShouldEqual, "ticket 42")
+				So(e.Tenant, ShouldEqual, "acme")
+				So(e.Customer, ShouldEqual, adaID)
+				So(e.Username, ShouldEqual, "ada")
+				So(e.Outcome, ShouldEqual, audit.OutcomeOK)
+			})
+		})
+
+		Convey("When it is disabled and restored by ID", func() {
+			_, err := a.Disable(ctx, adaID)
+			So(err, ShouldBeNil)
+			So(d.user.DisabledAt, ShouldNotBeNil)
+			_, err = a.Restore(ctx, adaID)
+			So(err, ShouldBeNil)
+
+			Convey("Then both actions are audited", func() {
+				So(d.user.DisabledAt, ShouldBeNil)
+				So(trail.entries, ShouldHaveLength, 4)
+				So(trail.entries[1].Action, ShouldEqual, ActionDisable)
+				So(trail.entries[3].Action, ShouldEqual, ActionRestore)
+			})
+		})
+
+		Convey("When its password is reset", func() {
+			_, err := a.ResetPassword(ctx, "ada", "n3w")
+			So(err, ShouldBeNil)
+
+			Convey("Then the new password is stored hashed with a new salt", func() {
+				So(d.user.Salt, ShouldNotEqual, "salt")
+				So(d.user.Password, ShouldEqual, users.HashPassword("n3w", d.user.Salt))
+			})
+
+			Convey("Then an empty password is refused and audited as failed", func() {
+				_, err := a.ResetPassword(ctx, "ada", "")
+				So(err, ShouldEqual, ErrEmptyPassword)
+				So(trail.entries[3].Outcome, ShouldEqual, audit.OutcomeFailed)
+				So(trail.entries[3].Error, ShouldEqual, ErrEmptyPassword.Error())
+			})
+		})
+
+		Convey("When the password of an erased customer is reset", func() {
+			now := time.Now()
+			d.user.ErasedAt = &now
+			_, err := a.ResetPassword(ctx, "ada", "n3w")
+
+			Convey("Then it is refused", func() {
+				So(err, ShouldEqual, ErrErased)
+				So(d.user.Password, ShouldEqual, "old")
+				So(trail.entries[1].Outcome, ShouldEqual, audit.OutcomeFailed)
+			})
+		})
+
+		Convey("When it is deleted", func() {
+			_, err := a.Delete(ctx, "ada")
+			So(err, ShouldBeNil)
+
+			Convey("Then it can no longer be found", func() {
+				So(d.deleted, ShouldBeTrue)
+				_, err := a.Get(ctx, "ada")
+				So(err.Error(), ShouldEqual, `No customer with ID or username "ada"`)
+				So(trail.entries, ShouldHaveLength, 3)
+				So(trail.entries[2].Customer, ShouldEqual, "ada")
+				So(trail.entries[2].Outcome, ShouldEqual, audit.OutcomeFailed)
+			})
+		})
+
+		Convey("When the audit trail cannot be written", func() {
+			trail.err = errors.New("disk full")
+			_, err := a.Disable(ctx, "ada")
+
+			Convey("Then the action is not done and reports it", func() {
+				So(err, ShouldHaveSameTypeAs, AuditError{})
+				So(err.Error(), ShouldContainSubstring, "disk full")
+				So(d.user.DisabledAt, ShouldBeNil)
+				So(trail.entries, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When no actor is given", func() {
+			a.Actor = ""
+			_, err := a.Delete(ctx, "ada")
+
+			Convey("Then nothing is done", func() {
+				So(err, ShouldEqual, ErrNoActor)
+				So(d.deleted, ShouldBeFalse)
+				So(trail.entries, ShouldBeEmpty)
+			})
+		})
+	})
+}
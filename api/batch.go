@@ -0,0 +1,66 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/aheadaviation/Users/users"
+)
+
+// maxBatchSize is the most items a batch call may carry.
+var maxBatchSize = 100
+
+// SetMaxBatchSize sets the most items a batch call may carry.
+func SetMaxBatchSize(n int) {
+	maxBatchSize = n
+}
+
+// checkBatch fails unless a batch of n items, read from field, is within
+// the limit.
+func checkBatch(field string, n int) error {
+	if n < 1 || n > maxBatchSize {
+		return users.FieldErrors{field: fmt.Sprintf("must have between 1 and %d items", maxBatchSize)}
+	}
+	return nil
+}
+
+// batchResult is the outcome of one item of a batch call, in the order the
+// items were sent.
+type batchResult struct {
+	Status int               `json:"status"`
+	ID     string            `json:"id,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Fields users.FieldErrors `json:"fields,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// batchResults reports each item as ok, with its ID, or with the status
+// its error would have answered on its own.
+func batchResults(ids []string, errs []error, ok int) batchResponse {
+	rs := make([]batchResult, len(errs))
+	for k, err := range errs {
+		if err == nil {
+			rs[k] = batchResult{Status: ok, ID: ids[k]}
+			continue
+		}
+		status, fields := statusOf(err)
+		rs[k] = batchResult{Status: status, ID: ids[k], Error: err.Error(), Fields: fields}
+	}
+	return batchResponse{Results: rs}
+}
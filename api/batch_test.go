@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/users"
+)
+
+// batchDatabase creates addresses for every customer but "missing" and
+// deletes every customer but "missing", recording the calls made.
+type batchDatabase struct {
+	db.Database
+	calls   int
+	created []users.Address
+	deleted []string
+}
+
+func (d *batchDatabase) CreateAddresses(ctx context.Context, as []users.Address, userids []string) ([]error, error) {
+	d.calls++
+	errs := make([]error, len(as))
+	for k := range as {
+		if userids[k] == "missing" {
+			errs[k] = db.ErrNotFound
+			continue
+		}
+		as[k].ID = fmt.Sprintf("a%d", k)
+		d.created = append(d.created, as[k])
+	}
+	return errs, nil
+}
+
+func (d *batchDatabase) DeleteUsers(ctx context.Context, ids []string) ([]error, error) {
+	d.calls++
+	errs := make([]error, len(ids))
+	for k, id := range ids {
+		if id == "missing" {
+			errs[k] = db.ErrNotFound
+			continue
+		}
+		d.deleted = append(d.deleted, id)
+	}
+	return errs, nil
+}
+
+func TestBatch(t *testing.T) {
+
+	Convey("Given the API over a database taking batches", t, func() {
+		d := &batchDatabase{}
+		db.DefaultDb = d
+		defer SetMaxBatchSize(maxBatchSize)
+		SetMaxBatchSize(3)
+		r := MakeHTTPHandler(MakeEndpoints(NewFixedService()), log.NewNopLogger())
+		serve := func(path, body string, caller ...string) (*httptest.ResponseRecorder, []batchResult) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", path, strings.NewReader(body))
+			if len(caller) > 0 {
+				req.Header.Set(reqctx.CallerIDHeader, caller[0])
+				req.Header.Set(reqctx.CallerRolesHeader, strings.Join(caller[1:], ","))
+			}
+			r.ServeHTTP(w, req)
+			var resp struct {
+				Results []batchResult `json:"results"`
+				Data    []batchResult `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Data != nil {
+				return w, resp.Data
+			}
+			return w, resp.Results
+		}
+
+		Convey("When addresses are created for existing and missing customers", func() {
+			w, rs := serve("/addresses:batch", `{"items":[
+				{"street":"Rue de Rivoli","city":"Paris","country":"France","postcode":"75001","userID":"u1"},
+				{"street":"","city":"Paris","country":"France","userID":"u1"},
+				{"street":"Unter den Linden","city":"Berlin","country":"DE","postcode":"10117","userID":"missing"}
+			]}`)
+
+			Convey("Then each item has its own status", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(rs, ShouldHaveLength, 3)
+				So(rs[0].Status, ShouldEqual, http.StatusCreated)
+				So(rs[0].ID, ShouldEqual, "a0")
+				So(rs[1].Status, ShouldEqual, http.StatusBadRequest)
+				So(rs[1].Fields, ShouldContainKey, "street")
+				So(rs[2].Status, ShouldEqual, http.StatusNotFound)
+				So(rs[2].ID, ShouldBeEmpty)
+			})
+
+			Convey("Then only the valid addresses reach the database, normalized and at once", func() {
+				So(d.calls, ShouldEqual, 1)
+				So(d.created, ShouldHaveLength, 1)
+				So(d.created[0].Country, ShouldEqual, "FR")
+			})
+		})
+
+		Convey("When an admin deletes customers through version 2", func() {
+			w, rs := serve("/api/v2/customers:batchDelete", `{"ids":["u1","missing"]}`, "root", "admin")
+
+			Convey("Then the results are the data of the response", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(rs, ShouldHaveLength, 2)
+				So(rs[0], ShouldResemble, batchResult{Status: http.StatusNoContent, ID: "u1"})
+				So(rs[1].Status, ShouldEqual, http.StatusNotFound)
+				So(rs[1].ID, ShouldEqual, "missing")
+				So(d.deleted, ShouldResemble, []string{"u1"})
+			})
+		})
+
+		Convey("When a customer deletes itself and another", func() {
+			_, rs := serve("/customers:batchDelete", `{"ids":["u1","u2"]}`, "u1")
+
+			Convey("Then only itself is deleted", func() {
+				So(rs[0].Status, ShouldEqual, http.StatusNoContent)
+				So(rs[1].Status, ShouldEqual, http.StatusForbidden)
+				So(d.deleted, ShouldResemble, []string{"u1"})
+			})
+		})
+
+		Convey("When customers are deleted by an unknown caller", func() {
+			w, _ := serve("/customers:batchDelete", `{"ids":["u1"]}`)
+
+			Convey("Then the batch is refused", func() {
+				So(w.Code, ShouldEqual, http.StatusUnauthorized)
+				So(d.calls, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a batch is empty or too big", func() {
+			empty, _ := serve("/customers:batchDelete", `{"ids":[]}`)
+			big, _ := serve("/customers:batchDelete", `{"ids":["1","2","3","4"]}`)
+
+			Convey("Then it is refused whole", func() {
+				So(empty.Code, ShouldEqual, http.StatusBadRequest)
+				So(big.Code, ShouldEqual, http.StatusBadRequest)
+				So(big.Body.String(), ShouldContainSubstring, "between 1 and 3 items")
+				So(d.calls, ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -16,81 +16,115 @@ package api
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
-	"github.com/go-kit/kit/tracing/opentracing"
-	stdopentracing "github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/tracing"
 	"github.com/aheadaviation/Users/users"
 )
 
 type Endpoints struct {
-	LoginEndpoint       endpoint.Endpoint
-	RegisterEndpoint    endpoint.Endpoint
-	UserGetEndpoint     endpoint.Endpoint
-	UserPostEndpoint    endpoint.Endpoint
-	AddressGetEndpoint  endpoint.Endpoint
-	AddressPostEndpoint endpoint.Endpoint
-	CardGetEndpoint     endpoint.Endpoint
-	CardPostEndpoint    endpoint.Endpoint
-	DeleteEndpoint      endpoint.Endpoint
-	HealthEndpoint      endpoint.Endpoint
-}
-
-func MakeEndpoints(s Service, tracer stdopentracing.Tracer) Endpoints {
+	LoginEndpoint              endpoint.Endpoint
+	RegisterEndpoint           endpoint.Endpoint
+	UserGetEndpoint            endpoint.Endpoint
+	UserSearchEndpoint         endpoint.Endpoint
+	UserPostEndpoint           endpoint.Endpoint
+	AddressGetEndpoint         endpoint.Endpoint
+	AddressPostEndpoint        endpoint.Endpoint
+	CardGetEndpoint            endpoint.Endpoint
+	CardPostEndpoint           endpoint.Endpoint
+	UserDeleteEndpoint         endpoint.Endpoint
+	AddressDeleteEndpoint      endpoint.Endpoint
+	CardDeleteEndpoint         endpoint.Endpoint
+	AddressesPostEndpoint      endpoint.Endpoint
+	CardsPostEndpoint          endpoint.Endpoint
+	UsersDeleteEndpoint        endpoint.Endpoint
+	ErasureEndpoint            endpoint.Endpoint
+	ErasureGetEndpoint         endpoint.Endpoint
+	DefaultAddressEndpoint     endpoint.Endpoint
+	CardBillingAddressEndpoint endpoint.Endpoint
+	TenantPostEndpoint         endpoint.Endpoint
+	TenantGetEndpoint          endpoint.Endpoint
+	HealthEndpoint             endpoint.Endpoint
+}
+
+func MakeEndpoints(s Service) Endpoints {
 	return Endpoints{
-		LoginEndpoint:       opentracing.TraceServer(tracer, "GET /login")(MakeLoginEndpoint(s)),
-		RegisterEndpoint:    opentracing.TraceServer(tracer, "POST /register")(MakeRegisterEndpoint(s)),
-		HealthEndpoint:      opentracing.TraceServer(tracer, "GET /health")(MakeHealthEndpoint(s)),
-		UserGetEndpoint:     opentracing.TraceServer(tracer, "GET /customers")(MakeUserGetEndpoint(s)),
-		UserPostEndpoint:    opentracing.TraceServer(tracer, "POST /customers")(MakeUserPostEndpoint(s)),
-		AddressGetEndpoint:  opentracing.TraceServer(tracer, "GET /addresses")(MakeAddressGetEndpoint(s)),
-		AddressPostEndpoint: opentracing.TraceServer(tracer, "POST /addresses")(MakeAddressPostEndpoint(s)),
-		CardGetEndpoint:     opentracing.TraceServer(tracer, "GET /cards")(MakeCardGetEndpoint(s)),
-		CardPostEndpoint:    opentracing.TraceServer(tracer, "POST /cards")(MakeCardPostEndpoint(s)),
-		DeleteEndpoint:      opentracing.TraceServer(tracer, "DELETE /")(MakeDeleteEndpoint(s)),
+		LoginEndpoint:              tracing.TraceServer("GET /login")(MakeLoginEndpoint(s)),
+		RegisterEndpoint:           tracing.TraceServer("POST /register")(MakeRegisterEndpoint(s)),
+		HealthEndpoint:             tracing.TraceServer("GET /health")(MakeHealthEndpoint(s)),
+		UserGetEndpoint:            tracing.TraceServer("GET /customers")(MakeUserGetEndpoint(s)),
+		UserSearchEndpoint:         tracing.TraceServer("GET /customers/search")(MakeUserSearchEndpoint(s)),
+		UserPostEndpoint:           tracing.TraceServer("POST /customers")(MakeUserPostEndpoint(s)),
+		AddressGetEndpoint:         tracing.TraceServer("GET /addresses")(MakeAddressGetEndpoint(s)),
+		AddressPostEndpoint:        tracing.TraceServer("POST /addresses")(MakeAddressPostEndpoint(s)),
+		CardGetEndpoint:            tracing.TraceServer("GET /cards")(MakeCardGetEndpoint(s)),
+		CardPostEndpoint:           tracing.TraceServer("POST /cards")(MakeCardPostEndpoint(s)),
+		UserDeleteEndpoint:         tracing.TraceServer("DELETE /customers")(MakeUserDeleteEndpoint(s)),
+		AddressDeleteEndpoint:      tracing.TraceServer("DELETE /addresses")(MakeAddressDeleteEndpoint(s)),
+		CardDeleteEndpoint:         tracing.TraceServer("DELETE /cards")(MakeCardDeleteEndpoint(s)),
+		AddressesPostEndpoint:      tracing.TraceServer("POST /addresses:batch")(MakeAddressesPostEndpoint(s)),
+		CardsPostEndpoint:          tracing.TraceServer("POST /cards:batch")(MakeCardsPostEndpoint(s)),
+		UsersDeleteEndpoint:        tracing.TraceServer("POST /customers:batchDelete")(MakeUsersDeleteEndpoint(s)),
+		ErasureEndpoint:            tracing.TraceServer("POST /customers/erasure")(MakeErasureEndpoint(s)),
+		ErasureGetEndpoint:         tracing.TraceServer("GET /customers/erasure")(MakeErasureGetEndpoint(s)),
+		DefaultAddressEndpoint:     tracing.TraceServer("PUT /customers/defaults")(MakeDefaultAddressEndpoint(s)),
+		CardBillingAddressEndpoint: tracing.TraceServer("PUT /cards/billing-address")(MakeCardBillingAddressEndpoint(s)),
+		TenantPostEndpoint:         tracing.TraceServer("POST /tenants")(MakeTenantPostEndpoint(s)),
+		TenantGetEndpoint:          tracing.TraceServer("GET /tenants")(MakeTenantGetEndpoint(s)),
 	}
 }
 
 func MakeLoginEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "login user")
-		span.SetTag("service", "user")
-		defer span.Finish()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "login user")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
 		req := request.(loginRequest)
-		u, err := s.Login(req.Username, req.Password)
+		u, err := s.Login(ctx, req.Username, req.Password)
 		return userResponse{User: u}, err
 	}
 }
 
 func MakeRegisterEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "register user")
-		span.SetTag("service", "user")
-		defer span.Finish()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "register user")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
 		req := request.(registerRequest)
-		id, err := s.Register(req.Username, req.Password, req.Email, req.FirstName, req.LastName)
+		id, err := s.Register(ctx, req.Username, req.Password, req.Email, req.FirstName, req.LastName)
 		return postResponse{ID: id}, err
 	}
 }
 
 func MakeUserGetEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "get users")
-		span.SetTag("service", "user")
-		defer span.Finish()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "get users")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
 
 		req := request.(GetRequest)
 
-		userspan := stdopentracing.StartSpan("users from db", stdopentracing.ChildOf(span.Context()))
-		usrs, err := s.GetUsers(req.ID)
-		userspan.Finish()
+		userctx, userspan := tracing.Tracer().Start(ctx, "users from db")
+		usrs, err := s.GetUsers(userctx, req.ID)
+		userspan.End()
 		if req.ID == "" {
-			return EmbedStruct{usersResponse{Users: usrs}}, err
+			if len(req.Embed) > 0 && err == nil {
+				attrctx, attrspan := tracing.Tracer().Start(ctx, "attributes from db")
+				err = db.GetUsersAttributes(attrctx, usrs)
+				attrspan.End()
+				for k := range usrs {
+					usrs[k].Embed(req.Embed)
+				}
+			}
+			return sparse(req.Fields, EmbedStruct{usersResponse{Users: usrs}}), err
 		}
 		if len(usrs) == 0 {
 			if req.Attr == "addresses" {
@@ -103,121 +137,298 @@ func MakeUserGetEndpoint(s Service) endpoint.Endpoint {
 		}
 		user := usrs[0]
 
-		attrspan := stdopentracing.StartSpan("attributes from db", stdopentracing.ChildOf(span.Context()))
-		db.GetUserAttributes(&user)
-		attrspan.Finish()
+		attrctx, attrspan := tracing.Tracer().Start(ctx, "attributes from db")
+		db.GetUserAttributes(attrctx, &user)
+		attrspan.End()
 		if req.Attr == "addresses" {
-			return EmbedStruct{addressesResponse{Addresses: user.Addresses}}, err
+			return sparse(req.Fields, EmbedStruct{addressesResponse{Addresses: user.Addresses}}), err
 		}
 		if req.Attr == "cards" {
-			return EmbedStruct{cardsResponse{Cards: user.Cards}}, err
+			return sparse(req.Fields, EmbedStruct{cardsResponse{Cards: user.Cards}}), err
 		}
-		return user, err
+		user.Embed(req.Embed)
+		return sparse(req.Fields, user), err
+	}
+}
+
+func MakeUserSearchEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "search users")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+
+		req := request.(searchRequest)
+		us, total, err := s.SearchUsers(ctx, req.Query, (req.Page-1)*req.Size, req.Size)
+		if err != nil {
+			return nil, err
+		}
+		return searchResponse{
+			Embed: usersResponse{Users: us},
+			Page: pageResponse{
+				Size:          req.Size,
+				Number:        req.Page,
+				TotalElements: total,
+				TotalPages:    (total + req.Size - 1) / req.Size,
+			},
+		}, nil
 	}
 }
 
 func MakeUserPostEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "post user")
-		span.SetTag("service", "user")
-		defer span.Finish()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "post user")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
 
 		req := request.(users.User)
-		id, err := s.PostUser(req)
+		id, err := s.PostUser(ctx, req)
 		return postResponse{ID: id}, err
 	}
 }
 
 func MakeAddressGetEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "get addresses")
-		span.SetTag("service", "user")
-		defer span.Finish()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "get addresses")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
 
 		req := request.(GetRequest)
-		addrspan := stdopentracing.StartSpan("addresses from db", stdopentracing.ChildOf(span.Context()))
-		adds, err := s.GetAddresses(req.ID)
-		addrspan.Finish()
+		addrctx, addrspan := tracing.Tracer().Start(ctx, "addresses from db")
+		adds, err := s.GetAddresses(addrctx, req.ID)
+		addrspan.End()
 
 		if req.ID == "" {
-			return EmbedStruct{addressesResponse{Addresses: adds}}, err
+			return sparse(req.Fields, EmbedStruct{addressesResponse{Addresses: adds}}), err
 		}
 		if len(adds) == 0 {
 			return users.Address{}, err
 		}
-		return adds[0], err
+		return sparse(req.Fields, adds[0]), err
 	}
 }
 
 func MakeAddressPostEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "post address")
-		span.SetTag("service", "user")
-		defer span.Finish()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "post address")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
 		req := request.(addressPostRequest)
-		id, err := s.PostAddress(req.Address, req.UserID)
+		id, err := s.PostAddress(ctx, req.Address, req.UserID)
 		return postResponse{ID: id}, err
 	}
 }
 
 func MakeCardGetEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "get cards")
-		span.SetTag("service", "user")
-		defer span.Finish()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "get cards")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
 
 		req := request.(GetRequest)
-		cardspan := stdopentracing.StartSpan("cards from db", stdopentracing.ChildOf(span.Context()))
-		cards, err := s.GetCards(req.ID)
-		cardspan.Finish()
+		cardctx, cardspan := tracing.Tracer().Start(ctx, "cards from db")
+		cards, err := s.GetCards(cardctx, req.ID)
+		cardspan.End()
 		if req.ID == "" {
-			return EmbedStruct{cardsResponse{Cards: cards}}, err
+			return sparse(req.Fields, EmbedStruct{cardsResponse{Cards: cards}}), err
 		}
 		if len(cards) == 0 {
 			return users.Card{}, err
 		}
-		return cards[0], err
+		return sparse(req.Fields, cards[0]), err
 	}
 }
 
 func MakeCardPostEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "post card")
-		span.SetTag("service", "user")
-		defer span.Finish()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "post card")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
 		req := request.(cardPostRequest)
-		id, err := s.PostCard(req.Card, req.UserID)
+		id, err := s.PostCard(ctx, req.Card, req.UserID)
 		return postResponse{ID: id}, err
 	}
 }
 
-func MakeDeleteEndpoint(s Service) endpoint.Endpoint {
+func MakeUserDeleteEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "delete entity")
-		span.SetTag("service", "user")
-		defer span.Finish()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "delete customer")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
 		req := request.(deleteRequest)
-		err = s.Delete(req.Entity, req.ID)
-		if err == nil {
-			return statusResponse{Status: true}, err
+		err = s.DeleteUser(ctx, req.ID)
+		return statusResponse{Status: err == nil}, err
+	}
+}
+
+func MakeAddressDeleteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "delete address")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(deleteRequest)
+		err = s.DeleteAddress(ctx, req.ID)
+		return statusResponse{Status: err == nil}, err
+	}
+}
+
+func MakeCardDeleteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "delete card")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(deleteRequest)
+		err = s.DeleteCard(ctx, req.ID)
+		return statusResponse{Status: err == nil}, err
+	}
+}
+
+func MakeAddressesPostEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "post addresses")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(addressesPostRequest)
+		as := make([]users.Address, len(req.Items))
+		userids := make([]string, len(req.Items))
+		for k, item := range req.Items {
+			as[k], userids[k] = item.Address, item.UserID
+		}
+		ids, errs, err := s.PostAddresses(ctx, as, userids)
+		if err != nil {
+			return nil, err
 		}
-		return statusResponse{Status: false}, err
+		return batchResults(ids, errs, http.StatusCreated), nil
+	}
+}
+
+func MakeCardsPostEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "post cards")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(cardsPostRequest)
+		cs := make([]users.Card, len(req.Items))
+		userids := make([]string, len(req.Items))
+		for k, item := range req.Items {
+			cs[k], userids[k] = item.Card, item.UserID
+		}
+		ids, errs, err := s.PostCards(ctx, cs, userids)
+		if err != nil {
+			return nil, err
+		}
+		return batchResults(ids, errs, http.StatusCreated), nil
+	}
+}
+
+func MakeUsersDeleteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "delete customers")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(usersDeleteRequest)
+		errs, err := s.DeleteUsers(ctx, req.IDs)
+		if err != nil {
+			return nil, err
+		}
+		return batchResults(req.IDs, errs, http.StatusNoContent), nil
+	}
+}
+
+func MakeErasureEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "erase user")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(erasureRequest)
+		return s.EraseUser(ctx, req.ID)
+	}
+}
+
+func MakeErasureGetEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "get erasure")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(erasureRequest)
+		return s.GetErasure(ctx, req.ID)
+	}
+}
+
+func MakeDefaultAddressEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "set default address")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(defaultAddressRequest)
+		err = s.SetDefaultAddress(ctx, req.UserID, req.Kind, req.AddressID)
+		return statusResponse{Status: err == nil}, err
+	}
+}
+
+func MakeCardBillingAddressEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "set card billing address")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(cardBillingAddressRequest)
+		err = s.SetCardBillingAddress(ctx, req.CardID, req.AddressID)
+		return statusResponse{Status: err == nil}, err
+	}
+}
+
+func MakeTenantPostEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "create tenant")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(users.Tenant)
+		id, err := s.CreateTenant(ctx, req)
+		return postResponse{ID: id}, err
+	}
+}
+
+func MakeTenantGetEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "get tenants")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		req := request.(GetRequest)
+		ts, err := s.GetTenants(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		if req.ID == "" {
+			return EmbedStruct{tenantsResponse{Tenants: ts}}, nil
+		}
+		return ts[0], nil
 	}
 }
 
 func MakeHealthEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		var span stdopentracing.Span
-		span, ctx = stdopentracing.StartSpanFromContext(ctx, "health check")
-		span.SetTag("service", "user")
-		defer span.Finish()
-		health := s.Health()
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "health check")
+		span.SetAttributes(attribute.String("service", "user"))
+		defer span.End()
+		health := s.Health(ctx)
 		return healthResponse{Health: health}, nil
 	}
 }
@@ -225,6 +436,10 @@ func MakeHealthEndpoint(s Service) endpoint.Endpoint {
 type GetRequest struct {
 	ID   string
 	Attr string
+	// Embed names the relations of a customer embedded in it.
+	Embed []string
+	// Fields is the sparse fieldset of the response, all fields when empty.
+	Fields []string
 }
 
 type loginRequest struct {
@@ -240,6 +455,24 @@ type usersResponse struct {
 	Users []users.User `json:"customer"`
 }
 
+type searchRequest struct {
+	Query string
+	Page  int
+	Size  int
+}
+
+type searchResponse struct {
+	Embed usersResponse `json:"_embedded"`
+	Page  pageResponse  `json:"page"`
+}
+
+type pageResponse struct {
+	Size          int `json:"size"`
+	Number        int `json:"number"`
+	TotalElements int `json:"totalElements"`
+	TotalPages    int `json:"totalPages"`
+}
+
 type addressPostRequest struct {
 	users.Address
 	UserID string `json:"userID"`
@@ -254,6 +487,20 @@ type cardPostRequest struct {
 	UserID string `json:"userID"`
 }
 
+// addressesPostRequest and cardsPostRequest carry the items of a batch,
+// each naming its own customer.
+type addressesPostRequest struct {
+	Items []addressPostRequest `json:"items"`
+}
+
+type cardsPostRequest struct {
+	Items []cardPostRequest `json:"items"`
+}
+
+type usersDeleteRequest struct {
+	IDs []string `json:"ids"`
+}
+
 type cardsResponse struct {
 	Cards []users.Card `json:"card"`
 }
@@ -270,13 +517,31 @@ type statusResponse struct {
 	Status bool `json:"status"`
 }
 
+type tenantsResponse struct {
+	Tenants []users.Tenant `json:"tenant"`
+}
+
 type postResponse struct {
 	ID string `json:"id"`
 }
 
 type deleteRequest struct {
-	Entity string
-	ID     string
+	ID string
+}
+
+type erasureRequest struct {
+	ID string
+}
+
+type defaultAddressRequest struct {
+	UserID    string `json:"-"`
+	Kind      string `json:"-"`
+	AddressID string `json:"address"`
+}
+
+type cardBillingAddressRequest struct {
+	CardID    string `json:"-"`
+	AddressID string `json:"address"`
 }
 
 type healthRequest struct {
@@ -0,0 +1,86 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// alwaysKept are the fields of a resource returned whichever fields are
+// asked for, so that it can still be identified and followed.
+var alwaysKept = []string{"id", "_links", "_embedded"}
+
+// sparse cuts the resources in response down to fields, the sparse fieldset
+// of the request. Embedded resources are returned whole. Without fields it
+// returns response as it is.
+func sparse(fields []string, response interface{}) interface{} {
+	if len(fields) == 0 {
+		return response
+	}
+	switch resp := response.(type) {
+	case EmbedStruct:
+		return EmbedStruct{sparse(fields, resp.Embed)}
+	case usersResponse:
+		return sparseList{key: "customer", items: pickAll(fields, resp.Users)}
+	case addressesResponse:
+		return sparseList{key: "address", items: pickAll(fields, resp.Addresses)}
+	case cardsResponse:
+		return sparseList{key: "card", items: pickAll(fields, resp.Cards)}
+	}
+	return pick(fields, response)
+}
+
+// sparseList is a list response of resources cut down by sparse, written
+// under key like the list it replaces.
+type sparseList struct {
+	key   string
+	items []interface{}
+}
+
+func (l sparseList) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{l.key: l.items})
+}
+
+func pickAll(fields []string, list interface{}) []interface{} {
+	v := reflect.ValueOf(list)
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = pick(fields, v.Index(i).Interface())
+	}
+	return items
+}
+
+// pick returns the JSON fields of v named in fields or alwaysKept, or v
+// itself if it is not a JSON object.
+func pick(fields []string, v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return v
+	}
+	kept := make(map[string]json.RawMessage, len(fields)+len(alwaysKept))
+	for _, names := range [][]string{fields, alwaysKept} {
+		for _, f := range names {
+			if raw, ok := all[f]; ok {
+				kept[f] = raw
+			}
+		}
+	}
+	return kept
+}
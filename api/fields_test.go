@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/aheadaviation/Users/users"
+)
+
+func TestDecodeGetRequest(t *testing.T) {
+
+	Convey("Given get requests", t, func() {
+		decode := func(target string) (GetRequest, error) {
+			g, err := decodeGetRequest(context.Background(), httptest.NewRequest("GET", target, nil))
+			if err != nil {
+				return GetRequest{}, err
+			}
+			return g.(GetRequest), nil
+		}
+
+		Convey("Then embed and fields should be read as lists", func() {
+			g, err := decode("/api/v2/customers/1?embed=addresses,%20cards&fields=username,,firstname")
+			So(err, ShouldBeNil)
+			So(g.ID, ShouldEqual, "1")
+			So(g.Embed, ShouldResemble, []string{"addresses", "cards"})
+			So(g.Fields, ShouldResemble, []string{"username", "firstname"})
+		})
+
+		Convey("Then unknown relations should be refused", func() {
+			_, err := decode("/customers?embed=orders")
+			So(err, ShouldHaveSameTypeAs, users.FieldErrors{})
+		})
+
+		Convey("Then embedding in anything but customers should be refused", func() {
+			_, err := decode("/cards/1?embed=addresses")
+			So(err, ShouldHaveSameTypeAs, users.FieldErrors{})
+			_, err = decode("/customers/1/cards?embed=addresses")
+			So(err, ShouldHaveSameTypeAs, users.FieldErrors{})
+		})
+	})
+}
+
+func TestSparseFieldsets(t *testing.T) {
+
+	Convey("Given the API with a customer list endpoint honouring fields", t, func() {
+		u := users.User{Username: "ada", FirstName: "Ada", LastName: "Lovelace", UserID: "1"}
+		u.AddLinks(users.LinkBase{})
+		u.Addresses = []users.Address{{ID: "a1", City: "London"}}
+		u.Embed([]string{"addresses"})
+		e := Endpoints{
+			UserGetEndpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				return sparse(request.(GetRequest).Fields, EmbedStruct{usersResponse{Users: []users.User{u}}}), nil
+			},
+		}
+		r := MakeHTTPHandler(e, log.NewNopLogger())
+		get := func(target string) map[string]interface{} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+			var body map[string]interface{}
+			So(json.NewDecoder(w.Body).Decode(&body), ShouldBeNil)
+			return body
+		}
+
+		Convey("When version 1 asks for the username", func() {
+			body := get("/customers?fields=username")
+			list := body["_embedded"].(map[string]interface{})["customer"].([]interface{})
+			c := list[0].(map[string]interface{})
+
+			Convey("Then only it, the ID, links and embedded resources are returned", func() {
+				So(c["username"], ShouldEqual, "ada")
+				So(c["id"], ShouldEqual, "1")
+				So(c, ShouldContainKey, "_links")
+				So(c, ShouldContainKey, "_embedded")
+				So(c, ShouldNotContainKey, "firstname")
+				So(c, ShouldNotContainKey, "lastname")
+			})
+		})
+
+		Convey("When version 2 asks for the last name", func() {
+			body := get("/api/v2/customers?fields=lastname")
+			c := body["data"].([]interface{})[0].(map[string]interface{})
+
+			Convey("Then the data holds the cut down customers", func() {
+				So(c["lastname"], ShouldEqual, "Lovelace")
+				So(c, ShouldNotContainKey, "username")
+			})
+		})
+
+		Convey("When no fields are asked for", func() {
+			body := get("/api/v2/customers")
+			c := body["data"].([]interface{})[0].(map[string]interface{})
+
+			Convey("Then every field is returned", func() {
+				So(c["firstname"], ShouldEqual, "Ada")
+				So(c["_embedded"].(map[string]interface{})["addresses"], ShouldHaveLength, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,473 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aheadaviation/Users/users"
+	"github.com/go-kit/kit/log"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// GraphQLPath is where main mounts the GraphQL API.
+const GraphQLPath = "/graphql"
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// MakeGraphQLHandler serves the GraphQL API over s. The query is read from
+// the JSON body of a POST or the query string of a GET. Each request gets
+// its own loaders, so reads are only batched and cached within it.
+func MakeGraphQLHandler(s Service, logger log.Logger) (http.Handler, error) {
+	schema, err := newGraphQLSchema(s)
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		req, err := decodeGraphQLRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+		res := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			OperationName:  req.OperationName,
+			VariableValues: req.Variables,
+			Context:        withLoaders(r.Context(), s),
+		})
+		for i, e := range res.Errors {
+			if err := originalError(e); err != nil {
+				status, fields := errorStatus(err, w)
+				if status == http.StatusInternalServerError {
+					logger.Log("err", err)
+				}
+				e.Extensions = map[string]interface{}{"code": errorCode(status)}
+				if fields != nil {
+					e.Extensions["fields"] = fields
+				}
+				res.Errors[i] = e
+			}
+		}
+		json.NewEncoder(w).Encode(res)
+	}), nil
+}
+
+func decodeGraphQLRequest(r *http.Request) (graphQLRequest, error) {
+	req := graphQLRequest{}
+	switch r.Method {
+	case "GET":
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return req, err
+			}
+		}
+	default:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, err
+		}
+	}
+	if req.Query == "" {
+		return req, ErrInvalidRequest
+	}
+	return req, nil
+}
+
+// originalError returns the error a resolver failed with, unwrapping the
+// errors the executor wraps it in, or nil for errors in the query itself.
+func originalError(err error) error {
+	for {
+		switch e := err.(type) {
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return err
+		}
+		if err == nil {
+			return nil
+		}
+	}
+}
+
+func newGraphQLSchema(s Service) (graphql.Schema, error) {
+	address := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Address",
+		Fields: graphql.Fields{
+			"id":       addressField(graphql.NewNonNull(graphql.ID), func(a users.Address) interface{} { return a.ID }),
+			"street":   addressField(graphql.String, func(a users.Address) interface{} { return a.Street }),
+			"number":   addressField(graphql.String, func(a users.Address) interface{} { return a.Number }),
+			"country":  addressField(graphql.String, func(a users.Address) interface{} { return a.Country }),
+			"city":     addressField(graphql.String, func(a users.Address) interface{} { return a.City }),
+			"state":    addressField(graphql.String, func(a users.Address) interface{} { return a.State }),
+			"postcode": addressField(graphql.String, func(a users.Address) interface{} { return a.PostCode }),
+		},
+	})
+
+	card := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Card",
+		Fields: graphql.Fields{
+			"id": cardField(graphql.NewNonNull(graphql.ID), func(c users.Card) interface{} { return c.ID }),
+			"longNum": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The card number with all but its last four digits masked.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					c := p.Source.(users.Card)
+					c.MaskCC()
+					return c.LongNum, nil
+				},
+			},
+			"expires":     cardField(graphql.String, func(c users.Card) interface{} { return c.Expires }),
+			"brand":       cardField(graphql.String, func(c users.Card) interface{} { return c.Brand }),
+			"expiryMonth": cardField(graphql.Int, func(c users.Card) interface{} { return c.ExpiryMonth }),
+			"expiryYear":  cardField(graphql.Int, func(c users.Card) interface{} { return c.ExpiryYear }),
+			"expired":     cardField(graphql.Boolean, func(c users.Card) interface{} { return c.Expired }),
+			"billingAddress": &graphql.Field{
+				Type: address,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					c := p.Source.(users.Card)
+					if c.BillingAddress == "" {
+						return nil, nil
+					}
+					return loadersFrom(p.Context).address(p.Context, c.BillingAddress), nil
+				},
+			},
+		},
+	})
+
+	user := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":         userField(graphql.NewNonNull(graphql.ID), func(u users.User) interface{} { return u.UserID }),
+			"username":   userField(graphql.String, func(u users.User) interface{} { return u.Username }),
+			"firstName":  userField(graphql.String, func(u users.User) interface{} { return u.FirstName }),
+			"lastName":   userField(graphql.String, func(u users.User) interface{} { return u.LastName }),
+			"erasedAt":   userField(graphql.DateTime, func(u users.User) interface{} { return u.ErasedAt }),
+			"disabledAt": userField(graphql.DateTime, func(u users.User) interface{} { return u.DisabledAt }),
+			"addresses": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(address))),
+				Resolve: attributes(func(u users.User) interface{} {
+					return u.Addresses
+				}),
+			},
+			"cards": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(card))),
+				Resolve: attributes(func(u users.User) interface{} {
+					return u.Cards
+				}),
+			},
+			"defaultShipping": &graphql.Field{
+				Type: address,
+				Resolve: attributes(func(u users.User) interface{} {
+					return findAddress(u.Addresses, u.DefaultShipping)
+				}),
+			},
+			"defaultBilling": &graphql.Field{
+				Type: address,
+				Resolve: attributes(func(u users.User) interface{} {
+					return findAddress(u.Addresses, u.DefaultBilling)
+				}),
+			},
+		},
+	})
+
+	userSearch := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserSearch",
+		Fields: graphql.Fields{
+			"users": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(user)))},
+			"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	id := &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type: user,
+				Args: graphql.FieldConfigArgument{"id": id},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					us, err := s.GetUsers(p.Context, p.Args["id"].(string))
+					if err != nil || len(us) == 0 {
+						return nil, err
+					}
+					return us[0], nil
+				},
+			},
+			"users": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(user))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return s.GetUsers(p.Context, "")
+				},
+			},
+			"searchUsers": &graphql.Field{
+				Type:        graphql.NewNonNull(userSearch),
+				Description: "Customers matching query, best first. Only open to admin callers.",
+				Args: graphql.FieldConfigArgument{
+					"query":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					offset, limit := p.Args["offset"].(int), p.Args["limit"].(int)
+					errs := users.FieldErrors{}
+					if offset < 0 {
+						errs["offset"] = "must not be negative"
+					}
+					if limit < 1 || limit > maxPageSize {
+						errs["limit"] = "must be between 1 and 100"
+					}
+					if len(errs) > 0 {
+						return nil, errs
+					}
+					us, total, err := s.SearchUsers(p.Context, p.Args["query"].(string), offset, limit)
+					if err != nil {
+						return nil, err
+					}
+					return map[string]interface{}{"users": us, "total": total}, nil
+				},
+			},
+			"address": &graphql.Field{
+				Type: address,
+				Args: graphql.FieldConfigArgument{"id": id},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersFrom(p.Context).address(p.Context, p.Args["id"].(string)), nil
+				},
+			},
+			"addresses": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(address))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return s.GetAddresses(p.Context, "")
+				},
+			},
+			"card": &graphql.Field{
+				Type: card,
+				Args: graphql.FieldConfigArgument{"id": id},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					cs, err := s.GetCards(p.Context, p.Args["id"].(string))
+					if err != nil || len(cs) == 0 {
+						return nil, err
+					}
+					return cs[0], nil
+				},
+			},
+			"cards": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(card))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return s.GetCards(p.Context, "")
+				},
+			},
+		},
+	})
+
+	userInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UserInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"username":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"password":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"email":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"firstName": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"lastName":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+	addressInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "AddressInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"street":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"number":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"country":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"city":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"state":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"postcode": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+	cardInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CardInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"longNum":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"expires":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"ccv":            &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"billingAddress": &graphql.InputObjectFieldConfig{Type: graphql.ID},
+		},
+	})
+
+	str := graphql.NewNonNull(graphql.String)
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"register": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Args: graphql.FieldConfigArgument{
+					"username":  &graphql.ArgumentConfig{Type: str},
+					"password":  &graphql.ArgumentConfig{Type: str},
+					"email":     &graphql.ArgumentConfig{Type: graphql.String},
+					"firstName": &graphql.ArgumentConfig{Type: graphql.String},
+					"lastName":  &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					a := p.Args
+					return s.Register(p.Context, arg(a, "username"), arg(a, "password"), arg(a, "email"), arg(a, "firstName"), arg(a, "lastName"))
+				},
+			},
+			"createUser": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Args: graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(userInput)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					in := p.Args["input"].(map[string]interface{})
+					u := users.New()
+					u.Username, u.Password, u.Email = arg(in, "username"), arg(in, "password"), arg(in, "email")
+					u.FirstName, u.LastName = arg(in, "firstName"), arg(in, "lastName")
+					return s.PostUser(p.Context, u)
+				},
+			},
+			"createAddress": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Args: graphql.FieldConfigArgument{
+					"userId": id,
+					"input":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(addressInput)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					in := p.Args["input"].(map[string]interface{})
+					a := users.Address{
+						Street:   arg(in, "street"),
+						Number:   arg(in, "number"),
+						Country:  arg(in, "country"),
+						City:     arg(in, "city"),
+						State:    arg(in, "state"),
+						PostCode: arg(in, "postcode"),
+					}
+					return s.PostAddress(p.Context, a, p.Args["userId"].(string))
+				},
+			},
+			"createCard": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Args: graphql.FieldConfigArgument{
+					"userId": id,
+					"input":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(cardInput)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					in := p.Args["input"].(map[string]interface{})
+					c := users.Card{
+						LongNum:        arg(in, "longNum"),
+						Expires:        arg(in, "expires"),
+						CCV:            arg(in, "ccv"),
+						BillingAddress: arg(in, "billingAddress"),
+					}
+					return s.PostCard(p.Context, c, p.Args["userId"].(string))
+				},
+			},
+			"setDefaultAddress": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Makes one of the customer's addresses its default of kind shipping or billing.",
+				Args: graphql.FieldConfigArgument{
+					"userId":    id,
+					"kind":      &graphql.ArgumentConfig{Type: str},
+					"addressId": id,
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					err := s.SetDefaultAddress(p.Context, p.Args["userId"].(string), p.Args["kind"].(string), p.Args["addressId"].(string))
+					return err == nil, err
+				},
+			},
+			"setCardBillingAddress": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"cardId":    id,
+					"addressId": id,
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					err := s.SetCardBillingAddress(p.Context, p.Args["cardId"].(string), p.Args["addressId"].(string))
+					return err == nil, err
+				},
+			},
+			"deleteUser":    deleteField(s.DeleteUser, id),
+			"deleteAddress": deleteField(s.DeleteAddress, id),
+			"deleteCard":    deleteField(s.DeleteCard, id),
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func userField(t graphql.Output, get func(users.User) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(users.User)), nil
+	}}
+}
+
+func addressField(t graphql.Output, get func(users.Address) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(users.Address)), nil
+	}}
+}
+
+func cardField(t graphql.Output, get func(users.Card) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(users.Card)), nil
+	}}
+}
+
+// attributes resolves a field from the addresses and cards of the customer,
+// loaded together with those of the other customers in the response.
+func attributes(get func(users.User) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		load := loadersFrom(p.Context).attributes(p.Context, p.Source.(users.User))
+		return func() (interface{}, error) {
+			u, err := load()
+			if err != nil {
+				return nil, err
+			}
+			return get(u), nil
+		}, nil
+	}
+}
+
+func deleteField(del func(context.Context, string) error, id *graphql.ArgumentConfig) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.Boolean),
+		Args: graphql.FieldConfigArgument{"id": id},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			err := del(p.Context, p.Args["id"].(string))
+			return err == nil, err
+		},
+	}
+}
+
+func findAddress(as []users.Address, id string) interface{} {
+	for _, a := range as {
+		if a.ID == id {
+			return a
+		}
+	}
+	return nil
+}
+
+// arg returns the string argument name, or "" if it was not given.
+func arg(args map[string]interface{}, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
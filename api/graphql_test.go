@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/users"
+)
+
+// stubService serves two customers, each with one address and one card.
+type stubService struct {
+	Service
+	addressReads int
+	deleted      []string
+}
+
+func (s *stubService) GetUsers(ctx context.Context, id string) ([]users.User, error) {
+	all := []users.User{
+		{UserID: "u1", Username: "ada", Addresses: []users.Address{{ID: "a1"}}, Cards: []users.Card{{ID: "c1"}}, DefaultShipping: "a1"},
+		{UserID: "u2", Username: "bob", Addresses: []users.Address{{ID: "a2"}}, Cards: []users.Card{{ID: "c2"}}},
+	}
+	if id == "" {
+		return all, nil
+	}
+	for _, u := range all {
+		if u.UserID == id {
+			return []users.User{u}, nil
+		}
+	}
+	return nil, db.ErrNotFound
+}
+
+func (s *stubService) GetAddresses(ctx context.Context, id string) ([]users.Address, error) {
+	s.addressReads++
+	return []users.Address{{ID: id, City: "City " + id}}, nil
+}
+
+func (s *stubService) SearchUsers(ctx context.Context, query string, offset, limit int) ([]users.User, int, error) {
+	return nil, 0, ErrForbidden
+}
+
+func (s *stubService) Register(ctx context.Context, username, password, email, first, last string) (string, error) {
+	return "new-" + username, nil
+}
+
+func (s *stubService) DeleteCard(ctx context.Context, id string) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+// attributesDatabase fills in attributes, counting the calls made.
+type attributesDatabase struct {
+	db.Database
+	calls int
+}
+
+func (d *attributesDatabase) GetUsersAttributes(ctx context.Context, us []users.User) error {
+	d.calls++
+	for k, u := range us {
+		for i, a := range u.Addresses {
+			us[k].Addresses[i] = users.Address{ID: a.ID, City: "City " + a.ID}
+		}
+		for i, c := range u.Cards {
+			us[k].Cards[i] = users.Card{ID: c.ID, LongNum: "4111111111111111", BillingAddress: "a9"}
+		}
+	}
+	return nil
+}
+
+func TestGraphQL(t *testing.T) {
+
+	Convey("Given the GraphQL API over a stub service", t, func() {
+		saved := db.DefaultDb
+		defer func() { db.DefaultDb = saved }()
+		d := &attributesDatabase{}
+		db.DefaultDb = d
+		s := &stubService{}
+		h, err := MakeGraphQLHandler(s, log.NewNopLogger())
+		So(err, ShouldBeNil)
+		post := func(query string) (int, map[string]interface{}) {
+			body, _ := json.Marshal(graphQLRequest{Query: query})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("POST", GraphQLPath, strings.NewReader(string(body))))
+			var res map[string]interface{}
+			So(json.NewDecoder(w.Body).Decode(&res), ShouldBeNil)
+			return w.Code, res
+		}
+
+		Convey("When listing customers with their addresses and cards", func() {
+			code, res := post(`{ users { username addresses { city } cards { longNum billingAddress { city } } defaultShipping { id } } }`)
+
+			Convey("Then the attributes are loaded in one batch", func() {
+				So(code, ShouldEqual, http.StatusOK)
+				So(res["errors"], ShouldBeNil)
+				So(d.calls, ShouldEqual, 1)
+				list := res["data"].(map[string]interface{})["users"].([]interface{})
+				So(list, ShouldHaveLength, 2)
+				ada := list[0].(map[string]interface{})
+				So(ada["addresses"].([]interface{})[0].(map[string]interface{})["city"], ShouldEqual, "City a1")
+				So(ada["defaultShipping"].(map[string]interface{})["id"], ShouldEqual, "a1")
+				So(list[1].(map[string]interface{})["defaultShipping"], ShouldBeNil)
+			})
+
+			Convey("Then card numbers are masked", func() {
+				ada := res["data"].(map[string]interface{})["users"].([]interface{})[0].(map[string]interface{})
+				So(ada["cards"].([]interface{})[0].(map[string]interface{})["longNum"], ShouldEqual, "************1111")
+			})
+
+			Convey("Then a billing address shared by cards is read once", func() {
+				So(s.addressReads, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a query is sent with GET", func() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", GraphQLPath+"?query="+url.QueryEscape(`query($id: ID!) { user(id: $id) { username } }`)+"&variables="+url.QueryEscape(`{"id":"u2"}`), nil))
+
+			Convey("Then its variables are used", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Body.String(), ShouldContainSubstring, `"username":"bob"`)
+			})
+		})
+
+		Convey("When a resolver fails", func() {
+			_, res := post(`{ searchUsers(query: "ada") { total } }`)
+
+			Convey("Then the error carries the code of its status", func() {
+				errs := res["errors"].([]interface{})
+				So(errs, ShouldHaveLength, 1)
+				ext := errs[0].(map[string]interface{})["extensions"].(map[string]interface{})
+				So(ext["code"], ShouldEqual, "forbidden")
+			})
+		})
+
+		Convey("When mutating", func() {
+			_, res := post(`mutation { register(username: "cy", password: "pw") deleteCard(id: "c1") }`)
+
+			Convey("Then the service is called", func() {
+				So(res["errors"], ShouldBeNil)
+				data := res["data"].(map[string]interface{})
+				So(data["register"], ShouldEqual, "new-cy")
+				So(data["deleteCard"], ShouldEqual, true)
+				So(s.deleted, ShouldResemble, []string{"c1"})
+			})
+		})
+
+		Convey("When the body is not a GraphQL request", func() {
+			code, res := post(``)
+
+			Convey("Then it is refused", func() {
+				So(code, ShouldEqual, http.StatusBadRequest)
+				So(res["errors"], ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,191 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aheadaviation/Users/db/cache"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/users"
+	"github.com/gorilla/mux"
+)
+
+// IdempotencyHeader names the key a client sends to make a POST safe to
+// retry. ReplayedHeader marks a response answered from the store.
+const (
+	IdempotencyHeader = "Idempotency-Key"
+	ReplayedHeader    = "Idempotent-Replayed"
+	maxIdempotencyKey = 255
+)
+
+var (
+	ErrIdempotencyKeyReused   = errors.New("Idempotency key already used for a different request")
+	ErrIdempotencyKeyInFlight = errors.New("A request with this idempotency key is in progress")
+	ErrIdempotencyUnavailable = errors.New("Idempotency keys are unavailable")
+	errInvalidIdempotencyKey  = users.FieldErrors{IdempotencyHeader: "must be 1 to 255 characters"}
+)
+
+// replayedHeaders are the response headers stored with a response. The rest
+// describe the request that was answered, not the response.
+var replayedHeaders = []string{"Content-Type", "Location", "Retry-After"}
+
+// storedResponse is the first response to a POST with an idempotency key,
+// with the fingerprint of its request.
+type storedResponse struct {
+	Fingerprint string
+	Status      int
+	Header      map[string]string
+	Body        []byte
+}
+
+// IdempotencyMiddleware answers a POST carrying an Idempotency-Key with the
+// response to the first POST of the same caller and tenant with that key,
+// kept in store for ttl. A key sent again with a different method, path or
+// body is refused with 422, and while its first request is being served by
+// this instance with 409. Responses with a 5xx status are not kept, so the
+// request can be retried. When the store fails requests with a key are
+// refused rather than risk being served twice.
+func IdempotencyMiddleware(store cache.Store, ttl time.Duration) mux.MiddlewareFunc {
+	var mu sync.Mutex
+	inFlight := map[string]bool{}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyHeader)
+			if r.Method != "POST" || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ver := v1
+			if versionPrefix(r) == V2Prefix {
+				ver = v2
+			}
+			ctx := r.Context()
+			if len(key) > maxIdempotencyKey {
+				ver.encodeError(ctx, errInvalidIdempotencyKey, w)
+				return
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				ver.encodeError(ctx, err, w)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			fingerprint := idempotencyHash(r.Method, r.URL.RequestURI(), string(body))
+			caller, _ := reqctx.CallerFrom(ctx)
+			skey := "idempotency:" + idempotencyHash(reqctx.Tenant(ctx), caller.ID, key)
+
+			mu.Lock()
+			if inFlight[skey] {
+				mu.Unlock()
+				ver.encodeError(ctx, ErrIdempotencyKeyInFlight, w)
+				return
+			}
+			inFlight[skey] = true
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				delete(inFlight, skey)
+				mu.Unlock()
+			}()
+
+			b, ok, err := store.Get(ctx, skey)
+			if err != nil {
+				ver.encodeError(ctx, ErrIdempotencyUnavailable, w)
+				return
+			}
+			if ok {
+				var stored storedResponse
+				if err := json.Unmarshal(b, &stored); err != nil {
+					ver.encodeError(ctx, ErrIdempotencyUnavailable, w)
+					return
+				}
+				if stored.Fingerprint != fingerprint {
+					ver.encodeError(ctx, ErrIdempotencyKeyReused, w)
+					return
+				}
+				for k, v := range stored.Header {
+					w.Header().Set(k, v)
+				}
+				w.Header().Set(ReplayedHeader, "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+				return
+			}
+			stored := storedResponse{
+				Fingerprint: fingerprint,
+				Status:      rec.status,
+				Header:      map[string]string{},
+				Body:        rec.body.Bytes(),
+			}
+			for _, h := range replayedHeaders {
+				if v := w.Header().Get(h); v != "" {
+					stored.Header[h] = v
+				}
+			}
+			if b, err := json.Marshal(stored); err == nil {
+				store.Set(ctx, skey, b, ttl)
+			}
+		})
+	}
+}
+
+// idempotencyHash hashes parts, separated so that no two lists of parts
+// join to the same string.
+func idempotencyHash(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping its status and
+// body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
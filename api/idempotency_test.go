@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/aheadaviation/Users/db/cache"
+	"github.com/aheadaviation/Users/reqctx"
+)
+
+// failingStore fails every read.
+type failingStore struct {
+	cache.Store
+}
+
+func (failingStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return nil, false, errors.New("down")
+}
+
+func TestIdempotency(t *testing.T) {
+
+	Convey("Given the API counting the customers it creates", t, func() {
+		created := 0
+		e := Endpoints{
+			UserPostEndpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				created++
+				return postResponse{ID: "id" + strconv.Itoa(created)}, nil
+			},
+		}
+		store := cache.NewLRU(10)
+		newRouter := func(store cache.Store) http.Handler {
+			r := MakeHTTPHandler(e, log.NewNopLogger())
+			r.Use(IdempotencyMiddleware(store, time.Hour))
+			return r
+		}
+		r := newRouter(store)
+		post := func(h http.Handler, path, key, caller, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", path, strings.NewReader(body))
+			if key != "" {
+				req.Header.Set(IdempotencyHeader, key)
+			}
+			if caller != "" {
+				req.Header.Set(reqctx.CallerIDHeader, caller)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("When a POST is retried with the same key and body", func() {
+			first := post(r, "/customers", "k1", "ada", `{"username":"x"}`)
+			again := post(r, "/customers", "k1", "ada", `{"username":"x"}`)
+
+			Convey("Then the first response is replayed", func() {
+				So(created, ShouldEqual, 1)
+				So(again.Code, ShouldEqual, first.Code)
+				So(again.Body.String(), ShouldEqual, first.Body.String())
+				So(again.Header().Get("Content-Type"), ShouldEqual, "application/hal+json")
+				So(again.Header().Get(ReplayedHeader), ShouldEqual, "true")
+				So(first.Header().Get(ReplayedHeader), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a key is reused with a different body", func() {
+			post(r, "/customers", "k1", "ada", `{"username":"x"}`)
+			w := post(r, "/api/v2/customers", "k1", "ada", `{"username":"y"}`)
+
+			Convey("Then it is refused with 422", func() {
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				So(w.Body.String(), ShouldContainSubstring, `"code":"unprocessable_entity"`)
+				So(created, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When another caller or no key is used", func() {
+			post(r, "/customers", "k1", "ada", `{"username":"x"}`)
+			post(r, "/customers", "k1", "bob", `{"username":"x"}`)
+			post(r, "/customers", "", "ada", `{"username":"x"}`)
+
+			Convey("Then each is served", func() {
+				So(created, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the key is too long", func() {
+			w := post(r, "/customers", strings.Repeat("k", 256), "ada", `{}`)
+
+			Convey("Then it is refused with 400", func() {
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+				So(created, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the store cannot be read", func() {
+			w := post(newRouter(failingStore{}), "/customers", "k1", "ada", `{}`)
+
+			Convey("Then the request is refused rather than risk serving it twice", func() {
+				So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+				So(created, ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,158 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aheadaviation/Users/users"
+	"github.com/gorilla/mux"
+)
+
+var (
+	ErrInvalidProxy    = "Invalid trusted proxy %q: want an address or CIDR range"
+	ErrInvalidLinkBase = "Invalid link base %q: want a host or an absolute URL"
+	ErrNoSuchRel       = errors.New("No such relation")
+)
+
+// LinkOptions say where the links in responses point. By default they point
+// at the scheme and host the request came to, under its API version prefix.
+type LinkOptions struct {
+	// Override replaces the scheme, host and prefix of the request.
+	Override *users.LinkBase
+	// Relative leaves the scheme and host out of links.
+	Relative bool
+	// TrustedProxies are the peers whose X-Forwarded-Proto, X-Forwarded-Host
+	// and X-Forwarded-Prefix headers describe the request.
+	TrustedProxies []*net.IPNet
+}
+
+// ParseTrustedProxies reads addresses and CIDR ranges.
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		if _, n, err := net.ParseCIDR(e); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+		ip := net.ParseIP(e)
+		if ip == nil {
+			return nil, fmt.Errorf(ErrInvalidProxy, e)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+// ParseLinkBase reads a link base written as an absolute URL, whose path is
+// the prefix, or as a bare host served over http.
+func ParseLinkBase(s string) (users.LinkBase, error) {
+	raw := s
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return users.LinkBase{}, fmt.Errorf(ErrInvalidLinkBase, s)
+	}
+	return users.LinkBase{Scheme: u.Scheme, Host: u.Host, Prefix: strings.TrimSuffix(u.Path, "/")}, nil
+}
+
+// LinkMiddleware gives each request the base of the links in its response.
+func LinkMiddleware(o LinkOptions) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := users.WithLinkBase(r.Context(), o.base(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func (o LinkOptions) base(r *http.Request) users.LinkBase {
+	b := users.LinkBase{Scheme: "http", Host: r.Host, Relative: o.Relative}
+	if r.TLS != nil {
+		b.Scheme = "https"
+	}
+	if o.trusted(r.RemoteAddr) {
+		if proto := forwarded(r, "X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			b.Scheme = proto
+		}
+		if host := forwarded(r, "X-Forwarded-Host"); host != "" {
+			b.Host = host
+		}
+		if prefix := forwarded(r, "X-Forwarded-Prefix"); strings.HasPrefix(prefix, "/") {
+			b.Prefix = strings.TrimSuffix(prefix, "/")
+		}
+	}
+	if o.Override != nil {
+		b.Scheme, b.Host, b.Prefix = o.Override.Scheme, o.Override.Host, o.Override.Prefix
+	}
+	b.Prefix += versionPrefix(r)
+	return b
+}
+
+func (o LinkOptions) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range o.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded returns the value a proxy header gives for the client, the
+// first of a list added to by each proxy.
+func forwarded(r *http.Request, header string) string {
+	v := r.Header.Get(header)
+	if i := strings.Index(v, ","); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
+
+type relResponse struct {
+	Rel         string `json:"rel"`
+	Description string `json:"description"`
+}
+
+// relHandler documents the link relations named by the curie.
+func relHandler(ver version) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rel := mux.Vars(r)["rel"]
+		desc, ok := users.Rels[rel]
+		if !ok {
+			ver.encodeError(r.Context(), ErrNoSuchRel, w)
+			return
+		}
+		ver.encodeResponse(r.Context(), w, relResponse{Rel: users.CurieName + ":" + rel, Description: desc})
+	})
+}
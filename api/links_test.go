@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/aheadaviation/Users/users"
+)
+
+func TestLinkMiddleware(t *testing.T) {
+
+	Convey("Given the API with a stub customer endpoint", t, func() {
+		var base users.LinkBase
+		e := Endpoints{
+			UserGetEndpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				base = users.LinkBaseFrom(ctx)
+				return EmbedStruct{usersResponse{Users: []users.User{}}}, nil
+			},
+		}
+		proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+		So(err, ShouldBeNil)
+		serve := func(o LinkOptions, path, remote string, headers map[string]string) *httptest.ResponseRecorder {
+			r := MakeHTTPHandler(e, log.NewNopLogger())
+			r.Use(LinkMiddleware(o))
+			req := httptest.NewRequest("GET", path, nil)
+			req.Host = "users.local:8084"
+			req.RemoteAddr = remote
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+		fwd := map[string]string{
+			"X-Forwarded-Proto":  "https",
+			"X-Forwarded-Host":   "shop.example.com, inner.example.com",
+			"X-Forwarded-Prefix": "/users/",
+		}
+
+		Convey("When requested directly under a version prefix", func() {
+			serve(LinkOptions{TrustedProxies: proxies}, "/api/v2/customers", "203.0.113.9:4000", nil)
+
+			Convey("Then links point at the request's host and version", func() {
+				So(base.URL("customers/1"), ShouldEqual, "http://users.local:8084/api/v2/customers/1")
+			})
+		})
+
+		Convey("When a trusted proxy forwards the request", func() {
+			serve(LinkOptions{TrustedProxies: proxies}, "/customers", "10.1.2.3:4000", fwd)
+
+			Convey("Then its headers are used", func() {
+				So(base.URL("customers/1"), ShouldEqual, "https://shop.example.com/users/customers/1")
+			})
+		})
+
+		Convey("When an untrusted peer sends forwarding headers", func() {
+			serve(LinkOptions{TrustedProxies: proxies}, "/customers", "192.0.2.2:4000", fwd)
+
+			Convey("Then they are ignored", func() {
+				So(base.URL("customers/1"), ShouldEqual, "http://users.local:8084/customers/1")
+			})
+		})
+
+		Convey("When an override is set", func() {
+			o, err := ParseLinkBase("https://api.example.com/shop/")
+			So(err, ShouldBeNil)
+			serve(LinkOptions{Override: &o, TrustedProxies: proxies}, "/api/v1/customers", "192.0.2.1:4000", fwd)
+
+			Convey("Then it replaces the request and the proxy", func() {
+				So(base.URL("customers/1"), ShouldEqual, "https://api.example.com/shop/api/v1/customers/1")
+			})
+		})
+
+		Convey("When links are relative", func() {
+			serve(LinkOptions{Relative: true}, "/api/v1/customers", "203.0.113.9:4000", nil)
+
+			Convey("Then they leave out the scheme and host", func() {
+				So(base.URL("customers/1"), ShouldEqual, "/api/v1/customers/1")
+			})
+		})
+
+		Convey("When a relation is looked up", func() {
+			found := serve(LinkOptions{}, "/rels/erasure", "203.0.113.9:4000", nil)
+			missing := serve(LinkOptions{}, "/api/v2/rels/nope", "203.0.113.9:4000", nil)
+
+			Convey("Then known relations are documented and others are not found", func() {
+				So(found.Code, ShouldEqual, http.StatusOK)
+				So(found.Body.String(), ShouldContainSubstring, `"rel":"users:erasure"`)
+				So(missing.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestParseLinkOptions(t *testing.T) {
+
+	Convey("Given link settings", t, func() {
+
+		Convey("Then a bare host is served over http", func() {
+			b, err := ParseLinkBase("users")
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, users.LinkBase{Scheme: "http", Host: "users"})
+		})
+
+		Convey("Then malformed settings are rejected", func() {
+			_, err := ParseLinkBase("ftp://users")
+			So(err, ShouldNotBeNil)
+			_, err = ParseTrustedProxies([]string{"proxy"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/users"
+)
+
+// loaders batch and cache the reads of one GraphQL request. The executor
+// resolves the fields of each level of the response before calling the
+// thunks they return, so every customer of a level asking for its
+// attributes joins one batch. Resolvers run one at a time, so loaders need
+// no locking.
+type loaders struct {
+	s Service
+
+	// batch collects the customers whose attributes are not loaded yet.
+	batch *attributesBatch
+	attrs map[string]attributesEntry
+
+	addresses map[string]addressResult
+}
+
+type attributesBatch struct {
+	users  []users.User
+	loaded bool
+	err    error
+}
+
+type attributesEntry struct {
+	batch *attributesBatch
+	i     int
+}
+
+type addressResult struct {
+	a   interface{}
+	err error
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, s Service) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		s:         s,
+		attrs:     map[string]attributesEntry{},
+		addresses: map[string]addressResult{},
+	})
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// attributes returns a thunk giving u with its addresses and cards. The
+// first thunk called loads them for every customer asked for so far with
+// one call to db.GetUsersAttributes.
+func (l *loaders) attributes(ctx context.Context, u users.User) func() (users.User, error) {
+	e, ok := l.attrs[u.UserID]
+	if !ok {
+		if l.batch == nil {
+			l.batch = &attributesBatch{}
+		}
+		e = attributesEntry{batch: l.batch, i: len(l.batch.users)}
+		l.batch.users = append(l.batch.users, u)
+		l.attrs[u.UserID] = e
+	}
+	return func() (users.User, error) {
+		b := e.batch
+		if !b.loaded {
+			if l.batch == b {
+				l.batch = nil
+			}
+			b.err = db.GetUsersAttributes(ctx, b.users)
+			b.loaded = true
+		}
+		return b.users[e.i], b.err
+	}
+}
+
+// address returns a thunk giving the address with id, or nil if there is
+// none, reading each address once per request.
+func (l *loaders) address(ctx context.Context, id string) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		if r, ok := l.addresses[id]; ok {
+			return r.a, r.err
+		}
+		r := addressResult{}
+		as, err := l.s.GetAddresses(ctx, id)
+		switch {
+		case err == db.ErrNotFound:
+		case err != nil:
+			r.err = err
+		case len(as) > 0:
+			r.a = as[0]
+		}
+		l.addresses[id] = r
+		return r.a, r.err
+	}
+}
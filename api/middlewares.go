@@ -15,11 +15,18 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/tracing"
 	"github.com/aheadaviation/Users/users"
 )
 
@@ -39,31 +46,36 @@ type loggingMiddleware struct {
 	logger log.Logger
 }
 
-func (mw loggingMiddleware) Login(username, password string) (user users.User, err error) {
+// log adds the request ID and caller carried by ctx to keyvals.
+func (mw loggingMiddleware) log(ctx context.Context, keyvals ...interface{}) {
+	mw.logger.Log(append(reqctx.Keyvals(ctx), keyvals...)...)
+}
+
+func (mw loggingMiddleware) Login(ctx context.Context, username, password string) (user users.User, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log(
+		mw.log(ctx,
 			"method", "Login",
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.Login(username, password)
+	return mw.next.Login(ctx, username, password)
 }
 
-func (mw loggingMiddleware) Register(username, password, email, first, last string) (string, error) {
+func (mw loggingMiddleware) Register(ctx context.Context, username, password, email, first, last string) (string, error) {
 	defer func(begin time.Time) {
-		mw.logger.Log(
+		mw.log(ctx,
 			"method", "Register",
 			"username", username,
 			"email", email,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.Register(username, password, email, first, last)
+	return mw.next.Register(ctx, username, password, email, first, last)
 }
 
-func (mw loggingMiddleware) PostUser(user users.User) (id string, err error) {
+func (mw loggingMiddleware) PostUser(ctx context.Context, user users.User) (id string, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log(
+		mw.log(ctx,
 			"method", "PostUser",
 			"username", user.Username,
 			"email", user.Email,
@@ -71,28 +83,42 @@ func (mw loggingMiddleware) PostUser(user users.User) (id string, err error) {
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.PostUser(user)
+	return mw.next.PostUser(ctx, user)
 }
 
-func (mw loggingMiddleware) GetUsers(id string) (u []users.User, err error) {
+func (mw loggingMiddleware) GetUsers(ctx context.Context, id string) (u []users.User, err error) {
 	defer func(begin time.Time) {
 		who := id
 		if who == "" {
 			who = "all"
 		}
-		mw.logger.Log(
+		mw.log(ctx,
 			"method", "GetUsers",
 			"id", who,
 			"result", len(u),
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.GetUsers(id)
+	return mw.next.GetUsers(ctx, id)
 }
 
-func (mw loggingMiddleware) PostAddress(a users.Address, id string) (string, error) {
+func (mw loggingMiddleware) SearchUsers(ctx context.Context, query string, offset, limit int) (u []users.User, total int, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log(
+		mw.log(ctx,
+			"method", "SearchUsers",
+			"offset", offset,
+			"limit", limit,
+			"result", len(u),
+			"total", total,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.SearchUsers(ctx, query, offset, limit)
+}
+
+func (mw loggingMiddleware) PostAddress(ctx context.Context, a users.Address, id string) (string, error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
 			"method", "PostAddress",
 			"street", a.Street,
 			"number", a.Number,
@@ -100,76 +126,209 @@ func (mw loggingMiddleware) PostAddress(a users.Address, id string) (string, err
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.PostAddress(a, id)
+	return mw.next.PostAddress(ctx, a, id)
 }
 
-func (mw loggingMiddleware) GetAddresses(id string) (a []users.Address, err error) {
+func (mw loggingMiddleware) GetAddresses(ctx context.Context, id string) (a []users.Address, err error) {
 	defer func(begin time.Time) {
 		who := id
 		if who == "" {
 			who = "all"
 		}
-		mw.logger.Log(
+		mw.log(ctx,
 			"method", "GetAddresses",
 			"id", who,
 			"result", len(a),
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.GetAddresses(id)
+	return mw.next.GetAddresses(ctx, id)
 }
 
-func (mw loggingMiddleware) PostCard(c users.Card, id string) (string, error) {
+func (mw loggingMiddleware) PostCard(ctx context.Context, c users.Card, id string) (string, error) {
 	defer func(begin time.Time) {
 		cc := c
 		cc.MaskCC()
-		mw.logger.Log(
+		mw.log(ctx,
 			"method", "PostCard",
 			"card", cc.LongNum,
 			"user", id,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.PostCard(c, id)
+	return mw.next.PostCard(ctx, c, id)
 }
 
-func (mw loggingMiddleware) GetCards(id string) (c []users.Card, err error) {
+func (mw loggingMiddleware) GetCards(ctx context.Context, id string) (c []users.Card, err error) {
 	defer func(begin time.Time) {
 		who := id
 		if who == "" {
 			who = "all"
 		}
-		mw.logger.Log(
+		mw.log(ctx,
 			"method", "GetCards",
 			"id", who,
 			"result", len(c),
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.GetCards(id)
+	return mw.next.GetCards(ctx, id)
+}
+
+func (mw loggingMiddleware) DeleteUser(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
+			"method", "DeleteUser",
+			"id", id,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.DeleteUser(ctx, id)
+}
+
+func (mw loggingMiddleware) DeleteAddress(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
+			"method", "DeleteAddress",
+			"id", id,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.DeleteAddress(ctx, id)
+}
+
+func (mw loggingMiddleware) DeleteCard(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
+			"method", "DeleteCard",
+			"id", id,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.DeleteCard(ctx, id)
+}
+
+func (mw loggingMiddleware) PostAddresses(ctx context.Context, as []users.Address, userids []string) (ids []string, errs []error, err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
+			"method", "PostAddresses",
+			"items", len(as),
+			"failed", db.CountErrors(errs),
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.PostAddresses(ctx, as, userids)
+}
+
+func (mw loggingMiddleware) PostCards(ctx context.Context, cs []users.Card, userids []string) (ids []string, errs []error, err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
+			"method", "PostCards",
+			"items", len(cs),
+			"failed", db.CountErrors(errs),
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.PostCards(ctx, cs, userids)
+}
+
+func (mw loggingMiddleware) DeleteUsers(ctx context.Context, ids []string) (errs []error, err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
+			"method", "DeleteUsers",
+			"items", len(ids),
+			"failed", db.CountErrors(errs),
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.DeleteUsers(ctx, ids)
+}
+
+func (mw loggingMiddleware) EraseUser(ctx context.Context, id string) (r users.ErasureReport, err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
+			"method", "EraseUser",
+			"id", id,
+			"verified", r.Verified,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.EraseUser(ctx, id)
 }
 
-func (mw loggingMiddleware) Delete(entity, id string) (err error) {
+func (mw loggingMiddleware) GetErasure(ctx context.Context, id string) (r users.ErasureReport, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log(
-			"method", "Delete",
-			"entity", entity,
+		mw.log(ctx,
+			"method", "GetErasure",
 			"id", id,
+			"verified", r.Verified,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.Delete(entity, id)
+	return mw.next.GetErasure(ctx, id)
 }
 
-func (mw loggingMiddleware) Health() (health []Health) {
+func (mw loggingMiddleware) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log(
+		mw.log(ctx,
+			"method", "SetDefaultAddress",
+			"user", userid,
+			"kind", kind,
+			"address", addressid,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.SetDefaultAddress(ctx, userid, kind, addressid)
+}
+
+func (mw loggingMiddleware) SetCardBillingAddress(ctx context.Context, cardid, addressid string) (err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
+			"method", "SetCardBillingAddress",
+			"card", cardid,
+			"address", addressid,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.SetCardBillingAddress(ctx, cardid, addressid)
+}
+
+func (mw loggingMiddleware) CreateTenant(ctx context.Context, t users.Tenant) (id string, err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
+			"method", "CreateTenant",
+			"id", t.ID,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.CreateTenant(ctx, t)
+}
+
+func (mw loggingMiddleware) GetTenants(ctx context.Context, id string) (ts []users.Tenant, err error) {
+	defer func(begin time.Time) {
+		who := id
+		if who == "" {
+			who = "all"
+		}
+		mw.log(ctx,
+			"method", "GetTenants",
+			"id", who,
+			"result", len(ts),
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.GetTenants(ctx, id)
+}
+
+func (mw loggingMiddleware) Health(ctx context.Context) (health []Health) {
+	defer func(begin time.Time) {
+		mw.log(ctx,
 			"method", "Health",
 			"result", len(health),
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.Health()
+	return mw.next.Health(ctx)
 }
 
 type instrumentingService struct {
@@ -178,6 +337,8 @@ type instrumentingService struct {
 	Service
 }
 
+// NewInstrumentingService records a count and latency for every call,
+// labelled by method and by error, "true" when the call failed.
 func NewInstrumentingService(requestCount metrics.Counter, requestLatency metrics.Histogram, s Service) Service {
 	return &instrumentingService{
 		requestCount:   requestCount,
@@ -186,92 +347,371 @@ func NewInstrumentingService(requestCount metrics.Counter, requestLatency metric
 	}
 }
 
-func (s *instrumentingService) Login(username, password string) (users.User, error) {
+func (s *instrumentingService) Login(ctx context.Context, username, password string) (user users.User, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "login", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.Login(ctx, username, password)
+}
+
+func (s *instrumentingService) Register(ctx context.Context, username, password, email, first, last string) (id string, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "register", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.Register(ctx, username, password, email, first, last)
+}
+
+func (s *instrumentingService) PostUser(ctx context.Context, user users.User) (id string, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "postUser", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.PostUser(ctx, user)
+}
+
+func (s *instrumentingService) GetUsers(ctx context.Context, id string) (u []users.User, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "login").Add(1)
-		s.requestLatency.With("method", "login").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "getUsers", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.Login(username, password)
+	return s.Service.GetUsers(ctx, id)
 }
 
-func (s *instrumentingService) Register(username, password, email, first, last string) (string, error) {
+func (s *instrumentingService) SearchUsers(ctx context.Context, query string, offset, limit int) (u []users.User, total int, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "register").Add(1)
-		s.requestLatency.With("method", "register").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "searchUsers", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.Register(username, password, email, first, last)
+	return s.Service.SearchUsers(ctx, query, offset, limit)
 }
 
-func (s *instrumentingService) PostUser(user users.User) (string, error) {
+func (s *instrumentingService) PostAddress(ctx context.Context, a users.Address, userid string) (id string, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "postUser").Add(1)
-		s.requestLatency.With("method", "postUser").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "postAddress", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.PostUser(user)
+	return s.Service.PostAddress(ctx, a, userid)
 }
 
-func (s *instrumentingService) GetUsers(id string) (u []users.User, err error) {
+func (s *instrumentingService) GetAddresses(ctx context.Context, id string) (a []users.Address, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "getUsers").Add(1)
-		s.requestLatency.With("method", "getUsers").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "getAddresses", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.GetUsers(id)
+	return s.Service.GetAddresses(ctx, id)
 }
 
-func (s *instrumentingService) PostAddress(a users.Address, id string) (string, error) {
+func (s *instrumentingService) PostCard(ctx context.Context, c users.Card, userid string) (id string, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "postAddress").Add(1)
-		s.requestLatency.With("method", "postAddress").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "postCard", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.PostAddress(a, id)
+	return s.Service.PostCard(ctx, c, userid)
 }
 
-func (s *instrumentingService) GetAddresses(id string) ([]users.Address, error) {
+func (s *instrumentingService) GetCards(ctx context.Context, id string) (c []users.Card, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "getAddresses").Add(1)
-		s.requestLatency.With("method", "getAddresses").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "getCards", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.GetAddresses(id)
+	return s.Service.GetCards(ctx, id)
 }
 
-func (s *instrumentingService) PostCard(c users.Card, id string) (string, error) {
+func (s *instrumentingService) DeleteUser(ctx context.Context, id string) (err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "postCard").Add(1)
-		s.requestLatency.With("method", "postCard").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "deleteUser", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.PostCard(c, id)
+	return s.Service.DeleteUser(ctx, id)
 }
 
-func (s *instrumentingService) GetCards(id string) ([]users.Card, error) {
+func (s *instrumentingService) DeleteAddress(ctx context.Context, id string) (err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "getCards").Add(1)
-		s.requestLatency.With("method", "getCards").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "deleteAddress", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.GetCards(id)
+	return s.Service.DeleteAddress(ctx, id)
 }
 
-func (s *instrumentingService) Delete(entity, id string) error {
+func (s *instrumentingService) DeleteCard(ctx context.Context, id string) (err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "delete").Add(1)
-		s.requestLatency.With("method", "delete").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "deleteCard", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.Delete(entity, id)
+	return s.Service.DeleteCard(ctx, id)
 }
 
-func (s *instrumentingService) Health() []Health {
+func (s *instrumentingService) PostAddresses(ctx context.Context, as []users.Address, userids []string) (ids []string, errs []error, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "health").Add(1)
-		s.requestLatency.With("method", "health").Observe(time.Since(begin).Seconds())
+		lvs := []string{"method", "postAddresses", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.Health()
+	return s.Service.PostAddresses(ctx, as, userids)
+}
+
+func (s *instrumentingService) PostCards(ctx context.Context, cs []users.Card, userids []string) (ids []string, errs []error, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "postCards", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.PostCards(ctx, cs, userids)
+}
+
+func (s *instrumentingService) DeleteUsers(ctx context.Context, ids []string) (errs []error, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "deleteUsers", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.DeleteUsers(ctx, ids)
+}
+
+func (s *instrumentingService) EraseUser(ctx context.Context, id string) (r users.ErasureReport, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "eraseUser", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.EraseUser(ctx, id)
+}
+
+func (s *instrumentingService) GetErasure(ctx context.Context, id string) (r users.ErasureReport, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "getErasure", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.GetErasure(ctx, id)
+}
+
+func (s *instrumentingService) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "setDefaultAddress", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.SetDefaultAddress(ctx, userid, kind, addressid)
+}
+
+func (s *instrumentingService) SetCardBillingAddress(ctx context.Context, cardid, addressid string) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "setCardBillingAddress", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.SetCardBillingAddress(ctx, cardid, addressid)
+}
+
+func (s *instrumentingService) CreateTenant(ctx context.Context, t users.Tenant) (id string, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "createTenant", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.CreateTenant(ctx, t)
+}
+
+func (s *instrumentingService) GetTenants(ctx context.Context, id string) (ts []users.Tenant, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "getTenants", "error", fmt.Sprint(err != nil)}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.GetTenants(ctx, id)
+}
+
+func (s *instrumentingService) Health(ctx context.Context) []Health {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "health", "error", "false"}
+		s.requestCount.With(lvs...).Add(1)
+		s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.Health(ctx)
+}
+
+// TracingMiddleware wraps each call in a span that joins the trace of the
+// request.
+func TracingMiddleware() Middleware {
+	return func(next Service) Service {
+		return tracingMiddleware{next: next}
+	}
+}
+
+type tracingMiddleware struct {
+	next Service
+}
+
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "service."+method,
+		trace.WithAttributes(attribute.String("service", "user")))
+}
+
+func (mw tracingMiddleware) Login(ctx context.Context, username, password string) (user users.User, err error) {
+	ctx, span := startSpan(ctx, "Login")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.Login(ctx, username, password)
+}
+
+func (mw tracingMiddleware) Register(ctx context.Context, username, password, email, first, last string) (id string, err error) {
+	ctx, span := startSpan(ctx, "Register")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.Register(ctx, username, password, email, first, last)
+}
+
+func (mw tracingMiddleware) PostUser(ctx context.Context, user users.User) (id string, err error) {
+	ctx, span := startSpan(ctx, "PostUser")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.PostUser(ctx, user)
+}
+
+func (mw tracingMiddleware) GetUsers(ctx context.Context, id string) (u []users.User, err error) {
+	ctx, span := startSpan(ctx, "GetUsers")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.GetUsers(ctx, id)
+}
+
+func (mw tracingMiddleware) SearchUsers(ctx context.Context, query string, offset, limit int) (u []users.User, total int, err error) {
+	ctx, span := startSpan(ctx, "SearchUsers")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.SearchUsers(ctx, query, offset, limit)
+}
+
+func (mw tracingMiddleware) PostAddress(ctx context.Context, a users.Address, userid string) (id string, err error) {
+	ctx, span := startSpan(ctx, "PostAddress")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.PostAddress(ctx, a, userid)
+}
+
+func (mw tracingMiddleware) GetAddresses(ctx context.Context, id string) (a []users.Address, err error) {
+	ctx, span := startSpan(ctx, "GetAddresses")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.GetAddresses(ctx, id)
+}
+
+func (mw tracingMiddleware) PostCard(ctx context.Context, c users.Card, userid string) (id string, err error) {
+	ctx, span := startSpan(ctx, "PostCard")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.PostCard(ctx, c, userid)
+}
+
+func (mw tracingMiddleware) GetCards(ctx context.Context, id string) (c []users.Card, err error) {
+	ctx, span := startSpan(ctx, "GetCards")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.GetCards(ctx, id)
+}
+
+func (mw tracingMiddleware) DeleteUser(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteUser")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.DeleteUser(ctx, id)
+}
+
+func (mw tracingMiddleware) DeleteAddress(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteAddress")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.DeleteAddress(ctx, id)
+}
+
+func (mw tracingMiddleware) DeleteCard(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteCard")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.DeleteCard(ctx, id)
+}
+
+func (mw tracingMiddleware) PostAddresses(ctx context.Context, as []users.Address, userids []string) (ids []string, errs []error, err error) {
+	ctx, span := startSpan(ctx, "PostAddresses")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.PostAddresses(ctx, as, userids)
+}
+
+func (mw tracingMiddleware) PostCards(ctx context.Context, cs []users.Card, userids []string) (ids []string, errs []error, err error) {
+	ctx, span := startSpan(ctx, "PostCards")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.PostCards(ctx, cs, userids)
+}
+
+func (mw tracingMiddleware) DeleteUsers(ctx context.Context, ids []string) (errs []error, err error) {
+	ctx, span := startSpan(ctx, "DeleteUsers")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.DeleteUsers(ctx, ids)
+}
+
+func (mw tracingMiddleware) EraseUser(ctx context.Context, id string) (r users.ErasureReport, err error) {
+	ctx, span := startSpan(ctx, "EraseUser")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.EraseUser(ctx, id)
+}
+
+func (mw tracingMiddleware) GetErasure(ctx context.Context, id string) (r users.ErasureReport, err error) {
+	ctx, span := startSpan(ctx, "GetErasure")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.GetErasure(ctx, id)
+}
+
+func (mw tracingMiddleware) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) (err error) {
+	ctx, span := startSpan(ctx, "SetDefaultAddress")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.SetDefaultAddress(ctx, userid, kind, addressid)
+}
+
+func (mw tracingMiddleware) SetCardBillingAddress(ctx context.Context, cardid, addressid string) (err error) {
+	ctx, span := startSpan(ctx, "SetCardBillingAddress")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.SetCardBillingAddress(ctx, cardid, addressid)
+}
+
+func (mw tracingMiddleware) CreateTenant(ctx context.Context, t users.Tenant) (id string, err error) {
+	ctx, span := startSpan(ctx, "CreateTenant")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.CreateTenant(ctx, t)
+}
+
+func (mw tracingMiddleware) GetTenants(ctx context.Context, id string) (ts []users.Tenant, err error) {
+	ctx, span := startSpan(ctx, "GetTenants")
+	defer func() { tracing.End(span, err) }()
+	return mw.next.GetTenants(ctx, id)
+}
+
+func (mw tracingMiddleware) Health(ctx context.Context) []Health {
+	ctx, span := startSpan(ctx, "Health")
+	defer span.End()
+	return mw.next.Health(ctx)
 }
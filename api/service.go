@@ -15,31 +15,117 @@
 package api
 
 import (
-	"crypto/sha1"
+	"context"
 	"errors"
-	"fmt"
-	"io"
 	"time"
 
 	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/events"
+	"github.com/aheadaviation/Users/health"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/tenant"
 	"github.com/aheadaviation/Users/users"
 )
 
 var (
 	ErrUnauthorized = errors.New("Unauthorized")
+	ErrDisabled     = errors.New("Account disabled")
+	ErrForbidden    = errors.New("Forbidden")
+	ErrNoSuchTenant = errors.New("Tenant not found")
 )
 
+// adminRoles are the caller roles allowed to use the admin API.
+var adminRoles = []string{"admin"}
+
+// SetAdminRoles sets the caller roles allowed to use the admin API.
+func SetAdminRoles(roles []string) {
+	adminRoles = roles
+}
+
+// tenants learns of tenants created here, so that they can be used at once.
+var tenants *tenant.Registry
+
+// SetTenantRegistry sets the registry told of tenants created through the
+// API.
+func SetTenantRegistry(r *tenant.Registry) {
+	tenants = r
+}
+
+// authorizeAdmin fails unless the caller has one of the admin roles.
+func authorizeAdmin(ctx context.Context) error {
+	c, ok := reqctx.CallerFrom(ctx)
+	if !ok {
+		return ErrUnauthorized
+	}
+	for _, r := range adminRoles {
+		if c.HasRole(r) {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+// authorizeOwner returns the customer the caller may act for: the caller
+// itself, or "" for admin callers, who may act for every customer.
+func authorizeOwner(ctx context.Context) (string, error) {
+	err := authorizeAdmin(ctx)
+	if err != ErrForbidden {
+		return "", err
+	}
+	c, _ := reqctx.CallerFrom(ctx)
+	if c.ID == "" {
+		return "", ErrForbidden
+	}
+	return c.ID, nil
+}
+
+// authorizeCustomer fails unless the caller is an admin or the customer id.
+func authorizeCustomer(ctx context.Context, id string) error {
+	owner, err := authorizeOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != id {
+		return ErrForbidden
+	}
+	return nil
+}
+
 type Service interface {
-	Login(username, password string) (users.User, error)
-	Register(username, password, email, first, last string) (string, error)
-	GetUsers(id string) ([]users.User, error)
-	PostUser(u users.User) (string, error)
-	GetAddresses(id string) ([]users.Address, error)
-	PostAddress(a users.Address, userid string) (string, error)
-	GetCards(id string) ([]users.Card, error)
-	PostCard(c users.Card, userid string) (string, error)
-	Delete(entity, id string) error
-	Health() []Health
+	Login(ctx context.Context, username, password string) (users.User, error)
+	Register(ctx context.Context, username, password, email, first, last string) (string, error)
+	GetUsers(ctx context.Context, id string) ([]users.User, error)
+	SearchUsers(ctx context.Context, query string, offset, limit int) ([]users.User, int, error)
+	PostUser(ctx context.Context, u users.User) (string, error)
+	GetAddresses(ctx context.Context, id string) ([]users.Address, error)
+	PostAddress(ctx context.Context, a users.Address, userid string) (string, error)
+	GetCards(ctx context.Context, id string) ([]users.Card, error)
+	PostCard(ctx context.Context, c users.Card, userid string) (string, error)
+	// DeleteUser, DeleteAddress and DeleteCard are open to admin callers and
+	// to the customer owning what is deleted.
+	DeleteUser(ctx context.Context, id string) error
+	DeleteAddress(ctx context.Context, id string) error
+	DeleteCard(ctx context.Context, id string) error
+	// PostAddresses creates the addresses at once, each for the customer of
+	// the same index in userids. It returns the ID or the failure of each
+	// address, failing as a whole only when the batch could not be tried.
+	PostAddresses(ctx context.Context, as []users.Address, userids []string) ([]string, []error, error)
+	// PostCards creates the cards at once like PostAddresses.
+	PostCards(ctx context.Context, cs []users.Card, userids []string) ([]string, []error, error)
+	// DeleteUsers deletes the customers at once, returning the failure of
+	// each like PostAddresses.
+	DeleteUsers(ctx context.Context, ids []string) ([]error, error)
+	// EraseUser and GetErasure are open to admin callers and to the
+	// customer itself.
+	EraseUser(ctx context.Context, id string) (users.ErasureReport, error)
+	GetErasure(ctx context.Context, id string) (users.ErasureReport, error)
+	// SetDefaultAddress and SetCardBillingAddress are open to admin callers
+	// and to the customer owning the addresses and card.
+	SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error
+	SetCardBillingAddress(ctx context.Context, cardid, addressid string) error
+	CreateTenant(ctx context.Context, t users.Tenant) (string, error)
+	GetTenants(ctx context.Context, id string) ([]users.Tenant, error)
+	Health(ctx context.Context) []Health
 }
 
 func NewFixedService() Service {
@@ -48,116 +134,330 @@ func NewFixedService() Service {
 
 type fixedService struct{}
 
+// Health is one entry of the /health report. Status is OK, err when a
+// critical check fails or degraded when another check fails.
 type Health struct {
 	Service string `json:"service"`
 	Status  string `json:"status"`
 	Time    string `json:"time"`
+	Error   string `json:"error,omitempty"`
 }
 
-func (s *fixedService) Login(username, password string) (users.User, error) {
-	u, err := db.GetUserByName(username)
+func (s *fixedService) Login(ctx context.Context, username, password string) (users.User, error) {
+	u, err := db.GetUserByName(ctx, username)
 	if err != nil {
 		return users.New(), err
 	}
-	if u.Password != calculatePassHash(password, u.Salt) {
+	if u.Password != users.HashPassword(password, u.Salt) {
 		return users.New(), ErrUnauthorized
 	}
+	if u.DisabledAt != nil {
+		return users.New(), ErrDisabled
+	}
 	return u, nil
 }
 
-func (s *fixedService) Register(username, password, email, first, last string) (string, error) {
+func (s *fixedService) Register(ctx context.Context, username, password, email, first, last string) (string, error) {
 	u := users.New()
 	u.Username = username
-	u.Password = calculatePassHash(password, u.Salt)
+	u.Password = users.HashPassword(password, u.Salt)
 	u.Email = email
 	u.FirstName = first
 	u.LastName = last
-	err := db.CreateUser(&u)
+	err := db.CreateUser(ctx, &u)
 	return u.UserID, err
 }
 
-func (s *fixedService) GetUsers(id string) ([]users.User, error) {
+func (s *fixedService) GetUsers(ctx context.Context, id string) ([]users.User, error) {
 	if id == "" {
-		us, err := db.GetUsers()
+		us, err := db.GetUsers(ctx)
 		for k, u := range us {
 			us[k] = u
 		}
 		return us, err
 	}
-	u, err := db.GetUser(id)
+	u, err := db.GetUser(ctx, id)
 	return []users.User{u}, err
 }
 
-func (s *fixedService) PostUser(u users.User) (string, error) {
+// SearchUsers is only open to admin callers.
+func (s *fixedService) SearchUsers(ctx context.Context, query string, offset, limit int) ([]users.User, int, error) {
+	if err := authorizeAdmin(ctx); err != nil {
+		return nil, 0, err
+	}
+	if len(users.SearchTerms(query)) == 0 {
+		return nil, 0, users.FieldErrors{"q": "must contain a letter or digit"}
+	}
+	return db.SearchUsers(ctx, query, offset, limit)
+}
+
+func (s *fixedService) PostUser(ctx context.Context, u users.User) (string, error) {
 	u.NewSalt()
-	u.Password = calculatePassHash(u.Password, u.Salt)
-	err := db.CreateUser(&u)
+	u.Password = users.HashPassword(u.Password, u.Salt)
+	err := db.CreateUser(ctx, &u)
 	return u.UserID, err
 }
 
-func (s *fixedService) GetAddresses(id string) ([]users.Address, error) {
+func (s *fixedService) GetAddresses(ctx context.Context, id string) ([]users.Address, error) {
 	if id == "" {
-		as, err := db.GetAddresses()
+		as, err := db.GetAddresses(ctx)
 		for k, a := range as {
-			a.AddLinks()
+			a.AddLinks(users.LinkBaseFrom(ctx))
 			as[k] = a
 		}
 		return as, err
 	}
-	a, err := db.GetAddress(id)
-	a.AddLinks()
+	a, err := db.GetAddress(ctx, id)
+	a.AddLinks(users.LinkBaseFrom(ctx))
 	return []users.Address{a}, err
 }
 
-func (s *fixedService) PostAddress(a users.Address, userid string) (string, error) {
-	err := db.CreateAddress(&a, userid)
+func (s *fixedService) PostAddress(ctx context.Context, a users.Address, userid string) (string, error) {
+	if err := a.Normalize(); err != nil {
+		return "", err
+	}
+	err := db.CreateAddress(ctx, &a, userid)
 	return a.ID, err
 }
 
-func (s *fixedService) GetCards(id string) ([]users.Card, error) {
+func (s *fixedService) GetCards(ctx context.Context, id string) ([]users.Card, error) {
 	if id == "" {
-		cs, err := db.GetCards()
+		cs, err := db.GetCards(ctx)
 		for k, c := range cs {
-			c.AddLinks()
+			c.AddLinks(users.LinkBaseFrom(ctx))
 			cs[k] = c
 		}
 		return cs, err
 	}
-	c, err := db.GetCard(id)
-	c.AddLinks()
+	c, err := db.GetCard(ctx, id)
+	c.AddLinks(users.LinkBaseFrom(ctx))
 	return []users.Card{c}, err
 }
 
-func (s *fixedService) PostCard(c users.Card, userid string) (string, error) {
-	err := db.CreateCard(&c, userid)
+func (s *fixedService) PostCard(ctx context.Context, c users.Card, userid string) (string, error) {
+	if err := c.Validate(time.Now()); err != nil {
+		return "", err
+	}
+	err := db.CreateCard(ctx, &c, userid)
 	return c.ID, err
 }
 
-func (s *fixedService) Delete(entity, id string) error {
-	return db.Delete(entity, id)
+func (s *fixedService) DeleteUser(ctx context.Context, id string) error {
+	if err := authorizeCustomer(ctx, id); err != nil {
+		return err
+	}
+	return db.DeleteUser(ctx, id)
+}
+
+// DeleteAddress and DeleteCard report what the caller does not own as not
+// found, so that its existence is not revealed.
+func (s *fixedService) DeleteAddress(ctx context.Context, id string) error {
+	owner, err := authorizeOwner(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteAddress(ctx, id, owner)
+}
+
+func (s *fixedService) DeleteCard(ctx context.Context, id string) error {
+	owner, err := authorizeOwner(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteCard(ctx, id, owner)
+}
+
+func (s *fixedService) PostAddresses(ctx context.Context, as []users.Address, userids []string) ([]string, []error, error) {
+	if err := checkBatch("items", len(as)); err != nil {
+		return nil, nil, err
+	}
+	errs := make([]error, len(as))
+	valid := make([]users.Address, 0, len(as))
+	owners := make([]string, 0, len(as))
+	idx := make([]int, 0, len(as))
+	for k, a := range as {
+		if errs[k] = a.Normalize(); errs[k] == nil {
+			valid, owners, idx = append(valid, a), append(owners, userids[k]), append(idx, k)
+		}
+	}
+	ids := make([]string, len(as))
+	if len(valid) == 0 {
+		return ids, errs, nil
+	}
+	dberrs, err := db.CreateAddresses(ctx, valid, owners)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, k := range idx {
+		if errs[k] = dberrs[i]; errs[k] == nil {
+			ids[k] = valid[i].ID
+		}
+	}
+	return ids, errs, nil
+}
+
+func (s *fixedService) PostCards(ctx context.Context, cs []users.Card, userids []string) ([]string, []error, error) {
+	if err := checkBatch("items", len(cs)); err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	errs := make([]error, len(cs))
+	valid := make([]users.Card, 0, len(cs))
+	owners := make([]string, 0, len(cs))
+	idx := make([]int, 0, len(cs))
+	for k, c := range cs {
+		if errs[k] = c.Validate(now); errs[k] == nil {
+			valid, owners, idx = append(valid, c), append(owners, userids[k]), append(idx, k)
+		}
+	}
+	ids := make([]string, len(cs))
+	if len(valid) == 0 {
+		return ids, errs, nil
+	}
+	dberrs, err := db.CreateCards(ctx, valid, owners)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, k := range idx {
+		if errs[k] = dberrs[i]; errs[k] == nil {
+			ids[k] = valid[i].ID
+		}
+	}
+	return ids, errs, nil
+}
+
+// DeleteUsers fails the customers the caller may not delete, as
+// DeleteUser would.
+func (s *fixedService) DeleteUsers(ctx context.Context, ids []string) ([]error, error) {
+	if err := checkBatch("ids", len(ids)); err != nil {
+		return nil, err
+	}
+	owner, err := authorizeOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]error, len(ids))
+	allowed := make([]string, 0, len(ids))
+	idx := make([]int, 0, len(ids))
+	for k, id := range ids {
+		if owner != "" && owner != id {
+			errs[k] = ErrForbidden
+			continue
+		}
+		allowed, idx = append(allowed, id), append(idx, k)
+	}
+	if len(allowed) == 0 {
+		return errs, nil
+	}
+	dberrs, err := db.DeleteUsers(ctx, allowed)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range idx {
+		errs[k] = dberrs[i]
+	}
+	return errs, nil
+}
+
+func (s *fixedService) EraseUser(ctx context.Context, id string) (users.ErasureReport, error) {
+	if err := authorizeCustomer(ctx, id); err != nil {
+		return users.ErasureReport{}, err
+	}
+	u, err := db.EraseUser(ctx, id)
+	if err != nil {
+		return users.ErasureReport{}, err
+	}
+	events.Publish(events.New(events.CustomerErased, u.UserID))
+	return u.ErasureReport(), nil
 }
 
-func (s *fixedService) Health() []Health {
-	var health []Health
-	dbstatus := "OK"
+func (s *fixedService) GetErasure(ctx context.Context, id string) (users.ErasureReport, error) {
+	if err := authorizeCustomer(ctx, id); err != nil {
+		return users.ErasureReport{}, err
+	}
+	u, err := db.GetUser(ctx, id)
+	if err != nil {
+		return users.ErasureReport{}, err
+	}
+	err = db.GetUserAttributes(ctx, &u)
+	if err != nil {
+		return users.ErasureReport{}, err
+	}
+	return u.ErasureReport(), nil
+}
 
-	err := db.Ping()
+func (s *fixedService) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error {
+	if err := authorizeCustomer(ctx, userid); err != nil {
+		return err
+	}
+	if kind != users.KindShipping && kind != users.KindBilling {
+		return users.FieldErrors{"kind": "must be shipping or billing"}
+	}
+	return db.SetDefaultAddress(ctx, userid, kind, addressid)
+}
+
+func (s *fixedService) SetCardBillingAddress(ctx context.Context, cardid, addressid string) error {
+	owner, err := authorizeOwner(ctx)
 	if err != nil {
-		dbstatus = "err"
+		return err
 	}
+	return db.SetCardBillingAddress(ctx, cardid, addressid, owner)
+}
 
-	app := Health{"user", "OK", time.Now().String()}
-	db := Health{"user-db", dbstatus, time.Now().String()}
+// CreateTenant is only open to admin callers.
+func (s *fixedService) CreateTenant(ctx context.Context, t users.Tenant) (string, error) {
+	if err := authorizeAdmin(ctx); err != nil {
+		return "", err
+	}
+	if err := t.Validate(); err != nil {
+		return "", err
+	}
+	if err := db.CreateTenant(ctx, &t); err != nil {
+		return "", err
+	}
+	if tenants != nil {
+		tenants.Add(t)
+	}
+	return t.ID, nil
+}
 
-	health = append(health, app)
-	health = append(health, db)
+// GetTenants is only open to admin callers.
+func (s *fixedService) GetTenants(ctx context.Context, id string) ([]users.Tenant, error) {
+	if err := authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	ts, err := db.GetTenants(ctx)
+	if err != nil || id == "" {
+		return ts, err
+	}
+	for _, t := range ts {
+		if t.ID == id {
+			return []users.Tenant{t}, nil
+		}
+	}
+	return nil, ErrNoSuchTenant
+}
 
-	return health
+// Health reports the service itself and each registered health check.
+func (s *fixedService) Health(ctx context.Context) []Health {
+	hs := []Health{{Service: "user", Status: "OK", Time: time.Now().String()}}
+	for _, c := range health.Run().Checks {
+		h := Health{Service: healthNames[c.Name], Status: "OK", Time: c.CheckedAt.Local().String(), Error: c.Error}
+		if h.Service == "" {
+			h.Service = "user-" + c.Name
+		}
+		if c.Status != health.StatusUp {
+			h.Status = "degraded"
+			if c.Critical {
+				h.Status = "err"
+			}
+		}
+		hs = append(hs, h)
+	}
+	return hs
 }
 
-func calculatePassHash(pass, salt string) string {
-	h := sha1.New()
-	io.WriteString(h, salt)
-	io.WriteString(h, pass)
-	return fmt.Sprintf("%x", h.Sum(nil))
+// healthNames keeps the names /health used before checks were pluggable.
+var healthNames = map[string]string{
+	"database": "user-db",
 }
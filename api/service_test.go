@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/reqctx"
+)
+
+// deleteDatabase keeps the address a1 and card c1 of the customer u1 and
+// records what is deleted or changed.
+type deleteDatabase struct {
+	db.Database
+	deleted []string
+	changed []string
+}
+
+func (d *deleteDatabase) DeleteUser(ctx context.Context, id string) error {
+	if id != "u1" {
+		return db.ErrNotFound
+	}
+	d.deleted = append(d.deleted, "customers/"+id)
+	return nil
+}
+
+func (d *deleteDatabase) DeleteAddress(ctx context.Context, id, userid string) error {
+	if id != "a1" || (userid != "" && userid != "u1") {
+		return db.ErrNotFound
+	}
+	d.deleted = append(d.deleted, "addresses/"+id)
+	return nil
+}
+
+func (d *deleteDatabase) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error {
+	d.changed = append(d.changed, "customers/"+userid)
+	return nil
+}
+
+func (d *deleteDatabase) SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) error {
+	if cardid != "c1" || (userid != "" && userid != "u1") {
+		return db.ErrNotFound
+	}
+	d.changed = append(d.changed, "cards/"+cardid)
+	return nil
+}
+
+func TestDelete(t *testing.T) {
+
+	Convey("Given the API over a database with one customer, address and card", t, func() {
+		d := &deleteDatabase{}
+		db.DefaultDb = d
+		r := MakeHTTPHandler(MakeEndpoints(NewFixedService()), log.NewNopLogger())
+		del := func(path, caller, roles string) int {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("DELETE", path, nil)
+			if caller != "" {
+				req.Header.Set(reqctx.CallerIDHeader, caller)
+				req.Header.Set(reqctx.CallerRolesHeader, roles)
+			}
+			r.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		Convey("When the owner deletes its address and itself", func() {
+			address := del("/api/v2/addresses/a1", "u1", "customer")
+			customer := del("/api/v2/customers/u1", "u1", "customer")
+
+			Convey("Then both are deleted", func() {
+				So(address, ShouldEqual, http.StatusNoContent)
+				So(customer, ShouldEqual, http.StatusNoContent)
+				So(d.deleted, ShouldResemble, []string{"addresses/a1", "customers/u1"})
+			})
+		})
+
+		Convey("When another customer deletes them", func() {
+			address := del("/addresses/a1", "u2", "customer")
+			customer := del("/customers/u1", "u2", "customer")
+
+			Convey("Then the address is not found and the customer forbidden", func() {
+				So(address, ShouldEqual, http.StatusNotFound)
+				So(customer, ShouldEqual, http.StatusForbidden)
+				So(d.deleted, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When an admin deletes a missing customer", func() {
+			code := del("/customers/u9", "root", "admin")
+
+			Convey("Then it is not found", func() {
+				So(code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When another customer or an unknown caller erases the customer", func() {
+			other := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/customers/u1/erasure", nil)
+			req.Header.Set(reqctx.CallerIDHeader, "u2")
+			r.ServeHTTP(other, req)
+			anonymous := httptest.NewRecorder()
+			r.ServeHTTP(anonymous, httptest.NewRequest("GET", "/customers/u1/erasure", nil))
+
+			Convey("Then it is refused before reaching the database", func() {
+				So(other.Code, ShouldEqual, http.StatusForbidden)
+				So(anonymous.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+
+		Convey("When defaults and billing addresses are changed", func() {
+			put := func(path, caller string) int {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("PUT", path, strings.NewReader(`{"address":"a1"}`))
+				if caller != "" {
+					req.Header.Set(reqctx.CallerIDHeader, caller)
+				}
+				r.ServeHTTP(w, req)
+				return w.Code
+			}
+			owner := []int{put("/customers/u1/defaults/shipping", "u1"), put("/cards/c1/billing-address", "u1")}
+			other := []int{put("/customers/u1/defaults/billing", "u2"), put("/cards/c1/billing-address", "u2")}
+			anonymous := put("/customers/u1/defaults/billing", "")
+
+			Convey("Then only the owner changes them", func() {
+				So(owner[0], ShouldBeLessThan, 300)
+				So(owner[1], ShouldBeLessThan, 300)
+				So(other, ShouldResemble, []int{http.StatusForbidden, http.StatusNotFound})
+				So(anonymous, ShouldEqual, http.StatusUnauthorized)
+				So(d.changed, ShouldResemble, []string{"customers/u1", "cards/c1"})
+			})
+		})
+
+		Convey("When the caller is unknown", func() {
+			code := del("/addresses/a1", "", "")
+
+			Convey("Then it is refused", func() {
+				So(code, ShouldEqual, http.StatusUnauthorized)
+				So(d.deleted, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When anything other than a customer, address or card is deleted", func() {
+			code := del("/tenants/default", "root", "admin")
+
+			Convey("Then no route takes it", func() {
+				So(code, ShouldBeIn, []int{http.StatusNotFound, http.StatusMethodNotAllowed})
+				So(d.deleted, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -18,15 +18,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/health"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/tenant"
+	"github.com/aheadaviation/Users/tracing"
 	"github.com/aheadaviation/Users/users"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/tracing/opentracing"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
-	stdopentracing "github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -34,90 +40,228 @@ var (
 	ErrInvalidRequest = errors.New("Invalid request")
 )
 
-func MakeHTTPHandler(e Endpoints, logger log.Logger, tracer stdopentracing.Tracer) *mux.Router {
+// MakeHTTPHandler serves version 2 of the API under V2Prefix and version 1
+// under V1Prefix and at the root.
+func MakeHTTPHandler(e Endpoints, logger log.Logger) *mux.Router {
 	r := mux.NewRouter().StrictSlash(false)
+	r.Use(tracing.HTTPMiddleware("/health/", "/metrics"))
+	r.Use(reqctx.HTTPMiddleware)
+	v2r := r.PathPrefix(V2Prefix).Subrouter()
+	makeRoutes(v2r, e, logger, v2)
+	v2r.PathPrefix("/").HandlerFunc(notFoundV2)
+	makeRoutes(r.PathPrefix(V1Prefix).Subrouter(), e, logger, v1)
+	makeRoutes(r, e, logger, v1)
+	r.Methods("GET").Path("/health/live").Handler(health.LiveHandler())
+	r.Methods("GET").Path("/health/ready").Handler(health.DefaultRegistry.ReadyHandler())
+	return r
+}
+
+// makeRoutes adds the routes of one version of the API to r.
+func makeRoutes(r *mux.Router, e Endpoints, logger log.Logger, ver version) {
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorLogger(logger),
-		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerErrorEncoder(ver.encodeError),
 	}
 
 	r.Methods("GET").Path("/login").Handler(httptransport.NewServer(
 		e.LoginEndpoint,
 		decodeLoginRequest,
-		encodeResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "GET /login", logger)))...,
+		ver.encodeResponse,
+		options...,
 	))
 	r.Methods("POST").Path("/register").Handler(httptransport.NewServer(
 		e.RegisterEndpoint,
 		decodeRegisterRequest,
-		encodeResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "POST /register", logger)))...,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/customers/{id}/erasure").Handler(httptransport.NewServer(
+		e.ErasureEndpoint,
+		decodeErasureRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/customers/{id}/erasure").Handler(httptransport.NewServer(
+		e.ErasureGetEndpoint,
+		decodeErasureRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/customers/{id}/defaults/{kind}").Handler(httptransport.NewServer(
+		e.DefaultAddressEndpoint,
+		decodeDefaultAddressRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/cards/{id}/billing-address").Handler(httptransport.NewServer(
+		e.CardBillingAddressEndpoint,
+		decodeCardBillingAddressRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/rels/{rel}").Handler(relHandler(ver))
+	r.Methods("GET").Path("/customers/search").Handler(httptransport.NewServer(
+		e.UserSearchEndpoint,
+		decodeSearchRequest,
+		ver.encodeResponse,
+		options...,
 	))
 	r.Methods("GET").PathPrefix("/customers").Handler(httptransport.NewServer(
 		e.UserGetEndpoint,
 		decodeGetRequest,
-		encodeResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "GET /customers", logger)))...,
+		ver.encodeResponse,
+		options...,
 	))
 	r.Methods("GET").PathPrefix("/cards").Handler(httptransport.NewServer(
 		e.CardGetEndpoint,
 		decodeGetRequest,
-		encodeResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "GET /cards", logger)))...,
+		ver.encodeResponse,
+		options...,
 	))
 	r.Methods("GET").PathPrefix("/addresses").Handler(httptransport.NewServer(
 		e.AddressGetEndpoint,
 		decodeGetRequest,
-		encodeResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "GET /addresses", logger)))...,
+		ver.encodeResponse,
+		options...,
 	))
 	r.Methods("POST").Path("/customers").Handler(httptransport.NewServer(
 		e.UserPostEndpoint,
 		decodeUserRequest,
-		encodeResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "POST /customers", logger)))...,
+		ver.encodeResponse,
+		options...,
 	))
 	r.Methods("POST").Path("/addresses").Handler(httptransport.NewServer(
 		e.AddressPostEndpoint,
 		decodeAddressRequest,
-		encodeResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "POST /addresses", logger)))...,
+		ver.encodeResponse,
+		options...,
 	))
 	r.Methods("POST").Path("/cards").Handler(httptransport.NewServer(
 		e.CardPostEndpoint,
 		decodeCardRequest,
-		encodeResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "POST /cards", logger)))...,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/addresses:batch").Handler(httptransport.NewServer(
+		e.AddressesPostEndpoint,
+		decodeAddressesRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/cards:batch").Handler(httptransport.NewServer(
+		e.CardsPostEndpoint,
+		decodeCardsRequest,
+		ver.encodeResponse,
+		options...,
 	))
-	r.Methods("DELETE").PathPrefix("/").Handler(httptransport.NewServer(
-		e.DeleteEndpoint,
+	r.Methods("POST").Path("/customers:batchDelete").Handler(httptransport.NewServer(
+		e.UsersDeleteEndpoint,
+		decodeUsersDeleteRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/customers/{id}").Handler(httptransport.NewServer(
+		e.UserDeleteEndpoint,
 		decodeDeleteRequest,
-		encodeResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "DELETE /", logger)))...,
+		ver.encodeResponse,
+		options...,
 	))
-	r.Methods("GET").Path("/health").Handler(httptransport.NewServer(
-		e.HealthEndpoint,
-		decodeHealthRequest,
-		encodeHealthResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "GET /health", logger)))...,
+	r.Methods("DELETE").Path("/addresses/{id}").Handler(httptransport.NewServer(
+		e.AddressDeleteEndpoint,
+		decodeDeleteRequest,
+		ver.encodeResponse,
+		options...,
 	))
-	r.Handle("/metrics", promhttp.Handler())
-	return r
+	r.Methods("DELETE").Path("/cards/{id}").Handler(httptransport.NewServer(
+		e.CardDeleteEndpoint,
+		decodeDeleteRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/tenants").Handler(httptransport.NewServer(
+		e.TenantPostEndpoint,
+		decodeTenantRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/tenants").Handler(httptransport.NewServer(
+		e.TenantGetEndpoint,
+		decodeGetRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/tenants/{id}").Handler(httptransport.NewServer(
+		e.TenantGetEndpoint,
+		decodeGetRequest,
+		ver.encodeResponse,
+		options...,
+	))
+	if ver.legacy {
+		r.Methods("GET").Path("/health").Handler(httptransport.NewServer(
+			e.HealthEndpoint,
+			decodeHealthRequest,
+			encodeHealthResponse,
+			options...,
+		))
+		r.Handle("/metrics", promhttp.Handler())
+	}
 }
 
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	code, fields := errorStatus(err, w)
+	body := map[string]interface{}{
+		"error": err.Error(),
+	}
+	if fields != nil {
+		body["fields"] = fields
+	}
+	body["status_code"] = code
+	body["status_text"] = http.StatusText(code)
+	w.Header().Set("Content-Type", "application/hal+json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// errorStatus returns the status answering err and the fields it names, if
+// any, setting the headers that go with the status.
+func errorStatus(err error, w http.ResponseWriter) (int, users.FieldErrors) {
+	code, fields := statusOf(err)
+	if open, ok := err.(db.CircuitOpenError); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.RetryAfter.Seconds()))))
+	}
+	return code, fields
+}
+
+// statusOf returns the status answering err and the fields it names, if
+// any.
+func statusOf(err error) (int, users.FieldErrors) {
 	code := http.StatusInternalServerError
 	switch err {
 	case ErrUnauthorized:
 		code = http.StatusUnauthorized
+	case ErrDisabled, ErrForbidden:
+		code = http.StatusForbidden
+	case db.ErrAddressNotOwned, tenant.ErrUnknownTenant, tenant.ErrInvalidToken:
+		code = http.StatusBadRequest
+	case db.ErrNotFound, ErrNoSuchTenant, ErrNoSuchRel:
+		code = http.StatusNotFound
+	case db.ErrTenantExists, ErrIdempotencyKeyInFlight:
+		code = http.StatusConflict
+	case ErrIdempotencyKeyReused:
+		code = http.StatusUnprocessableEntity
+	case ErrIdempotencyUnavailable:
+		code = http.StatusServiceUnavailable
+	case context.DeadlineExceeded, db.ErrTimeout:
+		code = http.StatusGatewayTimeout
 	}
-	w.WriteHeader(code)
-	w.Header().Set("Content-Type", "application/hal+json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error":       err.Error(),
-		"status_code": code,
-		"status_text": http.StatusText(code),
-	})
+	fields, ok := err.(users.FieldErrors)
+	if ok {
+		code = http.StatusBadRequest
+	}
+	if _, ok := err.(db.CircuitOpenError); ok {
+		code = http.StatusServiceUnavailable
+	}
+	return code, fields
 }
 
 func decodeLoginRequest(_ context.Context, r *http.Request) (interface{}, error) {
@@ -142,28 +286,117 @@ func decodeRegisterRequest(_ context.Context, r *http.Request) (interface{}, err
 }
 
 func decodeDeleteRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	d := deleteRequest{}
-	u := strings.Split(r.URL.Path, "/")
-	if len(u) == 3 {
-		d.Entity = u[1]
-		d.ID = u[2]
-		return d, nil
+	return deleteRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeErasureRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return erasureRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeDefaultAddressRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	defer r.Body.Close()
+	d := defaultAddressRequest{}
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		return nil, err
+	}
+	d.UserID = mux.Vars(r)["id"]
+	d.Kind = mux.Vars(r)["kind"]
+	return d, nil
+}
+
+func decodeCardBillingAddressRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	defer r.Body.Close()
+	c := cardBillingAddressRequest{}
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		return nil, err
 	}
-	return d, ErrInvalidRequest
+	c.CardID = mux.Vars(r)["id"]
+	return c, nil
 }
 
+// decodeGetRequest reads the sparse fieldset from fields and, for customers,
+// the relations to embed from embed, both comma separated.
 func decodeGetRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	g := GetRequest{}
-	u := strings.Split(r.URL.Path, "/")
+	u := strings.Split(routePath(r), "/")
 	if len(u) > 2 {
 		g.ID = u[2]
 		if len(u) > 3 {
 			g.Attr = u[3]
 		}
 	}
+	q := r.URL.Query()
+	g.Fields = splitList(q.Get("fields"))
+	g.Embed = splitList(q.Get("embed"))
+	if len(g.Embed) == 0 {
+		return g, nil
+	}
+	if u[1] != "customers" || g.Attr != "" {
+		return nil, users.FieldErrors{"embed": "is only supported on customers"}
+	}
+	for _, rel := range g.Embed {
+		if !contains(users.Embeddable, rel) {
+			return nil, users.FieldErrors{"embed": "must list " + strings.Join(users.Embeddable, " or ")}
+		}
+	}
 	return g, nil
 }
 
+// splitList returns the non-empty items of the comma separated list v.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Search results are paged with page, counting from 1, and size.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+func decodeSearchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	req := searchRequest{Query: q.Get("q"), Page: 1, Size: defaultPageSize}
+	errs := users.FieldErrors{}
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			errs["page"] = "must be a positive integer"
+		}
+		req.Page = n
+	}
+	if v := q.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			errs["size"] = fmt.Sprintf("must be between 1 and %d", maxPageSize)
+		}
+		req.Size = n
+	}
+	if len(errs) == 0 && req.Page-1 > math.MaxInt/req.Size {
+		errs["page"] = "is past the last result"
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return req, nil
+}
+
 func decodeUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	defer r.Body.Close()
 	u := users.User{}
@@ -174,6 +407,16 @@ func decodeUserRequest(_ context.Context, r *http.Request) (interface{}, error)
 	return u, nil
 }
 
+func decodeTenantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	defer r.Body.Close()
+	t := users.Tenant{}
+	err := json.NewDecoder(r.Body).Decode(&t)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
 func decodeAddressRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	defer r.Body.Close()
 	a := addressPostRequest{}
@@ -194,12 +437,50 @@ func decodeCardRequest(_ context.Context, r *http.Request) (interface{}, error)
 	return c, nil
 }
 
+func decodeAddressesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	defer r.Body.Close()
+	a := addressesPostRequest{}
+	err := json.NewDecoder(r.Body).Decode(&a)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func decodeCardsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	defer r.Body.Close()
+	c := cardsPostRequest{}
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func decodeUsersDeleteRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	defer r.Body.Close()
+	d := usersDeleteRequest{}
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
 func decodeHealthRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	return struct{}{}, nil
 }
 
 func encodeHealthResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
-	return encodeResponse(ctx, w, response.(healthResponse))
+	resp := response.(healthResponse)
+	for _, h := range resp.Health {
+		if h.Status == "err" {
+			w.Header().Set("Content-Type", "application/hal+json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return json.NewEncoder(w).Encode(resp)
+		}
+	}
+	return encodeResponse(ctx, w, resp)
 }
 
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
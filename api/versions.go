@@ -0,0 +1,253 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+
+	"github.com/aheadaviation/Users/users"
+)
+
+// Prefixes the versions of the API are mounted under. Version 1 is also
+// served at the root, where it was before it had a prefix.
+const (
+	V1Prefix = "/api/v1"
+	V2Prefix = "/api/v2"
+)
+
+// version holds what differs between versions of the API, which share
+// their endpoints and request decoders.
+type version struct {
+	encodeResponse httptransport.EncodeResponseFunc
+	encodeError    httptransport.ErrorEncoder
+	// legacy routes are only served by version 1.
+	legacy bool
+}
+
+var (
+	v1 = version{encodeResponse: encodeResponse, encodeError: encodeError, legacy: true}
+	v2 = version{encodeResponse: encodeResponseV2, encodeError: encodeErrorV2}
+)
+
+// routePath returns the path of r below the prefix of its version.
+func routePath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, versionPrefix(r))
+}
+
+// versionPrefix returns the version prefix of the path of r, if it has one.
+func versionPrefix(r *http.Request) string {
+	for _, p := range []string{V1Prefix, V2Prefix} {
+		if strings.HasPrefix(r.URL.Path, p+"/") {
+			return p
+		}
+	}
+	return ""
+}
+
+// v2Response is the envelope of every successful version 2 response. Lists
+// are returned whole in Data, with Page set when they are paged.
+type v2Response struct {
+	Data interface{}   `json:"data"`
+	Page *pageResponse `json:"page,omitempty"`
+}
+
+// v2Error is the body of every failed version 2 response.
+type v2Error struct {
+	Error v2ErrorBody `json:"error"`
+}
+
+type v2ErrorBody struct {
+	Status  int               `json:"status"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  users.FieldErrors `json:"fields,omitempty"`
+}
+
+// encodeResponseV2 unwraps the HAL envelopes the endpoints build for
+// version 1. Creating answers 201 and calls reporting only a status 204.
+func encodeResponseV2(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	status := http.StatusOK
+	body := v2Response{Data: response}
+	switch resp := response.(type) {
+	case EmbedStruct:
+		return encodeResponseV2(ctx, w, resp.Embed)
+	case usersResponse:
+		body.Data = resp.Users
+	case addressesResponse:
+		body.Data = resp.Addresses
+	case cardsResponse:
+		body.Data = resp.Cards
+	case sparseList:
+		body.Data = resp.items
+	case tenantsResponse:
+		body.Data = resp.Tenants
+	case batchResponse:
+		body.Data = resp.Results
+	case userResponse:
+		body.Data = resp.User
+	case searchResponse:
+		body.Data = resp.Embed.Users
+		body.Page = &resp.Page
+	case postResponse:
+		status = http.StatusCreated
+	case statusResponse:
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(body)
+}
+
+// encodeErrorV2 answers like encodeError, except that requests that cannot
+// be read are refused with 400 rather than 500, and the body is always a
+// v2Error.
+func encodeErrorV2(_ context.Context, err error, w http.ResponseWriter) {
+	code, fields := errorStatus(err, w)
+	if code == http.StatusInternalServerError && badRequest(err) {
+		code = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v2Error{Error: v2ErrorBody{
+		Status:  code,
+		Code:    errorCode(code),
+		Message: err.Error(),
+		Fields:  fields,
+	}})
+}
+
+// EncodeRequestError answers err for a request refused before reaching a
+// route, such as one whose tenant cannot be resolved, in the error body of
+// the version of r.
+func EncodeRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	if versionPrefix(r) == V2Prefix {
+		encodeErrorV2(r.Context(), err, w)
+		return
+	}
+	encodeError(r.Context(), err, w)
+}
+
+// badRequest reports whether err comes from reading a malformed request.
+func badRequest(err error) bool {
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	return err == ErrInvalidRequest || err == io.EOF || err == io.ErrUnexpectedEOF ||
+		errors.As(err, &syntax) || errors.As(err, &typ)
+}
+
+// errorCode names an HTTP status in snake case, such as not_found.
+func errorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// notFoundV2 answers requests below V2Prefix that match no route.
+func notFoundV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(v2Error{Error: v2ErrorBody{
+		Status:  http.StatusNotFound,
+		Code:    errorCode(http.StatusNotFound),
+		Message: fmt.Sprintf("No route for %v %v", r.Method, r.URL.Path),
+	}})
+}
+
+// Deprecation marks routes as deprecated. Path is a route template, such as
+// /api/v1/customers/{id}/erasure, or ends in * to cover every route below
+// it. An empty Method covers every method, and a zero Sunset means no date
+// has been set for the routes to go.
+type Deprecation struct {
+	Method string
+	Path   string
+	Sunset time.Time
+}
+
+var ErrInvalidDeprecation = "Invalid deprecation %q: want [METHOD ]path[=YYYY-MM-DD]"
+
+// ParseDeprecations reads deprecations written as [METHOD ]path[=sunset],
+// the sunset being a date.
+func ParseDeprecations(entries []string) ([]Deprecation, error) {
+	ds := make([]Deprecation, 0, len(entries))
+	for _, e := range entries {
+		d := Deprecation{}
+		route, sunset := e, ""
+		if i := strings.LastIndex(e, "="); i >= 0 {
+			route, sunset = e[:i], strings.TrimSpace(e[i+1:])
+		}
+		f := strings.Fields(route)
+		switch len(f) {
+		case 1:
+			d.Path = f[0]
+		case 2:
+			d.Method, d.Path = strings.ToUpper(f[0]), f[1]
+		}
+		if !strings.HasPrefix(d.Path, "/") {
+			return nil, fmt.Errorf(ErrInvalidDeprecation, e)
+		}
+		if sunset != "" {
+			t, err := time.Parse("2006-01-02", sunset)
+			if err != nil {
+				return nil, fmt.Errorf(ErrInvalidDeprecation, e)
+			}
+			d.Sunset = t
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+func (d Deprecation) matches(method, path string) bool {
+	if d.Method != "" && d.Method != method {
+		return false
+	}
+	if strings.HasSuffix(d.Path, "*") {
+		return strings.HasPrefix(path, strings.TrimSuffix(d.Path, "*"))
+	}
+	return d.Path == path
+}
+
+// DeprecationMiddleware answers requests to deprecated routes with a
+// Deprecation header and, once a date is set, a Sunset header. The first
+// deprecation matching the route applies.
+func DeprecationMiddleware(ds []Deprecation) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil && len(ds) > 0 {
+				if path, err := route.GetPathTemplate(); err == nil {
+					for _, d := range ds {
+						if d.matches(r.Method, path) {
+							w.Header().Set("Deprecation", "true")
+							if !d.Sunset.IsZero() {
+								w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+							}
+							break
+						}
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/aheadaviation/Users/tenant"
+	"github.com/aheadaviation/Users/users"
+)
+
+func TestVersions(t *testing.T) {
+
+	Convey("Given the API with stub endpoints", t, func() {
+		var deleted deleteRequest
+		e := Endpoints{
+			UserGetEndpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				return EmbedStruct{usersResponse{Users: []users.User{{Username: "ada", UserID: "1"}}}}, nil
+			},
+			UserPostEndpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				return postResponse{ID: "2"}, nil
+			},
+			AddressDeleteEndpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				deleted = request.(deleteRequest)
+				return statusResponse{Status: true}, nil
+			},
+		}
+		r := MakeHTTPHandler(e, log.NewNopLogger())
+		ds, err := ParseDeprecations([]string{"GET /api/v1/*=2027-01-31", "/customers"})
+		So(err, ShouldBeNil)
+		r.Use(DeprecationMiddleware(ds))
+		serve := func(method, path, body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+			return w
+		}
+
+		Convey("When version 1 is read at the root and under its prefix", func() {
+			root := serve("GET", "/customers", "")
+			prefixed := serve("GET", "/api/v1/customers", "")
+
+			Convey("Then both answer the same", func() {
+				So(prefixed.Code, ShouldEqual, http.StatusOK)
+				So(prefixed.Body.String(), ShouldEqual, root.Body.String())
+				So(prefixed.Header().Get("Content-Type"), ShouldEqual, "application/hal+json")
+			})
+
+			Convey("Then each is deprecated as configured", func() {
+				So(root.Header().Get("Deprecation"), ShouldEqual, "true")
+				So(root.Header().Get("Sunset"), ShouldBeEmpty)
+				So(prefixed.Header().Get("Deprecation"), ShouldEqual, "true")
+				So(prefixed.Header().Get("Sunset"), ShouldEqual, "Sun, 31 Jan 2027 00:00:00 GMT")
+			})
+		})
+
+		Convey("When version 2 is read", func() {
+			w := serve("GET", "/api/v2/customers", "")
+			var body struct {
+				Data []users.User `json:"data"`
+			}
+			So(json.NewDecoder(w.Body).Decode(&body), ShouldBeNil)
+
+			Convey("Then the list is the data of the response", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(body.Data, ShouldHaveLength, 1)
+				So(body.Data[0].Username, ShouldEqual, "ada")
+				So(w.Header().Get("Deprecation"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When version 2 creates and deletes", func() {
+			created := serve("POST", "/api/v2/customers", `{"username":"bob"}`)
+			gone := serve("DELETE", "/api/v2/addresses/3", "")
+
+			Convey("Then they answer 201 and 204", func() {
+				So(created.Code, ShouldEqual, http.StatusCreated)
+				So(created.Body.String(), ShouldEqual, `{"data":{"id":"2"}}`+"\n")
+				So(gone.Code, ShouldEqual, http.StatusNoContent)
+				So(deleted, ShouldResemble, deleteRequest{ID: "3"})
+			})
+		})
+
+		Convey("When a request body cannot be read", func() {
+			old := serve("POST", "/customers", "{")
+			w := serve("POST", "/api/v2/customers", "{")
+			var body v2Error
+			So(json.NewDecoder(w.Body).Decode(&body), ShouldBeNil)
+
+			Convey("Then version 1 answers as it always has", func() {
+				So(old.Code, ShouldEqual, http.StatusInternalServerError)
+				So(old.Body.String(), ShouldContainSubstring, `"status_code":500`)
+			})
+
+			Convey("Then version 2 answers 400 with its error body", func() {
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+				So(body.Error.Status, ShouldEqual, http.StatusBadRequest)
+				So(body.Error.Code, ShouldEqual, "bad_request")
+			})
+		})
+
+		Convey("When the tenant of a request is unknown", func() {
+			reg := tenant.NewRegistry("default", time.Hour, func(context.Context) ([]users.Tenant, error) {
+				return nil, nil
+			})
+			r.Use(tenant.Resolver{
+				Sources:  []string{tenant.SourceHeader},
+				Header:   "X-Tenant-ID",
+				Registry: reg,
+				Error:    EncodeRequestError,
+			}.Middleware)
+			serveAs := func(path string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", path, nil)
+				req.Header.Set("X-Tenant-ID", "globex")
+				r.ServeHTTP(w, req)
+				return w
+			}
+			old := serveAs("/customers")
+			w := serveAs("/api/v2/customers")
+			var body v2Error
+			So(json.NewDecoder(w.Body).Decode(&body), ShouldBeNil)
+
+			Convey("Then each version answers 400 with its own error body", func() {
+				So(old.Code, ShouldEqual, http.StatusBadRequest)
+				So(old.Body.String(), ShouldContainSubstring, `"status_code":400`)
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+				So(body.Error.Code, ShouldEqual, "bad_request")
+				So(body.Error.Message, ShouldEqual, tenant.ErrUnknownTenant.Error())
+			})
+		})
+
+		Convey("When a search asks for a page too far to count", func() {
+			w := serve("GET", "/api/v2/customers/search?q=ada&page=9223372036854775807&size=100", "")
+			var body v2Error
+			So(json.NewDecoder(w.Body).Decode(&body), ShouldBeNil)
+
+			Convey("Then the page is refused", func() {
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+				So(body.Error.Fields, ShouldContainKey, "page")
+			})
+		})
+
+		Convey("When version 2 has no such route", func() {
+			w := serve("GET", "/api/v2/nowhere", "")
+
+			Convey("Then it answers 404 with its error body", func() {
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+				So(w.Body.String(), ShouldContainSubstring, `"code":"not_found"`)
+			})
+		})
+	})
+
+	Convey("Given a deprecation without a path", t, func() {
+		_, err := ParseDeprecations([]string{"GET=2027-01-31"})
+
+		Convey("Then it is refused", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit keeps a trail of the actions operators take on customers.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Outcomes of an audited action. An action is recorded as started before it
+// is carried out, and again with how it ended.
+const (
+	OutcomeStarted = "started"
+	OutcomeOK      = "ok"
+	OutcomeFailed  = "failed"
+)
+
+// Entry is one action by an operator. Customer holds the customer's ID, or
+// what the operator named it by when it could not be found.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	Action   string    `json:"action"`
+	Tenant   string    `json:"tenant,omitempty"`
+	Customer string    `json:"customer"`
+	Username string    `json:"username,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type Trail interface {
+	Record(Entry) error
+}
+
+// Log is a trail written as JSON Lines, one entry per write.
+type Log struct {
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+func NewLog(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// Open returns a log appending to the file at path, which is created if
+// needed. "-" means standard error.
+func Open(path string) (*Log, error) {
+	if path == "-" {
+		return NewLog(os.Stderr), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewLog(f), nil
+}
+
+// Record writes e, filling in its time if unset. Entries written to a file
+// are synced before Record returns.
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if _, err := l.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if f, ok := l.w.(*os.File); ok && f != os.Stderr {
+		return f.Sync()
+	}
+	return nil
+}
+
+// Close closes the file the log writes to.
+func (l *Log) Close() error {
+	if f, ok := l.w.(*os.File); ok && f != os.Stderr {
+		return f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLog(t *testing.T) {
+
+	Convey("Given a log", t, func() {
+		var buf bytes.Buffer
+		l := NewLog(&buf)
+
+		Convey("When entries are recorded", func() {
+			So(l.Record(Entry{Actor: "a", Action: "disable", Customer: "1", Outcome: OutcomeOK}), ShouldBeNil)
+			So(l.Record(Entry{Actor: "a", Action: "delete", Customer: "2", Outcome: OutcomeFailed, Error: "boom"}), ShouldBeNil)
+
+			Convey("Then each is a timestamped JSON line", func() {
+				lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+				So(lines, ShouldHaveLength, 2)
+				var e Entry
+				So(json.Unmarshal(lines[1], &e), ShouldBeNil)
+				So(e.Action, ShouldEqual, "delete")
+				So(e.Error, ShouldEqual, "boom")
+				So(e.Time.IsZero(), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a log file", t, func() {
+		path := filepath.Join(t.TempDir(), "audit.log")
+
+		Convey("When it is opened twice", func() {
+			for _, action := range []string{"get", "disable"} {
+				l, err := Open(path)
+				So(err, ShouldBeNil)
+				So(l.Record(Entry{Action: action}), ShouldBeNil)
+				So(l.Close(), ShouldBeNil)
+			}
+
+			Convey("Then entries are appended", func() {
+				b, err := os.ReadFile(path)
+				So(err, ShouldBeNil)
+				So(bytes.Count(b, []byte("\n")), ShouldEqual, 2)
+			})
+		})
+	})
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+
+	"github.com/aheadaviation/Users/admin"
+	"github.com/aheadaviation/Users/audit"
+	"github.com/aheadaviation/Users/config"
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/db/cache"
+	"github.com/aheadaviation/Users/db/mongodb"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/transfer"
+)
+
+var (
+	errImportIncomplete = errors.New("Some records were not imported; see the report")
+	errNoCustomerArg    = errors.New("Name the customer by ID or username")
+	errNotConfirmed     = errors.New("Pass -yes to delete the customer")
+	errUnknownTenant    = "No tenant %v"
+)
+
+// command is a subcommand run instead of the service, such as
+// "users config print". args holds the arguments after its name.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"config print": {
+		usage: "Print the effective configuration with secrets redacted",
+		run:   printConfig,
+	},
+	"admin get": {
+		usage: "Show everything stored for a customer, with card numbers masked",
+		run:   adminGet,
+	},
+	"admin disable": {
+		usage: "Stop a customer logging in",
+		run:   adminDisable,
+	},
+	"admin restore": {
+		usage: "Let a disabled customer log in again",
+		run:   adminRestore,
+	},
+	"admin reset-password": {
+		usage: "Set a new password for a customer, generated unless read from standard input",
+		run:   adminResetPassword,
+	},
+	"admin delete": {
+		usage: "Delete a customer with its addresses and cards",
+		run:   adminDelete,
+	},
+	"export": {
+		usage: "Write every customer with addresses and cards as CSV or JSON Lines",
+		run:   exportCustomers,
+	},
+	"import": {
+		usage: "Create customers from a CSV or JSON Lines export",
+		run:   importCustomers,
+	},
+}
+
+// runCommand runs the subcommand named by the leading words of args. It
+// reports false when args do not name one, so the service should start.
+func runCommand(args []string) (bool, error) {
+	for n := 2; n > 0; n-- {
+		if len(args) < n {
+			continue
+		}
+		if c, ok := commands[strings.Join(args[:n], " ")]; ok {
+			return true, c.run(args[n:])
+		}
+	}
+	return false, nil
+}
+
+func printConfig(args []string) error {
+	_, report, err := config.Load(args, os.Getenv)
+	if err != nil {
+		return err
+	}
+	return report.Print(os.Stdout)
+}
+
+// openDatabase connects the database configured by args, which are the
+// service's own flags. Calls are retried and timed out as configured. With
+// a redis cache shared with the service, writes drop its stale entries.
+func openDatabase(args []string) (config.Config, db.Database, error) {
+	cfg, report, err := config.Load(args, os.Getenv)
+	if err != nil {
+		return cfg, nil, err
+	}
+	if err := report.Err(); err != nil {
+		report.Print(os.Stderr)
+		return cfg, nil, err
+	}
+	db.Register("mongodb", &mongodb.Mongo{
+		Host:          cfg.Mongo.Host,
+		User:          cfg.Mongo.User,
+		Password:      string(cfg.Mongo.Password),
+		DefaultTenant: cfg.Tenant.Default,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Database.ConnectTimeout)
+	defer cancel()
+	logger := log.With(log.NewLogfmtLogger(os.Stderr), "component", "db")
+	if err := db.Connect(ctx, cfg.Database.Kind, logger); err != nil {
+		return cfg, nil, err
+	}
+	mws := []db.Middleware{
+		db.RetryMiddleware(cfg.Database.Retries, cfg.Database.RetryBackoff),
+		db.TimeoutMiddleware(cfg.Database.Timeout),
+	}
+	if cfg.Cache.Kind == "redis" {
+		redis := cache.NewRedis(cfg.Cache.RedisAddr, string(cfg.Cache.RedisPassword), cfg.Cache.RedisPrefix, 1)
+		mws = append([]db.Middleware{cache.Middleware(redis, cfg.Cache.TTL, discard.NewCounter(), discard.NewCounter())}, mws...)
+	}
+	return cfg, db.Chain(db.DefaultDb, mws...), nil
+}
+
+// tenantContext returns a context for the tenant id, or the default tenant
+// when id is empty, failing if no such tenant exists.
+func tenantContext(cfg config.Config, database db.Database, id string) (context.Context, error) {
+	if id == "" {
+		id = cfg.Tenant.Default
+	}
+	ctx := context.Background()
+	ts, err := database.GetTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range ts {
+		if t.ID == id {
+			return reqctx.WithTenant(ctx, id), nil
+		}
+	}
+	return nil, fmt.Errorf(errUnknownTenant, id)
+}
+
+// fileArg splits the optional file name, "-" for the standard streams, from
+// the service flags that follow it.
+func fileArg(args []string) (string, []string) {
+	if len(args) > 0 && (args[0] == "-" || !strings.HasPrefix(args[0], "-")) {
+		return args[0], args[1:]
+	}
+	return "-", args
+}
+
+func exportCustomers(args []string) error {
+	fs := flag.NewFlagSet("users export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: users export [-format csv|jsonl] [-tenant id] [file] [service flags]")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "", "Output format, csv or jsonl; guessed from the file name, else jsonl")
+	tenantID := fs.String("tenant", "", "Tenant whose customers are exported (default the default tenant)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path, rest := fileArg(fs.Args())
+	if *format == "" {
+		*format = transfer.FormatOf(path)
+	}
+	if *format == "" {
+		*format = transfer.FormatJSONL
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc, err := transfer.NewEncoder(out, *format)
+	if err != nil {
+		return err
+	}
+	cfg, database, err := openDatabase(rest)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	ctx, err := tenantContext(cfg, database, *tenantID)
+	if err != nil {
+		return err
+	}
+	n, err := transfer.Export(ctx, database, enc)
+	fmt.Fprintf(os.Stderr, "exported %d customers\n", n)
+	return err
+}
+
+func importCustomers(args []string) error {
+	fs := flag.NewFlagSet("users import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: users import [-format csv|jsonl] [-tenant id] [-dry-run] [-report file] [file] [service flags]")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "", "Input format, csv or jsonl; guessed from the file name, else jsonl")
+	tenantID := fs.String("tenant", "", "Tenant the customers are created in (default the default tenant)")
+	dryRun := fs.Bool("dry-run", false, "Validate the input and check usernames without writing")
+	reportPath := fs.String("report", "-", "File to write the result of every record to")
+	reportFormat := fs.String("report-format", "", "Report format, csv or jsonl; guessed from the report name, else the input format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path, rest := fileArg(fs.Args())
+	if *format == "" {
+		*format = transfer.FormatOf(path)
+	}
+	if *format == "" {
+		*format = transfer.FormatJSONL
+	}
+	if *reportFormat == "" {
+		*reportFormat = transfer.FormatOf(*reportPath)
+	}
+	if *reportFormat == "" {
+		*reportFormat = *format
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	dec, err := transfer.NewDecoder(in, *format)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if *reportPath != "-" {
+		f, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	report, err := transfer.NewReport(out, *reportFormat)
+	if err != nil {
+		return err
+	}
+	cfg, database, err := openDatabase(rest)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	ctx, err := tenantContext(cfg, database, *tenantID)
+	if err != nil {
+		return err
+	}
+
+	im := transfer.Importer{Database: database, DryRun: *dryRun}
+	summary, err := im.Import(ctx, dec, report.Add)
+	if ferr := report.Flush(); err == nil {
+		err = ferr
+	}
+	for _, status := range []string{transfer.StatusCreated, transfer.StatusValid, transfer.StatusExists, transfer.StatusInvalid, transfer.StatusFailed} {
+		if summary[status] > 0 {
+			fmt.Fprintf(os.Stderr, "%v: %d\n", status, summary[status])
+		}
+	}
+	if err == nil && summary.Failed() {
+		err = errImportIncomplete
+	}
+	return err
+}
+
+// runAdmin parses the flags shared by the admin commands, and any added by
+// flags, and runs f on the customer named by the first argument.
+func runAdmin(name string, args []string, flags func(*flag.FlagSet), f func(context.Context, admin.Admin, string) error) error {
+	fs := flag.NewFlagSet("users "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: users %v [flags] id|username [service flags]\n", name)
+		fs.PrintDefaults()
+	}
+	actor := fs.String("actor", currentUser(), "Operator named in the audit trail")
+	tenantID := fs.String("tenant", "", "Tenant of the customer (default the default tenant)")
+	reason := fs.String("reason", "", "Reason recorded in the audit trail, such as a ticket number")
+	if flags != nil {
+		flags(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	rest := fs.Args()
+	if len(rest) == 0 || strings.HasPrefix(rest[0], "-") {
+		fs.Usage()
+		return errNoCustomerArg
+	}
+	cfg, database, err := openDatabase(rest[1:])
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	ctx, err := tenantContext(cfg, database, *tenantID)
+	if err != nil {
+		return err
+	}
+	trail, err := audit.Open(cfg.AuditLog)
+	if err != nil {
+		return err
+	}
+	defer trail.Close()
+	a := admin.Admin{Database: database, Trail: trail, Actor: *actor, Reason: *reason}
+	return f(ctx, a, rest[0])
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func adminGet(args []string) error {
+	return runAdmin("admin get", args, nil, func(ctx context.Context, a admin.Admin, ref string) error {
+		r, err := a.Get(ctx, ref)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	})
+}
+
+func adminDisable(args []string) error {
+	return runAdmin("admin disable", args, nil, func(ctx context.Context, a admin.Admin, ref string) error {
+		u, err := a.Disable(ctx, ref)
+		if err == nil {
+			fmt.Printf("disabled %v (%v)\n", u.UserID, u.Username)
+		}
+		return err
+	})
+}
+
+func adminRestore(args []string) error {
+	return runAdmin("admin restore", args, nil, func(ctx context.Context, a admin.Admin, ref string) error {
+		u, err := a.Restore(ctx, ref)
+		if err == nil {
+			fmt.Printf("restored %v (%v)\n", u.UserID, u.Username)
+		}
+		return err
+	})
+}
+
+func adminResetPassword(args []string) error {
+	var stdin *bool
+	flags := func(fs *flag.FlagSet) {
+		stdin = fs.Bool("stdin", false, "Read the new password from the first line of standard input instead of generating one")
+	}
+	return runAdmin("admin reset-password", args, flags, func(ctx context.Context, a admin.Admin, ref string) error {
+		password := admin.NewPassword()
+		if *stdin {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+		u, err := a.ResetPassword(ctx, ref, password)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reset password of %v (%v)\n", u.UserID, u.Username)
+		if !*stdin {
+			fmt.Printf("new password: %v\n", password)
+		}
+		return nil
+	})
+}
+
+func adminDelete(args []string) error {
+	var yes *bool
+	flags := func(fs *flag.FlagSet) {
+		yes = fs.Bool("yes", false, "Confirm the customer is to be deleted")
+	}
+	return runAdmin("admin delete", args, flags, func(ctx context.Context, a admin.Admin, ref string) error {
+		if !*yes {
+			return errNotConfirmed
+		}
+		u, err := a.Delete(ctx, ref)
+		if err == nil {
+			fmt.Printf("deleted %v (%v)\n", u.UserID, u.Username)
+		}
+		return err
+	})
+}
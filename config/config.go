@@ -0,0 +1,395 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config loads the service configuration. Each setting is taken from,
+// in increasing order of precedence, its default, the config file, the
+// environment and the command line. Secrets may also be read from files, as
+// mounted by Docker and Kubernetes secrets.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Secret is a setting that is never printed or logged.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+const redacted = "[redacted]"
+
+// Each setting is described by its tags: key is its name in the config file,
+// nested under the keys of enclosing sections, env lists the environment
+// variables it is read from, first set wins, and flag names its command line
+// flag.
+type Config struct {
+	Port           string        `key:"port" env:"USERS_PORT" flag:"port" usage:"Port on which to run"`
+	DrainTimeout   time.Duration `key:"drainTimeout" env:"USERS_DRAIN_TIMEOUT" flag:"drain-timeout" usage:"Time to wait for in-flight requests on shutdown"`
+	RequestTimeout time.Duration `key:"requestTimeout" env:"USERS_REQUEST_TIMEOUT" flag:"request-timeout" usage:"Time a request may take before its work is abandoned (0 for no limit)"`
+	LinkDomain     string        `key:"linkDomain" env:"LINK_DOMAIN,HATEAOS" flag:"link-domain" usage:"Base URL, or host, of HATEOAS links instead of the one each request came to"`
+	RelativeLinks  bool          `key:"relativeLinks" env:"USERS_RELATIVE_LINKS" flag:"relative-links" usage:"Leave the scheme and host out of HATEOAS links"`
+	TrustedProxies []string      `key:"trustedProxies" env:"USERS_TRUSTED_PROXIES" flag:"trusted-proxies" usage:"Comma separated addresses or CIDR ranges whose X-Forwarded-Proto, -Host and -Prefix headers are used in links"`
+	AdminRoles     []string      `key:"adminRoles" env:"USERS_ADMIN_ROLES" flag:"admin-roles" usage:"Comma separated caller roles allowed to use the admin API"`
+	AuditLog       string        `key:"auditLog" env:"USERS_AUDIT_LOG" flag:"audit-log" usage:"File the admin commands append their audit trail to, - for standard error"`
+	BatchMax       int           `key:"batchMax" env:"USERS_BATCH_MAX" flag:"batch-max" usage:"Items a batch create or delete call may carry"`
+	Deprecations   []string      `key:"deprecations" env:"USERS_API_DEPRECATIONS" flag:"api-deprecations" usage:"Comma separated routes answered with Deprecation and Sunset headers, each [METHOD ]path[=sunset date]"`
+	Database       Database      `key:"database"`
+	Mongo          Mongo         `key:"mongo"`
+	Tracing        Tracing       `key:"tracing"`
+	Discovery      Discovery     `key:"discovery"`
+	Events         Events        `key:"events"`
+	Health         Health        `key:"health"`
+	Cache          Cache         `key:"cache"`
+	Tenant         Tenant        `key:"tenant"`
+	Idempotency    Idempotency   `key:"idempotency"`
+}
+
+type Database struct {
+	Kind             string        `key:"kind" env:"USERS_DATABASE" flag:"database" usage:"Database to use for Users"`
+	Middlewares      []string      `key:"middlewares" env:"USERS_DB_MIDDLEWARES" flag:"db-middlewares" usage:"Comma separated database middlewares, outermost first (cache, logging, metrics, tracing, breaker, retry, timeout)"`
+	Timeout          time.Duration `key:"timeout" env:"USERS_DB_TIMEOUT" flag:"db-timeout" usage:"Time each database call may take with the timeout middleware"`
+	Retries          int           `key:"retries" env:"USERS_DB_RETRIES" flag:"db-retries" usage:"Times a call failing with a transient error is retried by the retry middleware"`
+	RetryBackoff     time.Duration `key:"retryBackoff" env:"USERS_DB_RETRY_BACKOFF" flag:"db-retry-backoff" usage:"Wait before the first retry, doubling for each one after"`
+	ConnectTimeout   time.Duration `key:"connectTimeout" env:"USERS_DB_CONNECT_TIMEOUT" flag:"db-connect-timeout" usage:"Time to keep trying to connect on startup before giving up"`
+	BreakerThreshold int           `key:"breakerThreshold" env:"USERS_DB_BREAKER_THRESHOLD" flag:"db-breaker-threshold" usage:"Consecutive transient failures that open the circuit breaker"`
+	BreakerCooldown  time.Duration `key:"breakerCooldown" env:"USERS_DB_BREAKER_COOLDOWN" flag:"db-breaker-cooldown" usage:"Time the open circuit breaker rejects calls before trying the database again"`
+}
+
+type Cache struct {
+	Kind          string        `key:"kind" env:"USERS_CACHE" flag:"cache" usage:"Cache for customer, address and card lookups: none, memory or redis"`
+	TTL           time.Duration `key:"ttl" env:"USERS_CACHE_TTL" flag:"cache-ttl" usage:"Time a cached lookup is kept"`
+	Size          int           `key:"size" env:"USERS_CACHE_SIZE" flag:"cache-size" usage:"Entries kept by the memory cache"`
+	RedisAddr     string        `key:"redisAddr" env:"USERS_CACHE_REDIS_ADDR" flag:"cache-redis-addr" usage:"Redis server as host:port"`
+	RedisPassword Secret        `key:"redisPassword" env:"USERS_CACHE_REDIS_PASSWORD" flag:"cache-redis-password" usage:"Redis password"`
+	RedisPrefix   string        `key:"redisPrefix" env:"USERS_CACHE_REDIS_PREFIX" flag:"cache-redis-prefix" usage:"Prefix of every key the cache sets in redis"`
+}
+
+type Idempotency struct {
+	Store       string        `key:"store" env:"USERS_IDEMPOTENCY" flag:"idempotency" usage:"Where responses to POSTs with an Idempotency-Key are kept: none, memory or redis"`
+	TTL         time.Duration `key:"ttl" env:"USERS_IDEMPOTENCY_TTL" flag:"idempotency-ttl" usage:"Time a key is remembered and its response replayed"`
+	Size        int           `key:"size" env:"USERS_IDEMPOTENCY_SIZE" flag:"idempotency-size" usage:"Responses kept by the memory store"`
+	RedisPrefix string        `key:"redisPrefix" env:"USERS_IDEMPOTENCY_REDIS_PREFIX" flag:"idempotency-redis-prefix" usage:"Prefix of every key set in the redis of the cache, not overlapping the cache's own"`
+}
+
+type Tenant struct {
+	Sources []string      `key:"sources" env:"USERS_TENANT_SOURCES" flag:"tenant-sources" usage:"Comma separated places the tenant of a request is read from, first found wins: header, claim or host"`
+	Header  string        `key:"header" env:"USERS_TENANT_HEADER" flag:"tenant-header" usage:"Header naming the tenant"`
+	Claim   string        `key:"claim" env:"USERS_TENANT_CLAIM" flag:"tenant-claim" usage:"Claim of the bearer token naming the tenant"`
+	Default string        `key:"default" env:"USERS_DEFAULT_TENANT" flag:"default-tenant" usage:"Tenant of requests naming none and of data stored before there were tenants"`
+	Refresh time.Duration `key:"refresh" env:"USERS_TENANT_REFRESH" flag:"tenant-refresh" usage:"Time the list of tenants is kept before it is read again"`
+}
+
+type Mongo struct {
+	Host     string `key:"host" env:"MONGO_HOST" flag:"mongo-host" usage:"Mongo Host"`
+	User     string `key:"user" env:"MONGO_USER" flag:"mongo-user" usage:"Mongo Username"`
+	Password Secret `key:"password" env:"MONGO_PASS" flag:"mongo-password" usage:"Mongo Password"`
+}
+
+type Tracing struct {
+	Exporter    string  `key:"exporter" env:"USERS_TRACING" flag:"tracing" usage:"Trace exporter: otlp-grpc, otlp-http, stdout or none"`
+	Endpoint    string  `key:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"tracing-endpoint" usage:"OTLP collector as host:port or URL"`
+	Insecure    bool    `key:"insecure" env:"OTEL_EXPORTER_OTLP_INSECURE" flag:"tracing-insecure" usage:"Connect to the collector without TLS"`
+	SampleRatio float64 `key:"sampleRatio" env:"USERS_TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio" usage:"Fraction of new traces to sample"`
+}
+
+type Discovery struct {
+	Kind          string   `key:"kind" env:"USERS_DISCOVERY" flag:"discovery" usage:"Service discovery: none, consul, static or kubernetes (default consul when a consul address is set)"`
+	ConsulAddr    string   `key:"consulAddr" env:"CONSUL_ADDR" flag:"consul_addr" usage:"Address of consul agent"`
+	AdvertiseAddr string   `key:"advertiseAddr" env:"ADVERTISE_ADDR" flag:"advertise-addr" usage:"Address other services reach this instance on (default first non-loopback interface)"`
+	Tags          []string `key:"tags" env:"USERS_SERVICE_TAGS" flag:"service-tags" usage:"Comma separated tags to register with"`
+}
+
+type Events struct {
+	Publisher  string `key:"publisher" env:"USERS_EVENTS" flag:"events" usage:"Event publisher to use (log, webhook, none)"`
+	WebhookURL string `key:"url" env:"USERS_EVENTS_URL" flag:"events-url" usage:"URL the webhook event publisher posts to"`
+}
+
+type Health struct {
+	CheckTimeout time.Duration `key:"checkTimeout" env:"USERS_HEALTH_TIMEOUT" flag:"health-timeout" usage:"Time each readiness check may take"`
+	MaxOutboxLag time.Duration `key:"maxOutboxLag" env:"USERS_HEALTH_MAX_OUTBOX_LAG" flag:"health-max-outbox-lag" usage:"Age of the oldest unpublished event before events are reported unhealthy"`
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() Config {
+	return Config{
+		Port:           "8084",
+		DrainTimeout:   15 * time.Second,
+		RequestTimeout: 30 * time.Second,
+		AdminRoles:     []string{"admin"},
+		AuditLog:       "-",
+		BatchMax:       100,
+		Discovery:      Discovery{Tags: []string{"app=bagshop"}},
+		Tracing:        Tracing{Exporter: "none", SampleRatio: 1},
+		Events:         Events{Publisher: "log"},
+		Health:         Health{CheckTimeout: 2 * time.Second, MaxOutboxLag: time.Minute},
+		Cache:          Cache{Kind: "none", TTL: 30 * time.Second, Size: 10000, RedisPrefix: "users:"},
+		Idempotency:    Idempotency{Store: "memory", TTL: 24 * time.Hour, Size: 10000, RedisPrefix: "users-idempotency:"},
+		Tenant: Tenant{
+			Sources: []string{"header", "claim", "host"},
+			Header:  "X-Tenant-ID",
+			Claim:   "tenant",
+			Default: "default",
+			Refresh: time.Minute,
+		},
+		Database: Database{
+			Middlewares:      []string{"cache", "metrics", "tracing", "breaker", "retry", "timeout"},
+			Timeout:          5 * time.Second,
+			Retries:          2,
+			RetryBackoff:     100 * time.Millisecond,
+			ConnectTimeout:   time.Minute,
+			BreakerThreshold: 5,
+			BreakerCooldown:  10 * time.Second,
+		},
+	}
+}
+
+var (
+	ErrInvalidValue = "Invalid value %q for %v: %v"
+	ErrUnknownKey   = "Unknown setting %v in %v"
+	ErrInvalid      = errors.New("Invalid configuration")
+)
+
+// Load builds the configuration from args, without the program name, and the
+// environment as returned by getenv. The config file is named by -config or
+// USERS_CONFIG and may be YAML or TOML. The report lists every setting with
+// where it came from and any validation problem.
+func Load(args []string, getenv func(string) string) (Config, Report, error) {
+	c := Default()
+	ss := settings(&c)
+	src := map[string]string{}
+
+	fs := flag.NewFlagSet("users", flag.ContinueOnError)
+	file := fs.String("config", getenv("USERS_CONFIG"), "Config file (YAML or TOML)")
+	for _, s := range ss {
+		if s.v.Kind() == reflect.Bool {
+			fs.Bool(s.flag, s.v.Bool(), s.usage)
+			continue
+		}
+		fs.String(s.flag, s.format(), s.usage)
+		if s.secret() {
+			fs.String(s.flag+"-file", "", "File to read "+s.key+" from")
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, nil, err
+	}
+
+	if *file != "" {
+		values, err := readFile(*file)
+		if err != nil {
+			return c, nil, err
+		}
+		byKey := map[string]setting{}
+		for _, s := range ss {
+			byKey[s.key] = s
+			if s.secret() {
+				byKey[s.key+"File"] = s
+			}
+		}
+		for _, k := range sortedKeys(values) {
+			s, ok := byKey[k]
+			if !ok {
+				return c, nil, fmt.Errorf(ErrUnknownKey, k, *file)
+			}
+			if err := s.setFrom(values[k], k != s.key); err != nil {
+				return c, nil, err
+			}
+			src[s.key] = "file " + *file
+		}
+	}
+
+	for _, s := range ss {
+		for _, name := range s.env {
+			if v := getenv(name); v != "" {
+				if err := s.set(v); err != nil {
+					return c, nil, err
+				}
+				src[s.key] = "env " + name
+				break
+			}
+			if !s.secret() {
+				continue
+			}
+			if p := getenv(name + "_FILE"); p != "" {
+				if err := s.setFrom(p, true); err != nil {
+					return c, nil, err
+				}
+				src[s.key] = "env " + name + "_FILE"
+				break
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range ss {
+			if err != nil {
+				return
+			}
+			switch f.Name {
+			case s.flag:
+				err = s.set(f.Value.String())
+			case s.flag + "-file":
+				err = s.setFrom(f.Value.String(), true)
+			default:
+				continue
+			}
+			src[s.key] = "flag -" + f.Name
+		}
+	})
+	if err != nil {
+		return c, nil, err
+	}
+
+	problems := c.Validate()
+	r := make(Report, 0, len(ss))
+	for _, s := range ss {
+		source, ok := src[s.key]
+		if !ok {
+			source = "default"
+		}
+		r = append(r, Setting{
+			Key:     s.key,
+			Value:   s.display(),
+			Source:  source,
+			Problem: problems[s.key],
+		})
+	}
+	return c, r, nil
+}
+
+// setting is one field of Config found by walking its tags.
+type setting struct {
+	key   string
+	env   []string
+	flag  string
+	usage string
+	v     reflect.Value
+}
+
+func settings(c *Config) []setting {
+	return walk(reflect.ValueOf(c).Elem(), "")
+}
+
+func walk(v reflect.Value, prefix string) []setting {
+	ss := make([]setting, 0)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := prefix + f.Tag.Get("key")
+		if f.Type.Kind() == reflect.Struct {
+			ss = append(ss, walk(v.Field(i), key+".")...)
+			continue
+		}
+		ss = append(ss, setting{
+			key:   key,
+			env:   strings.Split(f.Tag.Get("env"), ","),
+			flag:  f.Tag.Get("flag"),
+			usage: f.Tag.Get("usage"),
+			v:     v.Field(i),
+		})
+	}
+	return ss
+}
+
+var (
+	secretType   = reflect.TypeOf(Secret(""))
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+func (s setting) secret() bool {
+	return s.v.Type() == secretType
+}
+
+func (s setting) set(value string) error {
+	switch {
+	case s.v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf(ErrInvalidValue, value, s.key, err)
+		}
+		s.v.SetInt(int64(d))
+	case s.v.Kind() == reflect.String:
+		s.v.SetString(value)
+	case s.v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf(ErrInvalidValue, value, s.key, err)
+		}
+		s.v.SetInt(int64(n))
+	case s.v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf(ErrInvalidValue, value, s.key, err)
+		}
+		s.v.SetFloat(f)
+	case s.v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf(ErrInvalidValue, value, s.key, err)
+		}
+		s.v.SetBool(b)
+	case s.v.Kind() == reflect.Slice:
+		l := make([]string, 0)
+		for _, e := range strings.Split(value, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				l = append(l, e)
+			}
+		}
+		s.v.Set(reflect.ValueOf(l))
+	}
+	return nil
+}
+
+// setFrom sets the value, or reads it from the file it names when fromFile
+// is set. A single trailing newline is dropped from file contents.
+func (s setting) setFrom(value string, fromFile bool) error {
+	if !fromFile {
+		return s.set(value)
+	}
+	b, err := ioutil.ReadFile(value)
+	if err != nil {
+		return fmt.Errorf(ErrInvalidValue, value, s.key, err)
+	}
+	return s.set(strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r"))
+}
+
+func (s setting) format() string {
+	if s.v.Kind() == reflect.Slice {
+		return strings.Join(s.v.Interface().([]string), ",")
+	}
+	if s.secret() {
+		return ""
+	}
+	return fmt.Sprint(s.v.Interface())
+}
+
+func (s setting) display() string {
+	if s.secret() {
+		return s.v.Interface().(Secret).String()
+	}
+	return s.format()
+}
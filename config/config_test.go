@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func env(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestLoad(t *testing.T) {
+
+	Convey("Given a config file, environment and flags", t, func() {
+		dir, err := ioutil.TempDir("", "config")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		yml := filepath.Join(dir, "users.yaml")
+		ioutil.WriteFile(yml, []byte("port: 9000\ndrainTimeout: 5s\ndatabase:\n  kind: mongodb\nmongo:\n  host: file-host\n  user: file-user\ndiscovery:\n  tags: [a, b]\n"), 0600)
+		secret := filepath.Join(dir, "mongo_pass")
+		ioutil.WriteFile(secret, []byte("s3cret\n"), 0600)
+
+		e := map[string]string{
+			"USERS_CONFIG":    yml,
+			"MONGO_HOST":      "env-host",
+			"MONGO_PASS_FILE": secret,
+			"HATEAOS":         "legacy.example.com",
+		}
+
+		Convey("When loaded", func() {
+			c, r, err := Load([]string{"-mongo-host", "flag-host"}, env(e))
+			So(err, ShouldBeNil)
+
+			Convey("Then flags should beat the environment, which beats the file", func() {
+				So(c.Port, ShouldEqual, "9000")
+				So(c.DrainTimeout, ShouldEqual, 5*time.Second)
+				So(c.Mongo.User, ShouldEqual, "file-user")
+				So(c.Mongo.Host, ShouldEqual, "flag-host")
+				So(c.Discovery.Tags, ShouldResemble, []string{"a", "b"})
+				So(c.LinkDomain, ShouldEqual, "legacy.example.com")
+			})
+
+			Convey("Then the secret should be read from its file", func() {
+				So(string(c.Mongo.Password), ShouldEqual, "s3cret")
+			})
+
+			Convey("Then the report should give sources and redact secrets", func() {
+				So(r.Err(), ShouldBeNil)
+				var buf bytes.Buffer
+				So(r.Print(&buf), ShouldBeNil)
+				out := buf.String()
+				So(out, ShouldNotContainSubstring, "s3cret")
+				So(out, ShouldContainSubstring, `password: "[redacted]" # env MONGO_PASS_FILE`)
+				So(out, ShouldContainSubstring, `host: "flag-host" # flag -mongo-host`)
+				So(out, ShouldContainSubstring, `port: "9000" # file `+yml)
+				So(out, ShouldContainSubstring, `publisher: "log" # default`)
+			})
+		})
+	})
+
+	Convey("Given a TOML config file", t, func() {
+		dir, err := ioutil.TempDir("", "config")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		tml := filepath.Join(dir, "users.toml")
+		ioutil.WriteFile(tml, []byte("linkDomain = \"users\"\n[database]\nkind = \"mongodb\"\n[mongo]\nhost = \"db\"\n"), 0600)
+
+		Convey("When loaded with -config", func() {
+			c, r, err := Load([]string{"-config", tml}, env(nil))
+
+			Convey("Then its settings should apply", func() {
+				So(err, ShouldBeNil)
+				So(r.Err(), ShouldBeNil)
+				So(c.LinkDomain, ShouldEqual, "users")
+				So(c.Mongo.Host, ShouldEqual, "db")
+			})
+		})
+	})
+
+	Convey("Given a config file with a misspelt setting", t, func() {
+		dir, err := ioutil.TempDir("", "config")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		yml := filepath.Join(dir, "users.yml")
+		ioutil.WriteFile(yml, []byte("mongo:\n  hots: db\n"), 0600)
+
+		Convey("When loaded", func() {
+			_, _, err := Load([]string{"-config", yml}, env(nil))
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "mongo.hots")
+			})
+		})
+	})
+}
+
+func TestValidate(t *testing.T) {
+
+	Convey("Given an invalid configuration", t, func() {
+		_, r, err := Load([]string{"-port", "http", "-discovery", "consul", "-events", "webhook", "-tenant-sources", "header,cookie", "-trusted-proxies", "10.0.0.0/8,proxy", "-idempotency", "disk", "-batch-max", "0"}, env(nil))
+		So(err, ShouldBeNil)
+
+		Convey("When checked", func() {
+			err := r.Err()
+
+			Convey("Then every problem should be reported", func() {
+				So(err, ShouldNotBeNil)
+				for _, k := range []string{"port", "database.kind", "discovery.consulAddr", "events.url", "tenant.sources", "trustedProxies", "idempotency.store", "batchMax"} {
+					So(err.Error(), ShouldContainSubstring, k)
+				}
+				So(strings.HasPrefix(err.Error(), ErrInvalid.Error()), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given a value that cannot be parsed", t, func() {
+		_, _, err := Load([]string{"-drain-timeout", "soon"}, env(nil))
+
+		Convey("Then loading should fail", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+var ErrUnknownFormat = "Unknown config file format %v, use .yaml, .yml or .toml"
+
+// readFile returns the settings in a YAML or TOML file, flattened to dotted
+// keys with values as they would be written in the environment.
+func readFile(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &doc)
+	case ".toml":
+		_, err = toml.Decode(string(b), &doc)
+	default:
+		return nil, fmt.Errorf(ErrUnknownFormat, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	values := map[string]string{}
+	flatten(values, "", doc)
+	return values, nil
+}
+
+func flatten(values map[string]string, prefix string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			flatten(values, prefix+k+".", e)
+		}
+	case map[interface{}]interface{}:
+		for k, e := range v {
+			flatten(values, fmt.Sprintf("%v%v.", prefix, k), e)
+		}
+	case []interface{}:
+		l := make([]string, 0, len(v))
+		for _, e := range v {
+			l = append(l, fmt.Sprint(e))
+		}
+		values[strings.TrimSuffix(prefix, ".")] = strings.Join(l, ",")
+	case nil:
+	default:
+		values[strings.TrimSuffix(prefix, ".")] = fmt.Sprint(v)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
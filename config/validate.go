@@ -0,0 +1,242 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Validate returns the problems with c keyed by setting.
+func (c Config) Validate() map[string]string {
+	p := map[string]string{}
+	if n, err := strconv.Atoi(c.Port); err != nil || n < 1 || n > 65535 {
+		p["port"] = "must be a port number"
+	}
+	if c.DrainTimeout < 0 {
+		p["drainTimeout"] = "must not be negative"
+	}
+	if c.RequestTimeout < 0 {
+		p["requestTimeout"] = "must not be negative"
+	}
+	if strings.Contains(c.LinkDomain, "://") && !isURL(c.LinkDomain) {
+		p["linkDomain"] = "must be a host or an absolute URL"
+	}
+	for _, tp := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(tp); err != nil && net.ParseIP(tp) == nil {
+			p["trustedProxies"] = fmt.Sprintf("%q is not an address or CIDR range", tp)
+		}
+	}
+	if c.BatchMax < 1 {
+		p["batchMax"] = "must be at least 1"
+	}
+	if c.Health.CheckTimeout <= 0 {
+		p["health.checkTimeout"] = "must be positive"
+	}
+	for _, m := range c.Database.Middlewares {
+		switch m {
+		case "cache", "logging", "metrics", "tracing", "breaker", "retry", "timeout":
+		default:
+			p["database.middlewares"] = fmt.Sprintf("unknown middleware %q; must be cache, logging, metrics, tracing, breaker, retry or timeout", m)
+		}
+	}
+	if c.Database.Timeout <= 0 {
+		p["database.timeout"] = "must be positive"
+	}
+	if c.Database.Retries < 0 {
+		p["database.retries"] = "must not be negative"
+	}
+	if c.Database.RetryBackoff <= 0 {
+		p["database.retryBackoff"] = "must be positive"
+	}
+	if c.Database.ConnectTimeout <= 0 {
+		p["database.connectTimeout"] = "must be positive"
+	}
+	if c.Database.BreakerThreshold < 1 {
+		p["database.breakerThreshold"] = "must be at least 1"
+	}
+	if c.Database.BreakerCooldown <= 0 {
+		p["database.breakerCooldown"] = "must be positive"
+	}
+	switch c.Database.Kind {
+	case "":
+		p["database.kind"] = "is required"
+	case "mongodb":
+		if c.Mongo.Host == "" {
+			p["mongo.host"] = "is required for mongodb"
+		}
+	}
+	switch c.Cache.Kind {
+	case "", "none":
+	case "memory":
+		if c.Cache.Size < 1 {
+			p["cache.size"] = "must be at least 1"
+		}
+	case "redis":
+		if c.Cache.RedisAddr == "" {
+			p["cache.redisAddr"] = "is required for redis"
+		}
+	default:
+		p["cache.kind"] = "must be none, memory or redis"
+	}
+	if c.Cache.Kind != "" && c.Cache.Kind != "none" && c.Cache.TTL <= 0 {
+		p["cache.ttl"] = "must be positive"
+	}
+	switch c.Idempotency.Store {
+	case "", "none":
+	case "memory":
+		if c.Idempotency.Size < 1 {
+			p["idempotency.size"] = "must be at least 1"
+		}
+	case "redis":
+		if c.Cache.RedisAddr == "" {
+			p["cache.redisAddr"] = "is required for the redis idempotency store"
+		}
+		if strings.HasPrefix(c.Idempotency.RedisPrefix, c.Cache.RedisPrefix) || strings.HasPrefix(c.Cache.RedisPrefix, c.Idempotency.RedisPrefix) {
+			p["idempotency.redisPrefix"] = "must not overlap cache.redisPrefix, which the cache flushes"
+		}
+	default:
+		p["idempotency.store"] = "must be none, memory or redis"
+	}
+	if c.Idempotency.Store != "" && c.Idempotency.Store != "none" && c.Idempotency.TTL <= 0 {
+		p["idempotency.ttl"] = "must be positive"
+	}
+	for _, src := range c.Tenant.Sources {
+		switch src {
+		case "header":
+			if c.Tenant.Header == "" {
+				p["tenant.header"] = "is required for the header source"
+			}
+		case "claim":
+			if c.Tenant.Claim == "" {
+				p["tenant.claim"] = "is required for the claim source"
+			}
+		case "host":
+		default:
+			p["tenant.sources"] = fmt.Sprintf("unknown source %q; must be header, claim or host", src)
+		}
+	}
+	if !tenantID.MatchString(c.Tenant.Default) {
+		p["tenant.default"] = "must be lower case letters, digits and dashes"
+	}
+	if c.Tenant.Refresh <= 0 {
+		p["tenant.refresh"] = "must be positive"
+	}
+	switch c.Tracing.Exporter {
+	case "", "none", "stdout", "otlp-grpc", "otlp-http":
+	default:
+		p["tracing.exporter"] = "must be otlp-grpc, otlp-http, stdout or none"
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		p["tracing.sampleRatio"] = "must be between 0 and 1"
+	}
+	switch c.Discovery.Kind {
+	case "", "none", "static", "kubernetes", "dns":
+	case "consul":
+		if c.Discovery.ConsulAddr == "" {
+			p["discovery.consulAddr"] = "is required for consul"
+		}
+	default:
+		p["discovery.kind"] = "must be none, consul, static or kubernetes"
+	}
+	switch c.Events.Publisher {
+	case "", "log", "none":
+	case "webhook":
+		if !isURL(c.Events.WebhookURL) {
+			p["events.url"] = "must be an absolute URL for webhook"
+		}
+	default:
+		p["events.publisher"] = "must be log, webhook or none"
+	}
+	return p
+}
+
+// tenantID matches users.ValidTenantID, which config does not import.
+var tenantID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+type Setting struct {
+	Key     string
+	Value   string
+	Source  string
+	Problem string
+}
+
+// Report describes the effective configuration with secrets redacted.
+type Report []Setting
+
+// Err returns ErrInvalid with the problems found, or nil.
+func (r Report) Err() error {
+	problems := make([]string, 0)
+	for _, s := range r {
+		if s.Problem != "" {
+			problems = append(problems, fmt.Sprintf("%v %v", s.Key, s.Problem))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v: %v", ErrInvalid, strings.Join(problems, "; "))
+}
+
+// Log writes one line per setting, including the problem if it has one.
+func (r Report) Log(logger log.Logger) {
+	for _, s := range r {
+		kv := []interface{}{"key", s.Key, "value", s.Value, "source", s.Source}
+		if s.Problem != "" {
+			kv = append(kv, "err", s.Problem)
+		}
+		logger.Log(kv...)
+	}
+}
+
+// Print writes the configuration as YAML that can be loaded with -config,
+// noting the source of each value and any problem in comments.
+func (r Report) Print(w io.Writer) error {
+	section := ""
+	for _, s := range r {
+		key, indent := s.Key, ""
+		if i := strings.LastIndex(s.Key, "."); i >= 0 {
+			if s.Key[:i] != section {
+				section = s.Key[:i]
+				if _, err := fmt.Fprintf(w, "%v:\n", section); err != nil {
+					return err
+				}
+			}
+			key, indent = s.Key[i+1:], "  "
+		} else {
+			section = ""
+		}
+		comment := s.Source
+		if s.Problem != "" {
+			comment += ", " + s.Problem
+		}
+		if _, err := fmt.Fprintf(w, "%v%v: %v # %v\n", indent, key, strconv.Quote(s.Value), comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+
+	"github.com/aheadaviation/Users/users"
+)
+
+// Circuit breaker states, also the values of its state gauge.
+const (
+	BreakerClosed = iota
+	BreakerHalfOpen
+	BreakerOpen
+)
+
+var breakerStates = map[int]string{
+	BreakerClosed:   "closed",
+	BreakerHalfOpen: "half-open",
+	BreakerOpen:     "open",
+}
+
+// CircuitOpenError is returned without calling the database while the
+// breaker is open. RetryAfter is how long until it lets a call through.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e CircuitOpenError) Error() string {
+	return fmt.Sprintf("Database unavailable, retry in %v", e.RetryAfter)
+}
+
+// Breaker fails calls fast once the database looks down. After threshold
+// consecutive transient failures it opens and rejects every call for
+// cooldown. It then lets a single call through: if that succeeds it closes,
+// otherwise it opens for another cooldown. Errors that are not transient,
+// such as a missing record, show the database is up and count as success;
+// calls abandoned by their caller do not count at all.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	state     metrics.Gauge
+	rejected  metrics.Counter
+	now       func() time.Time
+
+	mtx      sync.Mutex
+	current  int
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// NewBreaker returns a closed breaker. state is set to the breaker state on
+// every change and rejected counts the calls refused while open.
+func NewBreaker(threshold int, cooldown time.Duration, state metrics.Gauge, rejected metrics.Counter) *Breaker {
+	state.Set(BreakerClosed)
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     state,
+		rejected:  rejected,
+		now:       time.Now,
+	}
+}
+
+// State returns closed, half-open or open.
+func (b *Breaker) State() string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return breakerStates[b.current]
+}
+
+// Check fails while the breaker is open, so it can be registered as a
+// health check.
+func (b *Breaker) Check() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.current == BreakerOpen {
+		return CircuitOpenError{RetryAfter: b.retryAfter()}
+	}
+	return nil
+}
+
+func (b *Breaker) allow() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	switch b.current {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			b.rejected.Add(1)
+			return CircuitOpenError{RetryAfter: b.retryAfter()}
+		}
+		b.set(BreakerHalfOpen)
+		b.trial = true
+	case BreakerHalfOpen:
+		if b.trial {
+			b.rejected.Add(1)
+			return CircuitOpenError{RetryAfter: time.Second}
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.trial = false
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		// The caller gave up, which says nothing about the database.
+		return
+	}
+	if !IsTransient(err) {
+		b.failures = 0
+		b.set(BreakerClosed)
+		return
+	}
+	b.failures++
+	if b.current == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.set(BreakerOpen)
+	}
+}
+
+func (b *Breaker) set(state int) {
+	if b.current != state {
+		b.current = state
+		b.state.Set(float64(state))
+	}
+}
+
+func (b *Breaker) retryAfter() time.Duration {
+	left := b.cooldown - b.now().Sub(b.openedAt)
+	if left < time.Second {
+		return time.Second
+	}
+	return left.Round(time.Second)
+}
+
+func (b *Breaker) do(f func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := f()
+	b.record(err)
+	return err
+}
+
+// BreakerMiddleware guards every operation with b. Ping is let through so
+// that health checks can see the database recover.
+func BreakerMiddleware(b *Breaker) Middleware {
+	return func(next Database) Database {
+		return breakerDatabase{next: next, b: b}
+	}
+}
+
+type breakerDatabase struct {
+	next Database
+	b    *Breaker
+}
+
+func (d breakerDatabase) Init() error {
+	return d.next.Init()
+}
+
+func (d breakerDatabase) GetUserByName(ctx context.Context, name string) (u users.User, err error) {
+	err = d.b.do(func() (err error) { u, err = d.next.GetUserByName(ctx, name); return })
+	return
+}
+
+func (d breakerDatabase) GetUser(ctx context.Context, id string) (u users.User, err error) {
+	err = d.b.do(func() (err error) { u, err = d.next.GetUser(ctx, id); return })
+	return
+}
+
+func (d breakerDatabase) GetUsers(ctx context.Context) (us []users.User, err error) {
+	err = d.b.do(func() (err error) { us, err = d.next.GetUsers(ctx); return })
+	return
+}
+
+func (d breakerDatabase) SearchUsers(ctx context.Context, query string, offset, limit int) (us []users.User, total int, err error) {
+	err = d.b.do(func() (err error) { us, total, err = d.next.SearchUsers(ctx, query, offset, limit); return })
+	return
+}
+
+func (d breakerDatabase) CreateUser(ctx context.Context, u *users.User) error {
+	return d.b.do(func() error { return d.next.CreateUser(ctx, u) })
+}
+
+func (d breakerDatabase) GetUserAttributes(ctx context.Context, u *users.User) error {
+	return d.b.do(func() error { return d.next.GetUserAttributes(ctx, u) })
+}
+
+func (d breakerDatabase) GetUsersAttributes(ctx context.Context, us []users.User) error {
+	return d.b.do(func() error { return d.next.GetUsersAttributes(ctx, us) })
+}
+
+func (d breakerDatabase) GetAddress(ctx context.Context, id string) (a users.Address, err error) {
+	err = d.b.do(func() (err error) { a, err = d.next.GetAddress(ctx, id); return })
+	return
+}
+
+func (d breakerDatabase) GetAddresses(ctx context.Context) (as []users.Address, err error) {
+	err = d.b.do(func() (err error) { as, err = d.next.GetAddresses(ctx); return })
+	return
+}
+
+func (d breakerDatabase) CreateAddress(ctx context.Context, a *users.Address, userid string) error {
+	return d.b.do(func() error { return d.next.CreateAddress(ctx, a, userid) })
+}
+
+func (d breakerDatabase) GetCard(ctx context.Context, id string) (c users.Card, err error) {
+	err = d.b.do(func() (err error) { c, err = d.next.GetCard(ctx, id); return })
+	return
+}
+
+func (d breakerDatabase) GetCards(ctx context.Context) (cs []users.Card, err error) {
+	err = d.b.do(func() (err error) { cs, err = d.next.GetCards(ctx); return })
+	return
+}
+
+func (d breakerDatabase) CreateCard(ctx context.Context, c *users.Card, userid string) error {
+	return d.b.do(func() error { return d.next.CreateCard(ctx, c, userid) })
+}
+
+func (d breakerDatabase) DeleteUser(ctx context.Context, id string) error {
+	return d.b.do(func() error { return d.next.DeleteUser(ctx, id) })
+}
+
+func (d breakerDatabase) DeleteAddress(ctx context.Context, id, userid string) error {
+	return d.b.do(func() error { return d.next.DeleteAddress(ctx, id, userid) })
+}
+
+func (d breakerDatabase) DeleteCard(ctx context.Context, id, userid string) error {
+	return d.b.do(func() error { return d.next.DeleteCard(ctx, id, userid) })
+}
+
+func (d breakerDatabase) CreateAddresses(ctx context.Context, as []users.Address, userids []string) (errs []error, err error) {
+	err = d.b.do(func() (err error) { errs, err = d.next.CreateAddresses(ctx, as, userids); return })
+	return
+}
+
+func (d breakerDatabase) CreateCards(ctx context.Context, cs []users.Card, userids []string) (errs []error, err error) {
+	err = d.b.do(func() (err error) { errs, err = d.next.CreateCards(ctx, cs, userids); return })
+	return
+}
+
+func (d breakerDatabase) DeleteUsers(ctx context.Context, ids []string) (errs []error, err error) {
+	err = d.b.do(func() (err error) { errs, err = d.next.DeleteUsers(ctx, ids); return })
+	return
+}
+
+func (d breakerDatabase) EraseUser(ctx context.Context, id string) (u users.User, err error) {
+	err = d.b.do(func() (err error) { u, err = d.next.EraseUser(ctx, id); return })
+	return
+}
+
+func (d breakerDatabase) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error {
+	return d.b.do(func() error { return d.next.SetDefaultAddress(ctx, userid, kind, addressid) })
+}
+
+func (d breakerDatabase) SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) error {
+	return d.b.do(func() error { return d.next.SetCardBillingAddress(ctx, cardid, addressid, userid) })
+}
+
+func (d breakerDatabase) SetPassword(ctx context.Context, userid, password, salt string) error {
+	return d.b.do(func() error { return d.next.SetPassword(ctx, userid, password, salt) })
+}
+
+func (d breakerDatabase) SetDisabled(ctx context.Context, userid string, disabled bool) error {
+	return d.b.do(func() error { return d.next.SetDisabled(ctx, userid, disabled) })
+}
+
+func (d breakerDatabase) CreateTenant(ctx context.Context, t *users.Tenant) error {
+	return d.b.do(func() error { return d.next.CreateTenant(ctx, t) })
+}
+
+func (d breakerDatabase) GetTenants(ctx context.Context) (ts []users.Tenant, err error) {
+	err = d.b.do(func() (err error) { ts, err = d.next.GetTenants(ctx); return })
+	return
+}
+
+func (d breakerDatabase) Ping(ctx context.Context) error {
+	return d.next.Ping(ctx)
+}
+
+func (d breakerDatabase) Close() error {
+	return d.next.Close()
+}
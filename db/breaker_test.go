@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/generic"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBreaker(t *testing.T) {
+
+	Convey("Given a breaker that opens after two failures", t, func() {
+		state := generic.NewGauge("state")
+		rejected := generic.NewCounter("rejected")
+		b := NewBreaker(2, 10*time.Second, state, rejected)
+		now := time.Now()
+		b.now = func() time.Time { return now }
+		f := &fakeDatabase{}
+		d := BreakerMiddleware(b)(f)
+		ctx := context.Background()
+
+		Convey("When calls fail with errors that are not transient", func() {
+			f.errs = []error{errors.New("not found"), errors.New("not found"), errors.New("not found")}
+			d.GetUser(ctx, "1")
+			d.GetUser(ctx, "1")
+			d.GetUser(ctx, "1")
+
+			Convey("Then it stays closed", func() {
+				So(b.State(), ShouldEqual, "closed")
+				So(b.Check(), ShouldBeNil)
+			})
+		})
+
+		Convey("When calls fail transiently", func() {
+			f.errs = []error{io.EOF, io.EOF}
+			d.GetUser(ctx, "1")
+			d.GetUser(ctx, "1")
+
+			Convey("Then it opens and rejects calls without trying", func() {
+				So(b.State(), ShouldEqual, "open")
+				So(state.Value(), ShouldEqual, BreakerOpen)
+				_, err := d.GetUser(ctx, "1")
+				So(err, ShouldResemble, CircuitOpenError{RetryAfter: 10 * time.Second})
+				So(f.calls, ShouldEqual, 2)
+				So(rejected.Value(), ShouldEqual, 1)
+				So(b.Check(), ShouldNotBeNil)
+			})
+
+			Convey("Then after the cooldown a successful call closes it", func() {
+				now = now.Add(10 * time.Second)
+				_, err := d.GetUser(ctx, "1")
+				So(err, ShouldBeNil)
+				So(b.State(), ShouldEqual, "closed")
+				So(state.Value(), ShouldEqual, BreakerClosed)
+			})
+
+			Convey("Then after the cooldown a failed call opens it again", func() {
+				now = now.Add(10 * time.Second)
+				f.errs = []error{io.EOF}
+				d.GetUser(ctx, "1")
+				So(b.State(), ShouldEqual, "open")
+				_, err := d.GetUser(ctx, "1")
+				So(err, ShouldHaveSameTypeAs, CircuitOpenError{})
+			})
+		})
+	})
+}
+
+type flakyDatabase struct {
+	fakeDatabase
+	fails int
+	inits int
+}
+
+func (d *flakyDatabase) Init() error {
+	d.inits++
+	if d.inits <= d.fails {
+		return errors.New("no reachable servers")
+	}
+	return nil
+}
+
+func TestConnect(t *testing.T) {
+
+	Convey("Given a database that is not up yet", t, func() {
+		backoff := ConnectBackoff
+		ConnectBackoff = time.Millisecond
+		defer func() { ConnectBackoff = backoff }()
+		f := &flakyDatabase{fails: 2}
+		Register("flaky", f)
+		defer delete(DBTypes, "flaky")
+
+		Convey("When it comes up before the deadline", func() {
+			err := Connect(context.Background(), "flaky", log.NewNopLogger())
+
+			Convey("Then connecting succeeds after retrying", func() {
+				So(err, ShouldBeNil)
+				So(f.inits, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the deadline passes first", func() {
+			f.fails = 1000
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := Connect(ctx, "flaky", log.NewNopLogger())
+
+			Convey("Then the last error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(f.inits, ShouldBeGreaterThan, 1)
+			})
+		})
+
+		Convey("When the database is not known", func() {
+			err := Connect(context.Background(), "other", log.NewNopLogger())
+
+			Convey("Then it fails at once", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,401 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/users"
+)
+
+// Middleware caches customers, their addresses and cards, and single
+// addresses and cards looked up by ID. Values are copied in and out of store
+// encoded, so callers never share them. Lookups of everything and by
+// username are not cached.
+//
+// Writes delete the entries they change. Where the database does not say
+// which customer a write affects, such as deleting an address, every entry
+// is dropped. Store errors are ignored: the database is read instead, and an
+// entry that could not be deleted lives until its ttl. hits and misses are
+// labelled by kind: user, attributes, address or card. Entries are kept
+// apart per tenant. Tenants are not cached.
+func Middleware(store Store, ttl time.Duration, hits, misses metrics.Counter) db.Middleware {
+	return func(next db.Database) db.Database {
+		return &cachingDatabase{
+			next:   next,
+			store:  store,
+			ttl:    ttl,
+			hits:   hits,
+			misses: misses,
+		}
+	}
+}
+
+type cachingDatabase struct {
+	next   db.Database
+	store  Store
+	ttl    time.Duration
+	hits   metrics.Counter
+	misses metrics.Counter
+	flight flight
+}
+
+// attributes is the cached result of GetUserAttributes.
+type attributes struct {
+	Addresses []users.Address
+	Cards     []users.Card
+}
+
+func userKey(id string) string { return "user:" + id }
+
+// attrsKey names the attributes of a customer by the IDs of its addresses
+// and cards as well as its own, so that once these change the old entry is
+// no longer read.
+func attrsKey(u users.User) string {
+	ids := make([]string, 0, len(u.Addresses)+len(u.Cards)+1)
+	for _, a := range u.Addresses {
+		ids = append(ids, "a"+a.ID)
+	}
+	for _, c := range u.Cards {
+		ids = append(ids, "c"+c.ID)
+	}
+	sort.Strings(ids)
+	h := sha1.Sum([]byte(strings.Join(ids, ",")))
+	return "attrs:" + u.UserID + ":" + hex.EncodeToString(h[:8])
+}
+
+// tenantKey puts key in the namespace of the tenant of ctx, so that no
+// tenant reads an entry another one stored.
+func tenantKey(ctx context.Context, key string) string {
+	return reqctx.Tenant(ctx) + ":" + key
+}
+
+// ownerKeys names the entries of the customers in userids, skipping the
+// blank IDs of items with no owner.
+func ownerKeys(userids []string) []string {
+	keys := make([]string, 0, len(userids))
+	for _, id := range userids {
+		if id != "" {
+			keys = append(keys, userKey(id))
+		}
+	}
+	return keys
+}
+
+func addressKey(id string) string { return "address:" + id }
+func cardKey(id string) string    { return "card:" + id }
+
+// read decodes the entry under key into out, or calls fetch, stores what it
+// returns and decodes that. Concurrent misses on one key share a fetch. A
+// caller whose shared fetch was abandoned by the caller that made it fetches
+// again itself.
+func (d *cachingDatabase) read(ctx context.Context, kind, key string, out interface{}, fetch func() (interface{}, error)) error {
+	key = tenantKey(ctx, key)
+	if b, ok, err := d.store.Get(ctx, key); err == nil && ok && decode(b, out) == nil {
+		d.hits.With("kind", kind).Add(1)
+		return nil
+	}
+	d.misses.With("kind", kind).Add(1)
+	load := func(raced func() bool) ([]byte, error) {
+		v, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		b, err := encode(v)
+		if err != nil {
+			return nil, err
+		}
+		if !raced() {
+			d.store.Set(ctx, key, b, d.ttl)
+		}
+		return b, nil
+	}
+	b, err, shared := d.flight.do(key, load)
+	if shared && isContextErr(err) && ctx.Err() == nil {
+		b, err = load(func() bool { return true })
+	}
+	if err != nil {
+		return err
+	}
+	return decode(b, out)
+}
+
+// invalidateTimeout bounds the deletes of an invalidation.
+const invalidateTimeout = time.Second
+
+// invalidate deletes keys, or every entry when none are given. It runs in a
+// context of its own carrying only the tenant, so that a request cancelled
+// right after its write still drops the entries it made stale.
+func (d *cachingDatabase) invalidate(ctx context.Context, keys ...string) {
+	d.flight.invalidated()
+	ctx, cancel := context.WithTimeout(reqctx.WithTenant(context.Background(), reqctx.Tenant(ctx)), invalidateTimeout)
+	defer cancel()
+	if len(keys) == 0 {
+		d.store.Flush(ctx)
+		return
+	}
+	scoped := make([]string, len(keys))
+	for i, k := range keys {
+		scoped[i] = tenantKey(ctx, k)
+	}
+	d.store.Delete(ctx, scoped...)
+}
+
+func (d *cachingDatabase) Init() error {
+	return d.next.Init()
+}
+
+func (d *cachingDatabase) GetUserByName(ctx context.Context, name string) (users.User, error) {
+	return d.next.GetUserByName(ctx, name)
+}
+
+func (d *cachingDatabase) GetUser(ctx context.Context, id string) (users.User, error) {
+	var u users.User
+	err := d.read(ctx, "user", userKey(id), &u, func() (interface{}, error) {
+		return d.next.GetUser(ctx, id)
+	})
+	if err != nil {
+		return users.New(), err
+	}
+	return u, nil
+}
+
+func (d *cachingDatabase) GetUsers(ctx context.Context) ([]users.User, error) {
+	return d.next.GetUsers(ctx)
+}
+
+func (d *cachingDatabase) SearchUsers(ctx context.Context, query string, offset, limit int) ([]users.User, int, error) {
+	return d.next.SearchUsers(ctx, query, offset, limit)
+}
+
+func (d *cachingDatabase) CreateUser(ctx context.Context, u *users.User) error {
+	return d.next.CreateUser(ctx, u)
+}
+
+func (d *cachingDatabase) GetUserAttributes(ctx context.Context, u *users.User) error {
+	if u.UserID == "" {
+		return d.next.GetUserAttributes(ctx, u)
+	}
+	var got attributes
+	err := d.read(ctx, "attributes", attrsKey(*u), &got, func() (interface{}, error) {
+		cp := *u
+		if err := d.next.GetUserAttributes(ctx, &cp); err != nil {
+			return nil, err
+		}
+		return attributes{Addresses: cp.Addresses, Cards: cp.Cards}, nil
+	})
+	if err != nil {
+		return err
+	}
+	u.Addresses, u.Cards = got.Addresses, got.Cards
+	return nil
+}
+
+func (d *cachingDatabase) GetUsersAttributes(ctx context.Context, us []users.User) error {
+	return d.next.GetUsersAttributes(ctx, us)
+}
+
+func (d *cachingDatabase) GetAddress(ctx context.Context, id string) (users.Address, error) {
+	var a users.Address
+	err := d.read(ctx, "address", addressKey(id), &a, func() (interface{}, error) {
+		return d.next.GetAddress(ctx, id)
+	})
+	if err != nil {
+		return users.Address{}, err
+	}
+	return a, nil
+}
+
+func (d *cachingDatabase) GetAddresses(ctx context.Context) ([]users.Address, error) {
+	return d.next.GetAddresses(ctx)
+}
+
+func (d *cachingDatabase) CreateAddress(ctx context.Context, a *users.Address, userid string) error {
+	err := d.next.CreateAddress(ctx, a, userid)
+	if userid != "" {
+		d.invalidate(ctx, userKey(userid))
+	}
+	return err
+}
+
+func (d *cachingDatabase) GetCard(ctx context.Context, id string) (users.Card, error) {
+	var c users.Card
+	err := d.read(ctx, "card", cardKey(id), &c, func() (interface{}, error) {
+		return d.next.GetCard(ctx, id)
+	})
+	if err != nil {
+		return users.Card{}, err
+	}
+	return c, nil
+}
+
+func (d *cachingDatabase) GetCards(ctx context.Context) ([]users.Card, error) {
+	return d.next.GetCards(ctx)
+}
+
+func (d *cachingDatabase) CreateCard(ctx context.Context, c *users.Card, userid string) error {
+	err := d.next.CreateCard(ctx, c, userid)
+	if userid != "" {
+		d.invalidate(ctx, userKey(userid))
+	}
+	return err
+}
+
+// DeleteUser drops a customer's entries along with those of its addresses
+// and cards.
+func (d *cachingDatabase) DeleteUser(ctx context.Context, id string) error {
+	keys := d.customerKeys(ctx, id)
+	err := d.next.DeleteUser(ctx, id)
+	d.invalidate(ctx, keys...)
+	return err
+}
+
+// DeleteAddress and DeleteCard can change customers that are not known
+// here, so they drop every entry.
+func (d *cachingDatabase) DeleteAddress(ctx context.Context, id, userid string) error {
+	err := d.next.DeleteAddress(ctx, id, userid)
+	d.invalidate(ctx)
+	return err
+}
+
+func (d *cachingDatabase) DeleteCard(ctx context.Context, id, userid string) error {
+	err := d.next.DeleteCard(ctx, id, userid)
+	d.invalidate(ctx)
+	return err
+}
+
+func (d *cachingDatabase) CreateAddresses(ctx context.Context, as []users.Address, userids []string) ([]error, error) {
+	errs, err := d.next.CreateAddresses(ctx, as, userids)
+	d.invalidate(ctx, ownerKeys(userids)...)
+	return errs, err
+}
+
+func (d *cachingDatabase) CreateCards(ctx context.Context, cs []users.Card, userids []string) ([]error, error) {
+	errs, err := d.next.CreateCards(ctx, cs, userids)
+	d.invalidate(ctx, ownerKeys(userids)...)
+	return errs, err
+}
+
+// DeleteUsers drops the entries of every customer like DeleteUser, or every
+// entry when the keys of any of them cannot be read.
+func (d *cachingDatabase) DeleteUsers(ctx context.Context, ids []string) ([]error, error) {
+	keys := make([]string, 0)
+	for _, id := range ids {
+		ck := d.customerKeys(ctx, id)
+		if ck == nil {
+			keys = nil
+			break
+		}
+		keys = append(keys, ck...)
+	}
+	errs, err := d.next.DeleteUsers(ctx, ids)
+	d.invalidate(ctx, keys...)
+	return errs, err
+}
+
+func (d *cachingDatabase) EraseUser(ctx context.Context, id string) (users.User, error) {
+	keys := d.customerKeys(ctx, id)
+	u, err := d.next.EraseUser(ctx, id)
+	d.invalidate(ctx, keys...)
+	return u, err
+}
+
+func (d *cachingDatabase) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error {
+	err := d.next.SetDefaultAddress(ctx, userid, kind, addressid)
+	d.invalidate(ctx, userKey(userid))
+	return err
+}
+
+// SetCardBillingAddress drops every entry, as the card is cached among its
+// owner's attributes and the owner is not known here.
+func (d *cachingDatabase) SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) error {
+	err := d.next.SetCardBillingAddress(ctx, cardid, addressid, userid)
+	d.invalidate(ctx)
+	return err
+}
+
+func (d *cachingDatabase) SetPassword(ctx context.Context, userid, password, salt string) error {
+	err := d.next.SetPassword(ctx, userid, password, salt)
+	d.invalidate(ctx, userKey(userid))
+	return err
+}
+
+func (d *cachingDatabase) SetDisabled(ctx context.Context, userid string, disabled bool) error {
+	err := d.next.SetDisabled(ctx, userid, disabled)
+	d.invalidate(ctx, userKey(userid))
+	return err
+}
+
+func (d *cachingDatabase) CreateTenant(ctx context.Context, t *users.Tenant) error {
+	return d.next.CreateTenant(ctx, t)
+}
+
+func (d *cachingDatabase) GetTenants(ctx context.Context) ([]users.Tenant, error) {
+	return d.next.GetTenants(ctx)
+}
+
+func (d *cachingDatabase) Ping(ctx context.Context) error {
+	return d.next.Ping(ctx)
+}
+
+func (d *cachingDatabase) Close() error {
+	return d.next.Close()
+}
+
+// customerKeys returns the keys of the customer id and of its addresses
+// and cards, read from the database. If they cannot be read it returns none,
+// so that invalidating them drops every entry.
+func (d *cachingDatabase) customerKeys(ctx context.Context, id string) []string {
+	u, err := d.next.GetUser(ctx, id)
+	if err != nil {
+		return nil
+	}
+	keys := []string{userKey(id), attrsKey(u)}
+	if err := d.next.GetUserAttributes(ctx, &u); err != nil {
+		return nil
+	}
+	for _, a := range u.Addresses {
+		keys = append(keys, addressKey(a.ID))
+	}
+	for _, c := range u.Cards {
+		keys = append(keys, cardKey(c.ID))
+	}
+	return keys
+}
+
+func isContextErr(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func decode(b []byte, out interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(out)
+}
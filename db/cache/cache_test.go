@@ -0,0 +1,264 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/users"
+)
+
+var errNotFound = errors.New("not found")
+
+// countingDatabase keeps one customer with one address and counts reads.
+type countingDatabase struct {
+	db.Database
+	mtx   sync.Mutex
+	reads int
+	delay time.Duration
+	user  users.User
+	addrs map[string]users.Address
+}
+
+func newCountingDatabase() *countingDatabase {
+	return &countingDatabase{
+		user: users.User{UserID: "u1", FirstName: "Ann", Addresses: []users.Address{{ID: "a1"}}, Cards: []users.Card{}},
+		addrs: map[string]users.Address{
+			"a1": {ID: "a1", Street: "High Street"},
+		},
+	}
+}
+
+func (d *countingDatabase) read() {
+	d.mtx.Lock()
+	d.reads++
+	d.mtx.Unlock()
+	time.Sleep(d.delay)
+}
+
+func (d *countingDatabase) Reads() int {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.reads
+}
+
+func (d *countingDatabase) GetUser(_ context.Context, id string) (users.User, error) {
+	d.read()
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if id != d.user.UserID {
+		return users.User{}, errNotFound
+	}
+	u := d.user
+	u.Addresses = make([]users.Address, 0)
+	for _, a := range d.user.Addresses {
+		u.Addresses = append(u.Addresses, users.Address{ID: a.ID})
+	}
+	return u, nil
+}
+
+func (d *countingDatabase) GetUserAttributes(_ context.Context, u *users.User) error {
+	d.read()
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	as := make([]users.Address, 0)
+	for _, a := range u.Addresses {
+		as = append(as, d.addrs[a.ID])
+	}
+	u.Addresses = as
+	return nil
+}
+
+func (d *countingDatabase) CreateAddress(_ context.Context, a *users.Address, userid string) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	a.ID = "a2"
+	d.addrs[a.ID] = *a
+	d.user.Addresses = append(d.user.Addresses, *a)
+	return nil
+}
+
+func (d *countingDatabase) CreateAddresses(ctx context.Context, as []users.Address, userids []string) ([]error, error) {
+	for k := range as {
+		d.CreateAddress(ctx, &as[k], userids[k])
+	}
+	return make([]error, len(as)), nil
+}
+
+func (d *countingDatabase) DeleteUsers(ctx context.Context, ids []string) ([]error, error) {
+	return make([]error, len(ids)), nil
+}
+
+func (d *countingDatabase) SetCardBillingAddress(_ context.Context, cardid, addressid, userid string) error {
+	return nil
+}
+
+func (d *countingDatabase) EraseUser(_ context.Context, id string) (users.User, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.user.FirstName = "Erased"
+	return d.user, nil
+}
+
+// counter counts across all label values.
+type counter struct {
+	mtx sync.Mutex
+	n   float64
+}
+
+func (c *counter) With(...string) metrics.Counter { return c }
+
+func (c *counter) Add(delta float64) {
+	c.mtx.Lock()
+	c.n += delta
+	c.mtx.Unlock()
+}
+
+func (c *counter) Value() float64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.n
+}
+
+func TestCache(t *testing.T) {
+	stores := map[string]func() (Store, func()){
+		"memory": func() (Store, func()) { return NewLRU(100), func() {} },
+		"redis": func() (Store, func()) {
+			f := newFakeRedis("")
+			r := NewRedis(f.Addr(), "", "users:", 4)
+			return r, func() { r.Close(); f.Close() }
+		},
+	}
+	for name, newStore := range stores {
+
+		Convey("Given a database cached in "+name, t, func() {
+			ctx := context.Background()
+			store, done := newStore()
+			defer done()
+			next := newCountingDatabase()
+			hits, misses := &counter{}, &counter{}
+			d := Middleware(store, time.Minute, hits, misses)(next)
+
+			Convey("When a customer is read twice", func() {
+				u, err := d.GetUser(ctx, "u1")
+				So(err, ShouldBeNil)
+				u.FirstName = "Changed by caller"
+				u, err = d.GetUser(ctx, "u1")
+				So(err, ShouldBeNil)
+
+				Convey("Then the database is read once", func() {
+					So(next.Reads(), ShouldEqual, 1)
+					So(hits.Value(), ShouldEqual, 1)
+					So(misses.Value(), ShouldEqual, 1)
+				})
+
+				Convey("Then callers do not share the value", func() {
+					So(u.FirstName, ShouldEqual, "Ann")
+				})
+			})
+
+			Convey("When two tenants read the same ID", func() {
+				d.GetUser(reqctx.WithTenant(ctx, "acme"), "u1")
+				d.GetUser(reqctx.WithTenant(ctx, "globex"), "u1")
+
+				Convey("Then neither reads the other's entry", func() {
+					So(next.Reads(), ShouldEqual, 2)
+				})
+			})
+
+			Convey("When a missing customer is read twice", func() {
+				d.GetUser(ctx, "u2")
+				_, err := d.GetUser(ctx, "u2")
+
+				Convey("Then the error is not cached", func() {
+					So(err, ShouldEqual, errNotFound)
+					So(next.Reads(), ShouldEqual, 2)
+				})
+			})
+
+			Convey("When attributes are read twice", func() {
+				u, _ := d.GetUser(ctx, "u1")
+				So(d.GetUserAttributes(ctx, &u), ShouldBeNil)
+				u, _ = d.GetUser(ctx, "u1")
+				So(d.GetUserAttributes(ctx, &u), ShouldBeNil)
+
+				Convey("Then the database is read once for them", func() {
+					So(next.Reads(), ShouldEqual, 2)
+					So(u.Addresses[0].Street, ShouldEqual, "High Street")
+				})
+
+				Convey("Then adding an address shows on the next read", func() {
+					d.CreateAddress(ctx, &users.Address{Street: "Low Street"}, "u1")
+					u, _ = d.GetUser(ctx, "u1")
+					So(d.GetUserAttributes(ctx, &u), ShouldBeNil)
+					So(len(u.Addresses), ShouldEqual, 2)
+				})
+
+				Convey("Then adding an address for a request past its deadline shows on the next read", func() {
+					acme := reqctx.WithTenant(ctx, "acme")
+					u, _ = d.GetUser(acme, "u1")
+					d.GetUserAttributes(acme, &u)
+					expired, cancel := context.WithDeadline(acme, time.Now())
+					defer cancel()
+					d.CreateAddress(expired, &users.Address{Street: "Low Street"}, "u1")
+					u, _ = d.GetUser(acme, "u1")
+					So(d.GetUserAttributes(acme, &u), ShouldBeNil)
+					So(len(u.Addresses), ShouldEqual, 2)
+				})
+
+				Convey("Then adding a batch of addresses shows on the next read", func() {
+					d.CreateAddresses(ctx, []users.Address{{Street: "Low Street"}}, []string{"u1"})
+					u, _ = d.GetUser(ctx, "u1")
+					So(d.GetUserAttributes(ctx, &u), ShouldBeNil)
+					So(len(u.Addresses), ShouldEqual, 2)
+				})
+
+				Convey("Then deleting a customer that cannot be read drops every entry", func() {
+					d.DeleteUsers(ctx, []string{"missing"})
+					reads := next.Reads()
+					u, _ = d.GetUser(ctx, "u1")
+					d.GetUserAttributes(ctx, &u)
+					So(next.Reads(), ShouldEqual, reads+2)
+				})
+
+				Convey("Then erasing the customer shows on the next read", func() {
+					d.EraseUser(ctx, "u1")
+					u, _ = d.GetUser(ctx, "u1")
+					So(u.FirstName, ShouldEqual, "Erased")
+				})
+
+				Convey("Then changing a billing address drops every entry", func() {
+					reads := next.Reads()
+					d.SetCardBillingAddress(ctx, "c1", "a1", "")
+					u, _ = d.GetUser(ctx, "u1")
+					d.GetUserAttributes(ctx, &u)
+					So(next.Reads(), ShouldEqual, reads+2)
+				})
+			})
+
+			Convey("When many requests miss at once", func() {
+				next.delay = 50 * time.Millisecond
+				var wg sync.WaitGroup
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						d.GetUser(ctx, "u1")
+					}()
+				}
+				wg.Wait()
+
+				Convey("Then the database is read once", func() {
+					So(next.Reads(), ShouldEqual, 1)
+				})
+			})
+		})
+	}
+}
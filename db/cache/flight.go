@@ -0,0 +1,73 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// flight makes concurrent loads of the same key share one call, so that an
+// entry expiring under load sends one query to the database rather than one
+// per request. It also counts invalidations, so that a load which raced a
+// write can tell not to store what it read.
+type flight struct {
+	mtx    sync.Mutex
+	calls  map[string]*call
+	writes uint64
+}
+
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// do runs load unless a load of key is in flight, in which case it waits for
+// that one and returns its result. shared reports the latter. load is told
+// whether anything was invalidated since it began.
+func (f *flight) do(key string, load func(raced func() bool) ([]byte, error)) (value []byte, err error, shared bool) {
+	f.mtx.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*call)
+	}
+	if c, ok := f.calls[key]; ok {
+		f.mtx.Unlock()
+		<-c.done
+		return c.value, c.err, true
+	}
+	c := &call{done: make(chan struct{})}
+	f.calls[key] = c
+	f.mtx.Unlock()
+
+	began := atomic.LoadUint64(&f.writes)
+	c.value, c.err = load(func() bool { return atomic.LoadUint64(&f.writes) != began })
+	f.mtx.Lock()
+	if f.calls[key] == c {
+		delete(f.calls, key)
+	}
+	f.mtx.Unlock()
+	close(c.done)
+	return c.value, c.err, false
+}
+
+// invalidated records a write. Loads in flight will not store their result
+// and later calls start new loads rather than sharing theirs.
+func (f *flight) invalidated() {
+	f.mtx.Lock()
+	atomic.AddUint64(&f.writes, 1)
+	f.calls = nil
+	f.mtx.Unlock()
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLRU(t *testing.T) {
+
+	Convey("Given an LRU of two entries", t, func() {
+		ctx := context.Background()
+		c := NewLRU(2)
+		now := time.Now()
+		c.now = func() time.Time { return now }
+		c.Set(ctx, "a", []byte("1"), time.Minute)
+		c.Set(ctx, "b", []byte("2"), time.Minute)
+
+		Convey("When a third is added", func() {
+			c.Get(ctx, "a")
+			c.Set(ctx, "c", []byte("3"), time.Minute)
+
+			Convey("Then the least recently used is evicted", func() {
+				_, ok, _ := c.Get(ctx, "b")
+				So(ok, ShouldBeFalse)
+				v, ok, _ := c.Get(ctx, "a")
+				So(ok, ShouldBeTrue)
+				So(string(v), ShouldEqual, "1")
+				So(c.Len(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When an entry outlives its ttl", func() {
+			now = now.Add(time.Minute)
+
+			Convey("Then it is gone", func() {
+				_, ok, _ := c.Get(ctx, "a")
+				So(ok, ShouldBeFalse)
+				So(c.Len(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When entries are deleted or flushed", func() {
+			c.Delete(ctx, "a")
+			_, ok, _ := c.Get(ctx, "a")
+			So(ok, ShouldBeFalse)
+			c.Flush(ctx)
+
+			Convey("Then none are left", func() {
+				So(c.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
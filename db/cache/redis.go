@@ -0,0 +1,270 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrRedisProtocol = errors.New("Invalid reply from redis")
+	// DefaultRedisTimeout bounds each command when the context has no
+	// deadline.
+	DefaultRedisTimeout = time.Second
+)
+
+// RedisError is an error reply from the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// Redis is a Store on a server speaking the Redis protocol. Every key is
+// prefixed so that the cache can share a database with other users and be
+// flushed without touching their keys. Values are stored with their TTL, so
+// the server should evict with volatile-lru or allkeys-lru.
+type Redis struct {
+	addr     string
+	password string
+	prefix   string
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// NewRedis returns a store on the server at addr keeping up to poolSize idle
+// connections. Connections are made as they are needed.
+func NewRedis(addr, password, prefix string, poolSize int) *Redis {
+	return &Redis{
+		addr:     addr,
+		password: password,
+		prefix:   prefix,
+		pool:     make(chan *redisConn, poolSize),
+	}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, err := r.do(ctx, "GET", r.prefix+key)
+	if err != nil || v == nil {
+		return nil, false, err
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, false, ErrRedisProtocol
+	}
+	return b, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	_, err := r.do(ctx, "SET", r.prefix+key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := []string{"DEL"}
+	for _, k := range keys {
+		args = append(args, r.prefix+k)
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// Flush deletes every key with the prefix. It walks the keyspace with SCAN,
+// which is slow on a large database but does not block the server.
+func (r *Redis) Flush(ctx context.Context) error {
+	cursor := "0"
+	for {
+		v, err := r.do(ctx, "SCAN", cursor, "MATCH", r.prefix+"*", "COUNT", "500")
+		if err != nil {
+			return err
+		}
+		reply, ok := v.([]interface{})
+		if !ok || len(reply) != 2 {
+			return ErrRedisProtocol
+		}
+		next, ok := reply[0].([]byte)
+		keys, ok2 := reply[1].([]interface{})
+		if !ok || !ok2 {
+			return ErrRedisProtocol
+		}
+		if len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, k := range keys {
+				b, ok := k.([]byte)
+				if !ok {
+					return ErrRedisProtocol
+				}
+				args = append(args, string(b))
+			}
+			if _, err := r.do(ctx, args...); err != nil {
+				return err
+			}
+		}
+		cursor = string(next)
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// Check pings the server, so it can be registered as a health check.
+func (r *Redis) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRedisTimeout)
+	defer cancel()
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections.
+func (r *Redis) Close() error {
+	for {
+		select {
+		case c := <-r.pool:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends one command and reads its reply: nil, a string, an int64, a
+// []byte or an []interface{} of those. An error reply is returned as a
+// RedisError and leaves the connection usable; any other error closes it.
+func (r *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultRedisTimeout)
+	}
+	c.SetDeadline(deadline)
+	v, err := c.command(args...)
+	if _, isReply := err.(RedisError); err != nil && !isReply {
+		c.Close()
+		return nil, err
+	}
+	select {
+	case r.pool <- c:
+	default:
+		c.Close()
+	}
+	return v, err
+}
+
+func (r *Redis) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.pool:
+		return c, nil
+	default:
+	}
+	d := net.Dialer{Timeout: DefaultRedisTimeout}
+	nc, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if r.password != "" {
+		if deadline, ok := ctx.Deadline(); ok {
+			c.SetDeadline(deadline)
+		} else {
+			c.SetDeadline(time.Now().Add(DefaultRedisTimeout))
+		}
+		if _, err := c.command("AUTH", r.password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) command(args ...string) (interface{}, error) {
+	w := bufio.NewWriter(c.Conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrRedisProtocol
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, RedisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, ErrRedisProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, ErrRedisProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	return nil, ErrRedisProtocol
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeRedis serves the commands Redis uses from memory.
+type fakeRedis struct {
+	l        net.Listener
+	password string
+
+	mtx     sync.Mutex
+	data    map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis(password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	f := &fakeRedis{l: l, password: password, data: map[string]string{}, expires: map[string]time.Time{}}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) Addr() string { return f.l.Addr().String() }
+func (f *fakeRedis) Close()       { f.l.Close() }
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := f.password == ""
+	for {
+		v, err := readReply(r)
+		if err != nil {
+			return
+		}
+		args := make([]string, 0)
+		for _, a := range v.([]interface{}) {
+			args = append(args, string(a.([]byte)))
+		}
+		cmd := strings.ToUpper(args[0])
+		if cmd == "AUTH" {
+			if args[1] != f.password {
+				fmt.Fprint(c, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authed = true
+			fmt.Fprint(c, "+OK\r\n")
+			continue
+		}
+		if !authed {
+			fmt.Fprint(c, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		fmt.Fprint(c, f.exec(cmd, args[1:]))
+	}
+}
+
+func (f *fakeRedis) exec(cmd string, args []string) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		v, ok := f.data[args[0]]
+		if !ok || time.Now().After(f.expires[args[0]]) {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		ms, _ := strconv.Atoi(args[3])
+		f.data[args[0]] = args[1]
+		f.expires[args[0]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			if _, ok := f.data[k]; ok {
+				delete(f.data, k)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SCAN":
+		keys := make([]string, 0)
+		for k := range f.data {
+			if ok, _ := path.Match(args[2], k); ok {
+				keys = append(keys, fmt.Sprintf("$%d\r\n%s\r\n", len(k), k))
+			}
+		}
+		return fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n%s", len(keys), strings.Join(keys, ""))
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (f *fakeRedis) keys() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return len(f.data)
+}
+
+func TestRedis(t *testing.T) {
+
+	Convey("Given a redis store", t, func() {
+		ctx := context.Background()
+		f := newFakeRedis("secret")
+		defer f.Close()
+		r := NewRedis(f.Addr(), "secret", "users:", 2)
+		defer r.Close()
+
+		Convey("When a value is set", func() {
+			So(r.Set(ctx, "user:1", []byte("a\r\nb"), time.Minute), ShouldBeNil)
+
+			Convey("Then it is read back under the prefix", func() {
+				v, ok, err := r.Get(ctx, "user:1")
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+				So(string(v), ShouldEqual, "a\r\nb")
+				f.mtx.Lock()
+				_, ok = f.data["users:user:1"]
+				f.mtx.Unlock()
+				So(ok, ShouldBeTrue)
+			})
+
+			Convey("Then it is gone once deleted", func() {
+				So(r.Delete(ctx, "user:1"), ShouldBeNil)
+				_, ok, err := r.Get(ctx, "user:1")
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Then a flush only drops prefixed keys", func() {
+				f.mtx.Lock()
+				f.data["other"] = "x"
+				f.mtx.Unlock()
+				So(r.Flush(ctx), ShouldBeNil)
+				So(f.keys(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the password is wrong", func() {
+			bad := NewRedis(f.Addr(), "wrong", "users:", 2)
+			_, _, err := bad.Get(ctx, "user:1")
+
+			Convey("Then the error is returned", func() {
+				So(err, ShouldHaveSameTypeAs, RedisError(""))
+			})
+		})
+
+		Convey("When the server is up", func() {
+			Convey("Then the check passes", func() {
+				So(r.Check(), ShouldBeNil)
+			})
+		})
+
+		Convey("When the server is down", func() {
+			f.Close()
+			down := NewRedis(f.Addr(), "secret", "users:", 2)
+
+			Convey("Then the check fails", func() {
+				So(down.Check(), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,33 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache provides a read-through cache for db.Database with an
+// in-process LRU store and a Redis store.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Store holds encoded values by key until they expire.
+type Store interface {
+	// Get returns the value stored under key. ok is false when there is
+	// none or it has expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// Flush drops every entry.
+	Flush(ctx context.Context) error
+}
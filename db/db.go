@@ -15,55 +15,115 @@
 package db
 
 import (
+	"context"
 	"errors"
-	"flag"
 	"fmt"
-	"os"
+	"time"
+
+	"github.com/go-kit/kit/log"
 
 	"github.com/aheadaviation/Users/users"
 )
 
 type Database interface {
 	Init() error
-	GetUserByName(string) (users.User, error)
-	GetUser(string) (users.User, error)
-	GetUsers() ([]users.User, error)
-	CreateUser(*users.User) error
-	GetUserAttributes(*users.User) error
-	GetAddress(string) (users.Address, error)
-	GetAddresses() ([]users.Address, error)
-	CreateAddress(*users.Address, string) error
-	GetCard(string) (users.Card, error)
-	GetCards() ([]users.Card, error)
-	CreateCard(*users.Card, string) error
-	Delete(string, string) error
-	Ping() error
+	GetUserByName(context.Context, string) (users.User, error)
+	GetUser(context.Context, string) (users.User, error)
+	GetUsers(context.Context) ([]users.User, error)
+	// SearchUsers returns limit customers after the first offset matching
+	// query, and how many match in all. Customers with a term as a whole
+	// token come first, by text search score and then username, followed
+	// by the rest by username.
+	SearchUsers(ctx context.Context, query string, offset, limit int) ([]users.User, int, error)
+	CreateUser(context.Context, *users.User) error
+	GetUserAttributes(context.Context, *users.User) error
+	// GetUsersAttributes loads the addresses and cards of every customer in
+	// us at once.
+	GetUsersAttributes(ctx context.Context, us []users.User) error
+	GetAddress(context.Context, string) (users.Address, error)
+	GetAddresses(context.Context) ([]users.Address, error)
+	CreateAddress(context.Context, *users.Address, string) error
+	GetCard(context.Context, string) (users.Card, error)
+	GetCards(context.Context) ([]users.Card, error)
+	CreateCard(context.Context, *users.Card, string) error
+	// CreateAddresses stores the addresses at once, each for the customer of
+	// the same index in userids, or for none when that ID is blank. It
+	// returns the failure of each address, if any, and only fails as a whole
+	// when it could not try them all.
+	CreateAddresses(ctx context.Context, as []users.Address, userids []string) ([]error, error)
+	// CreateCards stores the cards at once like CreateAddresses.
+	CreateCards(ctx context.Context, cs []users.Card, userids []string) ([]error, error)
+	DeleteUser(ctx context.Context, id string) error
+	// DeleteAddress and DeleteCard remove an address or card of the customer
+	// userid, or of any customer when userid is blank, failing with
+	// ErrNotFound when there is no such address or card.
+	DeleteAddress(ctx context.Context, id, userid string) error
+	DeleteCard(ctx context.Context, id, userid string) error
+	// DeleteUsers removes the customers with their addresses and cards at
+	// once, returning the failure of each like CreateAddresses.
+	DeleteUsers(ctx context.Context, ids []string) ([]error, error)
+	EraseUser(context.Context, string) (users.User, error)
+	SetDefaultAddress(context.Context, string, string, string) error
+	// SetCardBillingAddress links the card to one of its owner's addresses.
+	// When userid is set, a card that customer does not have is not found.
+	SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) error
+	SetPassword(context.Context, string, string, string) error
+	SetDisabled(context.Context, string, bool) error
+	CreateTenant(context.Context, *users.Tenant) error
+	GetTenants(context.Context) ([]users.Tenant, error)
+	Ping(context.Context) error
+	Close() error
 }
 
 var (
-	database              string
 	DefaultDb             Database
 	DBTypes               = map[string]Database{}
 	ErrNoDatabaseFound    = "No database with name %v registered"
 	ErrNoDatabaseSelected = errors.New("No DB selected")
-)
+	ErrAddressNotOwned    = errors.New("Address does not belong to customer")
+	ErrNotFound           = errors.New("not found")
+	ErrNoTenant           = errors.New("No tenant")
+	ErrTenantExists       = errors.New("Tenant already exists")
 
-func init() {
-	flag.StringVar(&database, "database", os.Getenv("USERS_DATABASE"), "Database to use for Users")
-}
+	ConnectBackoff    = 500 * time.Millisecond
+	MaxConnectBackoff = 15 * time.Second
+)
 
-func Init() error {
+// Init selects the registered database with the given name and connects it.
+func Init(database string) error {
 	if database == "" {
 		return ErrNoDatabaseSelected
 	}
-	err := Set()
+	err := Set(database)
 	if err != nil {
 		return err
 	}
 	return DefaultDb.Init()
 }
 
-func Set() error {
+// Connect calls Init until it succeeds, waiting between attempts with
+// exponential backoff from ConnectBackoff up to MaxConnectBackoff. It gives
+// up with the last error once ctx is done, and at once if no database is
+// selected or the name is unknown.
+func Connect(ctx context.Context, database string, logger log.Logger) error {
+	backoff := ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := Init(database)
+		if err == nil || err == ErrNoDatabaseSelected || DBTypes[database] == nil {
+			return err
+		}
+		logger.Log("database", database, "attempt", attempt, "retry_in", backoff, "err", err)
+		if wait(ctx, backoff) != nil {
+			return err
+		}
+		backoff *= 2
+		if backoff > MaxConnectBackoff {
+			backoff = MaxConnectBackoff
+		}
+	}
+}
+
+func Set(database string) error {
 	if v, ok := DBTypes[database]; ok {
 		DefaultDb = v
 		return nil
@@ -75,88 +135,183 @@ func Register(name string, db Database) {
 	DBTypes[name] = db
 }
 
-func CreateUser(u *users.User) error {
-	return DefaultDb.CreateUser(u)
+func CreateUser(ctx context.Context, u *users.User) error {
+	return DefaultDb.CreateUser(ctx, u)
 }
 
-func GetUserByName(n string) (users.User, error) {
-	u, err := DefaultDb.GetUserByName(n)
+func GetUserByName(ctx context.Context, n string) (users.User, error) {
+	u, err := DefaultDb.GetUserByName(ctx, n)
 	if err == nil {
-		u.AddLinks()
+		u.AddLinks(users.LinkBaseFrom(ctx))
 	}
 	return u, err
 }
 
-func GetUser(n string) (users.User, error) {
-	u, err := DefaultDb.GetUser(n)
+func GetUser(ctx context.Context, n string) (users.User, error) {
+	u, err := DefaultDb.GetUser(ctx, n)
 	if err == nil {
-		u.AddLinks()
+		u.AddLinks(users.LinkBaseFrom(ctx))
 	}
 	return u, err
 }
 
-func GetUsers() ([]users.User, error) {
-	us, err := DefaultDb.GetUsers()
+func GetUsers(ctx context.Context) ([]users.User, error) {
+	us, err := DefaultDb.GetUsers(ctx)
 	for k, _ := range us {
-		us[k].AddLinks()
+		us[k].AddLinks(users.LinkBaseFrom(ctx))
 	}
 	return us, err
 }
 
-func GetUserAttributes(u *users.User) error {
-	err := DefaultDb.GetUserAttributes(u)
+func SearchUsers(ctx context.Context, query string, offset, limit int) ([]users.User, int, error) {
+	us, total, err := DefaultDb.SearchUsers(ctx, query, offset, limit)
+	for k := range us {
+		us[k].AddLinks(users.LinkBaseFrom(ctx))
+	}
+	return us, total, err
+}
+
+func GetUserAttributes(ctx context.Context, u *users.User) error {
+	err := DefaultDb.GetUserAttributes(ctx, u)
 	if err != nil {
 		return err
 	}
 	for k, _ := range u.Addresses {
-		u.Addresses[k].AddLinks()
+		u.Addresses[k].AddLinks(users.LinkBaseFrom(ctx))
 	}
 	for k, _ := range u.Cards {
-		u.Cards[k].AddLinks()
+		u.Cards[k].AddLinks(users.LinkBaseFrom(ctx))
+		u.Cards[k].AddStatus(time.Now())
+	}
+	return nil
+}
+
+func GetUsersAttributes(ctx context.Context, us []users.User) error {
+	err := DefaultDb.GetUsersAttributes(ctx, us)
+	if err != nil {
+		return err
+	}
+	for k := range us {
+		for i := range us[k].Addresses {
+			us[k].Addresses[i].AddLinks(users.LinkBaseFrom(ctx))
+		}
+		for i := range us[k].Cards {
+			us[k].Cards[i].AddLinks(users.LinkBaseFrom(ctx))
+			us[k].Cards[i].AddStatus(time.Now())
+		}
 	}
 	return nil
 }
 
-func CreateAddress(a *users.Address, userid string) error {
-	return DefaultDb.CreateAddress(a, userid)
+func CreateAddress(ctx context.Context, a *users.Address, userid string) error {
+	return DefaultDb.CreateAddress(ctx, a, userid)
 }
 
-func GetAddress(n string) (users.Address, error) {
-	a, err := DefaultDb.GetAddress(n)
+func GetAddress(ctx context.Context, n string) (users.Address, error) {
+	a, err := DefaultDb.GetAddress(ctx, n)
 	if err == nil {
-		a.AddLinks()
+		a.AddLinks(users.LinkBaseFrom(ctx))
 	}
 	return a, err
 }
 
-func GetAddresses() ([]users.Address, error) {
-	as, err := DefaultDb.GetAddresses()
+func GetAddresses(ctx context.Context) ([]users.Address, error) {
+	as, err := DefaultDb.GetAddresses(ctx)
 	for k, _ := range as {
-		as[k].AddLinks()
+		as[k].AddLinks(users.LinkBaseFrom(ctx))
 	}
 	return as, err
 }
 
-func CreateCard(c *users.Card, userid string) error {
-	return DefaultDb.CreateCard(c, userid)
+func CreateCard(ctx context.Context, c *users.Card, userid string) error {
+	return DefaultDb.CreateCard(ctx, c, userid)
 }
 
-func GetCard(n string) (users.Card, error) {
-	return DefaultDb.GetCard(n)
+func GetCard(ctx context.Context, n string) (users.Card, error) {
+	c, err := DefaultDb.GetCard(ctx, n)
+	if err == nil {
+		c.AddStatus(time.Now())
+	}
+	return c, err
 }
 
-func GetCards() ([]users.Card, error) {
-	cs, err := DefaultDb.GetCards()
+func GetCards(ctx context.Context) ([]users.Card, error) {
+	cs, err := DefaultDb.GetCards(ctx)
 	for k, _ := range cs {
-		cs[k].AddLinks()
+		cs[k].AddLinks(users.LinkBaseFrom(ctx))
+		cs[k].AddStatus(time.Now())
 	}
 	return cs, err
 }
 
-func Delete(entity, id string) error {
-	return DefaultDb.Delete(entity, id)
+func DeleteUser(ctx context.Context, id string) error {
+	return DefaultDb.DeleteUser(ctx, id)
+}
+
+func DeleteAddress(ctx context.Context, id, userid string) error {
+	return DefaultDb.DeleteAddress(ctx, id, userid)
+}
+
+func DeleteCard(ctx context.Context, id, userid string) error {
+	return DefaultDb.DeleteCard(ctx, id, userid)
+}
+
+func CreateAddresses(ctx context.Context, as []users.Address, userids []string) ([]error, error) {
+	return DefaultDb.CreateAddresses(ctx, as, userids)
+}
+
+func CreateCards(ctx context.Context, cs []users.Card, userids []string) ([]error, error) {
+	return DefaultDb.CreateCards(ctx, cs, userids)
+}
+
+func DeleteUsers(ctx context.Context, ids []string) ([]error, error) {
+	return DefaultDb.DeleteUsers(ctx, ids)
+}
+
+// CountErrors counts the items of a batch that failed.
+func CountErrors(errs []error) int {
+	n := 0
+	for _, err := range errs {
+		if err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func EraseUser(ctx context.Context, id string) (users.User, error) {
+	u, err := DefaultDb.EraseUser(ctx, id)
+	if err == nil {
+		u.AddLinks(users.LinkBaseFrom(ctx))
+	}
+	return u, err
+}
+
+// SetDefaultAddress makes addressid the customer's default address of the
+// given kind, users.KindShipping or users.KindBilling.
+func SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error {
+	return DefaultDb.SetDefaultAddress(ctx, userid, kind, addressid)
+}
+
+// SetCardBillingAddress links a card to one of its owner's addresses.
+func SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) error {
+	return DefaultDb.SetCardBillingAddress(ctx, cardid, addressid, userid)
+}
+
+// CreateTenant stores a new tenant, failing with ErrTenantExists when its
+// ID or one of its hosts is taken.
+func CreateTenant(ctx context.Context, t *users.Tenant) error {
+	return DefaultDb.CreateTenant(ctx, t)
+}
+
+func GetTenants(ctx context.Context) ([]users.Tenant, error) {
+	return DefaultDb.GetTenants(ctx)
+}
+
+func Ping(ctx context.Context) error {
+	return DefaultDb.Ping(ctx)
 }
 
-func Ping() error {
-	return DefaultDb.Ping()
+func Close() error {
+	return DefaultDb.Close()
 }
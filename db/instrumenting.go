@@ -0,0 +1,189 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+
+	"github.com/aheadaviation/Users/users"
+)
+
+// InstrumentingMiddleware records the latency of every operation and counts
+// those that fail, both labelled by operation. Init and Close are not
+// recorded.
+func InstrumentingMiddleware(latency metrics.Histogram, errors metrics.Counter) Middleware {
+	return func(next Database) Database {
+		return instrumentingDatabase{latency: latency, errors: errors, next: next}
+	}
+}
+
+type instrumentingDatabase struct {
+	latency metrics.Histogram
+	errors  metrics.Counter
+	next    Database
+}
+
+func (d instrumentingDatabase) observe(op string, begin time.Time, err error) {
+	d.latency.With("operation", op).Observe(time.Since(begin).Seconds())
+	if err != nil {
+		d.errors.With("operation", op).Add(1)
+	}
+}
+
+func (d instrumentingDatabase) Init() error {
+	return d.next.Init()
+}
+
+func (d instrumentingDatabase) GetUserByName(ctx context.Context, name string) (u users.User, err error) {
+	defer func(begin time.Time) { d.observe("GetUserByName", begin, err) }(time.Now())
+	return d.next.GetUserByName(ctx, name)
+}
+
+func (d instrumentingDatabase) GetUser(ctx context.Context, id string) (u users.User, err error) {
+	defer func(begin time.Time) { d.observe("GetUser", begin, err) }(time.Now())
+	return d.next.GetUser(ctx, id)
+}
+
+func (d instrumentingDatabase) GetUsers(ctx context.Context) (us []users.User, err error) {
+	defer func(begin time.Time) { d.observe("GetUsers", begin, err) }(time.Now())
+	return d.next.GetUsers(ctx)
+}
+
+func (d instrumentingDatabase) SearchUsers(ctx context.Context, query string, offset, limit int) (us []users.User, total int, err error) {
+	defer func(begin time.Time) { d.observe("SearchUsers", begin, err) }(time.Now())
+	return d.next.SearchUsers(ctx, query, offset, limit)
+}
+
+func (d instrumentingDatabase) CreateUser(ctx context.Context, u *users.User) (err error) {
+	defer func(begin time.Time) { d.observe("CreateUser", begin, err) }(time.Now())
+	return d.next.CreateUser(ctx, u)
+}
+
+func (d instrumentingDatabase) GetUserAttributes(ctx context.Context, u *users.User) (err error) {
+	defer func(begin time.Time) { d.observe("GetUserAttributes", begin, err) }(time.Now())
+	return d.next.GetUserAttributes(ctx, u)
+}
+
+func (d instrumentingDatabase) GetUsersAttributes(ctx context.Context, us []users.User) (err error) {
+	defer func(begin time.Time) { d.observe("GetUsersAttributes", begin, err) }(time.Now())
+	return d.next.GetUsersAttributes(ctx, us)
+}
+
+func (d instrumentingDatabase) GetAddress(ctx context.Context, id string) (a users.Address, err error) {
+	defer func(begin time.Time) { d.observe("GetAddress", begin, err) }(time.Now())
+	return d.next.GetAddress(ctx, id)
+}
+
+func (d instrumentingDatabase) GetAddresses(ctx context.Context) (as []users.Address, err error) {
+	defer func(begin time.Time) { d.observe("GetAddresses", begin, err) }(time.Now())
+	return d.next.GetAddresses(ctx)
+}
+
+func (d instrumentingDatabase) CreateAddress(ctx context.Context, a *users.Address, userid string) (err error) {
+	defer func(begin time.Time) { d.observe("CreateAddress", begin, err) }(time.Now())
+	return d.next.CreateAddress(ctx, a, userid)
+}
+
+func (d instrumentingDatabase) GetCard(ctx context.Context, id string) (c users.Card, err error) {
+	defer func(begin time.Time) { d.observe("GetCard", begin, err) }(time.Now())
+	return d.next.GetCard(ctx, id)
+}
+
+func (d instrumentingDatabase) GetCards(ctx context.Context) (cs []users.Card, err error) {
+	defer func(begin time.Time) { d.observe("GetCards", begin, err) }(time.Now())
+	return d.next.GetCards(ctx)
+}
+
+func (d instrumentingDatabase) CreateCard(ctx context.Context, c *users.Card, userid string) (err error) {
+	defer func(begin time.Time) { d.observe("CreateCard", begin, err) }(time.Now())
+	return d.next.CreateCard(ctx, c, userid)
+}
+
+func (d instrumentingDatabase) DeleteUser(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) { d.observe("DeleteUser", begin, err) }(time.Now())
+	return d.next.DeleteUser(ctx, id)
+}
+
+func (d instrumentingDatabase) DeleteAddress(ctx context.Context, id, userid string) (err error) {
+	defer func(begin time.Time) { d.observe("DeleteAddress", begin, err) }(time.Now())
+	return d.next.DeleteAddress(ctx, id, userid)
+}
+
+func (d instrumentingDatabase) DeleteCard(ctx context.Context, id, userid string) (err error) {
+	defer func(begin time.Time) { d.observe("DeleteCard", begin, err) }(time.Now())
+	return d.next.DeleteCard(ctx, id, userid)
+}
+
+func (d instrumentingDatabase) CreateAddresses(ctx context.Context, as []users.Address, userids []string) (errs []error, err error) {
+	defer func(begin time.Time) { d.observe("CreateAddresses", begin, err) }(time.Now())
+	return d.next.CreateAddresses(ctx, as, userids)
+}
+
+func (d instrumentingDatabase) CreateCards(ctx context.Context, cs []users.Card, userids []string) (errs []error, err error) {
+	defer func(begin time.Time) { d.observe("CreateCards", begin, err) }(time.Now())
+	return d.next.CreateCards(ctx, cs, userids)
+}
+
+func (d instrumentingDatabase) DeleteUsers(ctx context.Context, ids []string) (errs []error, err error) {
+	defer func(begin time.Time) { d.observe("DeleteUsers", begin, err) }(time.Now())
+	return d.next.DeleteUsers(ctx, ids)
+}
+
+func (d instrumentingDatabase) EraseUser(ctx context.Context, id string) (u users.User, err error) {
+	defer func(begin time.Time) { d.observe("EraseUser", begin, err) }(time.Now())
+	return d.next.EraseUser(ctx, id)
+}
+
+func (d instrumentingDatabase) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) (err error) {
+	defer func(begin time.Time) { d.observe("SetDefaultAddress", begin, err) }(time.Now())
+	return d.next.SetDefaultAddress(ctx, userid, kind, addressid)
+}
+
+func (d instrumentingDatabase) SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) (err error) {
+	defer func(begin time.Time) { d.observe("SetCardBillingAddress", begin, err) }(time.Now())
+	return d.next.SetCardBillingAddress(ctx, cardid, addressid, userid)
+}
+
+func (d instrumentingDatabase) SetPassword(ctx context.Context, userid, password, salt string) (err error) {
+	defer func(begin time.Time) { d.observe("SetPassword", begin, err) }(time.Now())
+	return d.next.SetPassword(ctx, userid, password, salt)
+}
+
+func (d instrumentingDatabase) SetDisabled(ctx context.Context, userid string, disabled bool) (err error) {
+	defer func(begin time.Time) { d.observe("SetDisabled", begin, err) }(time.Now())
+	return d.next.SetDisabled(ctx, userid, disabled)
+}
+
+func (d instrumentingDatabase) CreateTenant(ctx context.Context, t *users.Tenant) (err error) {
+	defer func(begin time.Time) { d.observe("CreateTenant", begin, err) }(time.Now())
+	return d.next.CreateTenant(ctx, t)
+}
+
+func (d instrumentingDatabase) GetTenants(ctx context.Context) (ts []users.Tenant, err error) {
+	defer func(begin time.Time) { d.observe("GetTenants", begin, err) }(time.Now())
+	return d.next.GetTenants(ctx)
+}
+
+func (d instrumentingDatabase) Ping(ctx context.Context) (err error) {
+	defer func(begin time.Time) { d.observe("Ping", begin, err) }(time.Now())
+	return d.next.Ping(ctx)
+}
+
+func (d instrumentingDatabase) Close() error {
+	return d.next.Close()
+}
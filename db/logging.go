@@ -0,0 +1,203 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/users"
+)
+
+// LoggingMiddleware logs every operation with the IDs it was given, how
+// long it took and its error. Passwords and card numbers are never logged.
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Database) Database {
+		return loggingDatabase{next: next, logger: log.With(logger, "component", "db")}
+	}
+}
+
+type loggingDatabase struct {
+	next   Database
+	logger log.Logger
+}
+
+func (d loggingDatabase) log(ctx context.Context, op string, begin time.Time, err error, kv ...interface{}) {
+	kv = append(append(reqctx.Keyvals(ctx), "method", op), kv...)
+	kv = append(kv, "took", time.Since(begin))
+	if err != nil {
+		kv = append(kv, "err", err)
+	}
+	d.logger.Log(kv...)
+}
+
+func (d loggingDatabase) Init() (err error) {
+	defer func(begin time.Time) { d.log(context.Background(), "Init", begin, err) }(time.Now())
+	return d.next.Init()
+}
+
+func (d loggingDatabase) GetUserByName(ctx context.Context, name string) (u users.User, err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetUserByName", begin, err, "username", name) }(time.Now())
+	return d.next.GetUserByName(ctx, name)
+}
+
+func (d loggingDatabase) GetUser(ctx context.Context, id string) (u users.User, err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetUser", begin, err, "id", id) }(time.Now())
+	return d.next.GetUser(ctx, id)
+}
+
+func (d loggingDatabase) GetUsers(ctx context.Context) (us []users.User, err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetUsers", begin, err, "result", len(us)) }(time.Now())
+	return d.next.GetUsers(ctx)
+}
+
+func (d loggingDatabase) SearchUsers(ctx context.Context, query string, offset, limit int) (us []users.User, total int, err error) {
+	defer func(begin time.Time) {
+		d.log(ctx, "SearchUsers", begin, err, "offset", offset, "limit", limit, "result", len(us), "total", total)
+	}(time.Now())
+	return d.next.SearchUsers(ctx, query, offset, limit)
+}
+
+func (d loggingDatabase) CreateUser(ctx context.Context, u *users.User) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "CreateUser", begin, err, "username", u.Username) }(time.Now())
+	return d.next.CreateUser(ctx, u)
+}
+
+func (d loggingDatabase) GetUserAttributes(ctx context.Context, u *users.User) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetUserAttributes", begin, err, "id", u.UserID) }(time.Now())
+	return d.next.GetUserAttributes(ctx, u)
+}
+
+func (d loggingDatabase) GetUsersAttributes(ctx context.Context, us []users.User) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetUsersAttributes", begin, err, "users", len(us)) }(time.Now())
+	return d.next.GetUsersAttributes(ctx, us)
+}
+
+func (d loggingDatabase) GetAddress(ctx context.Context, id string) (a users.Address, err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetAddress", begin, err, "id", id) }(time.Now())
+	return d.next.GetAddress(ctx, id)
+}
+
+func (d loggingDatabase) GetAddresses(ctx context.Context) (as []users.Address, err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetAddresses", begin, err, "result", len(as)) }(time.Now())
+	return d.next.GetAddresses(ctx)
+}
+
+func (d loggingDatabase) CreateAddress(ctx context.Context, a *users.Address, userid string) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "CreateAddress", begin, err, "user", userid) }(time.Now())
+	return d.next.CreateAddress(ctx, a, userid)
+}
+
+func (d loggingDatabase) GetCard(ctx context.Context, id string) (c users.Card, err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetCard", begin, err, "id", id) }(time.Now())
+	return d.next.GetCard(ctx, id)
+}
+
+func (d loggingDatabase) GetCards(ctx context.Context) (cs []users.Card, err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetCards", begin, err, "result", len(cs)) }(time.Now())
+	return d.next.GetCards(ctx)
+}
+
+func (d loggingDatabase) CreateCard(ctx context.Context, c *users.Card, userid string) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "CreateCard", begin, err, "user", userid) }(time.Now())
+	return d.next.CreateCard(ctx, c, userid)
+}
+
+func (d loggingDatabase) DeleteUser(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "DeleteUser", begin, err, "id", id) }(time.Now())
+	return d.next.DeleteUser(ctx, id)
+}
+
+func (d loggingDatabase) DeleteAddress(ctx context.Context, id, userid string) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "DeleteAddress", begin, err, "id", id, "user", userid) }(time.Now())
+	return d.next.DeleteAddress(ctx, id, userid)
+}
+
+func (d loggingDatabase) DeleteCard(ctx context.Context, id, userid string) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "DeleteCard", begin, err, "id", id, "user", userid) }(time.Now())
+	return d.next.DeleteCard(ctx, id, userid)
+}
+
+func (d loggingDatabase) CreateAddresses(ctx context.Context, as []users.Address, userids []string) (errs []error, err error) {
+	defer func(begin time.Time) {
+		d.log(ctx, "CreateAddresses", begin, err, "items", len(as), "failed", CountErrors(errs))
+	}(time.Now())
+	return d.next.CreateAddresses(ctx, as, userids)
+}
+
+func (d loggingDatabase) CreateCards(ctx context.Context, cs []users.Card, userids []string) (errs []error, err error) {
+	defer func(begin time.Time) {
+		d.log(ctx, "CreateCards", begin, err, "items", len(cs), "failed", CountErrors(errs))
+	}(time.Now())
+	return d.next.CreateCards(ctx, cs, userids)
+}
+
+func (d loggingDatabase) DeleteUsers(ctx context.Context, ids []string) (errs []error, err error) {
+	defer func(begin time.Time) {
+		d.log(ctx, "DeleteUsers", begin, err, "items", len(ids), "failed", CountErrors(errs))
+	}(time.Now())
+	return d.next.DeleteUsers(ctx, ids)
+}
+
+func (d loggingDatabase) EraseUser(ctx context.Context, id string) (u users.User, err error) {
+	defer func(begin time.Time) { d.log(ctx, "EraseUser", begin, err, "id", id) }(time.Now())
+	return d.next.EraseUser(ctx, id)
+}
+
+func (d loggingDatabase) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) (err error) {
+	defer func(begin time.Time) {
+		d.log(ctx, "SetDefaultAddress", begin, err, "user", userid, "kind", kind, "address", addressid)
+	}(time.Now())
+	return d.next.SetDefaultAddress(ctx, userid, kind, addressid)
+}
+
+func (d loggingDatabase) SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) (err error) {
+	defer func(begin time.Time) {
+		d.log(ctx, "SetCardBillingAddress", begin, err, "card", cardid, "address", addressid, "user", userid)
+	}(time.Now())
+	return d.next.SetCardBillingAddress(ctx, cardid, addressid, userid)
+}
+
+func (d loggingDatabase) SetPassword(ctx context.Context, userid, password, salt string) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "SetPassword", begin, err, "user", userid) }(time.Now())
+	return d.next.SetPassword(ctx, userid, password, salt)
+}
+
+func (d loggingDatabase) SetDisabled(ctx context.Context, userid string, disabled bool) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "SetDisabled", begin, err, "user", userid, "disabled", disabled) }(time.Now())
+	return d.next.SetDisabled(ctx, userid, disabled)
+}
+
+func (d loggingDatabase) CreateTenant(ctx context.Context, t *users.Tenant) (err error) {
+	defer func(begin time.Time) { d.log(ctx, "CreateTenant", begin, err, "id", t.ID) }(time.Now())
+	return d.next.CreateTenant(ctx, t)
+}
+
+func (d loggingDatabase) GetTenants(ctx context.Context) (ts []users.Tenant, err error) {
+	defer func(begin time.Time) { d.log(ctx, "GetTenants", begin, err, "result", len(ts)) }(time.Now())
+	return d.next.GetTenants(ctx)
+}
+
+func (d loggingDatabase) Ping(ctx context.Context) error {
+	return d.next.Ping(ctx)
+}
+
+func (d loggingDatabase) Close() (err error) {
+	defer func(begin time.Time) { d.log(context.Background(), "Close", begin, err) }(time.Now())
+	return d.next.Close()
+}
@@ -0,0 +1,47 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+)
+
+// Middleware decorates a Database, as api.Middleware does a Service.
+type Middleware func(Database) Database
+
+var ErrUnknownMiddleware = "No database middleware with name %v"
+
+// Chain wraps d in mws. The first middleware is the outermost, so it sees
+// each call first and its result last.
+func Chain(d Database, mws ...Middleware) Database {
+	for i := len(mws) - 1; i >= 0; i-- {
+		d = mws[i](d)
+	}
+	return d
+}
+
+// ChainNamed wraps d in the middlewares named, in order, looking each up in
+// available.
+func ChainNamed(d Database, names []string, available map[string]Middleware) (Database, error) {
+	mws := make([]Middleware, 0, len(names))
+	for _, n := range names {
+		mw, ok := available[n]
+		if !ok {
+			return nil, fmt.Errorf(ErrUnknownMiddleware, n)
+		}
+		mws = append(mws, mw)
+	}
+	return Chain(d, mws...), nil
+}
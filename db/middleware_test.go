@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aheadaviation/Users/users"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeDatabase fails GetUser with each of errs in turn, then succeeds.
+type fakeDatabase struct {
+	Database
+	errs  []error
+	calls int
+	delay time.Duration
+}
+
+func (d *fakeDatabase) GetUser(ctx context.Context, id string) (users.User, error) {
+	d.calls++
+	time.Sleep(d.delay)
+	if len(d.errs) > 0 {
+		err := d.errs[0]
+		d.errs = d.errs[1:]
+		return users.User{}, err
+	}
+	return users.User{UserID: id}, nil
+}
+
+func (d *fakeDatabase) CreateUser(ctx context.Context, u *users.User) error {
+	d.calls++
+	return io.EOF
+}
+
+func (d *fakeDatabase) DeleteAddress(ctx context.Context, id, userid string) error {
+	d.calls++
+	return io.EOF
+}
+
+func (d *fakeDatabase) CreateAddress(ctx context.Context, a *users.Address, userid string) error {
+	time.Sleep(d.delay)
+	a.ID = "a1"
+	return nil
+}
+
+type recordingDatabase struct {
+	Database
+	name string
+	seen *[]string
+}
+
+func (d recordingDatabase) GetUser(ctx context.Context, id string) (users.User, error) {
+	*d.seen = append(*d.seen, d.name)
+	return d.Database.GetUser(ctx, id)
+}
+
+func recording(name string, seen *[]string) Middleware {
+	return func(next Database) Database {
+		return recordingDatabase{Database: next, name: name, seen: seen}
+	}
+}
+
+func noWait(context.Context, time.Duration) error { return nil }
+
+func TestChain(t *testing.T) {
+
+	Convey("Given named middlewares", t, func() {
+		seen := []string{}
+		available := map[string]Middleware{
+			"a": recording("a", &seen),
+			"b": recording("b", &seen),
+		}
+
+		Convey("When they are chained", func() {
+			d, err := ChainNamed(&fakeDatabase{}, []string{"b", "a"}, available)
+			So(err, ShouldBeNil)
+			d.GetUser(context.Background(), "1")
+
+			Convey("Then the first one named is the outermost", func() {
+				So(seen, ShouldResemble, []string{"b", "a"})
+			})
+		})
+
+		Convey("When an unknown one is named", func() {
+			_, err := ChainNamed(&fakeDatabase{}, []string{"a", "c"}, available)
+
+			Convey("Then it is an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRetry(t *testing.T) {
+
+	Convey("Given a retrying database", t, func() {
+		f := &fakeDatabase{}
+		d := retryDatabase{next: f, retries: 2, backoff: time.Millisecond, wait: noWait}
+
+		Convey("When a read fails transiently", func() {
+			f.errs = []error{io.EOF, errors.New("no reachable servers")}
+			u, err := d.GetUser(context.Background(), "1")
+
+			Convey("Then it is retried until it succeeds", func() {
+				So(err, ShouldBeNil)
+				So(u.UserID, ShouldEqual, "1")
+				So(f.calls, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When a read keeps failing transiently", func() {
+			f.errs = []error{io.EOF, io.EOF, io.EOF, io.EOF}
+			_, err := d.GetUser(context.Background(), "1")
+
+			Convey("Then it gives up after the retries", func() {
+				So(err, ShouldEqual, io.EOF)
+				So(f.calls, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When a read fails for good", func() {
+			f.errs = []error{errors.New("not found")}
+			_, err := d.GetUser(context.Background(), "1")
+
+			Convey("Then it is not retried", func() {
+				So(err, ShouldNotBeNil)
+				So(f.calls, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the caller gives up during the backoff", func() {
+			d.wait = wait
+			f.errs = []error{io.EOF, io.EOF}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := d.GetUser(ctx, "1")
+
+			Convey("Then it is not retried", func() {
+				So(err, ShouldEqual, io.EOF)
+				So(f.calls, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a create fails transiently", func() {
+			err := d.CreateUser(context.Background(), &users.User{})
+
+			Convey("Then it is not retried", func() {
+				So(err, ShouldEqual, io.EOF)
+				So(f.calls, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a delete fails transiently", func() {
+			err := d.DeleteAddress(context.Background(), "a1", "")
+
+			Convey("Then it is not retried", func() {
+				So(err, ShouldEqual, io.EOF)
+				So(f.calls, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestTimeout(t *testing.T) {
+
+	Convey("Given a database with a timeout", t, func() {
+		f := &fakeDatabase{}
+		d := TimeoutMiddleware(20 * time.Millisecond)(f)
+
+		Convey("When a call finishes in time", func() {
+			u, err := d.GetUser(context.Background(), "1")
+
+			Convey("Then its result is returned", func() {
+				So(err, ShouldBeNil)
+				So(u.UserID, ShouldEqual, "1")
+			})
+		})
+
+		Convey("When a call takes too long", func() {
+			f.delay = 200 * time.Millisecond
+			_, err := d.GetUser(context.Background(), "1")
+
+			Convey("Then it fails with a transient timeout", func() {
+				So(err, ShouldEqual, ErrTimeout)
+				So(IsTransient(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a create takes too long", func() {
+			f.delay = 50 * time.Millisecond
+			a := users.Address{}
+			err := d.CreateAddress(context.Background(), &a, "")
+			time.Sleep(2 * f.delay)
+
+			Convey("Then it does not write to the caller's address", func() {
+				So(err, ShouldEqual, ErrTimeout)
+				So(a.ID, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the caller's deadline is shorter", func() {
+			f.delay = 200 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+			defer cancel()
+			_, err := d.GetUser(ctx, "1")
+
+			Convey("Then it fails with the caller's error", func() {
+				So(err, ShouldResemble, context.DeadlineExceeded)
+			})
+		})
+	})
+}
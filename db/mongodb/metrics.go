@@ -0,0 +1,62 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/mgo.v2"
+)
+
+// StatsCollector exports the connection pool statistics kept by mgo as
+// gauges. mgo keeps one set of statistics per process, across sessions.
+type StatsCollector struct {
+	descs map[string]*prometheus.Desc
+}
+
+// NewStatsCollector turns on mgo statistics and returns a collector for
+// them, to be registered with Prometheus.
+func NewStatsCollector(namespace string) *StatsCollector {
+	mgo.SetStats(true)
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "mongo", name), help, nil, nil)
+	}
+	return &StatsCollector{descs: map[string]*prometheus.Desc{
+		"clusters":      desc("clusters", "Number of clusters known to the driver."),
+		"master_conns":  desc("master_conns", "Connections open to primaries."),
+		"slave_conns":   desc("slave_conns", "Connections open to secondaries."),
+		"sockets_alive": desc("sockets_alive", "Sockets open in the pool."),
+		"sockets_inuse": desc("sockets_in_use", "Sockets in use by sessions."),
+		"socket_refs":   desc("socket_refs", "References held to pooled sockets."),
+	}}
+}
+
+func (c *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+func (c *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := mgo.GetStats()
+	gauge := func(name string, v int) {
+		ch <- prometheus.MustNewConstMetric(c.descs[name], prometheus.GaugeValue, float64(v))
+	}
+	gauge("clusters", s.Clusters)
+	gauge("master_conns", s.MasterConns)
+	gauge("slave_conns", s.SlaveConns)
+	gauge("sockets_alive", s.SocketsAlive)
+	gauge("sockets_inuse", s.SocketsInUse)
+	gauge("socket_refs", s.SocketRefs)
+}
@@ -15,52 +15,83 @@
 package mongodb
 
 import (
+	"context"
 	"errors"
-	"flag"
 	"fmt"
 	"net/url"
-	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/reqctx"
 	"github.com/aheadaviation/Users/users"
 )
 
 var (
-	name            string
-	password        string
-	host            string
-	db              = "users"
+	dbName          = "users"
 	ErrInvalidHexID = errors.New("Invalid Id Hex")
 )
 
-func init() {
-	flag.StringVar(&name, "mongo-user", os.Getenv("MONGO_USER"), "Mongo Username")
-	flag.StringVar(&password, "mongo-password", os.Getenv("MONGO_PASS"), "Mongo Password")
-	flag.StringVar(&host, "mongo-host", os.Getenv("MONGO_HOST"), "Mongo Host")
-}
-
+// Mongo keeps every tenant's customers in the same collections, with each
+// document carrying its tenant and every query limited to the tenant of its
+// context.
 type Mongo struct {
-	Session *mgo.Session
+	Host     string
+	User     string
+	Password string
+	Session  *mgo.Session
+	// DefaultTenant owns the documents stored before there were tenants.
+	DefaultTenant string
 }
 
+// Init dials the server, moves documents without a tenant to the default
+// one and ensures the indexes. On failure it leaves no session behind, so it
+// can simply be called again.
 func (m *Mongo) Init() error {
-	u := getURL()
-	var err error
-	m.Session, err = mgo.DialWithTimeout(u.String(), time.Duration(5)*time.Second)
+	u := m.url()
+	s, err := mgo.DialWithTimeout(u.String(), time.Duration(5)*time.Second)
 	if err != nil {
-		return nil
+		return err
+	}
+	m.Session = s
+	if err := m.migrateTenants(); err != nil {
+		s.Close()
+		m.Session = nil
+		return err
+	}
+	if err := m.EnsureIndexes(); err != nil {
+		s.Close()
+		m.Session = nil
+		return err
 	}
-	return m.EnsureIndexes()
+	if err := m.indexSearch(context.Background()); err != nil {
+		s.Close()
+		m.Session = nil
+		return err
+	}
+	return nil
 }
 
 type MongoUser struct {
-	users.User `bson:",inline"`
-	ID         bson.ObjectId   `bson:"_id"`
-	AddressIDs []bson.ObjectId `bson:"addresses"`
-	CardIDs    []bson.ObjectId `bson:"cards"`
+	users.User        `bson:",inline"`
+	ID                bson.ObjectId   `bson:"_id"`
+	AddressIDs        []bson.ObjectId `bson:"addresses"`
+	CardIDs           []bson.ObjectId `bson:"cards"`
+	DefaultShippingID bson.ObjectId   `bson:"defaultShipping,omitempty"`
+	DefaultBillingID  bson.ObjectId   `bson:"defaultBilling,omitempty"`
+	// Search holds users.SearchTokens, kept up to date as addresses change.
+	Search []string `bson:"search,omitempty"`
+	Tenant string   `bson:"tenant"`
+}
+
+// defaultFields maps each kind of default address to its customer field.
+var defaultFields = map[string]string{
+	users.KindShipping: "defaultShipping",
+	users.KindBilling:  "defaultBilling",
 }
 
 func New() MongoUser {
@@ -88,11 +119,18 @@ func (mu *MongoUser) AddUserIds() {
 		mu.User.Cards = append(mu.User.Cards, users.Card{ID: id.Hex()})
 	}
 	mu.User.UserID = mu.ID.Hex()
+	if mu.DefaultShippingID.Valid() {
+		mu.User.DefaultShipping = mu.DefaultShippingID.Hex()
+	}
+	if mu.DefaultBillingID.Valid() {
+		mu.User.DefaultBilling = mu.DefaultBillingID.Hex()
+	}
 }
 
 type MongoAddress struct {
 	users.Address `bson:",inline"`
 	ID            bson.ObjectId `bson:"_id"`
+	Tenant        string        `bson:"tenant"`
 }
 
 func (m *MongoAddress) AddID() {
@@ -102,30 +140,46 @@ func (m *MongoAddress) AddID() {
 type MongoCard struct {
 	users.Card `bson:",inline"`
 	ID         bson.ObjectId `bson:"_id"`
+	Tenant     string        `bson:"tenant"`
 }
 
 func (m *MongoCard) AddID() {
 	m.Card.ID = m.ID.Hex()
 }
 
-func (m *Mongo) CreateUser(u *users.User) error {
-	s := m.Session.Copy()
+func (m *Mongo) CreateUser(ctx context.Context, u *users.User) error {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
 	defer s.Close()
 	id := bson.NewObjectId()
 	mu := New()
 	mu.User = *u
 	mu.ID = id
+	mu.Tenant = t
 	var carderr error
 	var addrerr error
-	mu.CardIDs, carderr = m.createCards(u.Cards)
-	mu.AddressIDs, addrerr = m.createAddresses(u.Addresses)
+	mu.CardIDs, carderr = m.createCards(ctx, t, u.Cards)
+	mu.AddressIDs, addrerr = m.createAddresses(ctx, t, u.Addresses)
+	if len(mu.AddressIDs) > 0 {
+		mu.DefaultShippingID = mu.AddressIDs[0]
+		mu.DefaultBillingID = mu.AddressIDs[0]
+	}
+	mu.Search = users.SearchTokens(*u, u.Addresses)
 	c := s.DB("").C("customers")
-	_, err := c.UpsertId(mu.ID, mu)
+	_, err = c.UpsertId(mu.ID, mu)
 	if err != nil {
-		m.cleanAttributes(mu)
+		m.cleanAttributes(ctx, mu)
 		return err
 	}
 	mu.User.UserID = mu.ID.Hex()
+	mu.User.DefaultShipping = mu.DefaultShippingID.Hex()
+	mu.User.DefaultBilling = mu.DefaultBillingID.Hex()
 	if carderr != nil || addrerr != nil {
 		return fmt.Errorf("%v %v", carderr, addrerr)
 	}
@@ -133,14 +187,17 @@ func (m *Mongo) CreateUser(u *users.User) error {
 	return nil
 }
 
-func (m *Mongo) createCards(cs []users.Card) ([]bson.ObjectId, error) {
-	s := m.Session.Copy()
+func (m *Mongo) createCards(ctx context.Context, tenant string, cs []users.Card) ([]bson.ObjectId, error) {
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer s.Close()
 	ids := make([]bson.ObjectId, 0)
 	defer s.Close()
 	for k, ca := range cs {
 		id := bson.NewObjectId()
-		mc := MongoCard{Card: ca, ID: id}
+		mc := MongoCard{Card: ca, ID: id, Tenant: tenant}
 		c := s.DB("").C("cards")
 		_, err := c.UpsertId(mc.ID, mc)
 		if err != nil {
@@ -152,13 +209,16 @@ func (m *Mongo) createCards(cs []users.Card) ([]bson.ObjectId, error) {
 	return ids, nil
 }
 
-func (m *Mongo) createAddresses(as []users.Address) ([]bson.ObjectId, error) {
+func (m *Mongo) createAddresses(ctx context.Context, tenant string, as []users.Address) ([]bson.ObjectId, error) {
 	ids := make([]bson.ObjectId, 0)
-	s := m.Session.Copy()
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer s.Close()
 	for k, a := range as {
 		id := bson.NewObjectId()
-		ma := MongoAddress{Address: a, ID: id}
+		ma := MongoAddress{Address: a, ID: id, Tenant: tenant}
 		c := s.DB("").C("addresses")
 		_, err := c.UpsertId(ma.ID, ma)
 		if err != nil {
@@ -170,61 +230,97 @@ func (m *Mongo) createAddresses(as []users.Address) ([]bson.ObjectId, error) {
 	return ids, nil
 }
 
-func (m *Mongo) cleanAttributes(mu MongoUser) error {
-	s := m.Session.Copy()
+func (m *Mongo) cleanAttributes(ctx context.Context, mu MongoUser) error {
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
 	defer s.Close()
 	c := s.DB("").C("addresses")
-	_, err := c.RemoveAll(bson.M{"_id": bson.M{"$in": mu.AddressIDs}})
+	_, err = c.RemoveAll(bson.M{"_id": bson.M{"$in": mu.AddressIDs}, "tenant": mu.Tenant})
 	c = s.DB("").C("cards")
-	_, err = c.RemoveAll(bson.M{"_id": bson.M{"$in": mu.CardIDs}})
+	_, err = c.RemoveAll(bson.M{"_id": bson.M{"$in": mu.CardIDs}, "tenant": mu.Tenant})
 	return err
 }
 
-func (m *Mongo) appendAttributeId(attr string, id bson.ObjectId, userid string) error {
-	s := m.Session.Copy()
+func (m *Mongo) appendAttributeId(ctx context.Context, attr string, id bson.ObjectId, userid string) error {
+	q, err := scoped(ctx, bson.M{"_id": bson.ObjectIdHex(userid)})
+	if err != nil {
+		return err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
 	defer s.Close()
 	c := s.DB("").C("customers")
-	return c.Update(bson.M{"_id": bson.ObjectIdHex(userid)},
-		bson.M{"$addToSet": bson.M{attr: id}})
+	return c.Update(q, bson.M{"$addToSet": bson.M{attr: id}})
 }
 
-func (m *Mongo) removeAttributeId(attr, userid string, id bson.ObjectId) error {
-	s := m.Session.Copy()
+func (m *Mongo) removeAttributeId(ctx context.Context, attr, userid string, id bson.ObjectId) error {
+	q, err := scoped(ctx, bson.M{"_id": bson.ObjectIdHex(userid)})
+	if err != nil {
+		return err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
 	defer s.Close()
 	c := s.DB("").C("customers")
-	return c.Update(bson.M{"_id": bson.ObjectIdHex(userid)},
-		bson.M{"$pull": bson.M{attr: id}})
+	return c.Update(q, bson.M{"$pull": bson.M{attr: id}})
 }
 
-func (m *Mongo) GetUserByName(name string) (users.User, error) {
-	s := m.Session.Copy()
+func (m *Mongo) GetUserByName(ctx context.Context, name string) (users.User, error) {
+	q, err := scoped(ctx, bson.M{"username": name})
+	if err != nil {
+		return users.New(), err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return users.New(), err
+	}
 	defer s.Close()
 	c := s.DB("").C("customers")
 	mu := New()
-	err := c.Find(bson.M{"username": name}).One(&mu)
+	err = c.Find(q).One(&mu)
 	mu.AddUserIds()
-	return mu.User, err
+	return mu.User, notFound(err)
 }
 
-func (m *Mongo) GetUser(id string) (users.User, error) {
-	s := m.Session.Copy()
+func (m *Mongo) GetUser(ctx context.Context, id string) (users.User, error) {
+	s, err := m.session(ctx)
+	if err != nil {
+		return users.New(), err
+	}
 	defer s.Close()
 	if !bson.IsObjectIdHex(id) {
 		return users.New(), errors.New("Invalid id hex")
 	}
+	q, err := scoped(ctx, bson.M{"_id": bson.ObjectIdHex(id)})
+	if err != nil {
+		return users.New(), err
+	}
 	c := s.DB("").C("customers")
 	mu := New()
-	err := c.FindId(bson.ObjectIdHex(id)).One(&mu)
+	err = c.Find(q).One(&mu)
 	mu.AddUserIds()
-	return mu.User, err
+	return mu.User, notFound(err)
 }
 
-func (m *Mongo) GetUsers() ([]users.User, error) {
-	s := m.Session.Copy()
+func (m *Mongo) GetUsers(ctx context.Context) ([]users.User, error) {
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer s.Close()
+	q, err := scoped(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
 	c := s.DB("").C("customers")
 	var mus []MongoUser
-	err := c.Find(nil).All(&mus)
+	err = c.Find(q).All(&mus)
 	us := make([]users.User, 0)
 	for _, mu := range mus {
 		mu.AddUserIds()
@@ -233,71 +329,227 @@ func (m *Mongo) GetUsers() ([]users.User, error) {
 	return us, err
 }
 
-func (m *Mongo) GetUserAttributes(u *users.User) error {
-	s := m.Session.Copy()
+// SearchUsers finds customers through two indexes on their search tokens.
+// Those where some term is a whole token are found with the text index and
+// ranked by its score; the rest, matching on prefixes alone, follow in
+// username order.
+func (m *Mongo) SearchUsers(ctx context.Context, query string, offset, limit int) ([]users.User, int, error) {
+	terms := users.SearchTerms(query)
+	if len(terms) == 0 {
+		return []users.User{}, 0, nil
+	}
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer s.Close()
+	c := s.DB("").C("customers")
+	prefixes := make([]interface{}, len(terms))
+	for i, t := range terms {
+		prefixes[i] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(t)}
+	}
+	whole := bson.M{"tenant": t, "$text": bson.M{"$search": strings.Join(terms, " ")}, "search": bson.M{"$all": prefixes}}
+	partial := bson.M{"tenant": t, "search": bson.M{"$all": prefixes, "$nin": terms}}
+	nwhole, err := c.Find(whole).Count()
+	if err != nil {
+		return nil, 0, err
+	}
+	npartial, err := c.Find(partial).Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	mus := []MongoUser{}
+	if offset < nwhole {
+		err = c.Find(whole).Select(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			Sort("$textScore:score", "username").Skip(offset).Limit(limit).All(&mus)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if rest := limit - len(mus); rest > 0 && offset+len(mus) < nwhole+npartial {
+		skip := offset - nwhole
+		if skip < 0 {
+			skip = 0
+		}
+		var more []MongoUser
+		err = c.Find(partial).Sort("username").Skip(skip).Limit(rest).All(&more)
+		if err != nil {
+			return nil, 0, err
+		}
+		mus = append(mus, more...)
+	}
+	us := make([]users.User, 0, len(mus))
+	for _, mu := range mus {
+		mu.AddUserIds()
+		us = append(us, mu.User)
+	}
+	return us, nwhole + npartial, nil
+}
+
+// updateSearch recomputes the search tokens of a customer after its
+// addresses change. Erased customers have none.
+func (m *Mongo) updateSearch(ctx context.Context, id bson.ObjectId) error {
+	u, err := m.GetUser(ctx, id.Hex())
+	if err != nil {
+		return err
+	}
+	if u.ErasedAt != nil {
+		return nil
+	}
+	if err := m.GetUserAttributes(ctx, &u); err != nil {
+		return err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	q, err := scoped(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	c := s.DB("").C("customers")
+	return c.Update(q, bson.M{"$set": bson.M{"search": users.SearchTokens(u, u.Addresses)}})
+}
+
+// indexSearch adds search tokens to customers stored before they were
+// searchable, each in the context of its own tenant.
+func (m *Mongo) indexSearch(ctx context.Context) error {
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	c := s.DB("").C("customers")
+	var mu MongoUser
+	iter := c.Find(bson.M{"search": bson.M{"$exists": false}, "erasedAt": bson.M{"$exists": false}}).
+		Select(bson.M{"_id": 1, "tenant": 1}).Iter()
+	for iter.Next(&mu) {
+		if err := m.updateSearch(reqctx.WithTenant(ctx, mu.Tenant), mu.ID); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+func (m *Mongo) GetUserAttributes(ctx context.Context, u *users.User) error {
+	us := []users.User{*u}
+	if err := m.GetUsersAttributes(ctx, us); err != nil {
+		return err
+	}
+	u.Addresses, u.Cards = us[0].Addresses, us[0].Cards
+	return nil
+}
+
+// GetUsersAttributes reads the addresses and the cards of all of us with one
+// query each, keeping the order in which each customer refers to them.
+func (m *Mongo) GetUsersAttributes(ctx context.Context, us []users.User) error {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
 	defer s.Close()
 	ids := make([]bson.ObjectId, 0)
-	for _, a := range u.Addresses {
-		if !bson.IsObjectIdHex(a.ID) {
-			return ErrInvalidHexID
+	for _, u := range us {
+		for _, a := range u.Addresses {
+			if !bson.IsObjectIdHex(a.ID) {
+				return ErrInvalidHexID
+			}
+			ids = append(ids, bson.ObjectIdHex(a.ID))
 		}
-		ids = append(ids, bson.ObjectIdHex(a.ID))
 	}
 	var ma []MongoAddress
-	c := s.DB("").C("addresses")
-	err := c.Find(bson.M{"_id": bson.M{"$in": ids}}).All(&ma)
+	err = s.DB("").C("addresses").Find(bson.M{"_id": bson.M{"$in": ids}, "tenant": t}).All(&ma)
 	if err != nil {
 		return err
 	}
-	na := make([]users.Address, 0)
+	as := make(map[string]users.Address, len(ma))
 	for _, a := range ma {
-		a.Address.ID = a.ID.Hex()
-		na = append(na, a.Address)
+		a.AddID()
+		as[a.Address.ID] = a.Address
 	}
-	u.Addresses = na
 
 	ids = make([]bson.ObjectId, 0)
-	for _, c := range u.Cards {
-		if !bson.IsObjectIdHex(c.ID) {
-			return ErrInvalidHexID
+	for _, u := range us {
+		for _, c := range u.Cards {
+			if !bson.IsObjectIdHex(c.ID) {
+				return ErrInvalidHexID
+			}
+			ids = append(ids, bson.ObjectIdHex(c.ID))
 		}
-		ids = append(ids, bson.ObjectIdHex(c.ID))
 	}
 	var mc []MongoCard
-	c = s.DB("").C("cards")
-	err = c.Find(bson.M{"_id": bson.M{"$in": ids}}).All(&mc)
+	err = s.DB("").C("cards").Find(bson.M{"_id": bson.M{"$in": ids}, "tenant": t}).All(&mc)
 	if err != nil {
 		return err
 	}
+	cs := make(map[string]users.Card, len(mc))
+	for _, c := range mc {
+		c.Card.ID = c.ID.Hex()
+		cs[c.Card.ID] = c.Card
+	}
 
-	nc := make([]users.Card, 0)
-	for _, ca := range mc {
-		ca.Card.ID = ca.ID.Hex()
-		nc = append(nc, ca.Card)
+	for k, u := range us {
+		na := make([]users.Address, 0, len(u.Addresses))
+		for _, a := range u.Addresses {
+			if found, ok := as[a.ID]; ok {
+				na = append(na, found)
+			}
+		}
+		nc := make([]users.Card, 0, len(u.Cards))
+		for _, c := range u.Cards {
+			if found, ok := cs[c.ID]; ok {
+				nc = append(nc, found)
+			}
+		}
+		us[k].Addresses, us[k].Cards = na, nc
 	}
-	u.Cards = nc
 	return nil
 }
 
-func (m *Mongo) GetCard(id string) (users.Card, error) {
-	s := m.Session.Copy()
+func (m *Mongo) GetCard(ctx context.Context, id string) (users.Card, error) {
+	s, err := m.session(ctx)
+	if err != nil {
+		return users.Card{}, err
+	}
 	defer s.Close()
 	if !bson.IsObjectIdHex(id) {
 		return users.Card{}, errors.New("Invalid id hex")
 	}
+	q, err := scoped(ctx, bson.M{"_id": bson.ObjectIdHex(id)})
+	if err != nil {
+		return users.Card{}, err
+	}
 	c := s.DB("").C("cards")
 	mc := MongoCard{}
-	err := c.FindId(bson.ObjectIdHex(id)).One(&mc)
+	err = c.Find(q).One(&mc)
 	mc.AddID()
-	return mc.Card, err
+	return mc.Card, notFound(err)
 }
 
-func (m *Mongo) GetCards() ([]users.Card, error) {
-	s := m.Session.Copy()
+func (m *Mongo) GetCards(ctx context.Context) ([]users.Card, error) {
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer s.Close()
+	q, err := scoped(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
 	c := s.DB("").C("cards")
 	var mcs []MongoCard
-	err := c.Find(nil).All(&mcs)
+	err = c.Find(q).All(&mcs)
 	cs := make([]users.Card, 0)
 	for _, mc := range mcs {
 		mc.AddID()
@@ -306,22 +558,34 @@ func (m *Mongo) GetCards() ([]users.Card, error) {
 	return cs, err
 }
 
-func (m *Mongo) CreateCard(ca *users.Card, userid string) error {
+func (m *Mongo) CreateCard(ctx context.Context, ca *users.Card, userid string) error {
 	if userid != "" && !bson.IsObjectIdHex(userid) {
 		return errors.New("Invalid id hex")
 	}
-	s := m.Session.Copy()
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	if ca.BillingAddress != "" {
+		if err := m.checkAddressOwner(ctx, userid, ca.BillingAddress); err != nil {
+			return err
+		}
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
 	defer s.Close()
 	c := s.DB("").C("cards")
 	id := bson.NewObjectId()
-	mc := MongoCard{Card: *ca, ID: id}
-	_, err := c.UpsertId(mc.ID, mc)
+	mc := MongoCard{Card: *ca, ID: id, Tenant: t}
+	_, err = c.UpsertId(mc.ID, mc)
 	if err != nil {
 		return err
 	}
 
 	if userid != "" {
-		err = m.appendAttributeId("cards", mc.ID, userid)
+		err = m.appendAttributeId(ctx, "cards", mc.ID, userid)
 		if err != nil {
 			return err
 		}
@@ -331,25 +595,39 @@ func (m *Mongo) CreateCard(ca *users.Card, userid string) error {
 	return err
 }
 
-func (m *Mongo) GetAddress(id string) (users.Address, error) {
-	s := m.Session.Copy()
+func (m *Mongo) GetAddress(ctx context.Context, id string) (users.Address, error) {
+	s, err := m.session(ctx)
+	if err != nil {
+		return users.Address{}, err
+	}
 	defer s.Close()
 	if !bson.IsObjectIdHex(id) {
 		return users.Address{}, errors.New("Invalid id hex")
 	}
+	q, err := scoped(ctx, bson.M{"_id": bson.ObjectIdHex(id)})
+	if err != nil {
+		return users.Address{}, err
+	}
 	c := s.DB("").C("addresses")
 	ma := MongoAddress{}
-	err := c.FindId(bson.ObjectIdHex(id)).One(&ma)
+	err = c.Find(q).One(&ma)
 	ma.AddID()
-	return ma.Address, err
+	return ma.Address, notFound(err)
 }
 
-func (m *Mongo) GetAddresses() ([]users.Address, error) {
-	s := m.Session.Copy()
+func (m *Mongo) GetAddresses(ctx context.Context) ([]users.Address, error) {
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer s.Close()
+	q, err := scoped(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
 	c := s.DB("").C("addresses")
 	var mas []MongoAddress
-	err := c.Find(nil).All(&mas)
+	err = c.Find(q).All(&mas)
 	as := make([]users.Address, 0)
 	for _, ma := range mas {
 		ma.AddID()
@@ -358,22 +636,37 @@ func (m *Mongo) GetAddresses() ([]users.Address, error) {
 	return as, err
 }
 
-func (m *Mongo) CreateAddress(a *users.Address, userid string) error {
+func (m *Mongo) CreateAddress(ctx context.Context, a *users.Address, userid string) error {
 	if userid != "" && !bson.IsObjectIdHex(userid) {
 		return errors.New("Invalid id hex")
 	}
-	s := m.Session.Copy()
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
 	defer s.Close()
 	c := s.DB("").C("addresses")
 	id := bson.NewObjectId()
-	ma := MongoAddress{Address: *a, ID: id}
-	_, err := c.UpsertId(ma.ID, ma)
+	ma := MongoAddress{Address: *a, ID: id, Tenant: t}
+	_, err = c.UpsertId(ma.ID, ma)
 	if err != nil {
 		return err
 	}
 
 	if userid != "" {
-		err = m.appendAttributeId("addresses", ma.ID, userid)
+		err = m.appendAttributeId(ctx, "addresses", ma.ID, userid)
+		if err != nil {
+			return err
+		}
+		err = m.setMissingDefaults(ctx, userid, ma.ID)
+		if err != nil {
+			return err
+		}
+		err = m.updateSearch(ctx, bson.ObjectIdHex(userid))
 		if err != nil {
 			return err
 		}
@@ -383,66 +676,830 @@ func (m *Mongo) CreateAddress(a *users.Address, userid string) error {
 	return err
 }
 
-func (m *Mongo) Delete(entity, id string) error {
+// DeleteUser removes the customer with its addresses and cards.
+func (m *Mongo) DeleteUser(ctx context.Context, id string) error {
 	if !bson.IsObjectIdHex(id) {
-		return errors.New("invalid id hex")
+		return db.ErrNotFound
+	}
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	u, err := m.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
 	}
-	s := m.Session.Copy()
 	defer s.Close()
-	c := s.DB("").C(entity)
-	if entity == "customers" {
-		u, err := m.GetUser(id)
-		if err != nil {
+	aids := make([]bson.ObjectId, 0)
+	for _, a := range u.Addresses {
+		aids = append(aids, bson.ObjectIdHex(a.ID))
+	}
+	cids := make([]bson.ObjectId, 0)
+	for _, c := range u.Cards {
+		cids = append(cids, bson.ObjectIdHex(c.ID))
+	}
+	if _, err := s.DB("").C("addresses").RemoveAll(bson.M{"_id": bson.M{"$in": aids}, "tenant": t}); err != nil {
+		return err
+	}
+	if _, err := s.DB("").C("cards").RemoveAll(bson.M{"_id": bson.M{"$in": cids}, "tenant": t}); err != nil {
+		return err
+	}
+	return notFound(s.DB("").C("customers").Remove(bson.M{"_id": bson.ObjectIdHex(id), "tenant": t}))
+}
+
+// DeleteAddress removes the address from its customer, whose defaults and
+// cards billed to it move to the customer's first remaining address.
+func (m *Mongo) DeleteAddress(ctx context.Context, id, userid string) error {
+	owners, err := m.deleteAttribute(ctx, "addresses", id, userid)
+	if err != nil {
+		return err
+	}
+	if err := m.reassignDefaults(ctx, bson.ObjectIdHex(id), owners); err != nil {
+		return err
+	}
+	for _, o := range owners {
+		if err := m.updateSearch(ctx, o.ID); err != nil {
 			return err
 		}
-		aids := make([]bson.ObjectId, 0)
-		for _, a := range u.Addresses {
-			aids = append(aids, bson.ObjectIdHex(a.ID))
-		}
-		cids := make([]bson.ObjectId, 0)
-		for _, c := range u.Cards {
-			cids = append(cids, bson.ObjectIdHex(c.ID))
-		}
-		ac := s.DB("").C("addresses")
-		ac.RemoveAll(bson.M{"_id": bson.M{"$in": aids}})
-		cc := s.DB("").C("cards")
-		cc.RemoveAll(bson.M{"_id": bson.M{"$in": cids}})
-	} else {
-		c := s.DB("").C("customers")
-		c.UpdateAll(bson.M{},
-			bson.M{"$pull": bson.M{entity: bson.ObjectIdHex(id)}})
 	}
-	return c.Remove(bson.M{"_id": bson.ObjectIdHex(id)})
+	return nil
 }
 
-func (m *Mongo) EnsureIndexes() error {
-	s := m.Session.Copy()
+func (m *Mongo) DeleteCard(ctx context.Context, id, userid string) error {
+	_, err := m.deleteAttribute(ctx, "cards", id, userid)
+	return err
+}
+
+// deleteAttribute removes the address or card id, as named by attr, and
+// pulls it from the customers listing it, which it returns. When userid is
+// set, an address or card that customer does not have is not found.
+func (m *Mongo) deleteAttribute(ctx context.Context, attr, id, userid string) ([]MongoUser, error) {
+	if !bson.IsObjectIdHex(id) || (userid != "" && !bson.IsObjectIdHex(userid)) {
+		return nil, db.ErrNotFound
+	}
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer s.Close()
-	i := mgo.Index{
-		Key:        []string{"username"},
-		Unique:     true,
-		DropDups:   true,
-		Background: true,
-		Sparse:     false,
+	oid := bson.ObjectIdHex(id)
+	customers := s.DB("").C("customers")
+	var owners []MongoUser
+	err = customers.Find(bson.M{attr: oid, "tenant": t}).Select(bson.M{"_id": 1}).All(&owners)
+	if err != nil {
+		return nil, err
 	}
-	c := s.DB("").C("customers")
-	return c.EnsureIndex(i)
+	if userid != "" && !ownedBy(owners, userid) {
+		return nil, db.ErrNotFound
+	}
+	err = s.DB("").C(attr).Remove(bson.M{"_id": oid, "tenant": t})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	_, err = customers.UpdateAll(bson.M{attr: oid, "tenant": t}, bson.M{"$pull": bson.M{attr: oid}})
+	return owners, err
 }
 
-func (m *Mongo) Ping() error {
-	s := m.Session.Copy()
+// ownedBy reports whether userid is one of owners.
+func ownedBy(owners []MongoUser, userid string) bool {
+	for _, o := range owners {
+		if o.ID.Hex() == userid {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAddresses stores the addresses in one unordered bulk write, each
+// appended to the customer of the same index in userids, if any. An address
+// whose customer does not exist fails with db.ErrNotFound and is not stored.
+func (m *Mongo) CreateAddresses(ctx context.Context, as []users.Address, userids []string) ([]error, error) {
+	if len(userids) != len(as) {
+		return nil, fmt.Errorf("%v addresses for %v customers", len(as), len(userids))
+	}
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer s.Close()
-	return s.Ping()
+	errs := make([]error, len(as))
+	if _, err := findCustomers(s, t, userids, errs); err != nil {
+		return nil, err
+	}
+	mas := make([]MongoAddress, len(as))
+	b := s.DB("").C("addresses").Bulk()
+	b.Unordered()
+	idx := make([]int, 0, len(as))
+	for k, a := range as {
+		if errs[k] != nil {
+			continue
+		}
+		mas[k] = MongoAddress{Address: a, ID: bson.NewObjectId(), Tenant: t}
+		b.Insert(mas[k])
+		idx = append(idx, k)
+	}
+	if err := runBulk(b, idx, errs); err != nil {
+		return nil, err
+	}
+	ids := make([]bson.ObjectId, len(as))
+	for k := range mas {
+		if errs[k] == nil {
+			ids[k] = mas[k].ID
+		}
+	}
+	added, err := m.appendAttributeIds(s, t, "addresses", ids, userids, errs)
+	if err != nil {
+		return nil, err
+	}
+	for userid, aids := range added {
+		if err := m.setMissingDefaults(ctx, userid, aids[0]); err != nil {
+			return nil, err
+		}
+		if err := m.updateSearch(ctx, bson.ObjectIdHex(userid)); err != nil {
+			return nil, err
+		}
+	}
+	for k := range mas {
+		if errs[k] == nil {
+			mas[k].AddID()
+			as[k] = mas[k].Address
+		}
+	}
+	return errs, nil
+}
+
+// CreateCards stores the cards in one unordered bulk write like
+// CreateAddresses. A card whose billing address does not belong to its
+// customer fails with db.ErrAddressNotOwned.
+func (m *Mongo) CreateCards(ctx context.Context, cs []users.Card, userids []string) ([]error, error) {
+	if len(userids) != len(cs) {
+		return nil, fmt.Errorf("%v cards for %v customers", len(cs), len(userids))
+	}
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	errs := make([]error, len(cs))
+	found, err := findCustomers(s, t, userids, errs)
+	if err != nil {
+		return nil, err
+	}
+	mcs := make([]MongoCard, len(cs))
+	b := s.DB("").C("cards").Bulk()
+	b.Unordered()
+	idx := make([]int, 0, len(cs))
+	for k, ca := range cs {
+		if errs[k] != nil {
+			continue
+		}
+		if ca.BillingAddress != "" && !owns(found[userids[k]], ca.BillingAddress) {
+			errs[k] = db.ErrAddressNotOwned
+			continue
+		}
+		mcs[k] = MongoCard{Card: ca, ID: bson.NewObjectId(), Tenant: t}
+		b.Insert(mcs[k])
+		idx = append(idx, k)
+	}
+	if err := runBulk(b, idx, errs); err != nil {
+		return nil, err
+	}
+	ids := make([]bson.ObjectId, len(cs))
+	for k := range mcs {
+		if errs[k] == nil {
+			ids[k] = mcs[k].ID
+		}
+	}
+	if _, err := m.appendAttributeIds(s, t, "cards", ids, userids, errs); err != nil {
+		return nil, err
+	}
+	for k := range mcs {
+		if errs[k] == nil {
+			mcs[k].AddID()
+			cs[k] = mcs[k].Card
+		}
+	}
+	return errs, nil
+}
+
+// DeleteUsers removes the customers with their addresses and cards, the
+// customers in one bulk write. A customer that does not exist fails with
+// db.ErrNotFound.
+func (m *Mongo) DeleteUsers(ctx context.Context, ids []string) ([]error, error) {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	errs := make([]error, len(ids))
+	found, err := findCustomers(s, t, ids, errs)
+	if err != nil {
+		return nil, err
+	}
+	aids := make([]bson.ObjectId, 0)
+	cids := make([]bson.ObjectId, 0)
+	b := s.DB("").C("customers").Bulk()
+	b.Unordered()
+	idx := make([]int, 0, len(ids))
+	for k, id := range ids {
+		mu, ok := found[id]
+		if !ok {
+			errs[k] = db.ErrNotFound
+			continue
+		}
+		aids = append(aids, mu.AddressIDs...)
+		cids = append(cids, mu.CardIDs...)
+		b.Remove(bson.M{"_id": mu.ID, "tenant": t})
+		idx = append(idx, k)
+	}
+	if len(aids) > 0 {
+		if _, err := s.DB("").C("addresses").RemoveAll(bson.M{"_id": bson.M{"$in": aids}, "tenant": t}); err != nil {
+			return nil, err
+		}
+	}
+	if len(cids) > 0 {
+		if _, err := s.DB("").C("cards").RemoveAll(bson.M{"_id": bson.M{"$in": cids}, "tenant": t}); err != nil {
+			return nil, err
+		}
+	}
+	if err := runBulk(b, idx, errs); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// findCustomers finds the customers named in userids at once, keyed by ID,
+// and records db.ErrNotFound in errs for every one that does not exist.
+// Blank IDs stand for no customer and are skipped.
+func findCustomers(s *mgo.Session, tenant string, userids []string, errs []error) (map[string]MongoUser, error) {
+	ids := make([]bson.ObjectId, 0, len(userids))
+	for _, id := range userids {
+		if bson.IsObjectIdHex(id) {
+			ids = append(ids, bson.ObjectIdHex(id))
+		}
+	}
+	var mus []MongoUser
+	err := s.DB("").C("customers").Find(bson.M{"_id": bson.M{"$in": ids}, "tenant": tenant}).
+		Select(bson.M{"_id": 1, "addresses": 1, "cards": 1}).All(&mus)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]MongoUser, len(mus))
+	for _, mu := range mus {
+		found[mu.ID.Hex()] = mu
+	}
+	for k, id := range userids {
+		if _, ok := found[id]; id != "" && !ok {
+			errs[k] = db.ErrNotFound
+		}
+	}
+	return found, nil
+}
+
+// owns reports whether addressid is one of the customer's addresses.
+func owns(mu MongoUser, addressid string) bool {
+	for _, id := range mu.AddressIDs {
+		if id.Hex() == addressid {
+			return true
+		}
+	}
+	return false
+}
+
+// appendAttributeIds adds each of ids that was stored to the attr IDs of the
+// customer of the same index, one update per customer in a bulk write. A
+// failed update is recorded in errs against every item of its customer and
+// those items are removed again. It returns the IDs added by customer.
+func (m *Mongo) appendAttributeIds(s *mgo.Session, tenant, attr string, ids []bson.ObjectId, userids []string, errs []error) (map[string][]bson.ObjectId, error) {
+	added := make(map[string][]bson.ObjectId)
+	order := make([]string, 0)
+	for k, id := range ids {
+		if errs[k] != nil || userids[k] == "" {
+			continue
+		}
+		if _, ok := added[userids[k]]; !ok {
+			order = append(order, userids[k])
+		}
+		added[userids[k]] = append(added[userids[k]], id)
+	}
+	if len(order) == 0 {
+		return added, nil
+	}
+	b := s.DB("").C("customers").Bulk()
+	b.Unordered()
+	for _, userid := range order {
+		b.Update(bson.M{"_id": bson.ObjectIdHex(userid), "tenant": tenant},
+			bson.M{"$addToSet": bson.M{attr: bson.M{"$each": added[userid]}}})
+	}
+	_, err := b.Run()
+	if err == nil {
+		return added, nil
+	}
+	berr, ok := err.(*mgo.BulkError)
+	if !ok {
+		return nil, err
+	}
+	orphans := make([]bson.ObjectId, 0)
+	for _, c := range berr.Cases() {
+		if c.Index < 0 || c.Index >= len(order) {
+			return nil, err
+		}
+		userid := order[c.Index]
+		for k := range ids {
+			if userids[k] == userid && errs[k] == nil {
+				errs[k] = c.Err
+			}
+		}
+		orphans = append(orphans, added[userid]...)
+		delete(added, userid)
+	}
+	s.DB("").C(attr).RemoveAll(bson.M{"_id": bson.M{"$in": orphans}, "tenant": tenant})
+	return added, nil
+}
+
+// runBulk runs b, whose operations were queued for the items at the indexes
+// in idx, and records the failure of each operation in errs. It only fails
+// itself when an error cannot be tied to an operation.
+func runBulk(b *mgo.Bulk, idx []int, errs []error) error {
+	if len(idx) == 0 {
+		return nil
+	}
+	_, err := b.Run()
+	berr, ok := err.(*mgo.BulkError)
+	if !ok {
+		return err
+	}
+	for _, c := range berr.Cases() {
+		if c.Index < 0 || c.Index >= len(idx) {
+			return err
+		}
+		errs[idx[c.Index]] = c.Err
+	}
+	return nil
+}
+
+func (m *Mongo) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error {
+	field, ok := defaultFields[kind]
+	if !ok {
+		return fmt.Errorf("unknown default address kind %v", kind)
+	}
+	if !bson.IsObjectIdHex(userid) || !bson.IsObjectIdHex(addressid) {
+		return ErrInvalidHexID
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	aid := bson.ObjectIdHex(addressid)
+	q, err := scoped(ctx, bson.M{"_id": bson.ObjectIdHex(userid), "addresses": aid})
+	if err != nil {
+		return err
+	}
+	c := s.DB("").C("customers")
+	err = c.Update(q, bson.M{"$set": bson.M{field: aid}})
+	if err == mgo.ErrNotFound {
+		return db.ErrAddressNotOwned
+	}
+	return err
+}
+
+func (m *Mongo) SetPassword(ctx context.Context, userid, password, salt string) error {
+	if !bson.IsObjectIdHex(userid) {
+		return ErrInvalidHexID
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	q, err := scoped(ctx, bson.M{"_id": bson.ObjectIdHex(userid)})
+	if err != nil {
+		return err
+	}
+	c := s.DB("").C("customers")
+	err = c.Update(q, bson.M{"$set": bson.M{"password": password, "salt": salt}})
+	return notFound(err)
+}
+
+// SetDisabled keeps the time an account was first disabled when it is
+// disabled again.
+func (m *Mongo) SetDisabled(ctx context.Context, userid string, disabled bool) error {
+	if !bson.IsObjectIdHex(userid) {
+		return ErrInvalidHexID
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	c := s.DB("").C("customers")
+	id := bson.ObjectIdHex(userid)
+	if !disabled {
+		return notFound(c.Update(bson.M{"_id": id, "tenant": t}, bson.M{"$unset": bson.M{"disabledAt": ""}}))
+	}
+	err = c.Update(bson.M{"_id": id, "tenant": t, "disabledAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"disabledAt": time.Now().UTC()}})
+	if err == mgo.ErrNotFound {
+		n, cerr := c.Find(bson.M{"_id": id, "tenant": t}).Count()
+		if cerr != nil {
+			return cerr
+		}
+		if n > 0 {
+			return nil
+		}
+	}
+	return notFound(err)
+}
+
+func (m *Mongo) SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) error {
+	if !bson.IsObjectIdHex(cardid) || !bson.IsObjectIdHex(addressid) {
+		return ErrInvalidHexID
+	}
+	if userid != "" && !bson.IsObjectIdHex(userid) {
+		return db.ErrNotFound
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	c := s.DB("").C("customers")
+	owner := bson.M{"tenant": t, "cards": bson.ObjectIdHex(cardid)}
+	if userid != "" {
+		owner["_id"] = bson.ObjectIdHex(userid)
+		n, err := c.Find(owner).Count()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return db.ErrNotFound
+		}
+	}
+	owner["addresses"] = bson.ObjectIdHex(addressid)
+	n, err := c.Find(owner).Count()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return db.ErrAddressNotOwned
+	}
+	return s.DB("").C("cards").Update(bson.M{"_id": bson.ObjectIdHex(cardid), "tenant": t},
+		bson.M{"$set": bson.M{"billingAddress": addressid}})
+}
+
+func (m *Mongo) checkAddressOwner(ctx context.Context, userid, addressid string) error {
+	if !bson.IsObjectIdHex(userid) || !bson.IsObjectIdHex(addressid) {
+		return db.ErrAddressNotOwned
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	q, err := scoped(ctx, bson.M{
+		"_id":       bson.ObjectIdHex(userid),
+		"addresses": bson.ObjectIdHex(addressid),
+	})
+	if err != nil {
+		return err
+	}
+	n, err := s.DB("").C("customers").Find(q).Count()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return db.ErrAddressNotOwned
+	}
+	return nil
+}
+
+// setMissingDefaults makes id the default for every kind of address the
+// customer has not chosen a default for yet.
+func (m *Mongo) setMissingDefaults(ctx context.Context, userid string, id bson.ObjectId) error {
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	c := s.DB("").C("customers")
+	for _, field := range defaultFields {
+		err := c.Update(bson.M{"_id": bson.ObjectIdHex(userid), "tenant": t, field: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{field: id}})
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// reassignDefaults moves the defaults and card billing addresses of owners
+// pointing at the deleted address id to their first remaining address, or
+// clears them when none is left.
+func (m *Mongo) reassignDefaults(ctx context.Context, id bson.ObjectId, owners []MongoUser) error {
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	c := s.DB("").C("customers")
+	cc := s.DB("").C("cards")
+	ids := make([]bson.ObjectId, 0, len(owners))
+	for _, o := range owners {
+		ids = append(ids, o.ID)
+	}
+	var mus []MongoUser
+	err = c.Find(bson.M{"_id": bson.M{"$in": ids}, "tenant": t}).All(&mus)
+	if err != nil {
+		return err
+	}
+	for _, mu := range mus {
+		field := bson.M{}
+		if mu.DefaultShippingID == id {
+			field["defaultShipping"] = ""
+		}
+		if mu.DefaultBillingID == id {
+			field["defaultBilling"] = ""
+		}
+		if len(field) > 0 {
+			update := bson.M{"$unset": field}
+			if len(mu.AddressIDs) > 0 {
+				for f := range field {
+					field[f] = mu.AddressIDs[0]
+				}
+				update = bson.M{"$set": field}
+			}
+			if err := c.UpdateId(mu.ID, update); err != nil {
+				return err
+			}
+		}
+		if len(mu.AddressIDs) > 0 {
+			_, err = cc.UpdateAll(bson.M{"_id": bson.M{"$in": mu.CardIDs}, "tenant": t, "billingAddress": id.Hex()},
+				bson.M{"$set": bson.M{"billingAddress": mu.AddressIDs[0].Hex()}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = cc.UpdateAll(bson.M{"tenant": t, "billingAddress": id.Hex()},
+		bson.M{"$unset": bson.M{"billingAddress": ""}})
+	return err
+}
+
+// EraseUser scrubs the personal data of a customer and its attributes but
+// keeps every document and ID in place. The erasure marker is written last so
+// a failed attempt is completed by simply erasing again.
+func (m *Mongo) EraseUser(ctx context.Context, id string) (users.User, error) {
+	u, err := m.GetUser(ctx, id)
+	if err != nil {
+		return u, err
+	}
+	err = m.GetUserAttributes(ctx, &u)
+	if err != nil {
+		return u, err
+	}
+	u.Erase(time.Now())
+
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return u, err
+	}
+	s, err := m.session(ctx)
+	if err != nil {
+		return u, err
+	}
+	defer s.Close()
+	c := s.DB("").C("addresses")
+	for _, a := range u.Addresses {
+		ma := MongoAddress{Address: a, ID: bson.ObjectIdHex(a.ID), Tenant: t}
+		if err := c.Update(bson.M{"_id": ma.ID, "tenant": t}, ma); err != nil {
+			return u, err
+		}
+	}
+	c = s.DB("").C("cards")
+	for _, ca := range u.Cards {
+		mc := MongoCard{Card: ca, ID: bson.ObjectIdHex(ca.ID), Tenant: t}
+		if err := c.Update(bson.M{"_id": mc.ID, "tenant": t}, mc); err != nil {
+			return u, err
+		}
+	}
+	c = s.DB("").C("customers")
+	err = c.Update(bson.M{"_id": bson.ObjectIdHex(id), "tenant": t}, bson.M{
+		"$set": bson.M{
+			"firstname": u.FirstName,
+			"lastname":  u.LastName,
+			"email":     u.Email,
+			"username":  u.Username,
+			"salt":      u.Salt,
+			"erasedAt":  u.ErasedAt,
+		},
+		"$unset": bson.M{"password": "", "search": ""},
+	})
+	return u, err
+}
+
+// CreateTenant stores t with its creation time.
+func (m *Mongo) CreateTenant(ctx context.Context, t *users.Tenant) error {
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	t.CreatedAt = time.Now().UTC()
+	err = s.DB("").C("tenants").Insert(t)
+	if mgo.IsDup(err) {
+		return db.ErrTenantExists
+	}
+	return err
+}
+
+func (m *Mongo) GetTenants(ctx context.Context) ([]users.Tenant, error) {
+	s, err := m.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	ts := make([]users.Tenant, 0)
+	err = s.DB("").C("tenants").Find(nil).Sort("_id").All(&ts)
+	return ts, err
+}
+
+// migrateTenants gives documents stored before there were tenants to the
+// default tenant and makes sure that tenant exists.
+func (m *Mongo) migrateTenants() error {
+	if m.DefaultTenant == "" {
+		return db.ErrNoTenant
+	}
+	s := m.Session.Copy()
+	defer s.Close()
+	for _, name := range []string{"customers", "addresses", "cards"} {
+		_, err := s.DB("").C(name).UpdateAll(bson.M{"tenant": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"tenant": m.DefaultTenant}})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := s.DB("").C("tenants").UpsertId(m.DefaultTenant, bson.M{"$setOnInsert": bson.M{
+		"name":      m.DefaultTenant,
+		"createdAt": time.Now().UTC(),
+	}})
+	return err
+}
+
+// EnsureIndexes makes usernames unique within each tenant and leads every
+// other index with the tenant, dropping the indexes used before tenants.
+func (m *Mongo) EnsureIndexes() error {
+	s := m.Session.Copy()
+	defer s.Close()
+	c := s.DB("").C("customers")
+	for _, name := range []string{"username_1", "search_text", "search_1"} {
+		c.DropIndexName(name)
+	}
+	i := mgo.Index{
+		Key:        []string{"tenant", "username"},
+		Unique:     true,
+		Background: true,
+		Sparse:     false,
+	}
+	if err := c.EnsureIndex(i); err != nil {
+		return err
+	}
+	// The text index finds whole search tokens and scores them; the
+	// ascending one serves anchored prefix matches.
+	err := c.EnsureIndex(mgo.Index{
+		Key:             []string{"tenant", "$text:search"},
+		DefaultLanguage: "none",
+		Background:      true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.EnsureIndex(mgo.Index{Key: []string{"tenant", "search"}, Background: true}); err != nil {
+		return err
+	}
+	for _, name := range []string{"addresses", "cards"} {
+		if err := s.DB("").C(name).EnsureIndexKey("tenant"); err != nil {
+			return err
+		}
+	}
+	return s.DB("").C("tenants").EnsureIndex(mgo.Index{
+		Key:        []string{"hosts"},
+		Unique:     true,
+		Sparse:     true,
+		Background: true,
+	})
+}
+
+func (m *Mongo) Ping(ctx context.Context) error {
+	s, err := m.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Ping()
+}
+
+func (m *Mongo) Close() error {
+	if m.Session != nil {
+		m.Session.Close()
+	}
+	return nil
+}
+
+// notFound reports a missing document as db.ErrNotFound.
+func notFound(err error) error {
+	if err == mgo.ErrNotFound {
+		return db.ErrNotFound
+	}
+	return err
+}
+
+// tenantOf returns the tenant of ctx, failing with db.ErrNoTenant rather
+// than reading across tenants when there is none.
+func tenantOf(ctx context.Context) (string, error) {
+	t := reqctx.Tenant(ctx)
+	if t == "" {
+		return "", db.ErrNoTenant
+	}
+	return t, nil
+}
+
+// scoped limits the query q to the tenant of ctx.
+func scoped(ctx context.Context, q bson.M) (bson.M, error) {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q["tenant"] = t
+	return q, nil
+}
+
+// session copies the master session for one operation. mgo cannot cancel a
+// query in flight, so the deadline of ctx becomes the socket timeout and a
+// context that is already done fails the operation before it starts.
+// Operations made of several queries therefore stop at the next query once
+// the caller goes away.
+func (m *Mongo) session(ctx context.Context) (*mgo.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s := m.Session.Copy()
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		if left <= 0 {
+			s.Close()
+			return nil, context.DeadlineExceeded
+		}
+		s.SetSocketTimeout(left)
+		s.SetSyncTimeout(left)
+	}
+	return s, nil
 }
 
-func getURL() url.URL {
+func (m *Mongo) url() url.URL {
 	ur := url.URL{
 		Scheme: "mongodb",
-		Host:   host,
-		Path:   db,
+		Host:   m.Host,
+		Path:   dbName,
 	}
-	if name != "" {
-		u := url.UserPassword(name, password)
+	if m.User != "" {
+		u := url.UserPassword(m.User, m.Password)
 		ur.User = u
 	}
 	return ur
@@ -0,0 +1,233 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aheadaviation/Users/users"
+)
+
+// transientMessages are driver errors that do not implement net.Error but
+// mean the server could not be reached.
+var transientMessages = []string{
+	"no reachable servers",
+	"connection reset",
+	"broken pipe",
+	"Closed explicitly",
+	"i/o timeout",
+}
+
+// IsTransient reports whether err is likely to go away if the operation is
+// tried again, such as a dropped connection or a timeout.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF || err == ErrTimeout {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	for _, m := range transientMessages {
+		if strings.Contains(err.Error(), m) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryMiddleware retries operations that fail with a transient error up to
+// retries more times. The wait before each retry doubles from backoff, with
+// up to half of it added at random so that replicas do not retry in step.
+// Creates are not retried: a create that failed in transit may have been
+// applied, and trying again could store it twice. Deletes are not retried
+// either, as a retry would find the document gone. Nothing is retried once
+// the caller's context is done.
+func RetryMiddleware(retries int, backoff time.Duration) Middleware {
+	return func(next Database) Database {
+		return retryDatabase{next: next, retries: retries, backoff: backoff, wait: wait}
+	}
+}
+
+type retryDatabase struct {
+	next    Database
+	retries int
+	backoff time.Duration
+	wait    func(context.Context, time.Duration) error
+}
+
+// wait sleeps for d or until ctx is done, returning the context's error in
+// the latter case.
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d retryDatabase) do(ctx context.Context, f func() error) error {
+	err := f()
+	backoff := d.backoff
+	for i := 0; i < d.retries && IsTransient(err); i++ {
+		if werr := d.wait(ctx, backoff+time.Duration(rand.Int63n(int64(backoff)/2+1))); werr != nil {
+			return err
+		}
+		backoff *= 2
+		err = f()
+	}
+	return err
+}
+
+func (d retryDatabase) Init() error {
+	return d.next.Init()
+}
+
+func (d retryDatabase) GetUserByName(ctx context.Context, name string) (u users.User, err error) {
+	err = d.do(ctx, func() (err error) { u, err = d.next.GetUserByName(ctx, name); return })
+	return
+}
+
+func (d retryDatabase) GetUser(ctx context.Context, id string) (u users.User, err error) {
+	err = d.do(ctx, func() (err error) { u, err = d.next.GetUser(ctx, id); return })
+	return
+}
+
+func (d retryDatabase) GetUsers(ctx context.Context) (us []users.User, err error) {
+	err = d.do(ctx, func() (err error) { us, err = d.next.GetUsers(ctx); return })
+	return
+}
+
+func (d retryDatabase) SearchUsers(ctx context.Context, query string, offset, limit int) (us []users.User, total int, err error) {
+	err = d.do(ctx, func() (err error) { us, total, err = d.next.SearchUsers(ctx, query, offset, limit); return })
+	return
+}
+
+func (d retryDatabase) CreateUser(ctx context.Context, u *users.User) error {
+	return d.next.CreateUser(ctx, u)
+}
+
+func (d retryDatabase) GetUserAttributes(ctx context.Context, u *users.User) error {
+	return d.do(ctx, func() error { return d.next.GetUserAttributes(ctx, u) })
+}
+
+func (d retryDatabase) GetUsersAttributes(ctx context.Context, us []users.User) error {
+	return d.do(ctx, func() error { return d.next.GetUsersAttributes(ctx, us) })
+}
+
+func (d retryDatabase) GetAddress(ctx context.Context, id string) (a users.Address, err error) {
+	err = d.do(ctx, func() (err error) { a, err = d.next.GetAddress(ctx, id); return })
+	return
+}
+
+func (d retryDatabase) GetAddresses(ctx context.Context) (as []users.Address, err error) {
+	err = d.do(ctx, func() (err error) { as, err = d.next.GetAddresses(ctx); return })
+	return
+}
+
+func (d retryDatabase) CreateAddress(ctx context.Context, a *users.Address, userid string) error {
+	return d.next.CreateAddress(ctx, a, userid)
+}
+
+func (d retryDatabase) GetCard(ctx context.Context, id string) (c users.Card, err error) {
+	err = d.do(ctx, func() (err error) { c, err = d.next.GetCard(ctx, id); return })
+	return
+}
+
+func (d retryDatabase) GetCards(ctx context.Context) (cs []users.Card, err error) {
+	err = d.do(ctx, func() (err error) { cs, err = d.next.GetCards(ctx); return })
+	return
+}
+
+func (d retryDatabase) CreateCard(ctx context.Context, c *users.Card, userid string) error {
+	return d.next.CreateCard(ctx, c, userid)
+}
+
+// DeleteUser, DeleteAddress and DeleteCard are not retried: a retry after
+// the document was removed would report it not found and skip the rest of
+// the delete.
+func (d retryDatabase) DeleteUser(ctx context.Context, id string) error {
+	return d.next.DeleteUser(ctx, id)
+}
+
+func (d retryDatabase) DeleteAddress(ctx context.Context, id, userid string) error {
+	return d.next.DeleteAddress(ctx, id, userid)
+}
+
+func (d retryDatabase) DeleteCard(ctx context.Context, id, userid string) error {
+	return d.next.DeleteCard(ctx, id, userid)
+}
+
+func (d retryDatabase) CreateAddresses(ctx context.Context, as []users.Address, userids []string) ([]error, error) {
+	return d.next.CreateAddresses(ctx, as, userids)
+}
+
+func (d retryDatabase) CreateCards(ctx context.Context, cs []users.Card, userids []string) ([]error, error) {
+	return d.next.CreateCards(ctx, cs, userids)
+}
+
+// DeleteUsers is not retried: a retry after some customers were deleted
+// would report them not found.
+func (d retryDatabase) DeleteUsers(ctx context.Context, ids []string) ([]error, error) {
+	return d.next.DeleteUsers(ctx, ids)
+}
+
+func (d retryDatabase) EraseUser(ctx context.Context, id string) (u users.User, err error) {
+	err = d.do(ctx, func() (err error) { u, err = d.next.EraseUser(ctx, id); return })
+	return
+}
+
+func (d retryDatabase) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error {
+	return d.do(ctx, func() error { return d.next.SetDefaultAddress(ctx, userid, kind, addressid) })
+}
+
+func (d retryDatabase) SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) error {
+	return d.do(ctx, func() error { return d.next.SetCardBillingAddress(ctx, cardid, addressid, userid) })
+}
+
+func (d retryDatabase) SetPassword(ctx context.Context, userid, password, salt string) error {
+	return d.do(ctx, func() error { return d.next.SetPassword(ctx, userid, password, salt) })
+}
+
+func (d retryDatabase) SetDisabled(ctx context.Context, userid string, disabled bool) error {
+	return d.do(ctx, func() error { return d.next.SetDisabled(ctx, userid, disabled) })
+}
+
+func (d retryDatabase) CreateTenant(ctx context.Context, t *users.Tenant) error {
+	return d.next.CreateTenant(ctx, t)
+}
+
+func (d retryDatabase) GetTenants(ctx context.Context) (ts []users.Tenant, err error) {
+	err = d.do(ctx, func() (err error) { ts, err = d.next.GetTenants(ctx); return })
+	return
+}
+
+func (d retryDatabase) Ping(ctx context.Context) error {
+	return d.next.Ping(ctx)
+}
+
+func (d retryDatabase) Close() error {
+	return d.next.Close()
+}
@@ -0,0 +1,300 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aheadaviation/Users/users"
+)
+
+var ErrTimeout = errors.New("Database operation timed out")
+
+// TimeoutMiddleware fails any operation that takes longer than timeout with
+// ErrTimeout, or returns the caller's error as soon as its context is done.
+// The operation is handed a context with the deadline, but a backend that
+// does not watch it carries on in the background with its result discarded.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next Database) Database {
+		return timeoutDatabase{next: next, timeout: timeout}
+	}
+}
+
+type timeoutDatabase struct {
+	next    Database
+	timeout time.Duration
+}
+
+// do runs f, returning ErrTimeout if it does not finish in time or the
+// error of ctx once that is done. Callers must only read what f writes when
+// do returns something else.
+func (d timeoutDatabase) do(ctx context.Context, f func(context.Context) error) error {
+	tctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- f(tctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-tctx.Done():
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrTimeout
+	}
+}
+
+// abandoned reports whether do gave up on its operation, which may then
+// still be writing its results.
+func abandoned(ctx context.Context, err error) bool {
+	return err != nil && (err == ErrTimeout || err == ctx.Err())
+}
+
+func (d timeoutDatabase) Init() error {
+	return d.next.Init()
+}
+
+func (d timeoutDatabase) GetUserByName(ctx context.Context, name string) (users.User, error) {
+	var u users.User
+	err := d.do(ctx, func(ctx context.Context) (err error) { u, err = d.next.GetUserByName(ctx, name); return })
+	if abandoned(ctx, err) {
+		return users.New(), err
+	}
+	return u, err
+}
+
+func (d timeoutDatabase) GetUser(ctx context.Context, id string) (users.User, error) {
+	var u users.User
+	err := d.do(ctx, func(ctx context.Context) (err error) { u, err = d.next.GetUser(ctx, id); return })
+	if abandoned(ctx, err) {
+		return users.New(), err
+	}
+	return u, err
+}
+
+func (d timeoutDatabase) GetUsers(ctx context.Context) ([]users.User, error) {
+	var us []users.User
+	err := d.do(ctx, func(ctx context.Context) (err error) { us, err = d.next.GetUsers(ctx); return })
+	if abandoned(ctx, err) {
+		return nil, err
+	}
+	return us, err
+}
+
+func (d timeoutDatabase) SearchUsers(ctx context.Context, query string, offset, limit int) ([]users.User, int, error) {
+	var us []users.User
+	var total int
+	err := d.do(ctx, func(ctx context.Context) (err error) {
+		us, total, err = d.next.SearchUsers(ctx, query, offset, limit)
+		return
+	})
+	if abandoned(ctx, err) {
+		return nil, 0, err
+	}
+	return us, total, err
+}
+
+// CreateUser, GetUserAttributes, CreateAddress, CreateCard and CreateTenant
+// work on a copy of what they are given, written back only when the call
+// was not abandoned, so that a call left running after the timeout does not
+// write to it.
+func (d timeoutDatabase) CreateUser(ctx context.Context, u *users.User) error {
+	cp := *u
+	cp.Addresses = append([]users.Address(nil), u.Addresses...)
+	cp.Cards = append([]users.Card(nil), u.Cards...)
+	err := d.do(ctx, func(ctx context.Context) error { return d.next.CreateUser(ctx, &cp) })
+	if abandoned(ctx, err) {
+		return err
+	}
+	*u = cp
+	return err
+}
+
+func (d timeoutDatabase) GetUserAttributes(ctx context.Context, u *users.User) error {
+	cp := *u
+	err := d.do(ctx, func(ctx context.Context) error { return d.next.GetUserAttributes(ctx, &cp) })
+	if abandoned(ctx, err) {
+		return err
+	}
+	*u = cp
+	return err
+}
+
+// GetUsersAttributes loads into copies of us, so that a call left running
+// after the timeout does not write to them.
+func (d timeoutDatabase) GetUsersAttributes(ctx context.Context, us []users.User) error {
+	cp := append([]users.User(nil), us...)
+	err := d.do(ctx, func(ctx context.Context) error { return d.next.GetUsersAttributes(ctx, cp) })
+	if abandoned(ctx, err) {
+		return err
+	}
+	copy(us, cp)
+	return err
+}
+
+func (d timeoutDatabase) GetAddress(ctx context.Context, id string) (users.Address, error) {
+	var a users.Address
+	err := d.do(ctx, func(ctx context.Context) (err error) { a, err = d.next.GetAddress(ctx, id); return })
+	if abandoned(ctx, err) {
+		return users.Address{}, err
+	}
+	return a, err
+}
+
+func (d timeoutDatabase) GetAddresses(ctx context.Context) ([]users.Address, error) {
+	var as []users.Address
+	err := d.do(ctx, func(ctx context.Context) (err error) { as, err = d.next.GetAddresses(ctx); return })
+	if abandoned(ctx, err) {
+		return nil, err
+	}
+	return as, err
+}
+
+func (d timeoutDatabase) CreateAddress(ctx context.Context, a *users.Address, userid string) error {
+	cp := *a
+	err := d.do(ctx, func(ctx context.Context) error { return d.next.CreateAddress(ctx, &cp, userid) })
+	if abandoned(ctx, err) {
+		return err
+	}
+	*a = cp
+	return err
+}
+
+func (d timeoutDatabase) GetCard(ctx context.Context, id string) (users.Card, error) {
+	var c users.Card
+	err := d.do(ctx, func(ctx context.Context) (err error) { c, err = d.next.GetCard(ctx, id); return })
+	if abandoned(ctx, err) {
+		return users.Card{}, err
+	}
+	return c, err
+}
+
+func (d timeoutDatabase) GetCards(ctx context.Context) ([]users.Card, error) {
+	var cs []users.Card
+	err := d.do(ctx, func(ctx context.Context) (err error) { cs, err = d.next.GetCards(ctx); return })
+	if abandoned(ctx, err) {
+		return nil, err
+	}
+	return cs, err
+}
+
+func (d timeoutDatabase) CreateCard(ctx context.Context, c *users.Card, userid string) error {
+	cp := *c
+	err := d.do(ctx, func(ctx context.Context) error { return d.next.CreateCard(ctx, &cp, userid) })
+	if abandoned(ctx, err) {
+		return err
+	}
+	*c = cp
+	return err
+}
+
+func (d timeoutDatabase) DeleteUser(ctx context.Context, id string) error {
+	return d.do(ctx, func(ctx context.Context) error { return d.next.DeleteUser(ctx, id) })
+}
+
+func (d timeoutDatabase) DeleteAddress(ctx context.Context, id, userid string) error {
+	return d.do(ctx, func(ctx context.Context) error { return d.next.DeleteAddress(ctx, id, userid) })
+}
+
+func (d timeoutDatabase) DeleteCard(ctx context.Context, id, userid string) error {
+	return d.do(ctx, func(ctx context.Context) error { return d.next.DeleteCard(ctx, id, userid) })
+}
+
+// CreateAddresses and CreateCards store copies of their items, so that a
+// call left running after the timeout does not write to them.
+func (d timeoutDatabase) CreateAddresses(ctx context.Context, as []users.Address, userids []string) ([]error, error) {
+	cp := append([]users.Address(nil), as...)
+	var errs []error
+	err := d.do(ctx, func(ctx context.Context) (err error) { errs, err = d.next.CreateAddresses(ctx, cp, userids); return })
+	if abandoned(ctx, err) {
+		return nil, err
+	}
+	copy(as, cp)
+	return errs, err
+}
+
+func (d timeoutDatabase) CreateCards(ctx context.Context, cs []users.Card, userids []string) ([]error, error) {
+	cp := append([]users.Card(nil), cs...)
+	var errs []error
+	err := d.do(ctx, func(ctx context.Context) (err error) { errs, err = d.next.CreateCards(ctx, cp, userids); return })
+	if abandoned(ctx, err) {
+		return nil, err
+	}
+	copy(cs, cp)
+	return errs, err
+}
+
+func (d timeoutDatabase) DeleteUsers(ctx context.Context, ids []string) ([]error, error) {
+	var errs []error
+	err := d.do(ctx, func(ctx context.Context) (err error) { errs, err = d.next.DeleteUsers(ctx, ids); return })
+	if abandoned(ctx, err) {
+		return nil, err
+	}
+	return errs, err
+}
+
+func (d timeoutDatabase) EraseUser(ctx context.Context, id string) (users.User, error) {
+	var u users.User
+	err := d.do(ctx, func(ctx context.Context) (err error) { u, err = d.next.EraseUser(ctx, id); return })
+	if abandoned(ctx, err) {
+		return users.New(), err
+	}
+	return u, err
+}
+
+func (d timeoutDatabase) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error {
+	return d.do(ctx, func(ctx context.Context) error { return d.next.SetDefaultAddress(ctx, userid, kind, addressid) })
+}
+
+func (d timeoutDatabase) SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) error {
+	return d.do(ctx, func(ctx context.Context) error { return d.next.SetCardBillingAddress(ctx, cardid, addressid, userid) })
+}
+
+func (d timeoutDatabase) SetPassword(ctx context.Context, userid, password, salt string) error {
+	return d.do(ctx, func(ctx context.Context) error { return d.next.SetPassword(ctx, userid, password, salt) })
+}
+
+func (d timeoutDatabase) SetDisabled(ctx context.Context, userid string, disabled bool) error {
+	return d.do(ctx, func(ctx context.Context) error { return d.next.SetDisabled(ctx, userid, disabled) })
+}
+
+func (d timeoutDatabase) CreateTenant(ctx context.Context, t *users.Tenant) error {
+	cp := *t
+	err := d.do(ctx, func(ctx context.Context) error { return d.next.CreateTenant(ctx, &cp) })
+	if abandoned(ctx, err) {
+		return err
+	}
+	*t = cp
+	return err
+}
+
+func (d timeoutDatabase) GetTenants(ctx context.Context) ([]users.Tenant, error) {
+	var ts []users.Tenant
+	err := d.do(ctx, func(ctx context.Context) (err error) { ts, err = d.next.GetTenants(ctx); return })
+	if abandoned(ctx, err) {
+		return nil, err
+	}
+	return ts, err
+}
+
+func (d timeoutDatabase) Ping(ctx context.Context) error {
+	return d.do(ctx, d.next.Ping)
+}
+
+func (d timeoutDatabase) Close() error {
+	return d.next.Close()
+}
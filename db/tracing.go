@@ -0,0 +1,222 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/aheadaviation/Users/tracing"
+	"github.com/aheadaviation/Users/users"
+)
+
+// TracingMiddleware wraps every query in a client span. system names the
+// database, such as mongodb. Init, Ping and Close are not traced so that
+// health checks do not flood the collector.
+func TracingMiddleware(system string) Middleware {
+	return func(next Database) Database {
+		return tracingDatabase{next: next, system: system}
+	}
+}
+
+type tracingDatabase struct {
+	next   Database
+	system string
+}
+
+func (d tracingDatabase) start(ctx context.Context, op string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "db."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", d.system),
+			attribute.String("db.operation", op),
+		))
+}
+
+func (d tracingDatabase) Init() error {
+	return d.next.Init()
+}
+
+func (d tracingDatabase) GetUserByName(ctx context.Context, name string) (u users.User, err error) {
+	ctx, span := d.start(ctx, "GetUserByName")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetUserByName(ctx, name)
+}
+
+func (d tracingDatabase) GetUser(ctx context.Context, id string) (u users.User, err error) {
+	ctx, span := d.start(ctx, "GetUser")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetUser(ctx, id)
+}
+
+func (d tracingDatabase) GetUsers(ctx context.Context) (us []users.User, err error) {
+	ctx, span := d.start(ctx, "GetUsers")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetUsers(ctx)
+}
+
+func (d tracingDatabase) SearchUsers(ctx context.Context, query string, offset, limit int) (us []users.User, total int, err error) {
+	ctx, span := d.start(ctx, "SearchUsers")
+	defer func() { tracing.End(span, err) }()
+	return d.next.SearchUsers(ctx, query, offset, limit)
+}
+
+func (d tracingDatabase) CreateUser(ctx context.Context, u *users.User) (err error) {
+	ctx, span := d.start(ctx, "CreateUser")
+	defer func() { tracing.End(span, err) }()
+	return d.next.CreateUser(ctx, u)
+}
+
+func (d tracingDatabase) GetUserAttributes(ctx context.Context, u *users.User) (err error) {
+	ctx, span := d.start(ctx, "GetUserAttributes")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetUserAttributes(ctx, u)
+}
+
+func (d tracingDatabase) GetUsersAttributes(ctx context.Context, us []users.User) (err error) {
+	ctx, span := d.start(ctx, "GetUsersAttributes")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetUsersAttributes(ctx, us)
+}
+
+func (d tracingDatabase) GetAddress(ctx context.Context, id string) (a users.Address, err error) {
+	ctx, span := d.start(ctx, "GetAddress")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetAddress(ctx, id)
+}
+
+func (d tracingDatabase) GetAddresses(ctx context.Context) (as []users.Address, err error) {
+	ctx, span := d.start(ctx, "GetAddresses")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetAddresses(ctx)
+}
+
+func (d tracingDatabase) CreateAddress(ctx context.Context, a *users.Address, userid string) (err error) {
+	ctx, span := d.start(ctx, "CreateAddress")
+	defer func() { tracing.End(span, err) }()
+	return d.next.CreateAddress(ctx, a, userid)
+}
+
+func (d tracingDatabase) GetCard(ctx context.Context, id string) (c users.Card, err error) {
+	ctx, span := d.start(ctx, "GetCard")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetCard(ctx, id)
+}
+
+func (d tracingDatabase) GetCards(ctx context.Context) (cs []users.Card, err error) {
+	ctx, span := d.start(ctx, "GetCards")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetCards(ctx)
+}
+
+func (d tracingDatabase) CreateCard(ctx context.Context, c *users.Card, userid string) (err error) {
+	ctx, span := d.start(ctx, "CreateCard")
+	defer func() { tracing.End(span, err) }()
+	return d.next.CreateCard(ctx, c, userid)
+}
+
+func (d tracingDatabase) DeleteUser(ctx context.Context, id string) (err error) {
+	ctx, span := d.start(ctx, "DeleteUser")
+	span.SetAttributes(attribute.String("db.collection.name", "customers"))
+	defer func() { tracing.End(span, err) }()
+	return d.next.DeleteUser(ctx, id)
+}
+
+func (d tracingDatabase) DeleteAddress(ctx context.Context, id, userid string) (err error) {
+	ctx, span := d.start(ctx, "DeleteAddress")
+	span.SetAttributes(attribute.String("db.collection.name", "addresses"))
+	defer func() { tracing.End(span, err) }()
+	return d.next.DeleteAddress(ctx, id, userid)
+}
+
+func (d tracingDatabase) DeleteCard(ctx context.Context, id, userid string) (err error) {
+	ctx, span := d.start(ctx, "DeleteCard")
+	span.SetAttributes(attribute.String("db.collection.name", "cards"))
+	defer func() { tracing.End(span, err) }()
+	return d.next.DeleteCard(ctx, id, userid)
+}
+
+func (d tracingDatabase) CreateAddresses(ctx context.Context, as []users.Address, userids []string) (errs []error, err error) {
+	ctx, span := d.start(ctx, "CreateAddresses")
+	span.SetAttributes(attribute.Int("db.operation.batch.size", len(as)))
+	defer func() { tracing.End(span, err) }()
+	return d.next.CreateAddresses(ctx, as, userids)
+}
+
+func (d tracingDatabase) CreateCards(ctx context.Context, cs []users.Card, userids []string) (errs []error, err error) {
+	ctx, span := d.start(ctx, "CreateCards")
+	span.SetAttributes(attribute.Int("db.operation.batch.size", len(cs)))
+	defer func() { tracing.End(span, err) }()
+	return d.next.CreateCards(ctx, cs, userids)
+}
+
+func (d tracingDatabase) DeleteUsers(ctx context.Context, ids []string) (errs []error, err error) {
+	ctx, span := d.start(ctx, "DeleteUsers")
+	span.SetAttributes(attribute.Int("db.operation.batch.size", len(ids)))
+	defer func() { tracing.End(span, err) }()
+	return d.next.DeleteUsers(ctx, ids)
+}
+
+func (d tracingDatabase) EraseUser(ctx context.Context, id string) (u users.User, err error) {
+	ctx, span := d.start(ctx, "EraseUser")
+	defer func() { tracing.End(span, err) }()
+	return d.next.EraseUser(ctx, id)
+}
+
+func (d tracingDatabase) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) (err error) {
+	ctx, span := d.start(ctx, "SetDefaultAddress")
+	defer func() { tracing.End(span, err) }()
+	return d.next.SetDefaultAddress(ctx, userid, kind, addressid)
+}
+
+func (d tracingDatabase) SetCardBillingAddress(ctx context.Context, cardid, addressid, userid string) (err error) {
+	ctx, span := d.start(ctx, "SetCardBillingAddress")
+	defer func() { tracing.End(span, err) }()
+	return d.next.SetCardBillingAddress(ctx, cardid, addressid, userid)
+}
+
+func (d tracingDatabase) SetPassword(ctx context.Context, userid, password, salt string) (err error) {
+	ctx, span := d.start(ctx, "SetPassword")
+	defer func() { tracing.End(span, err) }()
+	return d.next.SetPassword(ctx, userid, password, salt)
+}
+
+func (d tracingDatabase) SetDisabled(ctx context.Context, userid string, disabled bool) (err error) {
+	ctx, span := d.start(ctx, "SetDisabled")
+	defer func() { tracing.End(span, err) }()
+	return d.next.SetDisabled(ctx, userid, disabled)
+}
+
+func (d tracingDatabase) CreateTenant(ctx context.Context, t *users.Tenant) (err error) {
+	ctx, span := d.start(ctx, "CreateTenant")
+	defer func() { tracing.End(span, err) }()
+	return d.next.CreateTenant(ctx, t)
+}
+
+func (d tracingDatabase) GetTenants(ctx context.Context) (ts []users.Tenant, err error) {
+	ctx, span := d.start(ctx, "GetTenants")
+	defer func() { tracing.End(span, err) }()
+	return d.next.GetTenants(ctx)
+}
+
+func (d tracingDatabase) Ping(ctx context.Context) error {
+	return d.next.Ping(ctx)
+}
+
+func (d tracingDatabase) Close() error {
+	return d.next.Close()
+}
@@ -0,0 +1,169 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	stdconsul "github.com/hashicorp/consul/api"
+)
+
+type consulRegistrar struct {
+	client *stdconsul.Client
+	reg    *stdconsul.AgentServiceRegistration
+	ttlID  string
+	ttl    time.Duration
+	logger log.Logger
+
+	mtx     sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+	lastErr error
+}
+
+func newConsulRegistrar(c Config, logger log.Logger) (Registrar, error) {
+	if c.ConsulAddr == "" {
+		return nil, ErrNoConsulAddress
+	}
+	if c.AdvertiseAddr == "" {
+		return nil, ErrNoAdvertiseAddr
+	}
+	host, p, err := net.SplitHostPort(c.AdvertiseAddr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf(ErrInvalidAdvertise, c.AdvertiseAddr)
+	}
+	client, err := stdconsul.NewClient(&stdconsul.Config{Address: c.ConsulAddr})
+	if err != nil {
+		return nil, err
+	}
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	id := instanceID(c.ServiceName, c.AdvertiseAddr)
+	r := &consulRegistrar{
+		client: client,
+		ttlID:  id + ":ttl",
+		ttl:    ttl,
+		logger: log.With(logger, "id", id),
+	}
+	r.reg = &stdconsul.AgentServiceRegistration{
+		ID:                id,
+		Name:              c.ServiceName,
+		Tags:              c.Tags,
+		Port:              port,
+		Address:           host,
+		EnableTagOverride: false,
+		Checks: stdconsul.AgentServiceChecks{
+			{
+				CheckID:                        r.ttlID,
+				Name:                           "heartbeat",
+				TTL:                            ttl.String(),
+				DeregisterCriticalServiceAfter: (10 * ttl).String(),
+			},
+		},
+	}
+	if c.HealthPath != "" {
+		r.reg.Checks = append(r.reg.Checks, &stdconsul.AgentServiceCheck{
+			CheckID:  id + ":http",
+			Name:     "readiness",
+			HTTP:     fmt.Sprintf("http://%v%v", c.AdvertiseAddr, c.HealthPath),
+			Interval: "10s",
+			Timeout:  "2s",
+		})
+	}
+	return r, nil
+}
+
+// instanceID is unique per replica so that instances on different hosts, or
+// on different ports of the same host, do not replace each other.
+func instanceID(name, addr string) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+	r := strings.NewReplacer(":", "-", "[", "", "]", "")
+	return fmt.Sprintf("%v-%v-%v", name, hostname, r.Replace(addr))
+}
+
+// Register adds the service to the local agent and starts sending TTL
+// heartbeats until Deregister.
+func (r *consulRegistrar) Register() error {
+	if err := r.client.Agent().ServiceRegister(r.reg); err != nil {
+		return err
+	}
+	r.logger.Log("action", "register")
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.stop == nil {
+		r.stop = make(chan struct{})
+		r.done = make(chan struct{})
+		go r.heartbeat(r.stop, r.done)
+	}
+	return nil
+}
+
+func (r *consulRegistrar) Deregister() error {
+	r.mtx.Lock()
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+		r.stop = nil
+	}
+	r.mtx.Unlock()
+	r.logger.Log("action", "deregister")
+	return r.client.Agent().ServiceDeregister(r.reg.ID)
+}
+
+// Check reports whether the agent answers and the last heartbeat reached it.
+func (r *consulRegistrar) Check() error {
+	if _, err := r.client.Agent().NodeName(); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.lastErr
+}
+
+func (r *consulRegistrar) heartbeat(stop, done chan struct{}) {
+	defer close(done)
+	t := time.NewTicker(r.ttl / 3)
+	defer t.Stop()
+	for {
+		err := r.client.Agent().UpdateTTL(r.ttlID, "", stdconsul.HealthPassing)
+		if err != nil {
+			r.logger.Log("action", "heartbeat", "err", err)
+		}
+		r.mtx.Lock()
+		r.lastErr = err
+		r.mtx.Unlock()
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+	}
+}
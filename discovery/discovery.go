@@ -0,0 +1,125 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Registrar announces this instance to a discovery system.
+type Registrar interface {
+	Register() error
+	Deregister() error
+}
+
+type Config struct {
+	// Kind is one of none, consul, static, or kubernetes (alias dns).
+	Kind        string
+	ServiceName string
+	// AdvertiseAddr is the host:port other services reach this instance on.
+	AdvertiseAddr string
+	Tags          []string
+	ConsulAddr    string
+	// HealthPath is polled by Consul to check the instance.
+	HealthPath string
+	// TTL is how long Consul waits for a heartbeat before marking the
+	// instance critical.
+	TTL time.Duration
+}
+
+var (
+	ErrUnknownKind      = "Unknown discovery kind %v"
+	ErrNoConsulAddress  = errors.New("No consul address set")
+	ErrNoAdvertiseAddr  = errors.New("No advertise address set")
+	ErrInvalidAdvertise = "Invalid advertise address %v"
+)
+
+// New returns the registrar for c.Kind.
+func New(c Config, logger log.Logger) (Registrar, error) {
+	logger = log.With(logger, "component", "discovery", "kind", c.Kind)
+	switch c.Kind {
+	case "", "none":
+		return nopRegistrar{}, nil
+	case "static", "kubernetes", "dns":
+		if c.AdvertiseAddr == "" {
+			return nil, ErrNoAdvertiseAddr
+		}
+		return staticRegistrar{addr: c.AdvertiseAddr, logger: logger}, nil
+	case "consul":
+		return newConsulRegistrar(c, logger)
+	}
+	return nil, fmt.Errorf(ErrUnknownKind, c.Kind)
+}
+
+// AdvertiseAddr returns addr with port filled in when it has none. An empty
+// addr falls back to the first non-loopback address of the host, so no
+// network access is needed to find it.
+func AdvertiseAddr(addr, port string) (string, error) {
+	if addr == "" {
+		host, err := localIP()
+		if err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(host, port), nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr, nil
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port), nil
+}
+
+func localIP() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok || n.IP.IsLoopback() || n.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ip := n.IP.To4(); ip != nil {
+			return ip.String(), nil
+		}
+	}
+	return "127.0.0.1", nil
+}
+
+type nopRegistrar struct{}
+
+func (nopRegistrar) Register() error   { return nil }
+func (nopRegistrar) Deregister() error { return nil }
+
+// staticRegistrar is used when clients find the service through a fixed
+// address or cluster DNS, as with a Kubernetes Service, and nothing needs to
+// be registered.
+type staticRegistrar struct {
+	addr   string
+	logger log.Logger
+}
+
+func (r staticRegistrar) Register() error {
+	return r.logger.Log("advertise", r.addr)
+}
+
+func (r staticRegistrar) Deregister() error {
+	return nil
+}
@@ -0,0 +1,128 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	stdconsul "github.com/hashicorp/consul/api"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeAgent struct {
+	mtx          sync.Mutex
+	registered   []stdconsul.AgentServiceRegistration
+	heartbeats   int
+	deregistered []string
+}
+
+func (f *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var reg stdconsul.AgentServiceRegistration
+		json.NewDecoder(r.Body).Decode(&reg)
+		f.registered = append(f.registered, reg)
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/update/"):
+		f.heartbeats++
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		f.deregistered = append(f.deregistered, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestConsulRegistrar(t *testing.T) {
+
+	Convey("Given a consul agent", t, func() {
+		agent := &fakeAgent{}
+		ts := httptest.NewServer(agent)
+		defer ts.Close()
+		c := Config{
+			Kind:          "consul",
+			ServiceName:   "users",
+			AdvertiseAddr: "10.0.0.5:8084",
+			Tags:          []string{"app=bagshop"},
+			ConsulAddr:    strings.TrimPrefix(ts.URL, "http://"),
+			HealthPath:    "/health/ready",
+			TTL:           300 * time.Millisecond,
+		}
+
+		Convey("When two replicas register and one deregisters", func() {
+			a, err := New(c, log.NewNopLogger())
+			So(err, ShouldBeNil)
+			c.AdvertiseAddr = "10.0.0.6:8084"
+			b, err := New(c, log.NewNopLogger())
+			So(err, ShouldBeNil)
+			So(a.Register(), ShouldBeNil)
+			So(b.Register(), ShouldBeNil)
+			time.Sleep(250 * time.Millisecond)
+			So(a.Deregister(), ShouldBeNil)
+			So(b.Deregister(), ShouldBeNil)
+
+			agent.mtx.Lock()
+			defer agent.mtx.Unlock()
+
+			Convey("Then each should have its own ID and address", func() {
+				So(agent.registered, ShouldHaveLength, 2)
+				So(agent.registered[0].ID, ShouldNotEqual, agent.registered[1].ID)
+				So(agent.registered[0].Address, ShouldEqual, "10.0.0.5")
+				So(agent.registered[0].Port, ShouldEqual, 8084)
+			})
+
+			Convey("Then a TTL and an HTTP check should be registered", func() {
+				checks := agent.registered[0].Checks
+				So(checks, ShouldHaveLength, 2)
+				So(checks[0].TTL, ShouldEqual, "300ms")
+				So(checks[1].HTTP, ShouldEqual, "http://10.0.0.5:8084/health/ready")
+			})
+
+			Convey("Then heartbeats should be sent and both removed", func() {
+				So(agent.heartbeats, ShouldBeGreaterThanOrEqualTo, 4)
+				So(agent.deregistered, ShouldResemble, []string{agent.registered[0].ID, agent.registered[1].ID})
+			})
+		})
+	})
+
+	Convey("Given consul discovery without an agent address", t, func() {
+		_, err := New(Config{Kind: "consul", AdvertiseAddr: "10.0.0.5:8084"}, log.NewNopLogger())
+
+		Convey("Then it should be rejected", func() {
+			So(err, ShouldEqual, ErrNoConsulAddress)
+		})
+	})
+}
+
+func TestAdvertiseAddr(t *testing.T) {
+
+	Convey("Given advertise addresses with and without ports", t, func() {
+		Convey("Then the port should only be added when missing", func() {
+			a, _ := AdvertiseAddr("users.internal", "8084")
+			So(a, ShouldEqual, "users.internal:8084")
+			a, _ = AdvertiseAddr("10.0.0.5:9000", "8084")
+			So(a, ShouldEqual, "10.0.0.5:9000")
+			a, _ = AdvertiseAddr("fd00::5", "8084")
+			So(a, ShouldEqual, "[fd00::5]:8084")
+		})
+
+		Convey("Then an empty address should resolve without the network", func() {
+			a, err := AdvertiseAddr("", "8084")
+			So(err, ShouldBeNil)
+			So(a, ShouldEndWith, ":8084")
+		})
+	})
+
+	Convey("Given an unknown discovery kind", t, func() {
+		_, err := New(Config{Kind: "zookeeper"}, log.NewNopLogger())
+
+		Convey("Then it should be rejected", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,133 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+const (
+	CustomerErased = "customer.erased"
+)
+
+type Event struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Subject string    `json:"subject"`
+	Time    time.Time `json:"time"`
+}
+
+// New returns an event of the given type about subject, usually a customer ID.
+func New(typ, subject string) Event {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return Event{
+		ID:      fmt.Sprintf("%x", b),
+		Type:    typ,
+		Subject: subject,
+		Time:    time.Now().UTC(),
+	}
+}
+
+type Publisher interface {
+	Publish(Event) error
+}
+
+var (
+	DefaultOutbox       *Outbox
+	ErrNoPublisherFound = "No event publisher with name %v"
+	ErrOutboxLag        = "%v events pending, oldest for %v"
+)
+
+// Init starts the default outbox with the named publisher. webhookURL is only
+// used by the webhook publisher.
+func Init(publisher, webhookURL string, logger log.Logger) error {
+	var p Publisher
+	switch publisher {
+	case "", "log":
+		p = NewLogPublisher(logger)
+	case "webhook":
+		p = NewWebhookPublisher(webhookURL)
+	case "none":
+		p = nopPublisher{}
+	default:
+		return fmt.Errorf(ErrNoPublisherFound, publisher)
+	}
+	DefaultOutbox = NewOutbox(p, logger)
+	go DefaultOutbox.Run()
+	return nil
+}
+
+// Publish queues the event on the default outbox. Events published before
+// Init are dropped.
+func Publish(e Event) {
+	if DefaultOutbox != nil {
+		DefaultOutbox.Add(e)
+	}
+}
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(Event) error {
+	return nil
+}
+
+type logPublisher struct {
+	logger log.Logger
+}
+
+func NewLogPublisher(logger log.Logger) Publisher {
+	return logPublisher{logger: log.With(logger, "component", "events")}
+}
+
+func (p logPublisher) Publish(e Event) error {
+	return p.logger.Log("event", e.Type, "subject", e.Subject, "id", e.ID)
+}
+
+type webhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPublisher posts each event as JSON to url.
+func NewWebhookPublisher(url string) Publisher {
+	return webhookPublisher{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (p webhookPublisher) Publish(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Post(p.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Outbox decouples callers from the publisher. Events are delivered in order
+// and retried until the publisher accepts them, so delivery is at least once.
+type Outbox struct {
+	publisher Publisher
+	logger    log.Logger
+	retry     time.Duration
+
+	mtx     sync.Mutex
+	pending []Event
+
+	notify  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func NewOutbox(p Publisher, logger log.Logger) *Outbox {
+	return &Outbox{
+		publisher: p,
+		logger:    log.With(logger, "component", "outbox"),
+		retry:     5 * time.Second,
+		pending:   make([]Event, 0),
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+func (o *Outbox) Add(e Event) {
+	o.mtx.Lock()
+	o.pending = append(o.pending, e)
+	o.mtx.Unlock()
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers queued events until Close is called.
+func (o *Outbox) Run() {
+	defer close(o.stopped)
+	t := time.NewTicker(o.retry)
+	defer t.Stop()
+	for {
+		select {
+		case <-o.notify:
+		case <-t.C:
+		case <-o.done:
+			o.flush()
+			return
+		}
+		o.flush()
+	}
+}
+
+// Close stops Run after a last delivery attempt.
+func (o *Outbox) Close() {
+	close(o.done)
+	<-o.stopped
+}
+
+// Pending returns the number of undelivered events.
+func (o *Outbox) Pending() int {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return len(o.pending)
+}
+
+// Lag returns the age of the oldest undelivered event.
+func (o *Outbox) Lag() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if len(o.pending) == 0 {
+		return 0
+	}
+	return time.Since(o.pending[0].Time)
+}
+
+// CheckLag returns an error when the oldest pending event has waited longer
+// than max.
+func (o *Outbox) CheckLag(max time.Duration) error {
+	if lag := o.Lag(); lag > max {
+		return fmt.Errorf(ErrOutboxLag, o.Pending(), lag.Truncate(time.Millisecond))
+	}
+	return nil
+}
+
+func (o *Outbox) flush() {
+	for {
+		o.mtx.Lock()
+		if len(o.pending) == 0 {
+			o.mtx.Unlock()
+			return
+		}
+		e := o.pending[0]
+		o.mtx.Unlock()
+
+		if err := o.publisher.Publish(e); err != nil {
+			o.logger.Log("event", e.ID, "err", err)
+			return
+		}
+
+		o.mtx.Lock()
+		o.pending = o.pending[1:]
+		o.mtx.Unlock()
+	}
+}
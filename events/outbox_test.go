@@ -0,0 +1,72 @@
+package events
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordingPublisher struct {
+	mtx  sync.Mutex
+	fail bool
+	got  []Event
+}
+
+func (p *recordingPublisher) Publish(e Event) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.fail {
+		return errors.New("unavailable")
+	}
+	p.got = append(p.got, e)
+	return nil
+}
+
+func TestOutbox(t *testing.T) {
+
+	Convey("Given an outbox", t, func() {
+		p := &recordingPublisher{}
+		o := NewOutbox(p, log.NewNopLogger())
+
+		Convey("When the publisher is unavailable", func() {
+			p.fail = true
+			o.Add(New(CustomerErased, "a"))
+			o.Add(New(CustomerErased, "b"))
+			o.flush()
+
+			Convey("Then events stay pending in order", func() {
+				So(o.Pending(), ShouldEqual, 2)
+				So(o.Lag(), ShouldBeGreaterThan, 0)
+			})
+
+			Convey("Then the lag check fails once they are too old", func() {
+				So(o.CheckLag(time.Hour), ShouldBeNil)
+				So(o.CheckLag(0), ShouldNotBeNil)
+			})
+
+			Convey("Then they are delivered once it recovers", func() {
+				p.fail = false
+				o.flush()
+				So(o.Pending(), ShouldEqual, 0)
+				So(o.Lag(), ShouldEqual, 0)
+				So(len(p.got), ShouldEqual, 2)
+				So(p.got[0].Subject, ShouldEqual, "a")
+				So(p.got[1].Subject, ShouldEqual, "b")
+			})
+		})
+
+		Convey("When closed", func() {
+			go o.Run()
+			o.Add(New(CustomerErased, "c"))
+			o.Close()
+
+			Convey("Then pending events are flushed", func() {
+				So(o.Pending(), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,215 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health runs dependency checks for the readiness endpoint.
+// Subsystems register a Checker under a name; critical checks make the
+// instance unready when they fail, others only mark it degraded.
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+type Checker interface {
+	Check() error
+}
+
+// CheckerFunc adapts a function to a Checker.
+type CheckerFunc func() error
+
+func (f CheckerFunc) Check() error {
+	return f()
+}
+
+type Check struct {
+	Name     string
+	Critical bool
+	// Timeout bounds a single run of the check. Zero uses DefaultTimeout.
+	Timeout time.Duration
+	Checker Checker
+}
+
+// Result is the outcome of the latest run of a check. LastError and
+// LastErrorAt are kept after the check recovers.
+type Result struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"`
+	LatencyMs   float64    `json:"latencyMs"`
+	Error       string     `json:"error,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+	CheckedAt   time.Time  `json:"checkedAt"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+var (
+	DefaultTimeout  = 2 * time.Second
+	DefaultRegistry = NewRegistry()
+	ErrTimeout      = "Check timed out after %v"
+	started         = time.Now()
+)
+
+type Registry struct {
+	mtx    sync.Mutex
+	checks []Check
+	last   map[string]Result
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		checks: make([]Check, 0),
+		last:   map[string]Result{},
+	}
+}
+
+// Register adds a check, replacing any earlier check with the same name.
+func (r *Registry) Register(c Check) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for i, e := range r.checks {
+		if e.Name == c.Name {
+			r.checks[i] = c
+			return
+		}
+	}
+	r.checks = append(r.checks, c)
+}
+
+// Run runs every check concurrently and returns their results in the order
+// they were registered.
+func (r *Registry) Run() Report {
+	r.mtx.Lock()
+	checks := append([]Check(nil), r.checks...)
+	r.mtx.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = run(c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: results}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for i, res := range results {
+		prev := r.last[res.Name]
+		if res.Error == "" {
+			res.LastError, res.LastErrorAt = prev.LastError, prev.LastErrorAt
+		}
+		results[i] = res
+		r.last[res.Name] = res
+		if res.Status == StatusUp {
+			continue
+		}
+		if res.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func run(c Check) Result {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	begin := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.Checker.Check() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		err = fmt.Errorf(ErrTimeout, timeout)
+	}
+	res := Result{
+		Name:      c.Name,
+		Status:    StatusUp,
+		Critical:  c.Critical,
+		LatencyMs: float64(time.Since(begin)) / float64(time.Millisecond),
+		CheckedAt: begin.UTC(),
+	}
+	if err != nil {
+		at := res.CheckedAt
+		res.Status = StatusDown
+		res.Error = err.Error()
+		res.LastError = res.Error
+		res.LastErrorAt = &at
+	}
+	return res
+}
+
+// ReadyHandler runs the checks and answers 503 when a critical one fails,
+// otherwise 200. The body is the Report.
+func (r *Registry) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Run()
+		code := http.StatusOK
+		if report.Status == StatusDown {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	})
+}
+
+// LiveHandler answers 200 while the process can serve requests at all. It
+// does not look at dependencies, so an outage elsewhere never causes the
+// instance to be restarted.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": StatusUp,
+			"uptime": time.Since(started).Truncate(time.Second).String(),
+		})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Register adds a check to the default registry.
+func Register(name string, critical bool, c Checker) {
+	DefaultRegistry.Register(Check{Name: name, Critical: critical, Checker: c})
+}
+
+// Run runs the checks of the default registry.
+func Run() Report {
+	return DefaultRegistry.Run()
+}
@@ -0,0 +1,99 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+
+	Convey("Given a registry with critical and optional checks", t, func() {
+		var dbErr, tracerErr error
+		r := NewRegistry()
+		r.Register(Check{Name: "database", Critical: true, Checker: CheckerFunc(func() error { return dbErr })})
+		r.Register(Check{Name: "tracer", Checker: CheckerFunc(func() error { return tracerErr })})
+
+		Convey("When every check passes", func() {
+			report := r.Run()
+
+			Convey("Then the instance should be up", func() {
+				So(report.Status, ShouldEqual, StatusUp)
+				So(report.Checks, ShouldHaveLength, 2)
+				So(report.Checks[0].Name, ShouldEqual, "database")
+			})
+		})
+
+		Convey("When an optional check fails", func() {
+			tracerErr = errors.New("connection refused")
+			report := r.Run()
+
+			Convey("Then the instance should only be degraded", func() {
+				So(report.Status, ShouldEqual, StatusDegraded)
+				So(report.Checks[1].Status, ShouldEqual, StatusDown)
+				So(report.Checks[1].Error, ShouldEqual, "connection refused")
+			})
+		})
+
+		Convey("When a critical check fails and then recovers", func() {
+			dbErr = errors.New("no reachable servers")
+			down := r.Run()
+			dbErr = nil
+			up := r.Run()
+
+			Convey("Then the failure should make it unready", func() {
+				So(down.Status, ShouldEqual, StatusDown)
+			})
+
+			Convey("Then the last error should be kept after recovery", func() {
+				So(up.Status, ShouldEqual, StatusUp)
+				So(up.Checks[0].Error, ShouldEqual, "")
+				So(up.Checks[0].LastError, ShouldEqual, "no reachable servers")
+				So(up.Checks[0].LastErrorAt, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When served over HTTP", func() {
+			dbErr = errors.New("no reachable servers")
+			rec := httptest.NewRecorder()
+			r.ReadyHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/health/ready", nil))
+			var report Report
+			json.NewDecoder(rec.Body).Decode(&report)
+
+			Convey("Then readiness should be 503 with the report", func() {
+				So(rec.Code, ShouldEqual, http.StatusServiceUnavailable)
+				So(report.Status, ShouldEqual, StatusDown)
+			})
+
+			Convey("Then liveness should still be 200", func() {
+				rec := httptest.NewRecorder()
+				LiveHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/health/live", nil))
+				So(rec.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+
+	Convey("Given a check that hangs", t, func() {
+		r := NewRegistry()
+		r.Register(Check{Name: "slow", Critical: true, Timeout: 20 * time.Millisecond, Checker: CheckerFunc(func() error {
+			time.Sleep(time.Second)
+			return nil
+		})})
+
+		Convey("When run", func() {
+			begin := time.Now()
+			report := r.Run()
+
+			Convey("Then it should fail at its timeout", func() {
+				So(time.Since(begin), ShouldBeLessThan, 500*time.Millisecond)
+				So(report.Status, ShouldEqual, StatusDown)
+				So(report.Checks[0].Error, ShouldContainSubstring, "timed out")
+			})
+		})
+	})
+}
@@ -1,36 +1,28 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"net"
-	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
 	"syscall"
 
-	corelog "log"
-
 	"github.com/go-kit/kit/log"
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
-	"github.com/go-kit/kit/sd/consul"
-	stdconsul "github.com/hashicorp/consul/api"
-	stdopentracing "github.com/opentracing/opentracing-go"
-	zipkin "github.com/openzipkin/zipkin-go-opentracing"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
-	//commonMiddleware "github.com/weaveworks/common/middleware"
 
 	"github.com/aheadaviation/Users/api"
+	"github.com/aheadaviation/Users/config"
 	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/db/cache"
 	"github.com/aheadaviation/Users/db/mongodb"
-)
-
-var (
-	port        string
-	zipkinV2URL string
-	consulAddr  string
+	"github.com/aheadaviation/Users/discovery"
+	"github.com/aheadaviation/Users/events"
+	"github.com/aheadaviation/Users/health"
+	"github.com/aheadaviation/Users/server"
+	"github.com/aheadaviation/Users/tenant"
+	"github.com/aheadaviation/Users/tracing"
 )
 
 var (
@@ -38,7 +30,17 @@ var (
 		Name:    "http_request_duration_seconds",
 		Help:    "Time (in seconds) spent serving HTTP requests.",
 		Buckets: stdprometheus.DefBuckets,
-	}, []string{"method", "path", "status_code", "isWS"})
+	}, server.HTTPLabels)
+	HTTPRequestSize = stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+		Name:    "http_request_size_bytes",
+		Help:    "Size (in bytes) of HTTP request bodies.",
+		Buckets: stdprometheus.ExponentialBuckets(64, 4, 8),
+	}, server.HTTPLabels)
+	HTTPResponseSize = stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "Size (in bytes) of HTTP responses.",
+		Buckets: stdprometheus.ExponentialBuckets(64, 4, 8),
+	}, server.HTTPLabels)
 )
 
 const (
@@ -46,18 +48,11 @@ const (
 )
 
 func init() {
-	stdprometheus.MustRegister(HTTPLatency)
-	flag.StringVar(&zipkinV2URL, "zipkin", os.Getenv("ZIPKIN_V2_URL"), "zipkin v2 address")
-	flag.StringVar(&port, "port", "8084", "Port on which to run")
-	flag.StringVar(&consulAddr, "consul_addr", os.Getenv("CONSUL_ADDR"), "Address of consul agent")
-	db.Register("mongodb", &mongodb.Mongo{})
+	stdprometheus.MustRegister(HTTPLatency, HTTPRequestSize, HTTPResponseSize)
 }
 
 func main() {
 
-	flag.Parse()
-	errc := make(chan error)
-
 	var logger log.Logger
 	{
 		logger = log.NewLogfmtLogger(os.Stderr)
@@ -65,65 +60,163 @@ func main() {
 		logger = log.With(logger, "caller", log.DefaultCaller)
 	}
 
-	if consulAddr == "" {
-		logger.Log("error", "no consul address set")
+	if ok, err := runCommand(os.Args[1:]); ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, report, err := config.Load(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+	report.Log(log.With(logger, "component", "config"))
+	if err := report.Err(); err != nil {
+		logger.Log("err", err)
 		os.Exit(1)
 	}
 
-	conn, err := net.Dial("udp", "8.8.8.8:80")
+	errc := make(chan error)
+	api.SetAdminRoles(cfg.AdminRoles)
+	api.SetMaxBatchSize(cfg.BatchMax)
+	db.Register("mongodb", &mongodb.Mongo{
+		Host:          cfg.Mongo.Host,
+		User:          cfg.Mongo.User,
+		Password:      string(cfg.Mongo.Password),
+		DefaultTenant: cfg.Tenant.Default,
+	})
+
+	advertise, err := discovery.AdvertiseAddr(cfg.Discovery.AdvertiseAddr, cfg.Port)
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+	discoveryKind := cfg.Discovery.Kind
+	if discoveryKind == "" && cfg.Discovery.ConsulAddr != "" {
+		discoveryKind = "consul"
+	}
+	registrar, err := discovery.New(discovery.Config{
+		Kind:          discoveryKind,
+		ServiceName:   ServiceName,
+		AdvertiseAddr: advertise,
+		Tags:          cfg.Discovery.Tags,
+		ConsulAddr:    cfg.Discovery.ConsulAddr,
+		HealthPath:    "/health/ready",
+	}, logger)
 	if err != nil {
 		logger.Log("err", err)
 		os.Exit(1)
 	}
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	host := strings.Split(localAddr.String(), ":")[0]
-	defer conn.Close()
 
-	var tracer stdopentracing.Tracer
-	{
-		if zipkinV2URL == "" {
-			tracer = stdopentracing.NoopTracer{}
-		} else {
-			logger := log.With(logger, "tracer", "Zipkin")
-			logger.Log("addr", zipkinV2URL)
-			collector, err := zipkin.NewHTTPCollector(
-				zipkinV2URL,
-				zipkin.HTTPLogger(logger),
-			)
-			if err != nil {
-				logger.Log("err", err)
-				os.Exit(1)
-			}
-			tracer, err = zipkin.NewTracer(
-				zipkin.NewRecorder(collector, false, fmt.Sprintf("%v:%v", host, port), ServiceName),
-			)
-			if err != nil {
-				logger.Log("err", err)
-				os.Exit(1)
-			}
-		}
-		stdopentracing.InitGlobalTracer(tracer)
+	tracer, err := tracing.New(tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: ServiceName,
+		InstanceID:  advertise,
+	})
+	if err != nil {
+		logger.Log("tracer", cfg.Tracing.Exporter, "err", err)
+		os.Exit(1)
 	}
 
-	dbconn := false
-	for !dbconn {
-		err := db.Init()
-		if err != nil {
-			if err == db.ErrNoDatabaseSelected {
-				corelog.Fatal(err)
-			}
-			corelog.Print(err)
-		} else {
-			dbconn = true
+	connectCtx, cancel := context.WithTimeout(context.Background(), cfg.Database.ConnectTimeout)
+	err = db.Connect(connectCtx, cfg.Database.Kind, log.With(logger, "component", "db"))
+	cancel()
+	if err != nil {
+		logger.Log("database", cfg.Database.Kind, "err", err)
+		os.Exit(1)
+	}
+
+	breaker := db.NewBreaker(cfg.Database.BreakerThreshold, cfg.Database.BreakerCooldown,
+		kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "microservices_demo",
+			Subsystem: "users",
+			Name:      "db_circuit_state",
+			Help:      "State of the database circuit breaker: 0 closed, 1 half-open, 2 open.",
+		}, []string{}),
+		kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "microservices_demo",
+			Subsystem: "users",
+			Name:      "db_circuit_rejected_total",
+			Help:      "Number of database operations rejected by the open circuit breaker.",
+		}, []string{}),
+	)
+	cacheMiddleware := func(next db.Database) db.Database { return next }
+	if cfg.Cache.Kind != "none" {
+		var store cache.Store = cache.NewLRU(cfg.Cache.Size)
+		if cfg.Cache.Kind == "redis" {
+			redis := cache.NewRedis(cfg.Cache.RedisAddr, string(cfg.Cache.RedisPassword), cfg.Cache.RedisPrefix, 16)
+			health.Register("cache", false, redis)
+			store = redis
 		}
+		cacheMiddleware = cache.Middleware(store, cfg.Cache.TTL,
+			kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+				Namespace: "microservices_demo",
+				Subsystem: "users",
+				Name:      "cache_hits_total",
+				Help:      "Number of database lookups answered from the cache.",
+			}, []string{"kind"}),
+			kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+				Namespace: "microservices_demo",
+				Subsystem: "users",
+				Name:      "cache_misses_total",
+				Help:      "Number of database lookups not found in the cache.",
+			}, []string{"kind"}),
+		)
+	}
+
+	dbMiddlewares := map[string]db.Middleware{
+		"cache":   cacheMiddleware,
+		"logging": db.LoggingMiddleware(log.With(logger, "component", "db")),
+		"tracing": db.TracingMiddleware(cfg.Database.Kind),
+		"metrics": db.InstrumentingMiddleware(
+			kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+				Namespace: "microservices_demo",
+				Subsystem: "users",
+				Name:      "db_operation_duration_seconds",
+				Help:      "Time (in seconds) spent in database operations.",
+				Buckets:   stdprometheus.DefBuckets,
+			}, []string{"operation"}),
+			kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+				Namespace: "microservices_demo",
+				Subsystem: "users",
+				Name:      "db_operation_errors_total",
+				Help:      "Number of database operations that failed.",
+			}, []string{"operation"}),
+		),
+		"breaker": db.BreakerMiddleware(breaker),
+		"retry":   db.RetryMiddleware(cfg.Database.Retries, cfg.Database.RetryBackoff),
+		"timeout": db.TimeoutMiddleware(cfg.Database.Timeout),
+	}
+	db.DefaultDb, err = db.ChainNamed(db.DefaultDb, cfg.Database.Middlewares, dbMiddlewares)
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+	if cfg.Database.Kind == "mongodb" {
+		stdprometheus.MustRegister(mongodb.NewStatsCollector("microservices_demo_users"))
 	}
 
-	fieldKeys := []string{"method"}
+	if err := events.Init(cfg.Events.Publisher, cfg.Events.WebhookURL, logger); err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+
+	fieldKeys := []string{"method", "error"}
 
 	var service api.Service
 	{
 		service = api.NewFixedService()
 		service = api.LoggingMiddleware(logger)(service)
+		service = api.TracingMiddleware()(service)
 		service = api.NewInstrumentingService(
 			kitprometheus.NewCounterFrom(
 				stdprometheus.CounterOpts{
@@ -143,52 +236,113 @@ func main() {
 		)
 	}
 
-	endpoints := api.MakeEndpoints(service, tracer)
+	tenants := tenant.NewRegistry(cfg.Tenant.Default, cfg.Tenant.Refresh, db.GetTenants)
+	api.SetTenantRegistry(tenants)
 
-	router := api.MakeHTTPHandler(endpoints, logger, tracer)
+	endpoints := api.MakeEndpoints(service)
 
-	// httpMiddleware := []commonMiddleware.Interface{
-	// 	commonMiddleware.Instrument{
-	// 		Duration:     HTTPLatency,
-	// 		RouteMatcher: router,
-	// 	},
-	// }
+	deprecations, err := api.ParseDeprecations(cfg.Deprecations)
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
 
-	//handler := commonMiddleware.Merge(httpMiddleware...).Wrap(router)
+	links := api.LinkOptions{Relative: cfg.RelativeLinks}
+	links.TrustedProxies, err = api.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+	if cfg.LinkDomain != "" {
+		override, err := api.ParseLinkBase(cfg.LinkDomain)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		links.Override = &override
+	}
 
-	stdClient, err := stdconsul.NewClient(&stdconsul.Config{
-		Address: consulAddr,
-	})
+	graphQL, err := api.MakeGraphQLHandler(service, logger)
 	if err != nil {
-		logger.Log("error", "couldn't connect to consul agent")
+		logger.Log("err", err)
 		os.Exit(1)
 	}
-	sdclient := consul.NewClient(stdClient)
 
-	intPort, _ := strconv.Atoi(port)
-	reg := &stdconsul.AgentServiceRegistration{
-		ID:                "USR",
-		Name:              "users",
-		Tags:              []string{"app=bagshop"},
-		Port:              intPort,
-		Address:           localAddr.String(),
-		EnableTagOverride: false,
+	router := api.MakeHTTPHandler(endpoints, logger)
+	router.Methods("GET", "POST").Path(api.GraphQLPath).Handler(graphQL)
+	router.Use(api.DeprecationMiddleware(deprecations))
+	router.Use(api.LinkMiddleware(links))
+	router.Use(tenant.Resolver{
+		Sources:  cfg.Tenant.Sources,
+		Header:   cfg.Tenant.Header,
+		Claim:    cfg.Tenant.Claim,
+		Registry: tenants,
+		Error:    api.EncodeRequestError,
+	}.Middleware)
+	if cfg.Idempotency.Store != "none" {
+		var store cache.Store = cache.NewLRU(cfg.Idempotency.Size)
+		if cfg.Idempotency.Store == "redis" {
+			redis := cache.NewRedis(cfg.Cache.RedisAddr, string(cfg.Cache.RedisPassword), cfg.Idempotency.RedisPrefix, 16)
+			health.Register("idempotency", false, redis)
+			store = redis
+		}
+		router.Use(api.IdempotencyMiddleware(store, cfg.Idempotency.TTL))
 	}
 
-	registrar := consul.NewRegistrar(sdclient, reg, log.With(logger, "component", "registrar"))
-	registrar.Register()
-	defer registrar.Deregister()
+	handler := server.Instrument{
+		RouteMatcher: router,
+		Duration:     HTTPLatency,
+		RequestSize:  HTTPRequestSize,
+		ResponseSize: HTTPResponseSize,
+	}.Wrap(server.Deadline(cfg.RequestTimeout, router))
+
+	srv := server.New(fmt.Sprintf(":%v", cfg.Port), handler, cfg.DrainTimeout)
+
+	health.DefaultTimeout = cfg.Health.CheckTimeout
+	health.Register("server", true, srv)
+	health.Register("database", true, health.CheckerFunc(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Health.CheckTimeout)
+		defer cancel()
+		return db.Ping(ctx)
+	}))
+	health.Register("database-breaker", false, breaker)
+	health.Register("events", false, health.CheckerFunc(func() error {
+		return events.DefaultOutbox.CheckLag(cfg.Health.MaxOutboxLag)
+	}))
+	health.Register("tracer", false, tracer)
+	if c, ok := registrar.(health.Checker); ok {
+		health.Register("discovery", false, c)
+	}
 
 	go func() {
-		logger.Log("transport", "http", "port", port)
-		errc <- http.ListenAndServe(fmt.Sprintf(":%v", port), router)
+		logger.Log("transport", "http", "port", cfg.Port, "advertise", advertise)
+		errc <- srv.ListenAndServe()
 	}()
 
+	if err := registrar.Register(); err != nil {
+		logger.Log("component", "discovery", "err", err)
+	}
+
 	go func() {
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 		errc <- fmt.Errorf("%s", <-c)
 	}()
 
 	logger.Log("exit", <-errc)
+
+	server.Teardown(log.With(logger, "component", "shutdown"),
+		server.Step{Name: "deregister", Run: registrar.Deregister},
+		server.Step{Name: "readiness", Run: func() error {
+			srv.SetReady(false)
+			return nil
+		}},
+		server.Step{Name: "http", Run: srv.Drain},
+		server.Step{Name: "tracer", Run: tracer.Shutdown},
+		server.Step{Name: "events", Run: func() error {
+			events.DefaultOutbox.Close()
+			return nil
+		}},
+		server.Step{Name: "database", Run: db.Close},
+	)
 }
@@ -0,0 +1,164 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reqctx carries values scoped to one request, the request ID, the
+// identity of the caller and the tenant, through context.Context from the
+// transport to the database.
+package reqctx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers read by HTTPMiddleware. The caller headers are set by the gateway
+// once it has authenticated the request and must be stripped from anything
+// reaching the service from outside.
+const (
+	RequestIDHeader   = "X-Request-ID"
+	CallerIDHeader    = "X-Caller-ID"
+	CallerRolesHeader = "X-Caller-Roles"
+)
+
+// Caller is who made the request.
+type Caller struct {
+	ID    string
+	Roles []string
+}
+
+// HasRole reports whether the caller has been granted role.
+func (c Caller) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type key int
+
+const (
+	requestIDKey key = iota
+	callerKey
+	tenantKey
+)
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside a
+// request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func WithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey, c)
+}
+
+// CallerFrom returns the caller of the request ctx belongs to. ok is false
+// when the request carried no identity.
+func CallerFrom(ctx context.Context) (c Caller, ok bool) {
+	c, ok = ctx.Value(callerKey).(Caller)
+	return c, ok
+}
+
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey, id)
+}
+
+// Tenant returns the ID of the tenant the request belongs to, or "" when
+// none was resolved.
+func Tenant(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey).(string)
+	return id
+}
+
+// Keyvals returns the request ID, caller and tenant as log key value pairs,
+// leaving out the ones ctx does not carry.
+func Keyvals(ctx context.Context) []interface{} {
+	kv := make([]interface{}, 0, 6)
+	if id := RequestID(ctx); id != "" {
+		kv = append(kv, "request_id", id)
+	}
+	if c, ok := CallerFrom(ctx); ok {
+		kv = append(kv, "caller", c.ID)
+	}
+	if t := Tenant(ctx); t != "" {
+		kv = append(kv, "tenant", t)
+	}
+	return kv
+}
+
+// HTTPMiddleware puts the request ID and caller into the request context. An
+// incoming request ID is kept so that it can be followed across services;
+// otherwise a new one is made. Either way it is echoed in the response.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id := r.Header.Get(RequestIDHeader)
+		if !validID(id) {
+			id = newID()
+		}
+		ctx = WithRequestID(ctx, id)
+		w.Header().Set(RequestIDHeader, id)
+		attrs := []attribute.KeyValue{attribute.String("request.id", id)}
+
+		if cid := strings.TrimSpace(r.Header.Get(CallerIDHeader)); cid != "" {
+			c := Caller{ID: cid, Roles: splitRoles(r.Header.Get(CallerRolesHeader))}
+			ctx = WithCaller(ctx, c)
+			attrs = append(attrs, attribute.String("enduser.id", c.ID))
+		}
+		trace.SpanFromContext(ctx).SetAttributes(attrs...)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validID accepts IDs of printable ASCII that are short enough to log.
+func validID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func splitRoles(s string) []string {
+	roles := make([]string, 0)
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,75 @@
+package reqctx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+
+	Convey("Given a handler behind the middleware", t, func() {
+		var got context.Context
+		h := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Context()
+		}))
+
+		Convey("When a request carries an ID and a caller", func() {
+			r := httptest.NewRequest("GET", "/customers", nil)
+			r.Header.Set(RequestIDHeader, "abc-123")
+			r.Header.Set(CallerIDHeader, "57a98d98e4b00679b4a830af")
+			r.Header.Set(CallerRolesHeader, "customer, admin")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Convey("Then both reach the handler", func() {
+				So(RequestID(got), ShouldEqual, "abc-123")
+				c, ok := CallerFrom(got)
+				So(ok, ShouldBeTrue)
+				So(c.ID, ShouldEqual, "57a98d98e4b00679b4a830af")
+				So(c.HasRole("admin"), ShouldBeTrue)
+				So(c.HasRole("support"), ShouldBeFalse)
+				So(Keyvals(got), ShouldResemble, []interface{}{"request_id", "abc-123", "caller", "57a98d98e4b00679b4a830af"})
+			})
+
+			Convey("Then the ID is echoed", func() {
+				So(w.Header().Get(RequestIDHeader), ShouldEqual, "abc-123")
+			})
+		})
+
+		Convey("When a request carries no usable ID", func() {
+			r := httptest.NewRequest("GET", "/customers", nil)
+			r.Header.Set(RequestIDHeader, "has spaces\n")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Convey("Then a new one is made", func() {
+				So(RequestID(got), ShouldHaveLength, 32)
+				So(w.Header().Get(RequestIDHeader), ShouldEqual, RequestID(got))
+			})
+
+			Convey("Then there is no caller", func() {
+				_, ok := CallerFrom(got)
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestTenant(t *testing.T) {
+	Convey("Given a context with a tenant", t, func() {
+		ctx := WithTenant(WithRequestID(context.Background(), "abc-123"), "acme")
+
+		Convey("Then the tenant is read back and logged", func() {
+			So(Tenant(ctx), ShouldEqual, "acme")
+			So(Keyvals(ctx), ShouldResemble, []interface{}{"request_id", "abc-123", "tenant", "acme"})
+		})
+
+		Convey("Then a context without one has none", func() {
+			So(Tenant(context.Background()), ShouldEqual, "")
+		})
+	})
+}
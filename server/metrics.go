@@ -0,0 +1,97 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RouteMatcher finds the route a request will be served by, as
+// *mux.Router does.
+type RouteMatcher interface {
+	Match(*http.Request, *mux.RouteMatch) bool
+}
+
+// Instrument records the rate, errors and duration of HTTP requests, along
+// with request and response sizes. Each is labelled by method, route
+// template, status code and whether the request is a websocket upgrade,
+// which keeps label values bounded however many IDs are requested.
+// Requests matching no route are labelled "other". Nil metrics are skipped.
+type Instrument struct {
+	RouteMatcher RouteMatcher
+	Duration     *prometheus.HistogramVec
+	RequestSize  *prometheus.HistogramVec
+	ResponseSize *prometheus.HistogramVec
+}
+
+var HTTPLabels = []string{"method", "path", "status_code", "isWS"}
+
+func (i Instrument) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		begin := time.Now()
+		route := i.route(r)
+		cw := &countingWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(cw, r)
+
+		lvs := []string{r.Method, route, strconv.Itoa(cw.code), strconv.FormatBool(isWebsocket(r))}
+		if i.Duration != nil {
+			i.Duration.WithLabelValues(lvs...).Observe(time.Since(begin).Seconds())
+		}
+		if i.RequestSize != nil && r.ContentLength >= 0 {
+			i.RequestSize.WithLabelValues(lvs...).Observe(float64(r.ContentLength))
+		}
+		if i.ResponseSize != nil {
+			i.ResponseSize.WithLabelValues(lvs...).Observe(float64(cw.size))
+		}
+	})
+}
+
+func (i Instrument) route(r *http.Request) string {
+	var match mux.RouteMatch
+	if i.RouteMatcher == nil || !i.RouteMatcher.Match(r, &match) || match.Route == nil {
+		return "other"
+	}
+	if t, err := match.Route.GetPathTemplate(); err == nil {
+		return t
+	}
+	return "other"
+}
+
+func isWebsocket(r *http.Request) bool {
+	return strings.ToLower(r.Header.Get("Upgrade")) == "websocket"
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	code int
+	size int
+}
+
+func (w *countingWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInstrument(t *testing.T) {
+
+	Convey("Given an instrumented router", t, func() {
+		reg := prometheus.NewRegistry()
+		duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration"}, HTTPLabels)
+		size := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "response_size"}, HTTPLabels)
+		reg.MustRegister(duration, size)
+
+		r := mux.NewRouter()
+		r.Methods("GET").Path("/customers/{id}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("customer"))
+		})
+		h := Instrument{RouteMatcher: r, Duration: duration, ResponseSize: size}.Wrap(r)
+
+		Convey("When requests are served", func() {
+			for _, p := range []string{"/customers/1", "/customers/2", "/nowhere"} {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+			}
+			mfs, err := reg.Gather()
+			So(err, ShouldBeNil)
+
+			series := map[string]uint64{}
+			var bytes float64
+			for _, mf := range mfs {
+				for _, m := range mf.Metric {
+					labels := make([]string, 0)
+					for _, l := range m.Label {
+						labels = append(labels, l.GetName()+"="+l.GetValue())
+					}
+					key := mf.GetName() + "{" + strings.Join(labels, ",") + "}"
+					series[key] = m.Histogram.GetSampleCount()
+					if mf.GetName() == "response_size" && strings.Contains(key, "/customers/{id}") {
+						bytes = m.Histogram.GetSampleSum()
+					}
+				}
+			}
+
+			Convey("Then they should be labelled by route template and status", func() {
+				So(series["duration{isWS=false,method=GET,path=/customers/{id},status_code=200}"], ShouldEqual, 2)
+				So(series["duration{isWS=false,method=GET,path=other,status_code=404}"], ShouldEqual, 1)
+			})
+
+			Convey("Then response sizes should be recorded", func() {
+				So(bytes, ShouldEqual, 2*len("customer"))
+			})
+		})
+	})
+}
@@ -0,0 +1,142 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+var ErrShuttingDown = errors.New("Shutting down")
+
+// Server is an http.Server that reports readiness and drains in-flight
+// requests on shutdown.
+type Server struct {
+	srv   *http.Server
+	drain time.Duration
+	ready int32
+}
+
+func New(addr string, h http.Handler, drain time.Duration) *Server {
+	return &Server{
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           h,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       60 * time.Second,
+		},
+		drain: drain,
+		ready: 1,
+	}
+}
+
+// ListenAndServe serves until Drain is called, which is not an error.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	err := s.srv.Serve(l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) Ready() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+func (s *Server) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+}
+
+// Drain stops accepting connections and waits up to the drain timeout for
+// in-flight requests to complete.
+func (s *Server) Drain() error {
+	s.SetReady(false)
+	ctx, cancel := context.WithTimeout(context.Background(), s.drain)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+// Check fails once the server is shutting down, so it can be registered as
+// a critical health check.
+func (s *Server) Check() error {
+	if !s.Ready() {
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// ReadinessHandler answers 200 while the server takes traffic and 503 once
+// it is shutting down.
+func (s *Server) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ready\n"))
+	})
+}
+
+// Deadline gives every request handled by next a context that expires after
+// d, so that work done for a client is abandoned once it could no longer be
+// answered in time. A d of zero sets no deadline.
+func Deadline(d time.Duration, next http.Handler) http.Handler {
+	if d <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Step is one stage of an ordered teardown.
+type Step struct {
+	Name string
+	Run  func() error
+}
+
+// Teardown runs every step in order. A failing step is logged and does not
+// stop the ones after it.
+func Teardown(logger log.Logger, steps ...Step) {
+	for _, step := range steps {
+		begin := time.Now()
+		err := step.Run()
+		if err != nil {
+			logger.Log("shutdown", step.Name, "took", time.Since(begin), "err", err)
+			continue
+		}
+		logger.Log("shutdown", step.Name, "took", time.Since(begin))
+	}
+}
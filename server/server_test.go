@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDrain(t *testing.T) {
+
+	Convey("Given a server with a slow request in flight", t, func() {
+		started := make(chan struct{})
+		h := http.NewServeMux()
+		h.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("done"))
+		})
+		s := New("", h, 5*time.Second)
+		h.Handle("/ready", s.ReadinessHandler())
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		served := make(chan error, 1)
+		go func() { served <- s.Serve(l) }()
+
+		type result struct {
+			body string
+			err  error
+		}
+		res := make(chan result, 1)
+		go func() {
+			resp, err := http.Get("http://" + l.Addr().String() + "/slow")
+			if err != nil {
+				res <- result{err: err}
+				return
+			}
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			res <- result{string(b), err}
+		}()
+		<-started
+
+		Convey("When the server is drained", func() {
+			err := s.Drain()
+
+			Convey("Then the in-flight request should complete", func() {
+				So(err, ShouldBeNil)
+				r := <-res
+				So(r.err, ShouldBeNil)
+				So(r.body, ShouldEqual, "done")
+				So(<-served, ShouldBeNil)
+			})
+
+			Convey("Then it should no longer be ready or accept requests", func() {
+				So(s.Ready(), ShouldBeFalse)
+				_, err := http.Get("http://" + l.Addr().String() + "/ready")
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestReadiness(t *testing.T) {
+
+	Convey("Given a server", t, func() {
+		s := New("", http.NewServeMux(), time.Second)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+		go http.Serve(l, s.ReadinessHandler())
+
+		Convey("When it stops being ready", func() {
+			resp, err := http.Get("http://" + l.Addr().String())
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			s.SetReady(false)
+
+			Convey("Then readiness should fail", func() {
+				resp, err := http.Get("http://" + l.Addr().String())
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+			})
+		})
+	})
+}
+
+func TestTeardown(t *testing.T) {
+
+	Convey("Given teardown steps where one fails", t, func() {
+		var order []string
+		step := func(name string, err error) Step {
+			return Step{name, func() error {
+				order = append(order, name)
+				return err
+			}}
+		}
+
+		Convey("When torn down", func() {
+			Teardown(log.NewNopLogger(),
+				step("deregister", nil),
+				step("readiness", nil),
+				step("http", errors.New("timeout")),
+				step("tracer", nil),
+				step("events", nil),
+				step("database", nil),
+			)
+
+			Convey("Then every step should run in order", func() {
+				So(order, ShouldResemble, []string{"deregister", "readiness", "http", "tracer", "events", "database"})
+			})
+		})
+	})
+}
@@ -0,0 +1,241 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tenant resolves the tenant of each request and keeps the list of
+// known tenants.
+package tenant
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/users"
+)
+
+// Sources a Resolver reads the tenant from.
+const (
+	SourceHeader = "header"
+	SourceClaim  = "claim"
+	SourceHost   = "host"
+)
+
+var (
+	ErrUnknownTenant = errors.New("Unknown tenant")
+	ErrInvalidToken  = errors.New("Invalid bearer token")
+)
+
+// Registry knows which tenants exist and which hosts belong to them. The
+// list is read again when it is older than the refresh interval, at most
+// once per interval for names it does not know, so that a tenant created on
+// another replica is soon found. The default tenant is always known.
+type Registry struct {
+	defaultID string
+	refresh   time.Duration
+	load      func(context.Context) ([]users.Tenant, error)
+
+	mtx    sync.RWMutex
+	ids    map[string]bool
+	hosts  map[string]string
+	loaded time.Time
+}
+
+// NewRegistry returns a registry reading tenants with load, such as
+// db.GetTenants.
+func NewRegistry(defaultID string, refresh time.Duration, load func(context.Context) ([]users.Tenant, error)) *Registry {
+	return &Registry{
+		defaultID: defaultID,
+		refresh:   refresh,
+		load:      load,
+		ids:       map[string]bool{defaultID: true},
+		hosts:     map[string]string{},
+	}
+}
+
+// Default returns the ID of the default tenant.
+func (r *Registry) Default() string {
+	return r.defaultID
+}
+
+// Reload reads the list of tenants. On failure the old list is kept.
+func (r *Registry) Reload(ctx context.Context) error {
+	ts, err := r.load(ctx)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.loaded = time.Now()
+	if err != nil {
+		return err
+	}
+	r.ids = map[string]bool{r.defaultID: true}
+	r.hosts = map[string]string{}
+	for _, t := range ts {
+		r.ids[t.ID] = true
+		for _, h := range t.Hosts {
+			r.hosts[h] = t.ID
+		}
+	}
+	return nil
+}
+
+// Add makes t known at once, as after it was created here.
+func (r *Registry) Add(t users.Tenant) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.ids[t.ID] = true
+	for _, h := range t.Hosts {
+		r.hosts[h] = t.ID
+	}
+}
+
+// Known reports whether a tenant with the given ID exists.
+func (r *Registry) Known(ctx context.Context, id string) bool {
+	found := func() bool { return r.ids[id] }
+	return r.find(ctx, found)
+}
+
+// ByHost returns the tenant serving host.
+func (r *Registry) ByHost(ctx context.Context, host string) (string, bool) {
+	var id string
+	found := func() bool {
+		id = r.hosts[users.HostName(host)]
+		return id != ""
+	}
+	ok := r.find(ctx, found)
+	return id, ok
+}
+
+// find calls found under the lock, reloading first when the list is stale
+// and again, if allowed, when found fails.
+func (r *Registry) find(ctx context.Context, found func() bool) bool {
+	if r.stale() {
+		r.Reload(ctx)
+	}
+	r.mtx.RLock()
+	ok := found()
+	r.mtx.RUnlock()
+	if ok || !r.stale() {
+		return ok
+	}
+	r.Reload(ctx)
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return found()
+}
+
+func (r *Registry) stale() bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return time.Since(r.loaded) >= r.refresh
+}
+
+// Resolver finds the tenant of a request from its Sources in order: the
+// Header, the Claim of its bearer token or its host. A request naming none
+// belongs to the default tenant. The token is not verified: like the caller
+// headers it is trusted to have been checked by the gateway. Error, when
+// set, answers the requests whose tenant cannot be resolved.
+type Resolver struct {
+	Sources  []string
+	Header   string
+	Claim    string
+	Registry *Registry
+	Error    func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Resolve returns the tenant of r. A header or claim naming a tenant that
+// does not exist is an error rather than falling back to another source.
+func (res Resolver) Resolve(r *http.Request) (string, error) {
+	ctx := r.Context()
+	for _, src := range res.Sources {
+		var id string
+		switch src {
+		case SourceHeader:
+			id = strings.TrimSpace(r.Header.Get(res.Header))
+		case SourceClaim:
+			var err error
+			id, err = claim(r, res.Claim)
+			if err != nil {
+				return "", err
+			}
+		case SourceHost:
+			if t, ok := res.Registry.ByHost(ctx, r.Host); ok {
+				return t, nil
+			}
+		}
+		if id == "" {
+			continue
+		}
+		if !users.ValidTenantID(id) || !res.Registry.Known(ctx, id) {
+			return "", ErrUnknownTenant
+		}
+		return id, nil
+	}
+	return res.Registry.Default(), nil
+}
+
+// Middleware puts the tenant of each request into its context, answering
+// 400 when it cannot be resolved.
+func (res Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := res.Resolve(r)
+		if err != nil && res.Error != nil {
+			res.Error(w, r, err)
+			return
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/hal+json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":       err.Error(),
+				"status_code": http.StatusBadRequest,
+				"status_text": http.StatusText(http.StatusBadRequest),
+			})
+			return
+		}
+		ctx := reqctx.WithTenant(r.Context(), id)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// claim reads the string claim name from the payload of the bearer token of
+// r, returning "" when there is no token or no such claim.
+func claim(r *http.Request, name string) (string, error) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", nil
+	}
+	parts := strings.Split(strings.TrimSpace(auth[7:]), ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidToken
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return "", ErrInvalidToken
+	}
+	id, _ := claims[name].(string)
+	return id, nil
+}
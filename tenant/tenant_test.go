@@ -0,0 +1,134 @@
+package tenant
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/aheadaviation/Users/reqctx"
+	"github.com/aheadaviation/Users/users"
+)
+
+func token(payload string) string {
+	return "Bearer e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestResolver(t *testing.T) {
+
+	Convey("Given a resolver reading the header, claim and host", t, func() {
+		loads := 0
+		tenants := []users.Tenant{{ID: "acme", Hosts: []string{"shop.acme.example"}}}
+		reg := NewRegistry("default", time.Hour, func(context.Context) ([]users.Tenant, error) {
+			loads++
+			return tenants, nil
+		})
+		res := Resolver{
+			Sources:  []string{SourceHeader, SourceClaim, SourceHost},
+			Header:   "X-Tenant-ID",
+			Claim:    "tenant",
+			Registry: reg,
+		}
+		r := httptest.NewRequest("GET", "http://users.internal/customers", nil)
+
+		Convey("When the request names no tenant", func() {
+			id, err := res.Resolve(r)
+
+			Convey("Then it belongs to the default tenant", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "default")
+			})
+		})
+
+		Convey("When the header and the token disagree", func() {
+			r.Header.Set("X-Tenant-ID", "acme")
+			r.Header.Set("Authorization", token(`{"tenant":"globex"}`))
+			id, err := res.Resolve(r)
+
+			Convey("Then the first source wins", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "acme")
+			})
+		})
+
+		Convey("When only the token names the tenant", func() {
+			r.Header.Set("Authorization", token(`{"sub":"ann","tenant":"acme"}`))
+			id, err := res.Resolve(r)
+
+			Convey("Then the claim is used", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "acme")
+			})
+		})
+
+		Convey("When the request is for a tenant's host", func() {
+			r.Host = "Shop.Acme.example:443"
+			id, err := res.Resolve(r)
+
+			Convey("Then it belongs to that tenant", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "acme")
+			})
+		})
+
+		Convey("When the header names an unknown tenant", func() {
+			r.Header.Set("X-Tenant-ID", "globex")
+			_, err := res.Resolve(r)
+
+			Convey("Then it is refused without reading the list again", func() {
+				So(err, ShouldEqual, ErrUnknownTenant)
+				So(loads, ShouldEqual, 1)
+			})
+
+			Convey("Then a tenant added here is found", func() {
+				reg.Add(users.Tenant{ID: "globex"})
+				id, err := res.Resolve(r)
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "globex")
+			})
+		})
+
+		Convey("When requests pass through the middleware", func() {
+			var got string
+			h := res.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = reqctx.Tenant(r.Context())
+			}))
+
+			Convey("Then the tenant reaches the handler", func() {
+				r.Header.Set("X-Tenant-ID", "acme")
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(got, ShouldEqual, "acme")
+			})
+
+			Convey("Then a malformed token is refused", func() {
+				r.Header.Set("Authorization", "Bearer not-a-jwt")
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+				So(got, ShouldEqual, "")
+			})
+		})
+	})
+
+	Convey("Given a registry whose list is stale", t, func() {
+		loads := 0
+		reg := NewRegistry("default", time.Nanosecond, func(context.Context) ([]users.Tenant, error) {
+			loads++
+			if loads > 1 {
+				return []users.Tenant{{ID: "acme"}}, nil
+			}
+			return nil, nil
+		})
+		reg.Reload(context.Background())
+
+		Convey("Then a tenant created elsewhere is found", func() {
+			So(reg.Known(context.Background(), "acme"), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,200 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing sets up OpenTelemetry tracing and provides the HTTP and
+// endpoint middlewares that create spans. Trace context is propagated in W3C
+// traceparent and baggage headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/aheadaviation/Users"
+
+type Config struct {
+	// Exporter is one of otlp-grpc, otlp-http, stdout or none.
+	Exporter string
+	// Endpoint is the collector as host:port or a URL. When empty the
+	// OTLP exporters use OTEL_EXPORTER_OTLP_ENDPOINT or their default.
+	Endpoint    string
+	Insecure    bool
+	SampleRatio float64
+	ServiceName string
+	// InstanceID identifies this replica, usually its advertised address.
+	InstanceID string
+	// Writer receives spans from the stdout exporter, os.Stdout when nil.
+	Writer io.Writer
+}
+
+var ErrUnknownExporter = "Unknown trace exporter %v"
+
+// Provider owns the tracer provider installed by New.
+type Provider struct {
+	tp   *sdktrace.TracerProvider
+	addr string
+}
+
+// New creates the exporter selected by c and installs the tracer provider
+// and W3C propagators globally. With the none exporter spans are still
+// created and propagated but not sent anywhere.
+func New(c Config) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	exp, err := newExporter(c)
+	if err != nil {
+		return nil, err
+	}
+	ratio := c.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", c.ServiceName),
+			attribute.String("service.instance.id", c.InstanceID),
+		)),
+	}
+	if exp != nil {
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+	p := &Provider{tp: sdktrace.NewTracerProvider(opts...)}
+	if strings.HasPrefix(c.Exporter, "otlp") {
+		p.addr = collectorAddr(c.Exporter, c.Endpoint)
+	}
+	otel.SetTracerProvider(p.tp)
+	return p, nil
+}
+
+func newExporter(c Config) (sdktrace.SpanExporter, error) {
+	ctx := context.Background()
+	isURL := strings.Contains(c.Endpoint, "://")
+	switch c.Exporter {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		w := c.Writer
+		if w == nil {
+			w = os.Stdout
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	case "otlp-grpc":
+		opts := make([]otlptracegrpc.Option, 0)
+		if isURL {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(c.Endpoint))
+		} else if c.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "otlp-http":
+		opts := make([]otlptracehttp.Option, 0)
+		if isURL {
+			opts = append(opts, otlptracehttp.WithEndpointURL(c.Endpoint))
+		} else if c.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	}
+	return nil, fmt.Errorf(ErrUnknownExporter, c.Exporter)
+}
+
+// collectorAddr returns the host:port the exporter connects to, using the
+// OTLP default ports when the endpoint has none.
+func collectorAddr(exporter, endpoint string) string {
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	port := "4317"
+	if exporter == "otlp-http" {
+		port = "4318"
+	}
+	if endpoint == "" {
+		return net.JoinHostPort("localhost", port)
+	}
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return ""
+		}
+		if u.Port() != "" {
+			return u.Host
+		}
+		return net.JoinHostPort(u.Hostname(), port)
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err == nil {
+		return endpoint
+	}
+	return net.JoinHostPort(endpoint, port)
+}
+
+// Check reports whether the collector accepts connections. It always
+// succeeds for exporters that do not use one.
+func (p *Provider) Check() error {
+	if p.addr == "" {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", p.addr, time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Shutdown flushes pending spans and stops the exporter.
+func (p *Provider) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return p.tp.Shutdown(ctx)
+}
+
+// Tracer returns the tracer used throughout the service.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
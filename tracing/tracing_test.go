@@ -0,0 +1,184 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an in-process OTLP trace collector serving both gRPC and HTTP.
+type collector struct {
+	coltracepb.UnimplementedTraceServiceServer
+	mtx   sync.Mutex
+	spans []string
+	attrs []string
+}
+
+func (c *collector) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, a := range rs.Resource.Attributes {
+			c.attrs = append(c.attrs, a.Key+"="+a.Value.GetStringValue())
+		}
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				c.spans = append(c.spans, s.Name)
+			}
+		}
+	}
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	req := &coltracepb.ExportTraceServiceRequest{}
+	if r.URL.Path != "/v1/traces" || proto.Unmarshal(b, req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp, _ := c.Export(r.Context(), req)
+	out, _ := proto.Marshal(resp)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(out)
+}
+
+func TestExporters(t *testing.T) {
+
+	Convey("Given an in-process gRPC collector", t, func() {
+		c := &collector{}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		s := grpc.NewServer()
+		coltracepb.RegisterTraceServiceServer(s, c)
+		go s.Serve(l)
+		defer s.Stop()
+
+		Convey("When a span is exported over OTLP gRPC", func() {
+			p, err := New(Config{Exporter: "otlp-grpc", Endpoint: l.Addr().String(), Insecure: true, ServiceName: "users", InstanceID: "10.0.0.5:8084"})
+			So(err, ShouldBeNil)
+			_, span := Tracer().Start(context.Background(), "GET /customers")
+			span.End()
+			So(p.Check(), ShouldBeNil)
+			So(p.Shutdown(), ShouldBeNil)
+
+			Convey("Then the collector should receive it with the service resource", func() {
+				So(c.spans, ShouldResemble, []string{"GET /customers"})
+				So(c.attrs, ShouldContain, "service.name=users")
+				So(c.attrs, ShouldContain, "service.instance.id=10.0.0.5:8084")
+			})
+		})
+	})
+
+	Convey("Given an in-process HTTP collector", t, func() {
+		c := &collector{}
+		ts := httptest.NewServer(c)
+		defer ts.Close()
+
+		Convey("When a span is exported over OTLP HTTP", func() {
+			p, err := New(Config{Exporter: "otlp-http", Endpoint: ts.URL, Insecure: true, ServiceName: "users"})
+			So(err, ShouldBeNil)
+			_, span := Tracer().Start(context.Background(), "POST /cards")
+			span.End()
+			So(p.Shutdown(), ShouldBeNil)
+
+			Convey("Then the collector should receive it", func() {
+				So(c.spans, ShouldResemble, []string{"POST /cards"})
+			})
+		})
+	})
+
+	Convey("Given the stdout exporter", t, func() {
+		var buf bytes.Buffer
+		p, err := New(Config{Exporter: "stdout", Writer: &buf, ServiceName: "users"})
+		So(err, ShouldBeNil)
+
+		Convey("When a span ends", func() {
+			_, span := Tracer().Start(context.Background(), "db.GetUser")
+			span.End()
+			So(p.Shutdown(), ShouldBeNil)
+
+			Convey("Then it should be written out", func() {
+				So(buf.String(), ShouldContainSubstring, `"Name":"db.GetUser"`)
+			})
+		})
+	})
+
+	Convey("Given an unknown exporter", t, func() {
+		_, err := New(Config{Exporter: "zipkin"})
+
+		Convey("Then it should be rejected", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+
+	Convey("Given a traced router", t, func() {
+		_, err := New(Config{Exporter: "none"})
+		So(err, ShouldBeNil)
+		sr := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+		r := mux.NewRouter()
+		r.Use(HTTPMiddleware("/health/"))
+		r.Methods("GET").Path("/customers/{id}").Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			TraceServer("GET /customers")(func(ctx context.Context, _ interface{}) (interface{}, error) {
+				return nil, nil
+			})(r.Context(), nil)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		r.Methods("GET").Path("/health/ready").Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		Convey("When a request arrives with a W3C traceparent", func() {
+			req := httptest.NewRequest("GET", "/customers/57a98d98e4b00679b4a830af", nil)
+			req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health/ready", nil))
+			spans := sr.Ended()
+
+			Convey("Then the server span should continue the caller's trace", func() {
+				So(spans, ShouldHaveLength, 2)
+				server := spans[1]
+				So(server.Name(), ShouldEqual, "GET /customers/{id}")
+				So(server.SpanContext().TraceID().String(), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+				So(server.Parent().SpanID().String(), ShouldEqual, "00f067aa0ba902b7")
+				So(server.Parent().IsRemote(), ShouldBeTrue)
+			})
+
+			Convey("Then the endpoint span should be its child", func() {
+				So(spans[0].Name(), ShouldEqual, "GET /customers")
+				So(spans[0].Parent().SpanID(), ShouldEqual, spans[1].SpanContext().SpanID())
+			})
+
+			Convey("Then the status code should be recorded and skipped routes ignored", func() {
+				found := false
+				for _, a := range spans[1].Attributes() {
+					if a.Key == "http.response.status_code" {
+						found = a.Value.AsInt64() == 404
+					}
+				}
+				So(found, ShouldBeTrue)
+				for _, s := range spans {
+					So(strings.Contains(s.Name(), "health"), ShouldBeFalse)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"context"
+
+	"github.com/aheadaviation/Users/db"
+)
+
+// Export writes every customer in database with its addresses and cards to
+// enc and returns how many it wrote. Erased customers are left out, since
+// nothing of them is left to move.
+func Export(ctx context.Context, database db.Database, enc Encoder) (int, error) {
+	us, err := database.GetUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, u := range us {
+		if u.ErasedAt != nil {
+			continue
+		}
+		if err := database.GetUserAttributes(ctx, &u); err != nil {
+			return n, err
+		}
+		if err := enc.Encode(FromUser(u)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, enc.Flush()
+}
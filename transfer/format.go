@@ -0,0 +1,371 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Formats of customer files and import reports.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Kinds of row in the CSV format.
+const (
+	RowCustomer = "customer"
+	RowAddress  = "address"
+	RowCard     = "card"
+)
+
+var (
+	ErrUnknownFormat  = "Unknown format %q, use csv or jsonl"
+	ErrUnknownColumn  = "Unknown column %q"
+	ErrMissingColumn  = "Missing column %q"
+	ErrRepeatedColumn = "Repeated column %q"
+	ErrUnknownRow     = "Unknown row type %q"
+	ErrOrphanRow      = errors.New("Row does not follow a customer row")
+	ErrOtherCustomer  = "Row is for %q, not the customer before it"
+)
+
+// columns of the CSV format. Each customer row is followed by a row for each
+// of its addresses and cards, which repeat its username.
+var columns = []string{
+	"type", "id", "username", "firstName", "lastName", "email", "password", "passwordHash",
+	"defaultShipping", "defaultBilling",
+	"street", "number", "city", "state", "postcode", "country",
+	"longNum", "expires", "ccv", "billingAddress",
+}
+
+// RowError is a record that could not be read. Decoding can go on after it.
+type RowError struct {
+	Line     int
+	Username string
+	Err      error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Encoder writes records in one of the formats.
+type Encoder interface {
+	Encode(Record) error
+	// Flush writes any buffered data.
+	Flush() error
+}
+
+// Decoder reads records in one of the formats.
+type Decoder interface {
+	// Decode returns the next record and the line it starts on, or io.EOF
+	// after the last one. A record that cannot be read is reported as a
+	// *RowError; any other error means the input cannot be read further.
+	Decode() (r Record, line int, err error)
+}
+
+// FormatOf guesses the format of a file from its extension, returning ""
+// when it cannot.
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".ndjson", ".json":
+		return FormatJSONL
+	}
+	return ""
+}
+
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return jsonlEncoder{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+	return nil, fmt.Errorf(ErrUnknownFormat, format)
+}
+
+func NewDecoder(r io.Reader, format string) (Decoder, error) {
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		return &csvDecoder{r: cr}, nil
+	case FormatJSONL:
+		return &jsonlDecoder{r: bufio.NewReader(r)}, nil
+	}
+	return nil, fmt.Errorf(ErrUnknownFormat, format)
+}
+
+type jsonlEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e jsonlEncoder) Encode(r Record) error {
+	return e.enc.Encode(r)
+}
+
+func (e jsonlEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+type jsonlDecoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (d *jsonlDecoder) Decode() (Record, int, error) {
+	for {
+		b, err := d.r.ReadBytes('\n')
+		if len(b) == 0 && err != nil {
+			return Record{}, d.line, err
+		}
+		d.line++
+		b = bytes.TrimSpace(b)
+		if len(b) == 0 {
+			continue
+		}
+		var r Record
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&r); err != nil {
+			var named struct{ Username string }
+			json.Unmarshal(b, &named)
+			return Record{}, d.line, &RowError{Line: d.line, Username: named.Username, Err: err}
+		}
+		return r, d.line, nil
+	}
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (e *csvEncoder) Encode(r Record) error {
+	if !e.header {
+		e.header = true
+		if err := e.w.Write(columns); err != nil {
+			return err
+		}
+	}
+	e.w.Write(row(map[string]string{
+		"type":            RowCustomer,
+		"id":              r.ID,
+		"username":        r.Username,
+		"firstName":       r.FirstName,
+		"lastName":        r.LastName,
+		"email":           r.Email,
+		"password":        r.Password,
+		"passwordHash":    r.PasswordHash,
+		"defaultShipping": r.DefaultShipping,
+		"defaultBilling":  r.DefaultBilling,
+	}))
+	for _, a := range r.Addresses {
+		e.w.Write(row(map[string]string{
+			"type":     RowAddress,
+			"id":       a.ID,
+			"username": r.Username,
+			"street":   a.Street,
+			"number":   a.Number,
+			"city":     a.City,
+			"state":    a.State,
+			"postcode": a.PostCode,
+			"country":  a.Country,
+		}))
+	}
+	for _, c := range r.Cards {
+		e.w.Write(row(map[string]string{
+			"type":           RowCard,
+			"id":             c.ID,
+			"username":       r.Username,
+			"longNum":        c.LongNum,
+			"expires":        c.Expires,
+			"ccv":            c.CCV,
+			"billingAddress": c.BillingAddress,
+		}))
+	}
+	return e.w.Error()
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func row(values map[string]string) []string {
+	r := make([]string, len(columns))
+	for i, c := range columns {
+		r[i] = values[c]
+	}
+	return r
+}
+
+type csvDecoder struct {
+	r     *csv.Reader
+	cols  map[string]int
+	width int
+
+	// next is the customer row that ended the previous record.
+	next     []string
+	nextLine int
+}
+
+func (d *csvDecoder) Decode() (Record, int, error) {
+	if d.cols == nil {
+		if err := d.readHeader(); err != nil {
+			return Record{}, 0, err
+		}
+	}
+	for d.next == nil {
+		f, line, err := d.read()
+		if err != nil {
+			return Record{}, line, err
+		}
+		if d.get(f, "type") != RowCustomer {
+			return Record{}, line, &RowError{Line: line, Username: d.get(f, "username"), Err: ErrOrphanRow}
+		}
+		d.next, d.nextLine = f, line
+	}
+
+	f, line := d.next, d.nextLine
+	d.next = nil
+	r := Record{
+		ID:              d.get(f, "id"),
+		Username:        d.get(f, "username"),
+		FirstName:       d.get(f, "firstName"),
+		LastName:        d.get(f, "lastName"),
+		Email:           d.get(f, "email"),
+		Password:        d.get(f, "password"),
+		PasswordHash:    d.get(f, "passwordHash"),
+		DefaultShipping: d.get(f, "defaultShipping"),
+		DefaultBilling:  d.get(f, "defaultBilling"),
+		Addresses:       []Address{},
+		Cards:           []Card{},
+	}
+	var problem error
+	for d.next == nil {
+		f, l, err := d.read()
+		if err == io.EOF {
+			break
+		}
+		if re, ok := err.(*RowError); ok {
+			if problem == nil {
+				problem = re
+			}
+			continue
+		}
+		if err != nil {
+			return Record{}, l, err
+		}
+		t := d.get(f, "type")
+		if t != RowCustomer && d.get(f, "username") != r.Username && problem == nil {
+			problem = &RowError{Line: l, Err: fmt.Errorf(ErrOtherCustomer, d.get(f, "username"))}
+		}
+		switch t {
+		case RowCustomer:
+			d.next, d.nextLine = f, l
+		case RowAddress:
+			r.Addresses = append(r.Addresses, Address{
+				ID:       d.get(f, "id"),
+				Street:   d.get(f, "street"),
+				Number:   d.get(f, "number"),
+				City:     d.get(f, "city"),
+				State:    d.get(f, "state"),
+				PostCode: d.get(f, "postcode"),
+				Country:  d.get(f, "country"),
+			})
+		case RowCard:
+			r.Cards = append(r.Cards, Card{
+				ID:             d.get(f, "id"),
+				LongNum:        d.get(f, "longNum"),
+				Expires:        d.get(f, "expires"),
+				CCV:            d.get(f, "ccv"),
+				BillingAddress: d.get(f, "billingAddress"),
+			})
+		default:
+			if problem == nil {
+				problem = &RowError{Line: l, Err: fmt.Errorf(ErrUnknownRow, t)}
+			}
+		}
+	}
+	if problem != nil {
+		return r, line, &RowError{Line: line, Username: r.Username, Err: problem}
+	}
+	return r, line, nil
+}
+
+func (d *csvDecoder) readHeader() error {
+	h, err := d.r.Read()
+	if err != nil {
+		return err
+	}
+	d.cols, d.width = map[string]int{}, len(h)
+	known := map[string]bool{}
+	for _, c := range columns {
+		known[c] = true
+	}
+	for i, c := range h {
+		c = strings.TrimSpace(c)
+		if !known[c] {
+			return fmt.Errorf(ErrUnknownColumn, c)
+		}
+		if _, ok := d.cols[c]; ok {
+			return fmt.Errorf(ErrRepeatedColumn, c)
+		}
+		d.cols[c] = i
+	}
+	for _, c := range []string{"type", "username"} {
+		if _, ok := d.cols[c]; !ok {
+			return fmt.Errorf(ErrMissingColumn, c)
+		}
+	}
+	return nil
+}
+
+// read returns the next row with the line it starts on. Malformed rows are
+// returned as a *RowError.
+func (d *csvDecoder) read() ([]string, int, error) {
+	f, err := d.r.Read()
+	if pe, ok := err.(*csv.ParseError); ok {
+		return nil, pe.StartLine, &RowError{Line: pe.StartLine, Err: pe.Err}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	line, _ := d.r.FieldPos(0)
+	if len(f) != d.width {
+		return nil, line, &RowError{Line: line, Err: csv.ErrFieldCount}
+	}
+	return f, line, nil
+}
+
+func (d *csvDecoder) get(f []string, col string) string {
+	if i, ok := d.cols[col]; ok {
+		return f[i]
+	}
+	return ""
+}
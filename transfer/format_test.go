@@ -0,0 +1,167 @@
+package transfer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func sampleRecords() []Record {
+	return []Record{
+		{
+			ID:              "u1",
+			Username:        "ada",
+			FirstName:       "Ada",
+			LastName:        "Lovelace",
+			Email:           "ada@example.com",
+			PasswordHash:    FormatHash(HashSHA1, "salt", "hash"),
+			DefaultShipping: "a2",
+			DefaultBilling:  "a1",
+			Addresses: []Address{
+				{ID: "a1", Street: "Main St", Number: "1", City: "San Francisco", State: "US-CA", PostCode: "94105", Country: "US"},
+				{ID: "a2", Street: "Market St", Number: "2, rear", City: "San Francisco", State: "US-CA", PostCode: "94103", Country: "US"},
+			},
+			Cards: []Card{{ID: "c1", LongNum: "4111111111111111", Expires: "04/30", CCV: "123", BillingAddress: "a1"}},
+		},
+		{
+			Username:  "bob",
+			FirstName: "Bob",
+			LastName:  "Smith",
+			Password:  " spaced ",
+			Addresses: []Address{},
+			Cards:     []Card{},
+		},
+	}
+}
+
+func roundTrip(format string, rs []Record) []Record {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, format)
+	So(err, ShouldBeNil)
+	for _, r := range rs {
+		So(enc.Encode(r), ShouldBeNil)
+	}
+	So(enc.Flush(), ShouldBeNil)
+
+	dec, err := NewDecoder(&buf, format)
+	So(err, ShouldBeNil)
+	got := []Record{}
+	for {
+		r, _, err := dec.Decode()
+		if err == io.EOF {
+			return got
+		}
+		So(err, ShouldBeNil)
+		got = append(got, r)
+	}
+}
+
+func TestFormats(t *testing.T) {
+
+	Convey("Given customers with addresses and cards", t, func() {
+		rs := sampleRecords()
+
+		Convey("When they are written and read as CSV", func() {
+			got := roundTrip(FormatCSV, rs)
+
+			Convey("Then the same records are read back", func() {
+				So(got, ShouldResemble, rs)
+			})
+		})
+
+		Convey("When they are written and read as JSON Lines", func() {
+			got := roundTrip(FormatJSONL, rs)
+
+			Convey("Then the same records are read back", func() {
+				So(got, ShouldResemble, rs)
+			})
+		})
+	})
+
+	Convey("Given the format of a file", t, func() {
+		So(FormatOf("out/customers.CSV"), ShouldEqual, FormatCSV)
+		So(FormatOf("customers.ndjson"), ShouldEqual, FormatJSONL)
+		So(FormatOf("-"), ShouldEqual, "")
+		_, err := NewDecoder(nil, "xml")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestDecodeErrors(t *testing.T) {
+
+	Convey("Given JSON Lines with a bad line", t, func() {
+		in := "{\"username\":\"a\"}\n\n{\"username\":\"b\",\"bogus\":1}\n{\"username\":\"c\"}\n"
+		dec, _ := NewDecoder(strings.NewReader(in), FormatJSONL)
+
+		Convey("Then the bad line is a row error and decoding goes on", func() {
+			r, line, err := dec.Decode()
+			So(err, ShouldBeNil)
+			So(r.Username, ShouldEqual, "a")
+			So(line, ShouldEqual, 1)
+
+			_, line, err = dec.Decode()
+			re, ok := err.(*RowError)
+			So(ok, ShouldBeTrue)
+			So(re.Line, ShouldEqual, 3)
+			So(line, ShouldEqual, 3)
+			So(re.Username, ShouldEqual, "b")
+
+			r, line, err = dec.Decode()
+			So(err, ShouldBeNil)
+			So(r.Username, ShouldEqual, "c")
+			So(line, ShouldEqual, 4)
+
+			_, _, err = dec.Decode()
+			So(err, ShouldEqual, io.EOF)
+		})
+	})
+
+	Convey("Given CSV with misplaced rows", t, func() {
+		in := "type,username,street,city,country\n" +
+			"address,a,Main St,Springfield,US\n" +
+			"customer,b,,,\n" +
+			"address,c,Main St,Springfield,US\n" +
+			"customer,d,,,\n" +
+			"phone,d,,,\n" +
+			"customer,e,,,\n"
+		dec, _ := NewDecoder(strings.NewReader(in), FormatCSV)
+
+		Convey("Then each problem is a row error on its customer", func() {
+			_, line, err := dec.Decode()
+			So(err, ShouldHaveSameTypeAs, &RowError{})
+			So(err.(*RowError).Err, ShouldEqual, ErrOrphanRow)
+			So(line, ShouldEqual, 2)
+
+			r, line, err := dec.Decode()
+			So(err, ShouldHaveSameTypeAs, &RowError{})
+			So(r.Username, ShouldEqual, "b")
+			So(line, ShouldEqual, 3)
+			So(err.Error(), ShouldContainSubstring, `Row is for "c"`)
+
+			_, line, err = dec.Decode()
+			So(err, ShouldHaveSameTypeAs, &RowError{})
+			So(line, ShouldEqual, 5)
+			So(err.Error(), ShouldContainSubstring, `Unknown row type "phone"`)
+
+			r, _, err = dec.Decode()
+			So(err, ShouldBeNil)
+			So(r.Username, ShouldEqual, "e")
+
+			_, _, err = dec.Decode()
+			So(err, ShouldEqual, io.EOF)
+		})
+	})
+
+	Convey("Given CSV with an unknown column", t, func() {
+		dec, _ := NewDecoder(strings.NewReader("type,username,shoeSize\n"), FormatCSV)
+		_, _, err := dec.Decode()
+
+		Convey("Then the input is rejected", func() {
+			So(err, ShouldNotBeNil)
+			So(err, ShouldNotHaveSameTypeAs, &RowError{})
+		})
+	})
+}
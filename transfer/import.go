@@ -0,0 +1,224 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/users"
+)
+
+// Outcomes of importing a record.
+const (
+	StatusCreated = "created"
+	StatusValid   = "valid"
+	StatusExists  = "exists"
+	StatusInvalid = "invalid"
+	StatusFailed  = "failed"
+)
+
+// Result is the outcome of importing the record starting on Line. Records
+// that would be created in a dry run are StatusValid.
+type Result struct {
+	Line     int               `json:"line"`
+	Username string            `json:"username,omitempty"`
+	Status   string            `json:"status"`
+	ID       string            `json:"id,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Fields   users.FieldErrors `json:"fields,omitempty"`
+}
+
+// Summary counts the records of an import by status.
+type Summary map[string]int
+
+// Failed reports whether any record was invalid or failed.
+func (s Summary) Failed() bool {
+	return s[StatusInvalid] > 0 || s[StatusFailed] > 0
+}
+
+// Importer creates customers from records. A record whose username is
+// already taken is skipped, so an import that stopped part way can be run
+// again with the same input to finish it. A customer whose addresses or
+// cards cannot all be created is deleted again, leaving it to be retried.
+type Importer struct {
+	Database db.Database
+	// DryRun validates records and checks their usernames without writing.
+	DryRun bool
+}
+
+// Import creates the customers read from dec, passing the result of every
+// record to report. It stops early only if dec fails, report fails or ctx
+// is done.
+func (im Importer) Import(ctx context.Context, dec Decoder, report func(Result) error) (Summary, error) {
+	s := Summary{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return s, err
+		}
+		r, line, err := dec.Decode()
+		if err == io.EOF {
+			return s, nil
+		}
+		var res Result
+		switch e := err.(type) {
+		case nil:
+			res = im.importRecord(ctx, r)
+		case *RowError:
+			res = Result{Username: e.Username, Status: StatusInvalid, Error: e.Err.Error()}
+		default:
+			return s, err
+		}
+		res.Line = line
+		s[res.Status]++
+		if err := report(res); err != nil {
+			return s, err
+		}
+	}
+}
+
+func (im Importer) importRecord(ctx context.Context, r Record) Result {
+	res := Result{Username: r.Username}
+	u, err := r.Prepare()
+	if err != nil {
+		res.Status, res.Error = StatusInvalid, err.Error()
+		if fe, ok := err.(users.FieldErrors); ok {
+			res.Fields = fe
+		}
+		return res
+	}
+	existing, err := im.Database.GetUserByName(ctx, u.Username)
+	switch {
+	case err == nil:
+		res.Status, res.ID = StatusExists, existing.UserID
+		return res
+	case err != db.ErrNotFound:
+		res.Status, res.Error = StatusFailed, err.Error()
+		return res
+	}
+	if im.DryRun {
+		res.Status = StatusValid
+		return res
+	}
+	if err := im.create(ctx, &u, r); err != nil {
+		res.Status, res.Error = StatusFailed, err.Error()
+		return res
+	}
+	res.Status, res.ID = StatusCreated, u.UserID
+	return res
+}
+
+// create stores u and then the addresses, cards and defaults of r, mapping
+// the IDs in r to the new ones.
+func (im Importer) create(ctx context.Context, u *users.User, r Record) error {
+	if err := im.Database.CreateUser(ctx, u); err != nil {
+		return err
+	}
+	err := im.createAttributes(ctx, u.UserID, r)
+	if err == nil {
+		return nil
+	}
+	if derr := im.Database.DeleteUser(ctx, u.UserID); derr != nil {
+		return fmt.Errorf("%v; customer %v left incomplete: %v", err, u.UserID, derr)
+	}
+	return err
+}
+
+func (im Importer) createAttributes(ctx context.Context, userid string, r Record) error {
+	ids := map[string]string{}
+	for _, ra := range r.Addresses {
+		a := users.Address{
+			Street:   ra.Street,
+			Number:   ra.Number,
+			City:     ra.City,
+			State:    ra.State,
+			PostCode: ra.PostCode,
+			Country:  ra.Country,
+		}
+		if err := im.Database.CreateAddress(ctx, &a, userid); err != nil {
+			return err
+		}
+		if ra.ID != "" {
+			ids[ra.ID] = a.ID
+		}
+	}
+	for _, rc := range r.Cards {
+		c := users.Card{LongNum: rc.LongNum, Expires: rc.Expires, CCV: rc.CCV}
+		if err := c.Validate(time.Time{}); err != nil {
+			return err
+		}
+		c.BillingAddress = ids[rc.BillingAddress]
+		if err := im.Database.CreateCard(ctx, &c, userid); err != nil {
+			return err
+		}
+	}
+	for kind, id := range map[string]string{users.KindShipping: r.DefaultShipping, users.KindBilling: r.DefaultBilling} {
+		if id == "" {
+			continue
+		}
+		if err := im.Database.SetDefaultAddress(ctx, userid, kind, ids[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Report writes import results in one of the formats.
+type Report interface {
+	Add(Result) error
+	// Flush writes any buffered data.
+	Flush() error
+}
+
+func NewReport(w io.Writer, format string) (Report, error) {
+	switch format {
+	case FormatCSV:
+		return &csvReport{w: csv.NewWriter(w)}, nil
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return jsonlEncoder{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+	return nil, fmt.Errorf(ErrUnknownFormat, format)
+}
+
+func (e jsonlEncoder) Add(r Result) error {
+	return e.enc.Encode(r)
+}
+
+type csvReport struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (c *csvReport) Add(r Result) error {
+	if !c.header {
+		c.header = true
+		c.w.Write([]string{"line", "username", "status", "id", "error"})
+	}
+	c.w.Write([]string{strconv.Itoa(r.Line), r.Username, r.Status, r.ID, r.Error})
+	return c.w.Error()
+}
+
+func (c *csvReport) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
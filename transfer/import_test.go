@@ -0,0 +1,271 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/aheadaviation/Users/db"
+	"github.com/aheadaviation/Users/users"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// memDatabase keeps customers, addresses and cards in maps. CreateCard
+// fails while failCards is set.
+type memDatabase struct {
+	db.Database
+	users     map[string]users.User
+	addresses map[string]users.Address
+	cards     map[string]users.Card
+	next      int
+	failCards bool
+}
+
+func newMemDatabase() *memDatabase {
+	return &memDatabase{
+		users:     map[string]users.User{},
+		addresses: map[string]users.Address{},
+		cards:     map[string]users.Card{},
+	}
+}
+
+func (d *memDatabase) id() string {
+	d.next++
+	return fmt.Sprintf("%024x", d.next)
+}
+
+func (d *memDatabase) GetUsers(ctx context.Context) ([]users.User, error) {
+	us := []users.User{}
+	for _, u := range d.users {
+		us = append(us, u)
+	}
+	return us, nil
+}
+
+func (d *memDatabase) GetUserByName(ctx context.Context, name string) (users.User, error) {
+	for _, u := range d.users {
+		if u.Username == name {
+			return u, nil
+		}
+	}
+	return users.User{}, db.ErrNotFound
+}
+
+func (d *memDatabase) CreateUser(ctx context.Context, u *users.User) error {
+	u.UserID = d.id()
+	d.users[u.UserID] = *u
+	return nil
+}
+
+func (d *memDatabase) GetUserAttributes(ctx context.Context, u *users.User) error {
+	for k, a := range u.Addresses {
+		u.Addresses[k] = d.addresses[a.ID]
+	}
+	for k, c := range u.Cards {
+		u.Cards[k] = d.cards[c.ID]
+	}
+	return nil
+}
+
+func (d *memDatabase) CreateAddress(ctx context.Context, a *users.Address, userid string) error {
+	a.ID = d.id()
+	d.addresses[a.ID] = *a
+	u := d.users[userid]
+	u.Addresses = append(u.Addresses, users.Address{ID: a.ID})
+	if u.DefaultShipping == "" {
+		u.DefaultShipping, u.DefaultBilling = a.ID, a.ID
+	}
+	d.users[userid] = u
+	return nil
+}
+
+func (d *memDatabase) CreateCard(ctx context.Context, c *users.Card, userid string) error {
+	if d.failCards {
+		return errors.New("no reachable servers")
+	}
+	c.ID = d.id()
+	d.cards[c.ID] = *c
+	u := d.users[userid]
+	u.Cards = append(u.Cards, users.Card{ID: c.ID})
+	d.users[userid] = u
+	return nil
+}
+
+func (d *memDatabase) SetDefaultAddress(ctx context.Context, userid, kind, addressid string) error {
+	u := d.users[userid]
+	if kind == users.KindShipping {
+		u.DefaultShipping = addressid
+	} else {
+		u.DefaultBilling = addressid
+	}
+	d.users[userid] = u
+	return nil
+}
+
+func (d *memDatabase) DeleteUser(ctx context.Context, id string) error {
+	for _, a := range d.users[id].Addresses {
+		delete(d.addresses, a.ID)
+	}
+	for _, c := range d.users[id].Cards {
+		delete(d.cards, c.ID)
+	}
+	delete(d.users, id)
+	return nil
+}
+
+// sliceDecoder returns records, or errors, in turn.
+type sliceDecoder struct {
+	items []interface{}
+	line  int
+}
+
+func (d *sliceDecoder) Decode() (Record, int, error) {
+	if len(d.items) == 0 {
+		return Record{}, d.line, io.EOF
+	}
+	d.line++
+	item := d.items[0]
+	d.items = d.items[1:]
+	if err, ok := item.(error); ok {
+		return Record{}, d.line, err
+	}
+	return item.(Record), d.line, nil
+}
+
+func runImport(im Importer, items ...interface{}) (Summary, []Result, error) {
+	results := []Result{}
+	s, err := im.Import(context.Background(), &sliceDecoder{items: items}, func(r Result) error {
+		results = append(results, r)
+		return nil
+	})
+	return s, results, err
+}
+
+func TestImport(t *testing.T) {
+
+	Convey("Given an empty database", t, func() {
+		d := newMemDatabase()
+		im := Importer{Database: d}
+		rs := sampleRecords()
+		rs[1].Addresses = []Address{{Street: "High St", City: "London", PostCode: "sw1a1aa", Country: "United Kingdom"}}
+
+		Convey("When customers are imported", func() {
+			s, results, err := runImport(im, rs[0], rs[1])
+			So(err, ShouldBeNil)
+
+			Convey("Then each is created with its addresses, cards and defaults", func() {
+				So(s, ShouldResemble, Summary{StatusCreated: 2})
+				So(results[0].Status, ShouldEqual, StatusCreated)
+				So(results[1].Line, ShouldEqual, 2)
+
+				ada := d.users[results[0].ID]
+				So(ada.Salt, ShouldEqual, "salt")
+				So(ada.Password, ShouldEqual, "hash")
+				So(ada.Addresses, ShouldHaveLength, 2)
+				So(ada.DefaultShipping, ShouldEqual, ada.Addresses[1].ID)
+				So(ada.DefaultBilling, ShouldEqual, ada.Addresses[0].ID)
+				So(d.cards[ada.Cards[0].ID].BillingAddress, ShouldEqual, ada.Addresses[0].ID)
+				So(d.cards[ada.Cards[0].ID].Brand, ShouldEqual, "visa")
+
+				bob := d.users[results[1].ID]
+				So(bob.Password, ShouldEqual, users.HashPassword(" spaced ", bob.Salt))
+				So(d.addresses[bob.Addresses[0].ID].PostCode, ShouldEqual, "SW1A 1AA")
+			})
+
+			Convey("Then exporting gives back the same customers", func() {
+				var enc recordEncoder
+				n, err := Export(context.Background(), d, &enc)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+				for _, r := range enc {
+					if r.Username == "ada" {
+						So(r.PasswordHash, ShouldEqual, rs[0].PasswordHash)
+						So(r.Addresses, ShouldHaveLength, 2)
+						So(r.Cards[0].BillingAddress, ShouldEqual, r.Addresses[0].ID)
+						So(r.DefaultShipping, ShouldEqual, r.Addresses[1].ID)
+					}
+				}
+			})
+
+			Convey("Then importing again skips them", func() {
+				s, results, err := runImport(im, rs[0], rs[1])
+				So(err, ShouldBeNil)
+				So(s, ShouldResemble, Summary{StatusExists: 2})
+				So(results[0].ID, ShouldNotBeEmpty)
+				So(d.users, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("When invalid records are imported", func() {
+			bad := rs[0]
+			bad.Username = ""
+			bad.PasswordHash = "md5:x:y"
+			bad.Cards = []Card{{LongNum: "4111111111111112", Expires: "04/30", CCV: "123"}}
+			s, results, err := runImport(im, bad, &RowError{Line: 2, Username: "x", Err: ErrOrphanRow}, rs[1])
+			So(err, ShouldBeNil)
+
+			Convey("Then each problem is reported and the rest are created", func() {
+				So(s, ShouldResemble, Summary{StatusInvalid: 2, StatusCreated: 1})
+				So(s.Failed(), ShouldBeTrue)
+				So(results[0].Fields, ShouldContainKey, "username")
+				So(results[0].Fields["passwordHash"], ShouldContainSubstring, "md5")
+				So(results[0].Fields, ShouldContainKey, "cards[0].longNum")
+				So(results[1].Username, ShouldEqual, "x")
+				So(results[1].Error, ShouldEqual, ErrOrphanRow.Error())
+				So(d.users, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When a card cannot be stored", func() {
+			d.failCards = true
+			s, results, _ := runImport(im, rs[0])
+
+			Convey("Then the customer is removed so it can be retried", func() {
+				So(s, ShouldResemble, Summary{StatusFailed: 1})
+				So(results[0].Error, ShouldContainSubstring, "no reachable servers")
+				So(d.users, ShouldBeEmpty)
+				So(d.addresses, ShouldBeEmpty)
+
+				d.failCards = false
+				s, _, _ = runImport(im, rs[0])
+				So(s, ShouldResemble, Summary{StatusCreated: 1})
+			})
+		})
+
+		Convey("When customers are imported in a dry run", func() {
+			im.DryRun = true
+			s, results, err := runImport(im, rs[0], rs[1])
+			So(err, ShouldBeNil)
+
+			Convey("Then they are checked but not written", func() {
+				So(s, ShouldResemble, Summary{StatusValid: 2})
+				So(results[0].ID, ShouldBeEmpty)
+				So(d.users, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given plain and hashed passwords", t, func() {
+		r := Record{Username: "a", FirstName: "A", LastName: "B", Password: "p", PasswordHash: "sha1:s:h"}
+
+		Convey("Then only one may be given", func() {
+			_, err := r.Prepare()
+			So(err.(users.FieldErrors), ShouldContainKey, "password")
+			r.Password = ""
+			u, err := r.Prepare()
+			So(err, ShouldBeNil)
+			So(u.Salt, ShouldEqual, "s")
+		})
+	})
+}
+
+type recordEncoder []Record
+
+func (e *recordEncoder) Encode(r Record) error {
+	*e = append(*e, r)
+	return nil
+}
+
+func (e *recordEncoder) Flush() error { return nil }
@@ -0,0 +1,224 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transfer moves customers with their addresses and cards in and
+// out of a db.Database as CSV or JSON Lines.
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aheadaviation/Users/users"
+)
+
+// HashSHA1 tags password hashes made by users.HashPassword.
+const HashSHA1 = "sha1"
+
+var (
+	ErrUnsupportedHash = "Unsupported password hash algorithm %q"
+	ErrMalformedHash   = errors.New("Password hash must be algorithm:salt:hash")
+)
+
+// Record is one customer with everything stored for it. IDs are those of
+// the source database; on import addresses and cards get new IDs and the
+// defaults and billing addresses are mapped to them.
+type Record struct {
+	ID              string    `json:"id,omitempty"`
+	Username        string    `json:"username"`
+	FirstName       string    `json:"firstName"`
+	LastName        string    `json:"lastName"`
+	Email           string    `json:"email,omitempty"`
+	Password        string    `json:"password,omitempty"`
+	PasswordHash    string    `json:"passwordHash,omitempty"`
+	DefaultShipping string    `json:"defaultShipping,omitempty"`
+	DefaultBilling  string    `json:"defaultBilling,omitempty"`
+	Addresses       []Address `json:"addresses"`
+	Cards           []Card    `json:"cards"`
+}
+
+type Address struct {
+	ID       string `json:"id,omitempty"`
+	Street   string `json:"street"`
+	Number   string `json:"number,omitempty"`
+	City     string `json:"city"`
+	State    string `json:"state,omitempty"`
+	PostCode string `json:"postcode,omitempty"`
+	Country  string `json:"country"`
+}
+
+type Card struct {
+	ID             string `json:"id,omitempty"`
+	LongNum        string `json:"longNum"`
+	Expires        string `json:"expires"`
+	CCV            string `json:"ccv"`
+	BillingAddress string `json:"billingAddress,omitempty"`
+}
+
+// FromUser builds the record of u, whose attributes must be loaded. The
+// password is exported as its tagged hash.
+func FromUser(u users.User) Record {
+	r := Record{
+		ID:              u.UserID,
+		Username:        u.Username,
+		FirstName:       u.FirstName,
+		LastName:        u.LastName,
+		Email:           u.Email,
+		DefaultShipping: u.DefaultShipping,
+		DefaultBilling:  u.DefaultBilling,
+		Addresses:       make([]Address, 0, len(u.Addresses)),
+		Cards:           make([]Card, 0, len(u.Cards)),
+	}
+	if u.Password != "" {
+		r.PasswordHash = FormatHash(HashSHA1, u.Salt, u.Password)
+	}
+	for _, a := range u.Addresses {
+		r.Addresses = append(r.Addresses, Address{
+			ID:       a.ID,
+			Street:   a.Street,
+			Number:   a.Number,
+			City:     a.City,
+			State:    a.State,
+			PostCode: a.PostCode,
+			Country:  a.Country,
+		})
+	}
+	for _, c := range u.Cards {
+		r.Cards = append(r.Cards, Card{
+			ID:             c.ID,
+			LongNum:        c.LongNum,
+			Expires:        c.Expires,
+			CCV:            c.CCV,
+			BillingAddress: c.BillingAddress,
+		})
+	}
+	return r
+}
+
+// FormatHash tags a stored password hash with its algorithm and salt.
+func FormatHash(algorithm, salt, hash string) string {
+	return algorithm + ":" + salt + ":" + hash
+}
+
+// ParseHash splits a tagged password hash. Only HashSHA1 is accepted, as it
+// is the only algorithm Login can check.
+func ParseHash(s string) (salt, hash string, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "", "", ErrMalformedHash
+	}
+	if parts[0] != HashSHA1 {
+		return "", "", fmt.Errorf(ErrUnsupportedHash, parts[0])
+	}
+	return parts[1], parts[2], nil
+}
+
+// Prepare validates the record and converts it to a customer ready for
+// CreateUser, without addresses or cards. A plain password is hashed with a
+// new salt. Addresses are normalized and cards checked in place; expired
+// cards are accepted since they were valid when stored. Problems are
+// returned per field as users.FieldErrors, with attributes named like
+// addresses[0].postcode.
+func (r *Record) Prepare() (users.User, error) {
+	errs := users.FieldErrors{}
+	u := users.New()
+	u.Username = strings.TrimSpace(r.Username)
+	u.FirstName = strings.TrimSpace(r.FirstName)
+	u.LastName = strings.TrimSpace(r.LastName)
+	u.Email = strings.TrimSpace(r.Email)
+	if u.Username == "" {
+		errs["username"] = "is required"
+	}
+	if u.FirstName == "" {
+		errs["firstName"] = "is required"
+	}
+	if u.LastName == "" {
+		errs["lastName"] = "is required"
+	}
+	if u.Email != "" && !strings.Contains(u.Email, "@") {
+		errs["email"] = "is not an email address"
+	}
+	switch {
+	case r.Password != "" && r.PasswordHash != "":
+		errs["password"] = "cannot be given with passwordHash"
+	case r.Password != "":
+		u.Password = users.HashPassword(r.Password, u.Salt)
+	case r.PasswordHash != "":
+		salt, hash, err := ParseHash(r.PasswordHash)
+		if err != nil {
+			errs["passwordHash"] = err.Error()
+		}
+		u.Salt, u.Password = salt, hash
+	default:
+		errs["password"] = "or passwordHash is required"
+	}
+
+	ids := map[string]bool{}
+	for i := range r.Addresses {
+		a := users.Address{
+			Street:   r.Addresses[i].Street,
+			Number:   r.Addresses[i].Number,
+			City:     r.Addresses[i].City,
+			State:    r.Addresses[i].State,
+			PostCode: r.Addresses[i].PostCode,
+			Country:  r.Addresses[i].Country,
+		}
+		if err := a.Normalize(); err != nil {
+			addFields(errs, fmt.Sprintf("addresses[%d].", i), err)
+			continue
+		}
+		r.Addresses[i] = Address{r.Addresses[i].ID, a.Street, a.Number, a.City, a.State, a.PostCode, a.Country}
+		if id := r.Addresses[i].ID; id != "" {
+			if ids[id] {
+				errs[fmt.Sprintf("addresses[%d].id", i)] = "is repeated"
+			}
+			ids[id] = true
+		}
+	}
+	for i := range r.Cards {
+		c := users.Card{LongNum: r.Cards[i].LongNum, Expires: r.Cards[i].Expires, CCV: r.Cards[i].CCV}
+		if err := c.Validate(time.Time{}); err != nil {
+			addFields(errs, fmt.Sprintf("cards[%d].", i), err)
+			continue
+		}
+		r.Cards[i].LongNum, r.Cards[i].Expires = c.LongNum, c.Expires
+		if b := r.Cards[i].BillingAddress; b != "" && !ids[b] {
+			errs[fmt.Sprintf("cards[%d].billingAddress", i)] = "is not one of the addresses"
+		}
+	}
+	if r.DefaultShipping != "" && !ids[r.DefaultShipping] {
+		errs["defaultShipping"] = "is not one of the addresses"
+	}
+	if r.DefaultBilling != "" && !ids[r.DefaultBilling] {
+		errs["defaultBilling"] = "is not one of the addresses"
+	}
+
+	if len(errs) > 0 {
+		return u, errs
+	}
+	return u, nil
+}
+
+func addFields(errs users.FieldErrors, prefix string, err error) {
+	fe, ok := err.(users.FieldErrors)
+	if !ok {
+		errs[strings.TrimSuffix(prefix, ".")] = err.Error()
+		return
+	}
+	for k, v := range fe {
+		errs[prefix+k] = v
+	}
+}
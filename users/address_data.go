@@ -0,0 +1,732 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package users
+
+// countries lists every ISO 3166-1 country as alpha-2, alpha-3 and English
+// short name, with common names where they differ.
+var countries = []country{
+	{"AD", "AND", []string{"Andorra"}},
+	{"AE", "ARE", []string{"United Arab Emirates"}},
+	{"AF", "AFG", []string{"Afghanistan"}},
+	{"AG", "ATG", []string{"Antigua and Barbuda"}},
+	{"AI", "AIA", []string{"Anguilla"}},
+	{"AL", "ALB", []string{"Albania"}},
+	{"AM", "ARM", []string{"Armenia"}},
+	{"AO", "AGO", []string{"Angola"}},
+	{"AQ", "ATA", []string{"Antarctica"}},
+	{"AR", "ARG", []string{"Argentina"}},
+	{"AS", "ASM", []string{"American Samoa"}},
+	{"AT", "AUT", []string{"Austria"}},
+	{"AU", "AUS", []string{"Australia"}},
+	{"AW", "ABW", []string{"Aruba"}},
+	{"AX", "ALA", []string{"Åland Islands"}},
+	{"AZ", "AZE", []string{"Azerbaijan"}},
+	{"BA", "BIH", []string{"Bosnia and Herzegovina"}},
+	{"BB", "BRB", []string{"Barbados"}},
+	{"BD", "BGD", []string{"Bangladesh"}},
+	{"BE", "BEL", []string{"Belgium"}},
+	{"BF", "BFA", []string{"Burkina Faso"}},
+	{"BG", "BGR", []string{"Bulgaria"}},
+	{"BH", "BHR", []string{"Bahrain"}},
+	{"BI", "BDI", []string{"Burundi"}},
+	{"BJ", "BEN", []string{"Benin"}},
+	{"BL", "BLM", []string{"Saint Barthélemy"}},
+	{"BM", "BMU", []string{"Bermuda"}},
+	{"BN", "BRN", []string{"Brunei Darussalam"}},
+	{"BO", "BOL", []string{"Bolivia, Plurinational State of", "Bolivia"}},
+	{"BQ", "BES", []string{"Bonaire, Sint Eustatius and Saba"}},
+	{"BR", "BRA", []string{"Brazil"}},
+	{"BS", "BHS", []string{"Bahamas"}},
+	{"BT", "BTN", []string{"Bhutan"}},
+	{"BV", "BVT", []string{"Bouvet Island"}},
+	{"BW", "BWA", []string{"Botswana"}},
+	{"BY", "BLR", []string{"Belarus"}},
+	{"BZ", "BLZ", []string{"Belize"}},
+	{"CA", "CAN", []string{"Canada"}},
+	{"CC", "CCK", []string{"Cocos (Keeling) Islands"}},
+	{"CD", "COD", []string{"Congo, The Democratic Republic of the"}},
+	{"CF", "CAF", []string{"Central African Republic"}},
+	{"CG", "COG", []string{"Congo"}},
+	{"CH", "CHE", []string{"Switzerland"}},
+	{"CI", "CIV", []string{"Côte d'Ivoire"}},
+	{"CK", "COK", []string{"Cook Islands"}},
+	{"CL", "CHL", []string{"Chile"}},
+	{"CM", "CMR", []string{"Cameroon"}},
+	{"CN", "CHN", []string{"China"}},
+	{"CO", "COL", []string{"Colombia"}},
+	{"CR", "CRI", []string{"Costa Rica"}},
+	{"CU", "CUB", []string{"Cuba"}},
+	{"CV", "CPV", []string{"Cabo Verde"}},
+	{"CW", "CUW", []string{"Curaçao"}},
+	{"CX", "CXR", []string{"Christmas Island"}},
+	{"CY", "CYP", []string{"Cyprus"}},
+	{"CZ", "CZE", []string{"Czechia"}},
+	{"DE", "DEU", []string{"Germany"}},
+	{"DJ", "DJI", []string{"Djibouti"}},
+	{"DK", "DNK", []string{"Denmark"}},
+	{"DM", "DMA", []string{"Dominica"}},
+	{"DO", "DOM", []string{"Dominican Republic"}},
+	{"DZ", "DZA", []string{"Algeria"}},
+	{"EC", "ECU", []string{"Ecuador"}},
+	{"EE", "EST", []string{"Estonia"}},
+	{"EG", "EGY", []string{"Egypt"}},
+	{"EH", "ESH", []string{"Western Sahara"}},
+	{"ER", "ERI", []string{"Eritrea"}},
+	{"ES", "ESP", []string{"Spain"}},
+	{"ET", "ETH", []string{"Ethiopia"}},
+	{"FI", "FIN", []string{"Finland"}},
+	{"FJ", "FJI", []string{"Fiji"}},
+	{"FK", "FLK", []string{"Falkland Islands (Malvinas)"}},
+	{"FM", "FSM", []string{"Micronesia, Federated States of"}},
+	{"FO", "FRO", []string{"Faroe Islands"}},
+	{"FR", "FRA", []string{"France"}},
+	{"GA", "GAB", []string{"Gabon"}},
+	{"GB", "GBR", []string{"United Kingdom"}},
+	{"GD", "GRD", []string{"Grenada"}},
+	{"GE", "GEO", []string{"Georgia"}},
+	{"GF", "GUF", []string{"French Guiana"}},
+	{"GG", "GGY", []string{"Guernsey"}},
+	{"GH", "GHA", []string{"Ghana"}},
+	{"GI", "GIB", []string{"Gibraltar"}},
+	{"GL", "GRL", []string{"Greenland"}},
+	{"GM", "GMB", []string{"Gambia"}},
+	{"GN", "GIN", []string{"Guinea"}},
+	{"GP", "GLP", []string{"Guadeloupe"}},
+	{"GQ", "GNQ", []string{"Equatorial Guinea"}},
+	{"GR", "GRC", []string{"Greece"}},
+	{"GS", "SGS", []string{"South Georgia and the South Sandwich Islands"}},
+	{"GT", "GTM", []string{"Guatemala"}},
+	{"GU", "GUM", []string{"Guam"}},
+	{"GW", "GNB", []string{"Guinea-Bissau"}},
+	{"GY", "GUY", []string{"Guyana"}},
+	{"HK", "HKG", []string{"Hong Kong"}},
+	{"HM", "HMD", []string{"Heard Island and McDonald Islands"}},
+	{"HN", "HND", []string{"Honduras"}},
+	{"HR", "HRV", []string{"Croatia"}},
+	{"HT", "HTI", []string{"Haiti"}},
+	{"HU", "HUN", []string{"Hungary"}},
+	{"ID", "IDN", []string{"Indonesia"}},
+	{"IE", "IRL", []string{"Ireland"}},
+	{"IL", "ISR", []string{"Israel"}},
+	{"IM", "IMN", []string{"Isle of Man"}},
+	{"IN", "IND", []string{"India"}},
+	{"IO", "IOT", []string{"British Indian Ocean Territory"}},
+	{"IQ", "IRQ", []string{"Iraq"}},
+	{"IR", "IRN", []string{"Iran, Islamic Republic of", "Iran"}},
+	{"IS", "ISL", []string{"Iceland"}},
+	{"IT", "ITA", []string{"Italy"}},
+	{"JE", "JEY", []string{"Jersey"}},
+	{"JM", "JAM", []string{"Jamaica"}},
+	{"JO", "JOR", []string{"Jordan"}},
+	{"JP", "JPN", []string{"Japan"}},
+	{"KE", "KEN", []string{"Kenya"}},
+	{"KG", "KGZ", []string{"Kyrgyzstan"}},
+	{"KH", "KHM", []string{"Cambodia"}},
+	{"KI", "KIR", []string{"Kiribati"}},
+	{"KM", "COM", []string{"Comoros"}},
+	{"KN", "KNA", []string{"Saint Kitts and Nevis"}},
+	{"KP", "PRK", []string{"Korea, Democratic People's Republic of", "North Korea"}},
+	{"KR", "KOR", []string{"Korea, Republic of", "South Korea"}},
+	{"KW", "KWT", []string{"Kuwait"}},
+	{"KY", "CYM", []string{"Cayman Islands"}},
+	{"KZ", "KAZ", []string{"Kazakhstan"}},
+	{"LA", "LAO", []string{"Lao People's Democratic Republic", "Laos"}},
+	{"LB", "LBN", []string{"Lebanon"}},
+	{"LC", "LCA", []string{"Saint Lucia"}},
+	{"LI", "LIE", []string{"Liechtenstein"}},
+	{"LK", "LKA", []string{"Sri Lanka"}},
+	{"LR", "LBR", []string{"Liberia"}},
+	{"LS", "LSO", []string{"Lesotho"}},
+	{"LT", "LTU", []string{"Lithuania"}},
+	{"LU", "LUX", []string{"Luxembourg"}},
+	{"LV", "LVA", []string{"Latvia"}},
+	{"LY", "LBY", []string{"Libya"}},
+	{"MA", "MAR", []string{"Morocco"}},
+	{"MC", "MCO", []string{"Monaco"}},
+	{"MD", "MDA", []string{"Moldova, Republic of", "Moldova"}},
+	{"ME", "MNE", []string{"Montenegro"}},
+	{"MF", "MAF", []string{"Saint Martin (French part)"}},
+	{"MG", "MDG", []string{"Madagascar"}},
+	{"MH", "MHL", []string{"Marshall Islands"}},
+	{"MK", "MKD", []string{"North Macedonia"}},
+	{"ML", "MLI", []string{"Mali"}},
+	{"MM", "MMR", []string{"Myanmar"}},
+	{"MN", "MNG", []string{"Mongolia"}},
+	{"MO", "MAC", []string{"Macao"}},
+	{"MP", "MNP", []string{"Northern Mariana Islands"}},
+	{"MQ", "MTQ", []string{"Martinique"}},
+	{"MR", "MRT", []string{"Mauritania"}},
+	{"MS", "MSR", []string{"Montserrat"}},
+	{"MT", "MLT", []string{"Malta"}},
+	{"MU", "MUS", []string{"Mauritius"}},
+	{"MV", "MDV", []string{"Maldives"}},
+	{"MW", "MWI", []string{"Malawi"}},
+	{"MX", "MEX", []string{"Mexico"}},
+	{"MY", "MYS", []string{"Malaysia"}},
+	{"MZ", "MOZ", []string{"Mozambique"}},
+	{"NA", "NAM", []string{"Namibia"}},
+	{"NC", "NCL", []string{"New Caledonia"}},
+	{"NE", "NER", []string{"Niger"}},
+	{"NF", "NFK", []string{"Norfolk Island"}},
+	{"NG", "NGA", []string{"Nigeria"}},
+	{"NI", "NIC", []string{"Nicaragua"}},
+	{"NL", "NLD", []string{"Netherlands"}},
+	{"NO", "NOR", []string{"Norway"}},
+	{"NP", "NPL", []string{"Nepal"}},
+	{"NR", "NRU", []string{"Nauru"}},
+	{"NU", "NIU", []string{"Niue"}},
+	{"NZ", "NZL", []string{"New Zealand"}},
+	{"OM", "OMN", []string{"Oman"}},
+	{"PA", "PAN", []string{"Panama"}},
+	{"PE", "PER", []string{"Peru"}},
+	{"PF", "PYF", []string{"French Polynesia"}},
+	{"PG", "PNG", []string{"Papua New Guinea"}},
+	{"PH", "PHL", []string{"Philippines"}},
+	{"PK", "PAK", []string{"Pakistan"}},
+	{"PL", "POL", []string{"Poland"}},
+	{"PM", "SPM", []string{"Saint Pierre and Miquelon"}},
+	{"PN", "PCN", []string{"Pitcairn"}},
+	{"PR", "PRI", []string{"Puerto Rico"}},
+	{"PS", "PSE", []string{"Palestine, State of"}},
+	{"PT", "PRT", []string{"Portugal"}},
+	{"PW", "PLW", []string{"Palau"}},
+	{"PY", "PRY", []string{"Paraguay"}},
+	{"QA", "QAT", []string{"Qatar"}},
+	{"RE", "REU", []string{"Réunion"}},
+	{"RO", "ROU", []string{"Romania"}},
+	{"RS", "SRB", []string{"Serbia"}},
+	{"RU", "RUS", []string{"Russian Federation"}},
+	{"RW", "RWA", []string{"Rwanda"}},
+	{"SA", "SAU", []string{"Saudi Arabia"}},
+	{"SB", "SLB", []string{"Solomon Islands"}},
+	{"SC", "SYC", []string{"Seychelles"}},
+	{"SD", "SDN", []string{"Sudan"}},
+	{"SE", "SWE", []string{"Sweden"}},
+	{"SG", "SGP", []string{"Singapore"}},
+	{"SH", "SHN", []string{"Saint Helena, Ascension and Tristan da Cunha"}},
+	{"SI", "SVN", []string{"Slovenia"}},
+	{"SJ", "SJM", []string{"Svalbard and Jan Mayen"}},
+	{"SK", "SVK", []string{"Slovakia"}},
+	{"SL", "SLE", []string{"Sierra Leone"}},
+	{"SM", "SMR", []string{"San Marino"}},
+	{"SN", "SEN", []string{"Senegal"}},
+	{"SO", "SOM", []string{"Somalia"}},
+	{"SR", "SUR", []string{"Suriname"}},
+	{"SS", "SSD", []string{"South Sudan"}},
+	{"ST", "STP", []string{"Sao Tome and Principe"}},
+	{"SV", "SLV", []string{"El Salvador"}},
+	{"SX", "SXM", []string{"Sint Maarten (Dutch part)"}},
+	{"SY", "SYR", []string{"Syrian Arab Republic", "Syria"}},
+	{"SZ", "SWZ", []string{"Eswatini"}},
+	{"TC", "TCA", []string{"Turks and Caicos Islands"}},
+	{"TD", "TCD", []string{"Chad"}},
+	{"TF", "ATF", []string{"French Southern Territories"}},
+	{"TG", "TGO", []string{"Togo"}},
+	{"TH", "THA", []string{"Thailand"}},
+	{"TJ", "TJK", []string{"Tajikistan"}},
+	{"TK", "TKL", []string{"Tokelau"}},
+	{"TL", "TLS", []string{"Timor-Leste"}},
+	{"TM", "TKM", []string{"Turkmenistan"}},
+	{"TN", "TUN", []string{"Tunisia"}},
+	{"TO", "TON", []string{"Tonga"}},
+	{"TR", "TUR", []string{"Türkiye"}},
+	{"TT", "TTO", []string{"Trinidad and Tobago"}},
+	{"TV", "TUV", []string{"Tuvalu"}},
+	{"TW", "TWN", []string{"Taiwan, Province of China", "Taiwan"}},
+	{"TZ", "TZA", []string{"Tanzania, United Republic of", "Tanzania"}},
+	{"UA", "UKR", []string{"Ukraine"}},
+	{"UG", "UGA", []string{"Uganda"}},
+	{"UM", "UMI", []string{"United States Minor Outlying Islands"}},
+	{"US", "USA", []string{"United States"}},
+	{"UY", "URY", []string{"Uruguay"}},
+	{"UZ", "UZB", []string{"Uzbekistan"}},
+	{"VA", "VAT", []string{"Holy See (Vatican City State)"}},
+	{"VC", "VCT", []string{"Saint Vincent and the Grenadines"}},
+	{"VE", "VEN", []string{"Venezuela, Bolivarian Republic of", "Venezuela"}},
+	{"VG", "VGB", []string{"Virgin Islands, British"}},
+	{"VI", "VIR", []string{"Virgin Islands, U.S."}},
+	{"VN", "VNM", []string{"Viet Nam", "Vietnam"}},
+	{"VU", "VUT", []string{"Vanuatu"}},
+	{"WF", "WLF", []string{"Wallis and Futuna"}},
+	{"WS", "WSM", []string{"Samoa"}},
+	{"YE", "YEM", []string{"Yemen"}},
+	{"YT", "MYT", []string{"Mayotte"}},
+	{"ZA", "ZAF", []string{"South Africa"}},
+	{"ZM", "ZMB", []string{"Zambia"}},
+	{"ZW", "ZWE", []string{"Zimbabwe"}},
+}
+
+// subdivisions lists the ISO 3166-2 codes accepted as the state of an address
+// for countries that use them in postal addresses.
+var subdivisions = map[string][]subdivision{
+	"AR": {
+		{"AR-A", "Salta"},
+		{"AR-B", "Buenos Aires"},
+		{"AR-C", "Ciudad Autónoma de Buenos Aires"},
+		{"AR-D", "San Luis"},
+		{"AR-E", "Entre Ríos"},
+		{"AR-F", "La Rioja"},
+		{"AR-G", "Santiago del Estero"},
+		{"AR-H", "Chaco"},
+		{"AR-J", "San Juan"},
+		{"AR-K", "Catamarca"},
+		{"AR-L", "La Pampa"},
+		{"AR-M", "Mendoza"},
+		{"AR-N", "Misiones"},
+		{"AR-P", "Formosa"},
+		{"AR-Q", "Neuquén"},
+		{"AR-R", "Río Negro"},
+		{"AR-S", "Santa Fe"},
+		{"AR-T", "Tucumán"},
+		{"AR-U", "Chubut"},
+		{"AR-V", "Tierra del Fuego"},
+		{"AR-W", "Corrientes"},
+		{"AR-X", "Córdoba"},
+		{"AR-Y", "Jujuy"},
+		{"AR-Z", "Santa Cruz"},
+	},
+	"AU": {
+		{"AU-ACT", "Australian Capital Territory"},
+		{"AU-NSW", "New South Wales"},
+		{"AU-NT", "Northern Territory"},
+		{"AU-QLD", "Queensland"},
+		{"AU-SA", "South Australia"},
+		{"AU-TAS", "Tasmania"},
+		{"AU-VIC", "Victoria"},
+		{"AU-WA", "Western Australia"},
+	},
+	"BR": {
+		{"BR-AC", "Acre"},
+		{"BR-AL", "Alagoas"},
+		{"BR-AM", "Amazonas"},
+		{"BR-AP", "Amapá"},
+		{"BR-BA", "Bahia"},
+		{"BR-CE", "Ceará"},
+		{"BR-DF", "Distrito Federal"},
+		{"BR-ES", "Espírito Santo"},
+		{"BR-GO", "Goiás"},
+		{"BR-MA", "Maranhão"},
+		{"BR-MG", "Minas Gerais"},
+		{"BR-MS", "Mato Grosso do Sul"},
+		{"BR-MT", "Mato Grosso"},
+		{"BR-PA", "Pará"},
+		{"BR-PB", "Paraíba"},
+		{"BR-PE", "Pernambuco"},
+		{"BR-PI", "Piauí"},
+		{"BR-PR", "Paraná"},
+		{"BR-RJ", "Rio de Janeiro"},
+		{"BR-RN", "Rio Grande do Norte"},
+		{"BR-RO", "Rondônia"},
+		{"BR-RR", "Roraima"},
+		{"BR-RS", "Rio Grande do Sul"},
+		{"BR-SC", "Santa Catarina"},
+		{"BR-SE", "Sergipe"},
+		{"BR-SP", "São Paulo"},
+		{"BR-TO", "Tocantins"},
+	},
+	"CA": {
+		{"CA-AB", "Alberta"},
+		{"CA-BC", "British Columbia"},
+		{"CA-MB", "Manitoba"},
+		{"CA-NB", "New Brunswick"},
+		{"CA-NL", "Newfoundland and Labrador"},
+		{"CA-NS", "Nova Scotia"},
+		{"CA-NT", "Northwest Territories"},
+		{"CA-NU", "Nunavut"},
+		{"CA-ON", "Ontario"},
+		{"CA-PE", "Prince Edward Island"},
+		{"CA-QC", "Quebec"},
+		{"CA-SK", "Saskatchewan"},
+		{"CA-YT", "Yukon"},
+	},
+	"CN": {
+		{"CN-AH", "Anhui Sheng"},
+		{"CN-BJ", "Beijing Shi"},
+		{"CN-CQ", "Chongqing Shi"},
+		{"CN-FJ", "Fujian Sheng"},
+		{"CN-GD", "Guangdong Sheng"},
+		{"CN-GS", "Gansu Sheng"},
+		{"CN-GX", "Guangxi Zhuangzu Zizhiqu"},
+		{"CN-GZ", "Guizhou Sheng"},
+		{"CN-HA", "Henan Sheng"},
+		{"CN-HB", "Hubei Sheng"},
+		{"CN-HE", "Hebei Sheng"},
+		{"CN-HI", "Hainan Sheng"},
+		{"CN-HK", "Hong Kong SAR"},
+		{"CN-HL", "Heilongjiang Sheng"},
+		{"CN-HN", "Hunan Sheng"},
+		{"CN-JL", "Jilin Sheng"},
+		{"CN-JS", "Jiangsu Sheng"},
+		{"CN-JX", "Jiangxi Sheng"},
+		{"CN-LN", "Liaoning Sheng"},
+		{"CN-MO", "Macao SAR"},
+		{"CN-NM", "Nei Mongol Zizhiqu"},
+		{"CN-NX", "Ningxia Huizi Zizhiqu"},
+		{"CN-QH", "Qinghai Sheng"},
+		{"CN-SC", "Sichuan Sheng"},
+		{"CN-SD", "Shandong Sheng"},
+		{"CN-SH", "Shanghai Shi"},
+		{"CN-SN", "Shaanxi Sheng"},
+		{"CN-SX", "Shanxi Sheng"},
+		{"CN-TJ", "Tianjin Shi"},
+		{"CN-TW", "Taiwan Sheng"},
+		{"CN-XJ", "Xinjiang Uygur Zizhiqu"},
+		{"CN-XZ", "Xizang Zizhiqu"},
+		{"CN-YN", "Yunnan Sheng"},
+		{"CN-ZJ", "Zhejiang Sheng"},
+	},
+	"ES": {
+		{"ES-A", "Alacant"},
+		{"ES-AB", "Albacete"},
+		{"ES-AL", "Almería"},
+		{"ES-AV", "Ávila"},
+		{"ES-B", "Barcelona [Barcelona]"},
+		{"ES-BA", "Badajoz"},
+		{"ES-BI", "Bizkaia"},
+		{"ES-BU", "Burgos"},
+		{"ES-C", "A Coruña [La Coruña]"},
+		{"ES-CA", "Cádiz"},
+		{"ES-CC", "Cáceres"},
+		{"ES-CE", "Ceuta"},
+		{"ES-CO", "Córdoba"},
+		{"ES-CR", "Ciudad Real"},
+		{"ES-CS", "Castelló"},
+		{"ES-CU", "Cuenca"},
+		{"ES-GC", "Las Palmas"},
+		{"ES-GI", "Girona [Gerona]"},
+		{"ES-GR", "Granada"},
+		{"ES-GU", "Guadalajara"},
+		{"ES-H", "Huelva"},
+		{"ES-HU", "Huesca"},
+		{"ES-J", "Jaén"},
+		{"ES-L", "Lleida [Lérida]"},
+		{"ES-LE", "León"},
+		{"ES-LO", "La Rioja"},
+		{"ES-LU", "Lugo [Lugo]"},
+		{"ES-M", "Madrid"},
+		{"ES-MA", "Málaga"},
+		{"ES-ML", "Melilla"},
+		{"ES-MU", "Murcia"},
+		{"ES-NA", "Nafarroa"},
+		{"ES-O", "Asturias"},
+		{"ES-OR", "Ourense [Orense]"},
+		{"ES-P", "Palencia"},
+		{"ES-PM", "Illes Balears [Islas Baleares]"},
+		{"ES-PO", "Pontevedra [Pontevedra]"},
+		{"ES-S", "Cantabria"},
+		{"ES-SA", "Salamanca"},
+		{"ES-SE", "Sevilla"},
+		{"ES-SG", "Segovia"},
+		{"ES-SO", "Soria"},
+		{"ES-SS", "Gipuzkoa"},
+		{"ES-T", "Tarragona [Tarragona]"},
+		{"ES-TE", "Teruel"},
+		{"ES-TF", "Santa Cruz de Tenerife"},
+		{"ES-TO", "Toledo"},
+		{"ES-V", "Valencia"},
+		{"ES-VA", "Valladolid"},
+		{"ES-VI", "Araba"},
+		{"ES-Z", "Zaragoza"},
+		{"ES-ZA", "Zamora"},
+	},
+	"IN": {
+		{"IN-AN", "Andaman and Nicobar Islands"},
+		{"IN-AP", "Andhra Pradesh"},
+		{"IN-AR", "Arunāchal Pradesh"},
+		{"IN-AS", "Assam"},
+		{"IN-BR", "Bihār"},
+		{"IN-CH", "Chandīgarh"},
+		{"IN-CT", "Chhattīsgarh"},
+		{"IN-DH", "Dādra and Nagar Haveli and Damān and Diu"},
+		{"IN-DL", "Delhi"},
+		{"IN-GA", "Goa"},
+		{"IN-GJ", "Gujarāt"},
+		{"IN-HP", "Himāchal Pradesh"},
+		{"IN-HR", "Haryāna"},
+		{"IN-JH", "Jhārkhand"},
+		{"IN-JK", "Jammu and Kashmīr"},
+		{"IN-KA", "Karnātaka"},
+		{"IN-KL", "Kerala"},
+		{"IN-LA", "Ladākh"},
+		{"IN-LD", "Lakshadweep"},
+		{"IN-MH", "Mahārāshtra"},
+		{"IN-ML", "Meghālaya"},
+		{"IN-MN", "Manipur"},
+		{"IN-MP", "Madhya Pradesh"},
+		{"IN-MZ", "Mizoram"},
+		{"IN-NL", "Nāgāland"},
+		{"IN-OR", "Odisha"},
+		{"IN-PB", "Punjab"},
+		{"IN-PY", "Puducherry"},
+		{"IN-RJ", "Rājasthān"},
+		{"IN-SK", "Sikkim"},
+		{"IN-TG", "Telangāna"},
+		{"IN-TN", "Tamil Nādu"},
+		{"IN-TR", "Tripura"},
+		{"IN-UP", "Uttar Pradesh"},
+		{"IN-UT", "Uttarākhand"},
+		{"IN-WB", "West Bengal"},
+	},
+	"IT": {
+		{"IT-AG", "Agrigento"},
+		{"IT-AL", "Alessandria"},
+		{"IT-AN", "Ancona"},
+		{"IT-AP", "Ascoli Piceno"},
+		{"IT-AQ", "L'Aquila"},
+		{"IT-AR", "Arezzo"},
+		{"IT-AT", "Asti"},
+		{"IT-AV", "Avellino"},
+		{"IT-BA", "Bari"},
+		{"IT-BG", "Bergamo"},
+		{"IT-BI", "Biella"},
+		{"IT-BL", "Belluno"},
+		{"IT-BN", "Benevento"},
+		{"IT-BO", "Bologna"},
+		{"IT-BR", "Brindisi"},
+		{"IT-BS", "Brescia"},
+		{"IT-BT", "Barletta-Andria-Trani"},
+		{"IT-BZ", "Bolzano"},
+		{"IT-CA", "Cagliari"},
+		{"IT-CB", "Campobasso"},
+		{"IT-CE", "Caserta"},
+		{"IT-CH", "Chieti"},
+		{"IT-CL", "Caltanissetta"},
+		{"IT-CN", "Cuneo"},
+		{"IT-CO", "Como"},
+		{"IT-CR", "Cremona"},
+		{"IT-CS", "Cosenza"},
+		{"IT-CT", "Catania"},
+		{"IT-CZ", "Catanzaro"},
+		{"IT-EN", "Enna"},
+		{"IT-FC", "Forlì-Cesena"},
+		{"IT-FE", "Ferrara"},
+		{"IT-FG", "Foggia"},
+		{"IT-FI", "Firenze"},
+		{"IT-FM", "Fermo"},
+		{"IT-FR", "Frosinone"},
+		{"IT-GE", "Genova"},
+		{"IT-GO", "Gorizia"},
+		{"IT-GR", "Grosseto"},
+		{"IT-IM", "Imperia"},
+		{"IT-IS", "Isernia"},
+		{"IT-KR", "Crotone"},
+		{"IT-LC", "Lecco"},
+		{"IT-LE", "Lecce"},
+		{"IT-LI", "Livorno"},
+		{"IT-LO", "Lodi"},
+		{"IT-LT", "Latina"},
+		{"IT-LU", "Lucca"},
+		{"IT-MB", "Monza e Brianza"},
+		{"IT-MC", "Macerata"},
+		{"IT-ME", "Messina"},
+		{"IT-MI", "Milano"},
+		{"IT-MN", "Mantova"},
+		{"IT-MO", "Modena"},
+		{"IT-MS", "Massa-Carrara"},
+		{"IT-MT", "Matera"},
+		{"IT-NA", "Napoli"},
+		{"IT-NO", "Novara"},
+		{"IT-NU", "Nuoro"},
+		{"IT-OR", "Oristano"},
+		{"IT-PA", "Palermo"},
+		{"IT-PC", "Piacenza"},
+		{"IT-PD", "Padova"},
+		{"IT-PE", "Pescara"},
+		{"IT-PG", "Perugia"},
+		{"IT-PI", "Pisa"},
+		{"IT-PN", "Pordenone"},
+		{"IT-PO", "Prato"},
+		{"IT-PR", "Parma"},
+		{"IT-PT", "Pistoia"},
+		{"IT-PU", "Pesaro e Urbino"},
+		{"IT-PV", "Pavia"},
+		{"IT-PZ", "Potenza"},
+		{"IT-RA", "Ravenna"},
+		{"IT-RC", "Reggio Calabria"},
+		{"IT-RE", "Reggio Emilia"},
+		{"IT-RG", "Ragusa"},
+		{"IT-RI", "Rieti"},
+		{"IT-RM", "Roma"},
+		{"IT-RN", "Rimini"},
+		{"IT-RO", "Rovigo"},
+		{"IT-SA", "Salerno"},
+		{"IT-SI", "Siena"},
+		{"IT-SO", "Sondrio"},
+		{"IT-SP", "La Spezia"},
+		{"IT-SR", "Siracusa"},
+		{"IT-SS", "Sassari"},
+		{"IT-SU", "Sud Sardegna"},
+		{"IT-SV", "Savona"},
+		{"IT-TA", "Taranto"},
+		{"IT-TE", "Teramo"},
+		{"IT-TN", "Trento"},
+		{"IT-TO", "Torino"},
+		{"IT-TP", "Trapani"},
+		{"IT-TR", "Terni"},
+		{"IT-TS", "Trieste"},
+		{"IT-TV", "Treviso"},
+		{"IT-UD", "Udine"},
+		{"IT-VA", "Varese"},
+		{"IT-VB", "Verbano-Cusio-Ossola"},
+		{"IT-VC", "Vercelli"},
+		{"IT-VE", "Venezia"},
+		{"IT-VI", "Vicenza"},
+		{"IT-VR", "Verona"},
+		{"IT-VT", "Viterbo"},
+		{"IT-VV", "Vibo Valentia"},
+	},
+	"JP": {
+		{"JP-01", "Hokkaido"},
+		{"JP-02", "Aomori"},
+		{"JP-03", "Iwate"},
+		{"JP-04", "Miyagi"},
+		{"JP-05", "Akita"},
+		{"JP-06", "Yamagata"},
+		{"JP-07", "Fukushima"},
+		{"JP-08", "Ibaraki"},
+		{"JP-09", "Tochigi"},
+		{"JP-10", "Gunma"},
+		{"JP-11", "Saitama"},
+		{"JP-12", "Chiba"},
+		{"JP-13", "Tokyo"},
+		{"JP-14", "Kanagawa"},
+		{"JP-15", "Niigata"},
+		{"JP-16", "Toyama"},
+		{"JP-17", "Ishikawa"},
+		{"JP-18", "Fukui"},
+		{"JP-19", "Yamanashi"},
+		{"JP-20", "Nagano"},
+		{"JP-21", "Gifu"},
+		{"JP-22", "Shizuoka"},
+		{"JP-23", "Aichi"},
+		{"JP-24", "Mie"},
+		{"JP-25", "Shiga"},
+		{"JP-26", "Kyoto"},
+		{"JP-27", "Osaka"},
+		{"JP-28", "Hyogo"},
+		{"JP-29", "Nara"},
+		{"JP-30", "Wakayama"},
+		{"JP-31", "Tottori"},
+		{"JP-32", "Shimane"},
+		{"JP-33", "Okayama"},
+		{"JP-34", "Hiroshima"},
+		{"JP-35", "Yamaguchi"},
+		{"JP-36", "Tokushima"},
+		{"JP-37", "Kagawa"},
+		{"JP-38", "Ehime"},
+		{"JP-39", "Kochi"},
+		{"JP-40", "Fukuoka"},
+		{"JP-41", "Saga"},
+		{"JP-42", "Nagasaki"},
+		{"JP-43", "Kumamoto"},
+		{"JP-44", "Oita"},
+		{"JP-45", "Miyazaki"},
+		{"JP-46", "Kagoshima"},
+		{"JP-47", "Okinawa"},
+	},
+	"MX": {
+		{"MX-AGU", "Aguascalientes"},
+		{"MX-BCN", "Baja California"},
+		{"MX-BCS", "Baja California Sur"},
+		{"MX-CAM", "Campeche"},
+		{"MX-CHH", "Chihuahua"},
+		{"MX-CHP", "Chiapas"},
+		{"MX-CMX", "Ciudad de México"},
+		{"MX-COA", "Coahuila de Zaragoza"},
+		{"MX-COL", "Colima"},
+		{"MX-DUR", "Durango"},
+		{"MX-GRO", "Guerrero"},
+		{"MX-GUA", "Guanajuato"},
+		{"MX-HID", "Hidalgo"},
+		{"MX-JAL", "Jalisco"},
+		{"MX-MEX", "México"},
+		{"MX-MIC", "Michoacán de Ocampo"},
+		{"MX-MOR", "Morelos"},
+		{"MX-NAY", "Nayarit"},
+		{"MX-NLE", "Nuevo León"},
+		{"MX-OAX", "Oaxaca"},
+		{"MX-PUE", "Puebla"},
+		{"MX-QUE", "Querétaro"},
+		{"MX-ROO", "Quintana Roo"},
+		{"MX-SIN", "Sinaloa"},
+		{"MX-SLP", "San Luis Potosí"},
+		{"MX-SON", "Sonora"},
+		{"MX-TAB", "Tabasco"},
+		{"MX-TAM", "Tamaulipas"},
+		{"MX-TLA", "Tlaxcala"},
+		{"MX-VER", "Veracruz de Ignacio de la Llave"},
+		{"MX-YUC", "Yucatán"},
+		{"MX-ZAC", "Zacatecas"},
+	},
+	"US": {
+		{"US-AK", "Alaska"},
+		{"US-AL", "Alabama"},
+		{"US-AR", "Arkansas"},
+		{"US-AS", "American Samoa"},
+		{"US-AZ", "Arizona"},
+		{"US-CA", "California"},
+		{"US-CO", "Colorado"},
+		{"US-CT", "Connecticut"},
+		{"US-DC", "District of Columbia"},
+		{"US-DE", "Delaware"},
+		{"US-FL", "Florida"},
+		{"US-GA", "Georgia"},
+		{"US-GU", "Guam"},
+		{"US-HI", "Hawaii"},
+		{"US-IA", "Iowa"},
+		{"US-ID", "Idaho"},
+		{"US-IL", "Illinois"},
+		{"US-IN", "Indiana"},
+		{"US-KS", "Kansas"},
+		{"US-KY", "Kentucky"},
+		{"US-LA", "Louisiana"},
+		{"US-MA", "Massachusetts"},
+		{"US-MD", "Maryland"},
+		{"US-ME", "Maine"},
+		{"US-MI", "Michigan"},
+		{"US-MN", "Minnesota"},
+		{"US-MO", "Missouri"},
+		{"US-MP", "Northern Mariana Islands"},
+		{"US-MS", "Mississippi"},
+		{"US-MT", "Montana"},
+		{"US-NC", "North Carolina"},
+		{"US-ND", "North Dakota"},
+		{"US-NE", "Nebraska"},
+		{"US-NH", "New Hampshire"},
+		{"US-NJ", "New Jersey"},
+		{"US-NM", "New Mexico"},
+		{"US-NV", "Nevada"},
+		{"US-NY", "New York"},
+		{"US-OH", "Ohio"},
+		{"US-OK", "Oklahoma"},
+		{"US-OR", "Oregon"},
+		{"US-PA", "Pennsylvania"},
+		{"US-PR", "Puerto Rico"},
+		{"US-RI", "Rhode Island"},
+		{"US-SC", "South Carolina"},
+		{"US-SD", "South Dakota"},
+		{"US-TN", "Tennessee"},
+		{"US-TX", "Texas"},
+		{"US-UM", "United States Minor Outlying Islands"},
+		{"US-UT", "Utah"},
+		{"US-VA", "Virginia"},
+		{"US-VI", "Virgin Islands, U.S."},
+		{"US-VT", "Vermont"},
+		{"US-WA", "Washington"},
+		{"US-WI", "Wisconsin"},
+		{"US-WV", "West Virginia"},
+		{"US-WY", "Wyoming"},
+	},
+}
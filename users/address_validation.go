@@ -0,0 +1,269 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package users
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+type country struct {
+	Alpha2 string
+	Alpha3 string
+	Names  []string
+}
+
+type subdivision struct {
+	Code string
+	Name string
+}
+
+// addressFormat holds the postal conventions of a country. Postcodes are
+// matched with spaces and hyphens removed and then rewritten by postFormat.
+// The layout places %N number, %S street, %C city, %A state and %Z postcode.
+type addressFormat struct {
+	postCode      *regexp.Regexp
+	postFormat    func(string) string
+	postOptional  bool
+	stateRequired bool
+	stateName     bool
+	layout        string
+}
+
+var defaultFormat = addressFormat{layout: "%N %S\n%C %A %Z"}
+
+var formats = map[string]addressFormat{
+	"AR": {postCode: regexp.MustCompile(`^([A-Z]\d{4}[A-Z]{3}|\d{4})$`), stateRequired: true, stateName: true, layout: "%S %N\n%Z %C\n%A"},
+	"AT": {postCode: regexp.MustCompile(`^\d{4}$`), layout: "%S %N\n%Z %C"},
+	"AU": {postCode: regexp.MustCompile(`^\d{4}$`), stateRequired: true, layout: "%N %S\n%C %A %Z"},
+	"BE": {postCode: regexp.MustCompile(`^\d{4}$`), layout: "%S %N\n%Z %C"},
+	"BR": {postCode: regexp.MustCompile(`^\d{8}$`), postFormat: splitAt(5, "-"), stateRequired: true, layout: "%S, %N\n%C-%A\n%Z"},
+	"CA": {postCode: regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[A-Z]\d[A-Z]\d$`), postFormat: splitAt(3, " "), stateRequired: true, layout: "%N %S\n%C %A %Z"},
+	"CH": {postCode: regexp.MustCompile(`^\d{4}$`), layout: "%S %N\n%Z %C"},
+	"CN": {postCode: regexp.MustCompile(`^\d{6}$`), stateRequired: true, stateName: true, layout: "%N %S\n%C, %A %Z"},
+	"DE": {postCode: regexp.MustCompile(`^\d{5}$`), layout: "%S %N\n%Z %C"},
+	"DK": {postCode: regexp.MustCompile(`^\d{4}$`), layout: "%S %N\n%Z %C"},
+	"ES": {postCode: regexp.MustCompile(`^\d{5}$`), stateName: true, layout: "%S %N\n%Z %C %A"},
+	"FI": {postCode: regexp.MustCompile(`^\d{5}$`), layout: "%S %N\n%Z %C"},
+	"FR": {postCode: regexp.MustCompile(`^\d{5}$`), layout: "%N %S\n%Z %C"},
+	"GB": {postCode: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]?\d[A-Z]{2}$`), postFormat: splitAt(-3, " "), layout: "%N %S\n%C\n%Z"},
+	"IE": {postCode: regexp.MustCompile(`^([AC-FHKNPRTV-Y]\d{2}|D6W)[0-9AC-FHKNPRTV-Y]{4}$`), postFormat: splitAt(3, " "), postOptional: true, layout: "%N %S\n%C\n%Z"},
+	"IN": {postCode: regexp.MustCompile(`^\d{6}$`), stateRequired: true, stateName: true, layout: "%N %S\n%C %Z\n%A"},
+	"IT": {postCode: regexp.MustCompile(`^\d{5}$`), stateRequired: true, layout: "%S %N\n%Z %C %A"},
+	"JP": {postCode: regexp.MustCompile(`^\d{7}$`), postFormat: splitAt(3, "-"), stateRequired: true, stateName: true, layout: "%N %S\n%C, %A\n%Z"},
+	"MX": {postCode: regexp.MustCompile(`^\d{5}$`), stateRequired: true, stateName: true, layout: "%S %N\n%Z %C, %A"},
+	"NL": {postCode: regexp.MustCompile(`^\d{4}[A-Z]{2}$`), postFormat: splitAt(4, " "), layout: "%S %N\n%Z %C"},
+	"NO": {postCode: regexp.MustCompile(`^\d{4}$`), layout: "%S %N\n%Z %C"},
+	"PL": {postCode: regexp.MustCompile(`^\d{5}$`), postFormat: splitAt(2, "-"), layout: "%S %N\n%Z %C"},
+	"PT": {postCode: regexp.MustCompile(`^\d{7}$`), postFormat: splitAt(4, "-"), layout: "%S %N\n%Z %C"},
+	"SE": {postCode: regexp.MustCompile(`^\d{5}$`), postFormat: splitAt(3, " "), layout: "%S %N\n%Z %C"},
+	"US": {postCode: regexp.MustCompile(`^\d{5}(\d{4})?$`), postFormat: splitAt(5, "-"), stateRequired: true, layout: "%N %S\n%C, %A %Z"},
+}
+
+// countryAliases holds names in common use that are not in the ISO list.
+var countryAliases = map[string]string{
+	"america":               "US",
+	"unitedstatesofamerica": "US",
+	"uk":                    "GB",
+	"greatbritain":          "GB",
+	"britain":               "GB",
+	"england":               "GB",
+	"scotland":              "GB",
+	"wales":                 "GB",
+	"northernireland":       "GB",
+	"holland":               "NL",
+}
+
+var (
+	countryIndex     = map[string]string{}
+	countryByCode    = map[string]country{}
+	subdivisionIndex = map[string]map[string]string{}
+	subdivisionNames = map[string]string{}
+)
+
+func init() {
+	for k, v := range countryAliases {
+		countryIndex[k] = v
+	}
+	for _, c := range countries {
+		countryByCode[c.Alpha2] = c
+		countryIndex[fold(c.Alpha2)] = c.Alpha2
+		countryIndex[fold(c.Alpha3)] = c.Alpha2
+		for _, n := range c.Names {
+			countryIndex[fold(n)] = c.Alpha2
+		}
+	}
+	for cc, subs := range subdivisions {
+		idx := map[string]string{}
+		for _, s := range subs {
+			idx[fold(s.Code)] = s.Code
+			idx[fold(strings.TrimPrefix(s.Code, cc+"-"))] = s.Code
+			idx[fold(s.Name)] = s.Code
+			subdivisionNames[s.Code] = s.Name
+		}
+		subdivisionIndex[cc] = idx
+	}
+}
+
+// Normalize cleans up the address in place: the country becomes its ISO
+// 3166-1 alpha-2 code, the state its ISO 3166-2 code where the country has
+// subdivisions and the postcode is validated and formatted for the country.
+// Problems are returned per field as FieldErrors.
+func (a *Address) Normalize() error {
+	errs := FieldErrors{}
+	a.Street = collapse(a.Street)
+	a.Number = collapse(a.Number)
+	a.City = collapse(a.City)
+	a.State = collapse(a.State)
+	a.PostCode = collapse(a.PostCode)
+	a.Country = collapse(a.Country)
+
+	if a.Street == "" {
+		errs["street"] = "is required"
+	}
+	if a.City == "" {
+		errs["city"] = "is required"
+	}
+	if a.Country == "" {
+		errs["country"] = "is required"
+		return errs
+	}
+	cc, ok := countryIndex[fold(a.Country)]
+	if !ok {
+		errs["country"] = "is not a known country"
+		return errs
+	}
+	a.Country = cc
+	f := formatFor(cc)
+
+	if a.State == "" {
+		if f.stateRequired {
+			errs["state"] = "is required"
+		}
+	} else if idx, ok := subdivisionIndex[cc]; ok {
+		code, ok := idx[fold(a.State)]
+		if !ok {
+			errs["state"] = fmt.Sprintf("is not a subdivision of %v", cc)
+		} else {
+			a.State = code
+		}
+	}
+
+	if a.PostCode == "" {
+		if f.postCode != nil && !f.postOptional {
+			errs["postcode"] = "is required"
+		}
+	} else if f.postCode != nil {
+		p := strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(a.PostCode))
+		if !f.postCode.MatchString(p) {
+			errs["postcode"] = fmt.Sprintf("is not a valid %v postcode", cc)
+		} else if f.postFormat != nil {
+			a.PostCode = f.postFormat(p)
+		} else {
+			a.PostCode = p
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Label renders the address as a postal label, one line per row, in the line
+// order used by its country and ending with the country name. The recipient
+// line is left out when empty.
+func (a Address) Label(recipient string) string {
+	f := formatFor(a.Country)
+	state := a.State
+	if name, ok := subdivisionNames[a.State]; ok {
+		if f.stateName {
+			state = name
+		} else {
+			state = strings.TrimPrefix(a.State, a.Country+"-")
+		}
+	}
+	r := strings.NewReplacer(
+		"%N", a.Number,
+		"%S", a.Street,
+		"%C", a.City,
+		"%A", state,
+		"%Z", a.PostCode,
+	)
+	lines := make([]string, 0)
+	if recipient != "" {
+		lines = append(lines, recipient)
+	}
+	for _, l := range strings.Split(r.Replace(f.layout), "\n") {
+		l = strings.Trim(collapse(l), " ,-")
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	name := a.Country
+	if c, ok := countryByCode[a.Country]; ok {
+		name = c.Names[len(c.Names)-1]
+	}
+	if name != "" {
+		lines = append(lines, strings.ToUpper(name))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatFor(cc string) addressFormat {
+	if f, ok := formats[cc]; ok {
+		return f
+	}
+	return defaultFormat
+}
+
+// splitAt returns a postcode formatter inserting sep at position i, counted
+// from the end when negative.
+func splitAt(i int, sep string) func(string) string {
+	return func(p string) string {
+		n := i
+		if n < 0 {
+			n = len(p) + n
+		}
+		if n <= 0 || n >= len(p) {
+			return p
+		}
+		return p[:n] + sep + p[n:]
+	}
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// fold reduces s to lower case letters and digits without accents so that
+// names compare regardless of case, spacing, punctuation and diacritics.
+func fold(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	s, _, _ = transform.String(t, s)
+	b := make([]rune, 0, len(s))
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b = append(b, r)
+		}
+	}
+	return string(b)
+}
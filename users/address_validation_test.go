@@ -0,0 +1,94 @@
+package users
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAddressNormalize(t *testing.T) {
+
+	Convey("Given a US address written loosely", t, func() {
+		a := Address{
+			Street:   " Market  St ",
+			Number:   "1355",
+			City:     "San Francisco",
+			State:    "california",
+			Country:  "U.S.A.",
+			PostCode: "941031234",
+		}
+
+		Convey("When normalized", func() {
+			err := a.Normalize()
+
+			Convey("Then it should use ISO codes and a formatted ZIP", func() {
+				So(err, ShouldBeNil)
+				So(a.Street, ShouldEqual, "Market St")
+				So(a.Country, ShouldEqual, "US")
+				So(a.State, ShouldEqual, "US-CA")
+				So(a.PostCode, ShouldEqual, "94103-1234")
+			})
+
+			Convey("Then the label should follow US conventions", func() {
+				So(a.Label("Test User"), ShouldEqual, "Test User\n1355 Market St\nSan Francisco, CA 94103-1234\nUNITED STATES")
+			})
+		})
+	})
+
+	Convey("Given addresses from other countries", t, func() {
+		gb := Address{Street: "Downing Street", Number: "10", City: "London", Country: "United Kingdom", PostCode: "sw1a2aa"}
+		de := Address{Street: "Unter den Linden", Number: "77", City: "Berlin", Country: "deu", PostCode: "10117"}
+		jp := Address{Street: "Chiyoda", Number: "1-1", City: "Chiyoda-ku", State: "Tokyo", Country: "Japan", PostCode: "1000001"}
+		ci := Address{Street: "Rue du Commerce", City: "Abidjan", Country: "cote d ivoire"}
+
+		Convey("When normalized", func() {
+			So(gb.Normalize(), ShouldBeNil)
+			So(de.Normalize(), ShouldBeNil)
+			So(jp.Normalize(), ShouldBeNil)
+			So(ci.Normalize(), ShouldBeNil)
+
+			Convey("Then postcodes and subdivisions follow each country", func() {
+				So(gb.Country, ShouldEqual, "GB")
+				So(gb.PostCode, ShouldEqual, "SW1A 2AA")
+				So(de.Country, ShouldEqual, "DE")
+				So(jp.State, ShouldEqual, "JP-13")
+				So(jp.PostCode, ShouldEqual, "100-0001")
+				So(ci.Country, ShouldEqual, "CI")
+			})
+
+			Convey("Then labels use the country's line order", func() {
+				So(de.Label(""), ShouldEqual, "Unter den Linden 77\n10117 Berlin\nGERMANY")
+				So(gb.Label(""), ShouldEqual, "10 Downing Street\nLondon\nSW1A 2AA\nUNITED KINGDOM")
+			})
+		})
+	})
+
+	Convey("Given an invalid address", t, func() {
+		a := Address{Street: "Market St", Country: "US", State: "Narnia", PostCode: "ABCDE"}
+
+		Convey("When normalized", func() {
+			err := a.Normalize()
+
+			Convey("Then every problem should be reported by field", func() {
+				fe, ok := err.(FieldErrors)
+				So(ok, ShouldBeTrue)
+				So(fe, ShouldContainKey, "city")
+				So(fe, ShouldContainKey, "state")
+				So(fe, ShouldContainKey, "postcode")
+				So(fe, ShouldNotContainKey, "street")
+			})
+		})
+	})
+
+	Convey("Given an address in an unknown country", t, func() {
+		a := Address{Street: "Main St", City: "Springfield", Country: "Atlantis"}
+
+		Convey("When normalized", func() {
+			err := a.Normalize()
+
+			Convey("Then the country should be rejected", func() {
+				So(err, ShouldResemble, FieldErrors{"country": "is not a known country"})
+			})
+		})
+	})
+}
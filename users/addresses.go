@@ -5,12 +5,12 @@ type Address struct {
 	Number   string `json:"number" bson:"number,omitempty"`
 	Country  string `json:"country" bson:"country,omitempty"`
 	City     string `json:"city" bson:"city,omitempty"`
-	State		 string `json:"state" bson:"state,omitempty"`
+	State    string `json:"state" bson:"state,omitempty"`
 	PostCode string `json:"postcode" bson:"postcode,omitempty"`
 	ID       string `json:"id" bson:"-"`
 	Links    Links  `json:"_links"`
 }
 
-func (a *Address) AddLinks() {
-	a.Links.AddAddress(a.ID)
+func (a *Address) AddLinks(b LinkBase) {
+	a.Links.AddAddress(b, a.ID)
 }
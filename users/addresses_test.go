@@ -9,11 +9,11 @@ import (
 func TestAddressesHATEOAS(t *testing.T) {
 
 	Convey("Given a new address", t, func() {
-		domain = "example.com"
+		b := LinkBase{Host: "example.com"}
 		a := Address{ID: "test"}
 
 		Convey("When adding links", func() {
-			a.AddLinks()
+			a.AddLinks(b)
 			h := Href{"http://example.com/addresses/test"}
 
 			Convey("Then link should equal thet test link", func() {
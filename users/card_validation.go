@@ -0,0 +1,186 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package users
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidExpiry = errors.New("Expiry must be MM/YY or MM/YYYY")
+)
+
+// iinRange is an inclusive range of issuer identification number prefixes
+// of equal length.
+type iinRange struct {
+	from, to int
+}
+
+type brand struct {
+	name    string
+	iins    []iinRange
+	lengths []int
+	cvv     int
+}
+
+var brands = []brand{
+	{"visa", []iinRange{{4, 4}}, []int{13, 16, 19}, 3},
+	{"mastercard", []iinRange{{51, 55}, {2221, 2720}}, []int{16}, 3},
+	{"amex", []iinRange{{34, 34}, {37, 37}}, []int{15}, 4},
+	{"discover", []iinRange{{6011, 6011}, {644, 649}, {65, 65}, {622126, 622925}}, []int{16, 17, 18, 19}, 3},
+	{"diners", []iinRange{{300, 305}, {36, 36}, {38, 39}}, []int{14, 15, 16, 17, 18, 19}, 3},
+	{"jcb", []iinRange{{3528, 3589}}, []int{16, 17, 18, 19}, 3},
+	{"unionpay", []iinRange{{62, 62}}, []int{16, 17, 18, 19}, 3},
+	{"maestro", []iinRange{{50, 50}, {56, 58}, {639, 639}, {67, 67}}, []int{12, 13, 14, 15, 16, 17, 18, 19}, 3},
+}
+
+// Validate checks the card number against the Luhn checksum and the length
+// rules of its brand, the CCV length for the brand and that the card has not
+// expired at now. On success the number is stored without separators, the
+// brand and expiry month and year are set and Expires is rewritten as MM/YY.
+func (c *Card) Validate(now time.Time) error {
+	errs := FieldErrors{}
+	n := strings.NewReplacer(" ", "", "-", "").Replace(c.LongNum)
+	b, ok := detectBrand(n)
+	switch {
+	case n == "" || digits(n) != n:
+		errs["longNum"] = "must contain only digits"
+	case !luhn(n):
+		errs["longNum"] = "fails the checksum"
+	case !ok:
+		errs["longNum"] = "is not from a supported card brand"
+	case !hasLength(b, len(n)):
+		errs["longNum"] = fmt.Sprintf("has the wrong length for %v", b.name)
+	}
+
+	if ok {
+		if len(c.CCV) != b.cvv || digits(c.CCV) != c.CCV {
+			errs["ccv"] = fmt.Sprintf("must be %v digits", b.cvv)
+		}
+	}
+
+	m, y, err := ParseExpiry(c.Expires)
+	if err != nil {
+		errs["expires"] = "must be MM/YY or MM/YYYY"
+	} else {
+		c.ExpiryMonth, c.ExpiryYear = m, y
+		if c.IsExpired(now) {
+			errs["expires"] = "card has expired"
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	c.LongNum = n
+	c.Brand = b.name
+	c.Expires = fmt.Sprintf("%02d/%02d", m, y%100)
+	return nil
+}
+
+// IsExpired reports whether now is past the last day of the expiry month.
+func (c *Card) IsExpired(now time.Time) bool {
+	end := time.Date(c.ExpiryYear, time.Month(c.ExpiryMonth)+1, 1, 0, 0, 0, 0, time.UTC)
+	return !now.Before(end)
+}
+
+// ParseExpiry reads an expiry date written as MM/YY, MM/YYYY, MM-YY or MMYY.
+func ParseExpiry(s string) (month, year int, err error) {
+	s = strings.TrimSpace(s)
+	var ms, ys string
+	if i := strings.IndexAny(s, "/-"); i >= 0 {
+		ms, ys = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	} else if len(s) == 4 {
+		ms, ys = s[:2], s[2:]
+	} else {
+		return 0, 0, ErrInvalidExpiry
+	}
+	month, err = strconv.Atoi(ms)
+	if err != nil || month < 1 || month > 12 || len(ms) > 2 {
+		return 0, 0, ErrInvalidExpiry
+	}
+	year, err = strconv.Atoi(ys)
+	if err != nil {
+		return 0, 0, ErrInvalidExpiry
+	}
+	switch len(ys) {
+	case 2:
+		year += 2000
+	case 4:
+	default:
+		return 0, 0, ErrInvalidExpiry
+	}
+	return month, year, nil
+}
+
+// detectBrand picks the brand with the most specific IIN prefix matching n.
+func detectBrand(n string) (brand, bool) {
+	var found brand
+	best := 0
+	for _, b := range brands {
+		for _, r := range b.iins {
+			l := len(strconv.Itoa(r.from))
+			if len(n) < l || l <= best {
+				continue
+			}
+			p, _ := strconv.Atoi(n[:l])
+			if p >= r.from && p <= r.to {
+				found, best = b, l
+			}
+		}
+	}
+	return found, best > 0
+}
+
+func hasLength(b brand, l int) bool {
+	for _, v := range b.lengths {
+		if v == l {
+			return true
+		}
+	}
+	return false
+}
+
+func luhn(n string) bool {
+	sum := 0
+	double := false
+	for i := len(n) - 1; i >= 0; i-- {
+		d := int(n[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// digits returns the digits of s, dropping everything else.
+func digits(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,106 @@
+package users
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCardBrands(t *testing.T) {
+
+	Convey("Given test numbers from each brand", t, func() {
+		now := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+		cases := map[string]string{
+			"4111 1111 1111 1111": "visa",
+			"5555555555554444":    "mastercard",
+			"2223003122003222":    "mastercard",
+			"378282246310005":     "amex",
+			"6011111111111117":    "discover",
+			"3530111333300000":    "jcb",
+			"30569309025904":      "diners",
+			"6200000000000005":    "unionpay",
+		}
+
+		Convey("When validated", func() {
+			for n, want := range cases {
+				ccv := "123"
+				if want == "amex" {
+					ccv = "1234"
+				}
+				c := Card{LongNum: n, Expires: "12/21", CCV: ccv}
+				So(c.Validate(now), ShouldBeNil)
+				So(c.Brand, ShouldEqual, want)
+			}
+		})
+	})
+}
+
+func TestCardValidate(t *testing.T) {
+
+	Convey("Given a valid card", t, func() {
+		now := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+		c := Card{LongNum: "4111-1111-1111-1111", Expires: "6/2020", CCV: "123"}
+
+		Convey("When validated in its expiry month", func() {
+			err := c.Validate(now)
+
+			Convey("Then it should be normalized", func() {
+				So(err, ShouldBeNil)
+				So(c.LongNum, ShouldEqual, "4111111111111111")
+				So(c.Expires, ShouldEqual, "06/20")
+				So(c.ExpiryMonth, ShouldEqual, 6)
+				So(c.ExpiryYear, ShouldEqual, 2020)
+			})
+		})
+
+		Convey("When validated after its expiry month", func() {
+			err := c.Validate(now.AddDate(0, 1, 0))
+
+			Convey("Then it should be rejected as expired", func() {
+				So(err, ShouldResemble, FieldErrors{"expires": "card has expired"})
+			})
+		})
+
+		Convey("When its status is added after expiry", func() {
+			c.Validate(now)
+			c.AddStatus(now.AddDate(1, 0, 0))
+
+			Convey("Then it should be reported as expired", func() {
+				So(c.Expired, ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given invalid cards", t, func() {
+		now := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+		luhn := Card{LongNum: "4111111111111112", Expires: "12/21", CCV: "123"}
+		amex := Card{LongNum: "378282246310005", Expires: "12/21", CCV: "123"}
+		length := Card{LongNum: "411111111111111", Expires: "12/21", CCV: "123"}
+		expiry := Card{LongNum: "4111111111111111", Expires: "13/21", CCV: "123"}
+
+		Convey("When validated", func() {
+			Convey("Then each problem should be reported on its field", func() {
+				So(luhn.Validate(now), ShouldResemble, FieldErrors{"longNum": "fails the checksum"})
+				So(amex.Validate(now), ShouldResemble, FieldErrors{"ccv": "must be 4 digits"})
+				So(length.Validate(now), ShouldContainKey, "longNum")
+				So(expiry.Validate(now), ShouldContainKey, "expires")
+			})
+		})
+	})
+}
+
+func TestMaskShortCC(t *testing.T) {
+
+	Convey("Given a card with a short number", t, func() {
+		c := Card{LongNum: "12"}
+
+		Convey("When the card is masked", func() {
+			c.MaskCC()
+
+			Convey("Then it should not panic and leave the number", func() {
+				So(c.LongNum, ShouldEqual, "12")
+			})
+		})
+	})
+}
@@ -3,21 +3,48 @@ package users
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 type Card struct {
-	LongNum string `json:"longNum" bson:"longNum"`
-	Expires string `json:"expires" bson:"expires"`
-	CCV     string `json:"ccv" bson:"ccv"`
-	ID      string `json:"id" bson:"-"`
-	Links   Links  `json:"_links" bson:"-"`
+	LongNum     string `json:"longNum" bson:"longNum"`
+	Expires     string `json:"expires" bson:"expires"`
+	CCV         string `json:"ccv" bson:"ccv"`
+	Brand       string `json:"brand,omitempty" bson:"brand,omitempty"`
+	ExpiryMonth int    `json:"expiryMonth,omitempty" bson:"expiryMonth,omitempty"`
+	ExpiryYear  int    `json:"expiryYear,omitempty" bson:"expiryYear,omitempty"`
+	Expired     bool   `json:"expired" bson:"-"`
+
+	BillingAddress string `json:"billingAddress,omitempty" bson:"billingAddress,omitempty"`
+	ID             string `json:"id" bson:"-"`
+	Links          Links  `json:"_links" bson:"-"`
 }
 
 func (c *Card) MaskCC() {
 	l := len(c.LongNum) - 4
+	if l < 0 {
+		l = 0
+	}
 	c.LongNum = fmt.Sprintf("%v%v", strings.Repeat("*", l), c.LongNum[l:])
 }
 
-func (c *Card) AddLinks() {
-	c.Links.AddCard(c.ID)
+func (c *Card) AddLinks(b LinkBase) {
+	c.Links.AddCard(b, c.ID)
+	if c.BillingAddress != "" {
+		c.Links.AddRelLink(b, "billingAddress", "address", c.BillingAddress)
+	}
+}
+
+// AddStatus fills in the brand and expiry of cards stored before they were
+// validated on write, and whether the card has expired at now.
+func (c *Card) AddStatus(now time.Time) {
+	if c.Brand == "" {
+		if b, ok := detectBrand(digits(c.LongNum)); ok {
+			c.Brand = b.name
+		}
+	}
+	if c.ExpiryMonth == 0 {
+		c.ExpiryMonth, c.ExpiryYear, _ = ParseExpiry(c.Expires)
+	}
+	c.Expired = c.ExpiryMonth != 0 && c.IsExpired(now)
 }
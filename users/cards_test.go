@@ -8,11 +8,11 @@ import (
 
 func TestCardsHATEOAS(t *testing.T) {
 	Convey("Given a new card", t, func() {
-		domain = "example.com"
+		b := LinkBase{Host: "example.com"}
 		c := Card{ID: "test"}
 
 		Convey("When adding links", func() {
-			c.AddLinks()
+			c.AddLinks(b)
 			h := Href{"http://example.com/cards/test"}
 
 			Convey("Then link should equal thet test link", func() {
@@ -0,0 +1,150 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package users
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Tombstone replaces every piece of personal data scrubbed by Erase.
+const Tombstone = "erased"
+
+// ErasureReport describes whether a customer has been erased and whether any
+// personal data is still held against it.
+type ErasureReport struct {
+	UserID   string     `json:"id"`
+	Erased   bool       `json:"erased"`
+	ErasedAt *time.Time `json:"erasedAt,omitempty"`
+	Verified bool       `json:"verified"`
+	Fields   []string   `json:"fields,omitempty"`
+}
+
+// Erase irreversibly replaces the personal data of the user, its addresses and
+// its cards with tombstone values. The user ID is kept so that references held
+// by other services stay valid. Erasing twice keeps the original timestamp.
+func (u *User) Erase(at time.Time) {
+	if u.ErasedAt == nil {
+		t := at.UTC()
+		u.ErasedAt = &t
+	}
+	u.FirstName = Tombstone
+	u.LastName = Tombstone
+	u.Email = Tombstone
+	u.Username = erasedUsername(u.UserID)
+	u.Password = ""
+	u.Salt = ""
+	for k := range u.Addresses {
+		u.Addresses[k].Erase()
+	}
+	for k := range u.Cards {
+		u.Cards[k].Erase()
+	}
+}
+
+// IsErased reports whether the user has been through Erase.
+func (u *User) IsErased() bool {
+	return u.ErasedAt != nil
+}
+
+// ErasureReport checks every personal field of the user, its addresses and
+// cards. Attributes must be loaded for the report to be complete.
+func (u *User) ErasureReport() ErasureReport {
+	r := ErasureReport{
+		UserID:   u.UserID,
+		Erased:   u.IsErased(),
+		ErasedAt: u.ErasedAt,
+		Fields:   make([]string, 0),
+	}
+	check := func(field, value string) {
+		if value != Tombstone && value != "" {
+			r.Fields = append(r.Fields, field)
+		}
+	}
+	check("firstname", u.FirstName)
+	check("lastname", u.LastName)
+	check("email", u.Email)
+	check("password", u.Password)
+	if u.Username != erasedUsername(u.UserID) {
+		r.Fields = append(r.Fields, "username")
+	}
+	for _, a := range u.Addresses {
+		for _, f := range a.personalFields() {
+			check(fmt.Sprintf("addresses/%v/%v", a.ID, f[0]), f[1])
+		}
+	}
+	for _, c := range u.Cards {
+		for _, f := range c.personalFields() {
+			check(fmt.Sprintf("cards/%v/%v", c.ID, f[0]), f[1])
+		}
+	}
+	r.Verified = r.Erased && len(r.Fields) == 0
+	return r
+}
+
+// Erase replaces every field of the address with a tombstone value.
+func (a *Address) Erase() {
+	a.Street = Tombstone
+	a.Number = Tombstone
+	a.Country = Tombstone
+	a.City = Tombstone
+	a.State = Tombstone
+	a.PostCode = Tombstone
+}
+
+func (a *Address) personalFields() [][2]string {
+	return [][2]string{
+		{"street", a.Street},
+		{"number", a.Number},
+		{"country", a.Country},
+		{"city", a.City},
+		{"state", a.State},
+		{"postcode", a.PostCode},
+	}
+}
+
+// Erase replaces the card details with tombstone values. The CCV and the
+// parsed expiry are dropped.
+func (c *Card) Erase() {
+	c.LongNum = Tombstone
+	c.Expires = Tombstone
+	c.CCV = ""
+	c.ExpiryMonth = 0
+	c.ExpiryYear = 0
+}
+
+func (c *Card) personalFields() [][2]string {
+	return [][2]string{
+		{"longNum", c.LongNum},
+		{"expires", c.Expires},
+		{"ccv", c.CCV},
+		{"expiryMonth", nonZero(c.ExpiryMonth)},
+		{"expiryYear", nonZero(c.ExpiryYear)},
+	}
+}
+
+// nonZero formats n, leaving it out when it is zero.
+func nonZero(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// erasedUsername keeps usernames unique across erased customers.
+func erasedUsername(id string) string {
+	return fmt.Sprintf("%v-%v", Tombstone, id)
+}
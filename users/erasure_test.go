@@ -0,0 +1,65 @@
+package users
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestErase(t *testing.T) {
+
+	Convey("Given a user with an address and a card", t, func() {
+		u := New()
+		u.UserID = "abc"
+		u.FirstName = "Test"
+		u.LastName = "User"
+		u.Email = "test@example.com"
+		u.Username = "testuser"
+		u.Password = "testpass"
+		u.Addresses = append(u.Addresses, Address{ID: "a1", Street: "Main St", Number: "1", City: "Springfield", PostCode: "12345"})
+		u.Cards = append(u.Cards, Card{ID: "c1", LongNum: "4111111111111111", Expires: "08/30", CCV: "123", ExpiryMonth: 8, ExpiryYear: 2030})
+
+		Convey("When it has not been erased", func() {
+			r := u.ErasureReport()
+
+			Convey("Then the report should not be verified", func() {
+				So(r.Erased, ShouldBeFalse)
+				So(r.Verified, ShouldBeFalse)
+				So(r.Fields, ShouldContain, "email")
+				So(r.Fields, ShouldContain, "cards/c1/longNum")
+				So(r.Fields, ShouldContain, "cards/c1/expiryYear")
+			})
+		})
+
+		Convey("When erased", func() {
+			at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			u.Erase(at)
+
+			Convey("Then the ID is kept and personal data is gone", func() {
+				So(u.UserID, ShouldEqual, "abc")
+				So(u.FirstName, ShouldEqual, Tombstone)
+				So(u.Username, ShouldEqual, "erased-abc")
+				So(u.Password, ShouldBeEmpty)
+				So(u.Addresses[0].Street, ShouldEqual, Tombstone)
+				So(u.Cards[0].LongNum, ShouldEqual, Tombstone)
+				So(u.Cards[0].CCV, ShouldBeEmpty)
+				So(u.Cards[0].ExpiryMonth, ShouldBeZeroValue)
+				So(u.Cards[0].ExpiryYear, ShouldBeZeroValue)
+			})
+
+			Convey("Then the report should be verified", func() {
+				r := u.ErasureReport()
+				So(r.Verified, ShouldBeTrue)
+				So(r.Fields, ShouldBeEmpty)
+				So(*r.ErasedAt, ShouldResemble, at)
+			})
+
+			Convey("Then erasing again keeps the original timestamp", func() {
+				u.Erase(at.Add(time.Hour))
+				So(*u.ErasedAt, ShouldResemble, at)
+				So(u.ErasureReport().Verified, ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -1,13 +1,12 @@
 package users
 
 import (
-	"flag"
-	"fmt"
-	"os"
+	"context"
+	"encoding/json"
+	"strings"
 )
 
 var (
-	domain    string
 	entitymap = map[string]string{
 		"customer": "customers",
 		"address":  "addresses",
@@ -15,41 +14,195 @@ var (
 	}
 )
 
-func init() {
-	flag.StringVar(&domain, "link-domain", os.Getenv("HATEAOS"), "HATEAOS link domain")
+// CurieName prefixes the link relations this service defines, which are
+// documented at the href of the curie.
+const CurieName = "users"
+
+// Rels describes the relations under CurieName.
+var Rels = map[string]string{
+	"erasure":  "The customer's erasure: POST erases its personal data and GET verifies the erasure.",
+	"defaults": "The customer's default address of a kind, shipping or billing, set with PUT.",
+}
+
+// LinkBase is where links point: the scheme, host and path prefix the
+// client reached the service at. Relative links, and links without a host,
+// leave out the scheme and host.
+type LinkBase struct {
+	Scheme   string
+	Host     string
+	Prefix   string
+	Relative bool
+}
+
+// URL returns the link to path below the base.
+func (b LinkBase) URL(path string) string {
+	p := strings.TrimSuffix(b.Prefix, "/") + "/" + strings.TrimPrefix(path, "/")
+	if b.Relative || b.Host == "" {
+		return p
+	}
+	scheme := b.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + b.Host + p
+}
+
+type linkBaseKey struct{}
+
+// WithLinkBase returns ctx carrying the base of the links of its responses.
+func WithLinkBase(ctx context.Context, b LinkBase) context.Context {
+	return context.WithValue(ctx, linkBaseKey{}, b)
+}
+
+// LinkBaseFrom returns the link base of ctx, making links relative to the
+// root when it has none.
+func LinkBaseFrom(ctx context.Context) LinkBase {
+	b, _ := ctx.Value(linkBaseKey{}).(LinkBase)
+	return b
 }
 
+// Links are the HAL links of a resource by relation. The curies relation
+// holds the href of the CurieName curie.
 type Links map[string]Href
 
-func (l *Links) AddLink(ent string, id string) {
+func (l *Links) AddLink(b LinkBase, ent string, id string) {
 	nl := make(Links)
-	link := fmt.Sprintf("http://%v/%v/%v", domain, entitymap[ent], id)
+	link := b.URL(entitymap[ent] + "/" + id)
 	nl[ent] = Href{link}
 	nl["self"] = Href{link}
 	*l = nl
 }
 
-func (l *Links) AddAttrLink(attr, corent, id string) {
-	link := fmt.Sprintf("http://%v/%v/%v/%v", domain, entitymap[corent], id, entitymap[attr])
+func (l *Links) AddAttrLink(b LinkBase, attr, corent, id string) {
+	link := b.URL(entitymap[corent] + "/" + id + "/" + entitymap[attr])
 	nl := *l
 	nl[entitymap[attr]] = Href{link}
 	*l = nl
 }
 
-func (l *Links) AddCustomer(id string) {
-	l.AddLink("customer", id)
-	l.AddAttrLink("address", "customer", id)
-	l.AddAttrLink("card", "customer", id)
+// AddRelLink adds a link named rel pointing at another entity.
+func (l *Links) AddRelLink(b LinkBase, rel, ent, id string) {
+	link := b.URL(entitymap[ent] + "/" + id)
+	nl := *l
+	nl[rel] = Href{link}
+	*l = nl
+}
+
+// AddCurieLink adds a link to path named rel under CurieName, along with the
+// curie itself. A path holding {variables} is a templated link.
+func (l *Links) AddCurieLink(b LinkBase, rel, path string) {
+	nl := *l
+	nl["curies"] = Href{b.URL("rels/{rel}")}
+	nl[CurieName+":"+rel] = Href{b.URL(path)}
+	*l = nl
+}
+
+func (l *Links) AddCustomer(b LinkBase, id string) {
+	l.AddLink(b, "customer", id)
+	l.AddAttrLink(b, "address", "customer", id)
+	l.AddAttrLink(b, "card", "customer", id)
+	l.AddCurieLink(b, "erasure", "customers/"+id+"/erasure")
+	l.AddCurieLink(b, "defaults", "customers/"+id+"/defaults/{kind}")
+}
+
+func (l *Links) AddAddress(b LinkBase, id string) {
+	l.AddLink(b, "address", id)
 }
 
-func (l *Links) AddAddress(id string) {
-	l.AddLink("address", id)
+func (l *Links) AddCard(b LinkBase, id string) {
+	l.AddLink(b, "card", id)
 }
 
-func (l *Links) AddCard(id string) {
-	l.AddLink("card", id)
+// MarshalJSON writes the links in HAL form, the curie as a list.
+func (l Links) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(l))
+	for rel, h := range l {
+		if rel == "curies" {
+			m[rel] = []curie{{Name: CurieName, Href: h.string, Templated: true}}
+			continue
+		}
+		m[rel] = h
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON reads links written by MarshalJSON.
+func (l *Links) UnmarshalJSON(b []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	nl := make(Links, len(m))
+	for rel, raw := range m {
+		if rel == "curies" {
+			var cs []curie
+			if err := json.Unmarshal(raw, &cs); err != nil {
+				return err
+			}
+			for _, c := range cs {
+				if c.Name == CurieName {
+					nl[rel] = Href{c.Href}
+				}
+			}
+			continue
+		}
+		var h Href
+		if err := json.Unmarshal(raw, &h); err != nil {
+			return err
+		}
+		nl[rel] = h
+	}
+	*l = nl
+	return nil
+}
+
+type curie struct {
+	Name      string `json:"name"`
+	Href      string `json:"href"`
+	Templated bool   `json:"templated"`
 }
 
 type Href struct {
 	string `json:"href"`
 }
+
+// String returns the URL of h.
+func (h Href) String() string {
+	return h.string
+}
+
+// Templated reports whether h is a URI template.
+func (h Href) Templated() bool {
+	return strings.Contains(h.string, "{")
+}
+
+// MarshalJSON writes h as a HAL link object, marked templated when it is
+// one.
+func (h Href) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Href      string `json:"href"`
+		Templated bool   `json:"templated,omitempty"`
+	}{h.string, h.Templated()})
+}
+
+func (h *Href) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Href string `json:"href"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	h.string = v.Href
+	return nil
+}
+
+// MarshalBinary and UnmarshalBinary let links be gob encoded, as the cache
+// does, despite the unexported field.
+func (h Href) MarshalBinary() ([]byte, error) {
+	return []byte(h.string), nil
+}
+
+func (h *Href) UnmarshalBinary(b []byte) error {
+	h.string = string(b)
+	return nil
+}
@@ -0,0 +1,60 @@
+package users
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLinkBase(t *testing.T) {
+	Convey("Given link bases", t, func() {
+		Convey("Then a full base should give absolute links", func() {
+			b := LinkBase{Scheme: "https", Host: "shop.example.com", Prefix: "/users/api/v1/"}
+			So(b.URL("customers/1"), ShouldEqual, "https://shop.example.com/users/api/v1/customers/1")
+		})
+		Convey("Then the scheme should default to http", func() {
+			So(LinkBase{Host: "example.com"}.URL("cards/1"), ShouldEqual, "http://example.com/cards/1")
+		})
+		Convey("Then relative and hostless bases should give relative links", func() {
+			So(LinkBase{Host: "example.com", Prefix: "/api/v2", Relative: true}.URL("cards/1"), ShouldEqual, "/api/v2/cards/1")
+			So(LinkBase{}.URL("cards/1"), ShouldEqual, "/cards/1")
+		})
+	})
+}
+
+func TestLinksJSON(t *testing.T) {
+	Convey("Given a customer's links", t, func() {
+		var l Links
+		l.AddCustomer(LinkBase{Host: "example.com"}, "test")
+
+		Convey("When encoding them", func() {
+			b, err := json.Marshal(l)
+			So(err, ShouldBeNil)
+			var m map[string]interface{}
+			So(json.Unmarshal(b, &m), ShouldBeNil)
+
+			Convey("Then plain links should be link objects", func() {
+				So(m["self"], ShouldResemble, map[string]interface{}{"href": "http://example.com/customers/test"})
+			})
+			Convey("Then templated links should be marked", func() {
+				So(m["users:defaults"], ShouldResemble, map[string]interface{}{
+					"href":      "http://example.com/customers/test/defaults/{kind}",
+					"templated": true,
+				})
+			})
+			Convey("Then the curie should be a list", func() {
+				So(m["curies"], ShouldResemble, []interface{}{map[string]interface{}{
+					"name":      "users",
+					"href":      "http://example.com/rels/{rel}",
+					"templated": true,
+				}})
+			})
+			Convey("Then decoding should give the links back", func() {
+				var got Links
+				So(json.Unmarshal(b, &got), ShouldBeNil)
+				So(got, ShouldResemble, l)
+			})
+		})
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package users
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SearchTokens returns the words a customer can be found by: its username,
+// names and email, and the postcodes of addrs. Each is folded to lower case
+// without accents, split at punctuation and also kept whole, so
+// "ada_l@example.com" gives ada, l, example, com and adalexamplecom.
+func SearchTokens(u User, addrs []Address) []string {
+	seen := map[string]bool{}
+	tokens := []string{}
+	add := func(s string) {
+		words := searchWords(s)
+		if len(words) > 1 {
+			words = append(words, strings.Join(words, ""))
+		}
+		for _, w := range words {
+			if !seen[w] {
+				seen[w] = true
+				tokens = append(tokens, w)
+			}
+		}
+	}
+	add(u.Username)
+	add(u.FirstName)
+	add(u.LastName)
+	add(u.Email)
+	for _, a := range addrs {
+		add(a.PostCode)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// SearchTerms splits a query into folded words, each of which must begin
+// one of a customer's SearchTokens for it to match.
+func SearchTerms(q string) []string {
+	return searchWords(q)
+}
+
+func searchWords(s string) []string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	s, _, _ = transform.String(t, s)
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
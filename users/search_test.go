@@ -0,0 +1,56 @@
+package users
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// matches reports whether every term begins one of tokens, as the database
+// requires of a customer found by a search.
+func matches(terms, tokens []string) bool {
+	for _, t := range terms {
+		found := false
+		for _, tok := range tokens {
+			found = found || strings.HasPrefix(tok, t)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSearch(t *testing.T) {
+
+	Convey("Given a customer with an address", t, func() {
+		u := User{Username: "zoe_b", FirstName: "Zoë", LastName: "Brontë-Smith", Email: "Zoe.B@Example.com"}
+		tokens := SearchTokens(u, []Address{{PostCode: "SW1A 1AA"}})
+
+		Convey("Then its tokens are folded words and whole values", func() {
+			So(tokens, ShouldContain, "zoe")
+			So(tokens, ShouldContain, "zoeb")
+			So(tokens, ShouldContain, "bronte")
+			So(tokens, ShouldContain, "brontesmith")
+			So(tokens, ShouldContain, "example")
+			So(tokens, ShouldContain, "sw1a1aa")
+			So(tokens, ShouldNotContain, "Zoë")
+		})
+
+		Convey("Then queries match prefixes regardless of case and accents", func() {
+			So(matches(SearchTerms("BRONTË"), tokens), ShouldBeTrue)
+			So(matches(SearchTerms("bron smi"), tokens), ShouldBeTrue)
+			So(matches(SearchTerms("sw1a1"), tokens), ShouldBeTrue)
+			So(matches(SearchTerms("zoe bronte"), tokens), ShouldBeTrue)
+		})
+
+		Convey("Then a term matching nothing excludes it", func() {
+			So(matches(SearchTerms("zoe jones"), tokens), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a query of punctuation", t, func() {
+		So(SearchTerms(" -@. "), ShouldBeEmpty)
+	})
+}
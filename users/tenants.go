@@ -0,0 +1,77 @@
+// Copyright © 2018 Tim Curless <tim.curless@thinkahead.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package users
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// tenantID is the form of tenant IDs, which appear in URLs and headers.
+var tenantID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Tenant is a storefront with its own customers. Requests for any of its
+// Hosts belong to it unless they name another tenant.
+type Tenant struct {
+	ID        string    `json:"id" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	Hosts     []string  `json:"hosts" bson:"hosts,omitempty"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// ValidTenantID reports whether id has the form of a tenant ID.
+func ValidTenantID(id string) bool {
+	return tenantID.MatchString(id)
+}
+
+// Validate checks the tenant and lower cases its hosts, dropping any port.
+func (t *Tenant) Validate() error {
+	errs := FieldErrors{}
+	if !ValidTenantID(t.ID) {
+		errs["id"] = "must be lower case letters, digits and dashes"
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		errs["name"] = "is required"
+	}
+	seen := map[string]bool{}
+	hosts := make([]string, 0, len(t.Hosts))
+	for _, h := range t.Hosts {
+		h = HostName(h)
+		if h == "" {
+			errs["hosts"] = "must not contain empty names"
+			continue
+		}
+		if !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+	t.Hosts = hosts
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// HostName lower cases a host and drops its port.
+func HostName(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	return strings.TrimSuffix(host, ".")
+}
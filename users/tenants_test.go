@@ -0,0 +1,36 @@
+package users
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTenantValidate(t *testing.T) {
+	Convey("Given a tenant", t, func() {
+		tn := Tenant{ID: "acme-eu", Name: " Acme ", Hosts: []string{"Shop.Acme.example:8443", "shop.acme.example."}}
+
+		Convey("When it is valid", func() {
+			err := tn.Validate()
+
+			Convey("Then its name is trimmed and hosts are folded", func() {
+				So(err, ShouldBeNil)
+				So(tn.Name, ShouldEqual, "Acme")
+				So(tn.Hosts, ShouldResemble, []string{"shop.acme.example"})
+			})
+		})
+
+		Convey("When its ID and name are unusable", func() {
+			tn.ID = "Acme EU"
+			tn.Name = ""
+			err := tn.Validate()
+
+			Convey("Then both are named", func() {
+				fe, ok := err.(FieldErrors)
+				So(ok, ShouldBeTrue)
+				So(fe, ShouldContainKey, "id")
+				So(fe, ShouldContainKey, "name")
+			})
+		})
+	})
+}
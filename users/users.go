@@ -19,28 +19,66 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// Kinds of default address a customer can designate.
+const (
+	KindShipping = "shipping"
+	KindBilling  = "billing"
+)
+
 var (
 	ErrNoCustomerInResponse = errors.New("Response has no matching customer")
 	ErrMissingField         = "Error missing %v"
 )
 
+// FieldErrors maps the JSON name of each invalid field to what is wrong
+// with it.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, 0, len(e))
+	for _, k := range keys {
+		msgs = append(msgs, fmt.Sprintf("%v %v", k, e[k]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
 type User struct {
-	FirstName string    `json:"firstname" bson:"firstname"`
-	LastName  string    `json:"lastname" bson:"lastname"`
-	Email     string    `json:"-" bson:"email"`
-	Username  string    `json:"username" bson:"username"`
-	Password  string    `json:"-" bson:"password,omitempty"`
-	Addresses []Address `json:"-,omitempty" bson:"-"`
-	Cards     []Card    `json:"-,omitempty" bson:"-"`
-	UserID    string    `json:"id" bson:"-"`
-	Links     Links     `json:"_links"`
-	Salt      string    `json:"-" bson:"salt"`
+	FirstName string     `json:"firstname" bson:"firstname"`
+	LastName  string     `json:"lastname" bson:"lastname"`
+	Email     string     `json:"-" bson:"email"`
+	Username  string     `json:"username" bson:"username"`
+	Password  string     `json:"-" bson:"password,omitempty"`
+	Addresses []Address  `json:"-" bson:"-"`
+	Cards     []Card     `json:"-" bson:"-"`
+	UserID    string     `json:"id" bson:"-"`
+	Links     Links      `json:"_links"`
+	Salt      string     `json:"-" bson:"salt"`
+	ErasedAt  *time.Time `json:"erasedAt,omitempty" bson:"erasedAt,omitempty"`
+
+	// DisabledAt is set while an operator has disabled the account.
+	DisabledAt *time.Time `json:"disabledAt,omitempty" bson:"disabledAt,omitempty"`
+
+	DefaultShipping string `json:"-" bson:"-"`
+	DefaultBilling  string `json:"-" bson:"-"`
+
+	// Embedded holds the resources embedded on request, by link relation.
+	Embedded map[string]interface{} `json:"_embedded,omitempty" bson:"-"`
 }
 
+// Embeddable are the relations of a customer that can be embedded in it.
+var Embeddable = []string{"addresses", "cards"}
+
 func New() User {
 	u := User{Addresses: make([]Address, 0), Cards: make([]Card, 0)}
 	u.NewSalt()
@@ -70,8 +108,40 @@ func (u *User) MaskCCs() {
 	}
 }
 
-func (u *User) AddLinks() {
-	u.Links.AddCustomer(u.UserID)
+func (u *User) AddLinks(b LinkBase) {
+	u.Links.AddCustomer(b, u.UserID)
+	if u.DefaultShipping != "" {
+		u.Links.AddRelLink(b, "defaultShipping", "address", u.DefaultShipping)
+	}
+	if u.DefaultBilling != "" {
+		u.Links.AddRelLink(b, "defaultBilling", "address", u.DefaultBilling)
+	}
+}
+
+// Embed embeds the addresses or cards of u, named by their relation, which
+// must already be loaded.
+func (u *User) Embed(rels []string) {
+	if len(rels) == 0 {
+		return
+	}
+	e := make(map[string]interface{}, len(rels))
+	for _, rel := range rels {
+		switch rel {
+		case "addresses":
+			as := u.Addresses
+			if as == nil {
+				as = make([]Address, 0)
+			}
+			e[rel] = as
+		case "cards":
+			cs := u.Cards
+			if cs == nil {
+				cs = make([]Card, 0)
+			}
+			e[rel] = cs
+		}
+	}
+	u.Embedded = e
 }
 
 func (u *User) NewSalt() {
@@ -79,3 +149,12 @@ func (u *User) NewSalt() {
 	io.WriteString(h, strconv.Itoa(int(time.Now().UnixNano())))
 	u.Salt = fmt.Sprintf("%x", h.Sum(nil))
 }
+
+// HashPassword returns the stored form of pass for a user with the given
+// salt.
+func HashPassword(pass, salt string) string {
+	h := sha1.New()
+	io.WriteString(h, salt)
+	io.WriteString(h, pass)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -15,6 +15,7 @@
 package users
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -94,3 +95,63 @@ func TestCardsMasked(t *testing.T) {
 		})
 	})
 }
+
+func TestUserDefaultAddressLinks(t *testing.T) {
+
+	Convey("Given a user with default addresses", t, func() {
+		b := LinkBase{Host: "example.com"}
+		u := New()
+		u.UserID = "test"
+		u.DefaultShipping = "ship"
+		u.DefaultBilling = "bill"
+
+		Convey("When adding links", func() {
+			u.AddLinks(b)
+
+			Convey("Then the defaults should link to their addresses", func() {
+				So(u.Links["defaultShipping"], ShouldResemble, Href{"http://example.com/addresses/ship"})
+				So(u.Links["defaultBilling"], ShouldResemble, Href{"http://example.com/addresses/bill"})
+				So(u.Links["self"], ShouldResemble, Href{"http://example.com/customers/test"})
+			})
+		})
+	})
+}
+
+func TestUserEmbed(t *testing.T) {
+
+	Convey("Given a user with an address and no cards", t, func() {
+		u := New()
+		u.UserID = "test"
+		u.Addresses = []Address{{ID: "a1", City: "Denver"}}
+		u.Cards = nil
+
+		Convey("When embedding both", func() {
+			u.Embed(Embeddable)
+			b, err := json.Marshal(u)
+			So(err, ShouldBeNil)
+			var got struct {
+				Embedded struct {
+					Addresses []Address `json:"addresses"`
+					Cards     []Card    `json:"cards"`
+				} `json:"_embedded"`
+			}
+			So(json.Unmarshal(b, &got), ShouldBeNil)
+
+			Convey("Then both should be embedded, the cards as an empty list", func() {
+				So(got.Embedded.Addresses, ShouldHaveLength, 1)
+				So(got.Embedded.Addresses[0].City, ShouldEqual, "Denver")
+				So(got.Embedded.Cards, ShouldNotBeNil)
+				So(string(b), ShouldContainSubstring, `"cards":[]`)
+			})
+		})
+
+		Convey("When embedding nothing", func() {
+			u.Embed(nil)
+			b, _ := json.Marshal(u)
+
+			Convey("Then there should be no _embedded", func() {
+				So(string(b), ShouldNotContainSubstring, "_embedded")
+			})
+		})
+	})
+}